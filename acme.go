@@ -0,0 +1,116 @@
+package serverconfig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const acmeStagingDirURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+var acmeCAs = map[string]struct {
+	dirURL      string
+	requiresEAB bool
+}{
+	"letsencrypt": {dirURL: "https://acme-v02.api.letsencrypt.org/directory"},
+	"zerossl":     {dirURL: "https://acme.zerossl.com/v2/DV90", requiresEAB: true},
+	"buypass":     {dirURL: "https://api.buypass.com/acme/directory"},
+	"google":      {dirURL: "https://dv.acme-v02.api.pki.goog/directory", requiresEAB: true},
+}
+
+// Verify resolves CA to its directory URL and checks the External Account Binding settings, which are
+// required by zerossl and google.  EABHMACKey is the base64url encoded key as issued by the CA.  Staging is
+// only allowed with Let's Encrypt.
+func (cfg *HTTPACMEConfig) Verify() error {
+	var (
+		ca  string
+		ok  bool
+		err error
+	)
+
+	cfg.eabKey = nil
+	cfg.manager = nil
+	cfg.CA = strings.ToLower(strings.TrimSpace(cfg.CA))
+	if cfg.Staging {
+		if (len(cfg.CA) > 0 && cfg.CA != "letsencrypt") || (len(cfg.CADirURL) > 0 && cfg.CADirURL != acmeStagingDirURL) {
+			return fmt.Errorf("ACME staging is only available with the letsencrypt ca")
+		}
+		cfg.CA = ""
+		cfg.CADirURL = acmeStagingDirURL
+	}
+	if cfg.RenewBefore < 0 {
+		return fmt.Errorf("ACME renewbefore cannot be negative")
+	}
+	if cfg.RenewBefore > 60*24*time.Hour {
+		warnf("ACME renewbefore of %s is more than 60 days; certificates may be renewed on every check", cfg.RenewBefore)
+	}
+	if len(cfg.CA) > 0 {
+		_, ok = acmeCAs[cfg.CA]
+		if !ok {
+			return fmt.Errorf("unknown ACME ca %q (expected letsencrypt, zerossl, buypass, or google)", cfg.CA)
+		}
+		if len(cfg.CADirURL) > 0 && cfg.CADirURL != acmeCAs[cfg.CA].dirURL {
+			return fmt.Errorf("ACME ca %q conflicts with cadirurl %s", cfg.CA, cfg.CADirURL)
+		}
+		cfg.CADirURL = acmeCAs[cfg.CA].dirURL
+	} else if len(cfg.CADirURL) > 0 {
+		_, err = validateURL(cfg.CADirURL, "https")
+		if err != nil {
+			return fmt.Errorf("invalid ACME cadirurl: %w", err)
+		}
+		for ca = range acmeCAs {
+			if acmeCAs[ca].dirURL == cfg.CADirURL {
+				cfg.CA = ca
+			}
+		}
+	}
+
+	if (len(cfg.EABKeyID) == 0) != (len(cfg.EABHMACKey) == 0) {
+		return fmt.Errorf("ACME external account binding requires both eabkeyid and eabhmackey (or ACMEEABKEYID and ACMEEABHMACKEY environment variables)")
+	}
+	if len(cfg.EABHMACKey) > 0 {
+		cfg.eabKey, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.EABHMACKey, "="))
+		if err != nil {
+			return fmt.Errorf("ACME eabhmackey must be base64url encoded: %w", err)
+		}
+	} else if len(cfg.CA) > 0 && acmeCAs[cfg.CA].requiresEAB {
+		return fmt.Errorf("ACME ca %s requires external account binding (eabkeyid and eabhmackey, or ACMEEABKEYID and ACMEEABHMACKEY environment variables)", cfg.CA)
+	}
+	return nil
+}
+
+// Manager returns the autocert.Manager for the ACME settings.  Certificates are cached in DiskCache, requested
+// with Email as the contact, and only issued for the ExternalHostName entries of the enclosing HTTPConfig.  A
+// non-empty CADirURL selects a CA other than Let's Encrypt.  The same Manager is returned on every call after
+// Verify, so GetCertificate and HTTPHandler share challenge state.
+func (cfg *HTTPACMEConfig) Manager() *autocert.Manager {
+	if cfg.manager != nil {
+		return cfg.manager
+	}
+
+	cfg.manager = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cfg.DiskCache),
+		HostPolicy:  autocert.HostWhitelist(cfg.hosts...),
+		Email:       cfg.Email,
+		RenewBefore: cfg.RenewBefore,
+	}
+	if len(cfg.CADirURL) > 0 {
+		cfg.manager.Client = &acme.Client{DirectoryURL: cfg.CADirURL}
+	}
+	if len(cfg.eabKey) > 0 {
+		cfg.manager.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: cfg.EABKeyID, Key: cfg.eabKey}
+	}
+	return cfg.manager
+}
+
+// HTTPHandler returns the handler for the plaintext listener, which answers ACME HTTP-01 challenges and
+// passes all other requests to fallback.  If fallback is nil other requests are redirected to HTTPS.
+func (cfg *HTTPACMEConfig) HTTPHandler(fallback http.Handler) http.Handler {
+	return cfg.Manager().HTTPHandler(fallback)
+}
@@ -0,0 +1,473 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+	"github.com/go-acme/lego/v4/providers/dns/gcloud"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+	"github.com/go-acme/lego/v4/providers/dns/route53"
+	"github.com/go-acme/lego/v4/registration"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// HTTPACMEDNSConfig selects a DNS provider for the ACME dns-01 challenge, which is required for wildcard
+// certificates.  Provider is one of route53, cloudflare, gcloud, or rfc2136 and only the fields for that
+// provider are used.  Credentials are normally supplied through the environment.  With a dns section, the
+// wildcard names among ExternalHostName and the virtual hosts without a static certificate are issued
+// through lego, while other names still use autocert:
+//
+//	http:
+//	  externalhostname: [www.example.com, "*.example.com"]
+//	  acme:
+//	    email: admin@example.com
+//	    diskcache: /var/cache/acme
+//	    dns:
+//	      provider: cloudflare
+type HTTPACMEDNSConfig struct {
+	Provider string `yaml:"provider" env:"ACMEDNSPROVIDER"`
+
+	// route53
+	AccessKeyID     string `yaml:"accesskeyid" env:"AWS_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretaccesskey" env:"AWS_SECRET_ACCESS_KEY"`
+	Region          string `yaml:"region" env:"AWS_REGION"`
+	HostedZoneID    string `yaml:"hostedzoneid" env:"AWS_HOSTED_ZONE_ID"`
+
+	// cloudflare
+	APIToken string `yaml:"apitoken" env:"CF_DNS_API_TOKEN"`
+
+	// gcloud
+	Project            string `yaml:"project" env:"GCE_PROJECT"`
+	ServiceAccountFile string `yaml:"serviceaccountfile" env:"GCE_SERVICE_ACCOUNT_FILE"`
+
+	// rfc2136
+	Nameserver    string `yaml:"nameserver" env:"RFC2136_NAMESERVER"`
+	TSIGKey       string `yaml:"tsigkey" env:"RFC2136_TSIG_KEY"`
+	TSIGSecret    string `yaml:"tsigsecret" env:"RFC2136_TSIG_SECRET"`
+	TSIGAlgorithm string `yaml:"tsigalgorithm"`
+}
+
+// Verify checks that the fields required by the selected provider are present.  For route53 the credentials
+// may be left out when the host has an instance role.  TSIGAlgorithm defaults to hmac-sha256.
+func (cfg *HTTPACMEDNSConfig) Verify() error {
+	var (
+		info os.FileInfo
+		err  error
+	)
+
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	switch cfg.Provider {
+	case "route53":
+		if (len(cfg.AccessKeyID) == 0) != (len(cfg.SecretAccessKey) == 0) {
+			return fmt.Errorf("ACME route53 requires both accesskeyid and secretaccesskey (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables)")
+		}
+	case "cloudflare":
+		if len(cfg.APIToken) == 0 {
+			return fmt.Errorf("missing ACME cloudflare apitoken (or CF_DNS_API_TOKEN environment variable)")
+		}
+	case "gcloud":
+		if len(cfg.Project) == 0 {
+			return fmt.Errorf("missing ACME gcloud project (or GCE_PROJECT environment variable)")
+		}
+		if len(cfg.ServiceAccountFile) > 0 {
+			info, err = os.Stat(cfg.ServiceAccountFile)
+			if err != nil {
+				return fmt.Errorf("ACME gcloud serviceaccountfile: %w", err)
+			}
+			if info.IsDir() {
+				return fmt.Errorf("ACME gcloud serviceaccountfile %s is a directory", cfg.ServiceAccountFile)
+			}
+		}
+	case "rfc2136":
+		if len(cfg.Nameserver) == 0 {
+			return fmt.Errorf("missing ACME rfc2136 nameserver (or RFC2136_NAMESERVER environment variable)")
+		}
+		if !strings.Contains(cfg.Nameserver, ":") {
+			cfg.Nameserver = net.JoinHostPort(cfg.Nameserver, "53")
+		}
+		err = validateHostPort(cfg.Nameserver)
+		if err != nil {
+			return fmt.Errorf("invalid ACME rfc2136 nameserver: %w", err)
+		}
+		if (len(cfg.TSIGKey) == 0) != (len(cfg.TSIGSecret) == 0) {
+			return fmt.Errorf("ACME rfc2136 requires both tsigkey and tsigsecret (or RFC2136_TSIG_KEY and RFC2136_TSIG_SECRET environment variables)")
+		}
+		if len(cfg.TSIGAlgorithm) == 0 {
+			cfg.TSIGAlgorithm = "hmac-sha256"
+		}
+		cfg.TSIGAlgorithm = strings.TrimSuffix(strings.ToLower(cfg.TSIGAlgorithm), ".")
+		if !containsString([]string{"hmac-md5", "hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512"}, cfg.TSIGAlgorithm) {
+			return fmt.Errorf("invalid ACME rfc2136 tsigalgorithm %q", cfg.TSIGAlgorithm)
+		}
+	case "":
+		return fmt.Errorf("missing ACME dns provider (or ACMEDNSPROVIDER environment variable)")
+	default:
+		return fmt.Errorf("unsupported ACME dns provider %q (expected route53, cloudflare, gcloud, or rfc2136)", cfg.Provider)
+	}
+	return nil
+}
+
+// newProvider returns the lego challenge provider for the selected provider.
+func (cfg *HTTPACMEDNSConfig) newProvider() (challenge.Provider, error) {
+	var (
+		r53 *route53.Config
+		cf  *cloudflare.Config
+		rfc *rfc2136.Config
+	)
+
+	switch cfg.Provider {
+	case "route53":
+		r53 = route53.NewDefaultConfig()
+		r53.AccessKeyID = cfg.AccessKeyID
+		r53.SecretAccessKey = cfg.SecretAccessKey
+		r53.HostedZoneID = cfg.HostedZoneID
+		if len(cfg.Region) > 0 {
+			r53.Region = cfg.Region
+		}
+		return route53.NewDNSProviderConfig(r53)
+	case "cloudflare":
+		cf = cloudflare.NewDefaultConfig()
+		cf.AuthToken = cfg.APIToken
+		return cloudflare.NewDNSProviderConfig(cf)
+	case "gcloud":
+		if len(cfg.ServiceAccountFile) > 0 {
+			return gcloud.NewDNSProviderServiceAccount(cfg.ServiceAccountFile)
+		}
+		return gcloud.NewDNSProviderCredentials(cfg.Project)
+	case "rfc2136":
+		rfc = rfc2136.NewDefaultConfig()
+		rfc.Nameserver = cfg.Nameserver
+		rfc.TSIGKey = cfg.TSIGKey
+		rfc.TSIGSecret = cfg.TSIGSecret
+		rfc.TSIGAlgorithm = cfg.TSIGAlgorithm + "."
+		return rfc2136.NewDNSProviderConfig(rfc)
+	}
+	return nil, fmt.Errorf("unsupported ACME dns provider %q", cfg.Provider)
+}
+
+const (
+	dnsIssuerCheckInterval = 12 * time.Hour
+	dnsIssuerRetryInterval = 10 * time.Minute
+	dnsIssuerAccountKey    = "acme_dns01_account+key"
+)
+
+// dnsIssuer obtains and renews the certificates for wildcard host names through the dns-01 challenge.  Each
+// name gets its own certificate, kept in the ACME DiskCache beside those of autocert.
+type dnsIssuer struct {
+	cfg    *HTTPACMEConfig
+	cache  autocert.DirCache
+	mu     sync.RWMutex
+	certs  map[string]*tls.Certificate
+	client *lego.Client
+}
+
+// dnsIssuerUser is the ACME account lego registers with.
+type dnsIssuerUser struct {
+	email        string
+	key          crypto.PrivateKey
+	registration *registration.Resource
+}
+
+func (u *dnsIssuerUser) GetEmail() string                        { return u.email }
+func (u *dnsIssuerUser) GetRegistration() *registration.Resource { return u.registration }
+func (u *dnsIssuerUser) GetPrivateKey() crypto.PrivateKey        { return u.key }
+
+// newDNSIssuer returns the dns-01 issuer for the wildcard host names, or nil when there are none.
+func (cfg *HTTPACMEConfig) newDNSIssuer() *dnsIssuer {
+	if cfg.DNS == nil || len(cfg.dnsHosts) == 0 {
+		return nil
+	}
+	return &dnsIssuer{cfg: cfg, cache: autocert.DirCache(cfg.DiskCache), certs: make(map[string]*tls.Certificate)}
+}
+
+// load serves the certificates already in the cache, so that they are available before run has checked them.
+func (d *dnsIssuer) load(ctx context.Context) error {
+	var (
+		cert *tls.Certificate
+		err  error
+		i    int
+	)
+
+	for i = 0; i < len(d.cfg.dnsHosts); i++ {
+		cert, err = d.cached(ctx, d.cfg.dnsHosts[i])
+		if err != nil {
+			return err
+		}
+		if cert != nil {
+			d.certs[d.cfg.dnsHosts[i]] = cert
+		}
+	}
+	return nil
+}
+
+// run obtains the certificates that are missing or due for renewal, checking again every 12 hours, until ctx
+// is cancelled.
+func (d *dnsIssuer) run(ctx context.Context) {
+	var (
+		wait  time.Duration
+		timer *time.Timer
+		err   error
+	)
+
+	for {
+		wait = dnsIssuerCheckInterval
+		err = d.renew(ctx)
+		if err != nil {
+			warnf("ACME dns-01 certificate renewal failed: %v", err)
+			wait = dnsIssuerRetryInterval
+		}
+		timer = time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// renew obtains a certificate for every host name whose cached certificate is missing or expires within
+// RenewBefore.
+func (d *dnsIssuer) renew(ctx context.Context) error {
+	var (
+		cert *tls.Certificate
+		errs []error
+		err  error
+		i    int
+	)
+
+	for i = 0; i < len(d.cfg.dnsHosts); i++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		cert, err = d.cached(ctx, d.cfg.dnsHosts[i])
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if cert == nil || time.Until(cert.Leaf.NotAfter) < d.renewBefore() {
+			cert, err = d.obtain(ctx, d.cfg.dnsHosts[i])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", d.cfg.dnsHosts[i], err))
+			}
+		}
+		if cert != nil {
+			d.mu.Lock()
+			d.certs[d.cfg.dnsHosts[i]] = cert
+			d.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *dnsIssuer) renewBefore() time.Duration {
+	if d.cfg.RenewBefore > 0 {
+		return d.cfg.RenewBefore
+	}
+	return 30 * 24 * time.Hour
+}
+
+// cached returns the certificate for name from the cache, or nil if there is none.
+func (d *dnsIssuer) cached(ctx context.Context, name string) (*tls.Certificate, error) {
+	var (
+		data []byte
+		cert tls.Certificate
+		err  error
+	)
+
+	data, err = d.cache.Get(ctx, dnsIssuerCacheKey(name))
+	if errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cert, err = tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cached certificate for %s: %w", name, err)
+	}
+	return &cert, nil
+}
+
+// obtain requests a certificate for name from the CA and caches it.
+func (d *dnsIssuer) obtain(ctx context.Context, name string) (*tls.Certificate, error) {
+	var (
+		res  *certificate.Resource
+		data []byte
+		cert tls.Certificate
+		err  error
+	)
+
+	if d.client == nil {
+		d.client, err = d.newClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res, err = d.client.Certificate.Obtain(certificate.ObtainRequest{Domains: []string{name}, Bundle: true})
+	if err != nil {
+		return nil, err
+	}
+	data = append(append(data, res.PrivateKey...), res.Certificate...)
+	cert, err = tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from the CA: %w", err)
+	}
+	err = d.cache.Put(ctx, dnsIssuerCacheKey(name), data)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// newClient registers the ACME account, using the key in the cache or a new one, and returns a lego client
+// answering the dns-01 challenge through the provider.
+func (d *dnsIssuer) newClient(ctx context.Context) (*lego.Client, error) {
+	var (
+		user     *dnsIssuerUser
+		config   *lego.Config
+		client   *lego.Client
+		provider challenge.Provider
+		err      error
+	)
+
+	user = &dnsIssuerUser{email: d.cfg.Email}
+	user.key, err = d.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config = lego.NewConfig(user)
+	config.Certificate.KeyType = certcrypto.EC256
+	if len(d.cfg.CADirURL) > 0 {
+		config.CADirURL = d.cfg.CADirURL
+	}
+	client, err = lego.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	provider, err = d.cfg.DNS.newProvider()
+	if err != nil {
+		return nil, fmt.Errorf("ACME dns provider %s: %w", d.cfg.DNS.Provider, err)
+	}
+	err = client.Challenge.SetDNS01Provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.cfg.EABKeyID) > 0 {
+		user.registration, err = client.Registration.RegisterWithExternalAccountBinding(registration.RegisterEABOptions{
+			TermsOfServiceAgreed: true,
+			Kid:                  d.cfg.EABKeyID,
+			HmacEncoded:          d.cfg.EABHMACKey,
+		})
+	} else {
+		user.registration, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ACME account registration: %w", err)
+	}
+	return client, nil
+}
+
+// accountKey returns the ACME account key from the cache, generating and caching one if there is none.
+func (d *dnsIssuer) accountKey(ctx context.Context) (crypto.PrivateKey, error) {
+	var (
+		data  []byte
+		block *pem.Block
+		key   *ecdsa.PrivateKey
+		der   []byte
+		err   error
+	)
+
+	data, err = d.cache.Get(ctx, dnsIssuerAccountKey)
+	if err == nil {
+		block, _ = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid cached ACME account key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, err
+	}
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err = x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = d.cache.Put(ctx, dnsIssuerAccountKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetCertificate returns the certificate for the wildcard name covering the requested server name.  The
+// handshake fails until the certificate has been obtained.
+func (d *dnsIssuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var (
+		name string
+		cert *tls.Certificate
+	)
+
+	name = d.hostFor(hello.ServerName)
+	d.mu.RLock()
+	cert = d.certs[name]
+	d.mu.RUnlock()
+	if cert == nil {
+		return nil, fmt.Errorf("no ACME dns-01 certificate for %s yet", hello.ServerName)
+	}
+	return cert, nil
+}
+
+// hostFor returns the wildcard name covering host, or "" when there is none.
+func (d *dnsIssuer) hostFor(host string) string {
+	var i int
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for i = 0; i < len(d.cfg.dnsHosts); i++ {
+		if hostNameMatches(d.cfg.dnsHosts[i], host) {
+			return d.cfg.dnsHosts[i]
+		}
+	}
+	return ""
+}
+
+// dnsIssuerCertificates answers connections for the wildcard names from the issuer and passes the others to
+// getCertificate, or to the certificates in the tls.Config when getCertificate is nil.
+func dnsIssuerCertificates(issuer *dnsIssuer, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(issuer.hostFor(hello.ServerName)) > 0 {
+			return issuer.GetCertificate(hello)
+		}
+		if getCertificate != nil {
+			return getCertificate(hello)
+		}
+		return nil, nil
+	}
+}
+
+// dnsIssuerCacheKey is the cache key for the certificate of name, without the "*" Windows does not allow in
+// file names.
+func dnsIssuerCacheKey(name string) string {
+	return "dns01+" + strings.ReplaceAll(name, "*", "_")
+}
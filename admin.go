@@ -0,0 +1,255 @@
+package serverconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// adminEndpoints are the endpoints that can be named in AdminConfig.Endpoints.
+var adminEndpoints = []string{"config", "reload", "health"}
+
+// AdminConfig describes the admin interface, served by Handler on a dedicated listener at BindAddr, which
+// defaults to localhost:9090, under PathPrefix, which defaults to /admin.  Endpoints selects from config,
+// the configuration with secrets redacted (GET); reload, which reloads the configuration (POST), usually
+// with a ConfigReloader; and health, the readiness checks; all three by default.
+//
+// AllowedCIDRs, if given, limits the interface to clients in those ranges.  Auth is none, basic, or oidc.
+// With basic the User and Password are required.  With oidc the OIDC section named by OIDCSection, by yaml
+// key and defaulting to oidc, must be present, and the application supplies the middleware that
+// authenticates against it in AdminHandlers.
+//
+//	admin:
+//	  enabled: true
+//	  bindaddr: 10.0.0.5:9090
+//	  allowedcidrs: [10.0.0.0/8]
+//	  auth: basic
+//	  endpoints: [config, health]
+type AdminConfig struct {
+	Enabled      bool     `yaml:"enabled" env:"ADMINENABLED"`
+	BindAddr     string   `yaml:"bindaddr" env:"ADMINBINDADDR"`
+	PathPrefix   string   `yaml:"pathprefix"`
+	AllowedCIDRs []string `yaml:"allowedcidrs"`
+	Auth         string   `yaml:"auth"`
+	User         string   `yaml:"user" env:"ADMINUSER"`
+	Password     string   `yaml:"password" env:"ADMINPASS"`
+	OIDCSection  string   `yaml:"oidcsection"`
+	Endpoints    []string `yaml:"endpoints"`
+	allowed      []*net.IPNet
+}
+
+// AdminHandlers supplies what the admin endpoints act on.  Config is dumped through Redact by the config
+// endpoint; given a ConfigReloader, its current configuration is dumped.  Reload is called by the reload
+// endpoint, which reports the errors it returns as JSON, and the readiness checks of Health are run by the
+// health endpoint, which reports ok when Health is nil.  Authenticate wraps the endpoints when Auth is
+// oidc.
+type AdminHandlers struct {
+	Config       any
+	Reload       func(ctx context.Context) error
+	Health       *Health
+	Authenticate func(next http.Handler) http.Handler
+}
+
+// Verify applies the defaults and checks the bind address, CIDRs, auth settings, and endpoint names.
+// Nothing is checked when the interface is not enabled.
+func (cfg *AdminConfig) Verify() error {
+	var (
+		s     string
+		ip    net.IP
+		ipnet *net.IPNet
+		host  string
+		err   error
+		i     int
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.BindAddr) == 0 {
+		cfg.BindAddr = "localhost:9090"
+	}
+	err = validateHostPort(cfg.BindAddr)
+	if err != nil {
+		return fmt.Errorf("invalid admin bindaddr: %w", err)
+	}
+	if len(cfg.PathPrefix) == 0 {
+		cfg.PathPrefix = "/admin"
+	}
+	cfg.PathPrefix = strings.TrimSuffix(cfg.PathPrefix, "/")
+	if !strings.HasPrefix(cfg.PathPrefix, "/") {
+		return fmt.Errorf("admin pathprefix must begin with '/': %q", cfg.PathPrefix)
+	}
+
+	cfg.allowed = nil
+	for i = 0; i < len(cfg.AllowedCIDRs); i++ {
+		s = strings.TrimSpace(cfg.AllowedCIDRs[i])
+		if !strings.Contains(s, "/") {
+			ip = net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid admin allowedcidrs entry %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, ipnet, err = net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid admin allowedcidrs entry: %w", err)
+		}
+		cfg.allowed = append(cfg.allowed, ipnet)
+	}
+
+	cfg.Auth = strings.ToLower(strings.TrimSpace(cfg.Auth))
+	if len(cfg.Auth) == 0 {
+		cfg.Auth = "none"
+		if len(cfg.User) > 0 {
+			cfg.Auth = "basic"
+		}
+	}
+	switch cfg.Auth {
+	case "none":
+		host, _, _ = net.SplitHostPort(cfg.BindAddr)
+		ip = net.ParseIP(host)
+		if len(cfg.allowed) == 0 && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			warnf("admin interface bound to %s without auth or allowedcidrs", cfg.BindAddr)
+		}
+	case "basic":
+		if len(cfg.User) == 0 || len(cfg.Password) == 0 {
+			return fmt.Errorf("admin basic auth requires both user and password (or ADMINUSER and ADMINPASS environment variables)")
+		}
+	case "oidc":
+		if len(cfg.OIDCSection) == 0 {
+			cfg.OIDCSection = "oidc"
+		}
+	default:
+		return fmt.Errorf("invalid admin auth %q (expected none, basic, or oidc)", cfg.Auth)
+	}
+
+	if len(cfg.Endpoints) == 0 {
+		cfg.Endpoints = append([]string(nil), adminEndpoints...)
+	}
+	for i = 0; i < len(cfg.Endpoints); i++ {
+		cfg.Endpoints[i] = strings.ToLower(strings.TrimSpace(cfg.Endpoints[i]))
+		if !containsString(adminEndpoints, cfg.Endpoints[i]) {
+			return fmt.Errorf("invalid admin endpoints entry %q (expected one of %s)", cfg.Endpoints[i], strings.Join(adminEndpoints, ", "))
+		}
+	}
+	return nil
+}
+
+// PostVerify checks that OIDCSection names an OIDC section when Auth is oidc.
+func (cfg *AdminConfig) PostVerify(root any) error {
+	var (
+		section any
+		found   bool
+	)
+
+	if !cfg.Enabled || cfg.Auth != "oidc" {
+		return nil
+	}
+	section, found = findSection(root, cfg.OIDCSection)
+	if !found {
+		return fmt.Errorf("admin oidcsection %q was not found in the configuration", cfg.OIDCSection)
+	}
+	_, found = section.(*OIDCConfig)
+	if !found {
+		return fmt.Errorf("admin oidcsection %q is not an OIDC section", cfg.OIDCSection)
+	}
+	return nil
+}
+
+// Handler returns the handler for the admin listener.  If the interface isn't enabled the handler responds
+// with 404 to everything.
+//
+//	admin, err := gc.Admin.Handler(serverconfig.AdminHandlers{Config: &gc, Reload: reload, Health: health})
+//	go http.ListenAndServe(gc.Admin.BindAddr, admin)
+func (cfg *AdminConfig) Handler(h AdminHandlers) (http.Handler, error) {
+	var (
+		mux     *http.ServeMux
+		handler http.Handler
+		i       int
+	)
+
+	if !cfg.Enabled {
+		return http.NotFoundHandler(), nil
+	}
+
+	mux = http.NewServeMux()
+	for i = 0; i < len(cfg.Endpoints); i++ {
+		switch cfg.Endpoints[i] {
+		case "config":
+			if h.Config == nil {
+				return nil, fmt.Errorf("admin config endpoint requires AdminHandlers.Config")
+			}
+			mux.HandleFunc("GET "+cfg.PathPrefix+"/config", func(w http.ResponseWriter, r *http.Request) {
+				writeAdminJSON(w, http.StatusOK, Redact(resolveConfig(h.Config)))
+			})
+		case "reload":
+			if h.Reload == nil {
+				return nil, fmt.Errorf("admin reload endpoint requires AdminHandlers.Reload")
+			}
+			mux.Handle(cfg.PathPrefix+"/reload", reloadHandler(h.Reload))
+		case "health":
+			mux.HandleFunc("GET "+cfg.PathPrefix+"/health", func(w http.ResponseWriter, r *http.Request) {
+				if h.Health == nil {
+					writeAdminJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+					return
+				}
+				h.Health.serve(w, r, h.Health.readiness, true)
+			})
+		}
+	}
+
+	handler = mux
+	switch cfg.Auth {
+	case "basic":
+		handler = basicAuthHandler(cfg.User, cfg.Password, "admin", handler)
+	case "oidc":
+		if h.Authenticate == nil {
+			return nil, fmt.Errorf("admin oidc auth requires AdminHandlers.Authenticate")
+		}
+		handler = h.Authenticate(handler)
+	}
+	if len(cfg.allowed) > 0 {
+		handler = cfg.allowedHandler(handler)
+	}
+	return handler, nil
+}
+
+// allowedHandler rejects requests from peers outside AllowedCIDRs with 403.  The admin listener is not
+// expected to sit behind a proxy, so only the peer address is considered.
+func (cfg *AdminConfig) allowedHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			host string
+			ip   net.IP
+			err  error
+			i    int
+		)
+
+		host, _, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip = net.ParseIP(host)
+		for i = 0; ip != nil && i < len(cfg.allowed); i++ {
+			if cfg.allowed[i].Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,102 @@
+package serverconfig
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	pagerDutyKeyRE = regexp.MustCompile(`^[0-9a-zA-Z]{32}$`)
+	opsgenieKeyRE  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	alertingSeverities = map[string][]string{
+		"pagerduty": {"critical", "error", "warning", "info"},
+		"opsgenie":  {"P1", "P2", "P3", "P4", "P5"},
+	}
+)
+
+// AlertingConfig configures on-call escalation through PagerDuty (Events API v2) or Opsgenie.  Key is the
+// PagerDuty integration/routing key or the Opsgenie API key.  SeverityMap translates the application's
+// severity names into the provider's: critical/error/warning/info for PagerDuty or P1-P5 for Opsgenie.
+//
+//	alerting:
+//	  provider: pagerduty
+//	  severitymap:
+//	    LOG_CRIT: critical
+//	    LOG_ERR: error
+type AlertingConfig struct {
+	Provider    string            `yaml:"provider"`
+	Key         string            `yaml:"key" env:"ALERTINGKEY"`
+	Region      string            `yaml:"region"`
+	SeverityMap map[string]string `yaml:"severitymap"`
+}
+
+// Verify checks the provider, the form of the key, and that every SeverityMap value is valid for the
+// provider.  Region applies to Opsgenie only and is "us" (the default) or "eu".
+func (cfg *AlertingConfig) Verify() error {
+	var (
+		valid []string
+		found bool
+		k     string
+		keys  []string
+	)
+
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	valid, found = alertingSeverities[cfg.Provider]
+	if !found {
+		return fmt.Errorf("invalid alerting provider %q (expected pagerduty or opsgenie)", cfg.Provider)
+	}
+
+	if len(cfg.Key) == 0 {
+		return fmt.Errorf("missing alerting key (or ALERTINGKEY environment variable)")
+	}
+	switch cfg.Provider {
+	case "pagerduty":
+		if !pagerDutyKeyRE.MatchString(cfg.Key) {
+			return fmt.Errorf("invalid pagerduty integration key (expected 32 alphanumeric characters)")
+		}
+		if len(cfg.Region) > 0 {
+			return fmt.Errorf("alerting region only applies to opsgenie")
+		}
+	case "opsgenie":
+		if !opsgenieKeyRE.MatchString(cfg.Key) {
+			return fmt.Errorf("invalid opsgenie api key (expected a UUID)")
+		}
+		cfg.Region = strings.ToLower(cfg.Region)
+		if len(cfg.Region) == 0 {
+			cfg.Region = "us"
+		}
+		if cfg.Region != "us" && cfg.Region != "eu" {
+			return fmt.Errorf("invalid opsgenie region %q (expected us or eu)", cfg.Region)
+		}
+	}
+
+	for k = range cfg.SeverityMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k = range keys {
+		if !containsString(valid, cfg.SeverityMap[k]) {
+			return fmt.Errorf("invalid %s severity %q for %q (expected one of %s)",
+				cfg.Provider, cfg.SeverityMap[k], k, strings.Join(valid, ", "))
+		}
+	}
+	return nil
+}
+
+// Severity returns the provider severity mapped from the application severity name, or fallback if it
+// isn't mapped.
+func (cfg AlertingConfig) Severity(name, fallback string) string {
+	var (
+		s     string
+		found bool
+	)
+
+	s, found = cfg.SeverityMap[name]
+	if !found {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,189 @@
+package serverconfig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIAuthConfig configures static API key authentication for service-to-service calls.  Keys are never
+// stored in clear: each is given as "sha256:<hex>" or "sha512:<hex>" of the key, either inline in Keys or in
+// KeysFile with one "name hash" pair per line (blank lines and # comments are ignored).  RateLimit is the
+// default allowed requests per minute for each key, which a key may override; zero means unlimited.
+//
+//	apiauth:
+//	  headername: X-API-Key
+//	  ratelimit: 600
+//	  keys:
+//	    - name: billing
+//	      hash: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+type APIAuthConfig struct {
+	Keys       []APIKey `yaml:"keys"`
+	KeysFile   string   `yaml:"keysfile" env:"APIKEYSFILE"`
+	HeaderName string   `yaml:"headername"`
+	RateLimit  int      `yaml:"ratelimit"`
+}
+
+// APIKey is one hashed API key.
+type APIKey struct {
+	Name      string `yaml:"name"`
+	Hash      string `yaml:"hash"`
+	RateLimit int    `yaml:"ratelimit"`
+	digest    []byte
+	algorithm string
+	fromFile  bool
+}
+
+// Verify loads KeysFile, if given, appending its keys to Keys, and checks every hash is well formed and
+// every name unique.  HeaderName defaults to X-API-Key.
+func (cfg *APIAuthConfig) Verify() error {
+	var (
+		data    []byte
+		scanner *bufio.Scanner
+		line    string
+		fields  []string
+		lineNo  int
+		names   map[string]bool
+		keys    []APIKey
+		err     error
+		i       int
+	)
+
+	// drop keys loaded from the file by an earlier Verify so that it can be called again
+	for i = 0; i < len(cfg.Keys); i++ {
+		if !cfg.Keys[i].fromFile {
+			keys = append(keys, cfg.Keys[i])
+		}
+	}
+	cfg.Keys = keys
+
+	if len(cfg.KeysFile) > 0 {
+		data, err = os.ReadFile(cfg.KeysFile)
+		if err != nil {
+			return fmt.Errorf("unable to read API keysfile: %w", err)
+		}
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			lineNo++
+			line = strings.TrimSpace(scanner.Text())
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields = strings.Fields(line)
+			if len(fields) != 2 {
+				return fmt.Errorf("API keysfile %s line %d: expected \"name hash\"", cfg.KeysFile, lineNo)
+			}
+			cfg.Keys = append(cfg.Keys, APIKey{Name: fields[0], Hash: fields[1], fromFile: true})
+		}
+	}
+
+	if len(cfg.Keys) == 0 {
+		return fmt.Errorf("API auth requires at least one key in keys or keysfile")
+	}
+	names = make(map[string]bool)
+	for i = 0; i < len(cfg.Keys); i++ {
+		if len(cfg.Keys[i].Name) == 0 {
+			return fmt.Errorf("API key %d is missing a name", i)
+		}
+		if names[cfg.Keys[i].Name] {
+			return fmt.Errorf("duplicate API key name %q", cfg.Keys[i].Name)
+		}
+		names[cfg.Keys[i].Name] = true
+		err = cfg.Keys[i].parseHash()
+		if err != nil {
+			return fmt.Errorf("API key %q: %w", cfg.Keys[i].Name, err)
+		}
+		if cfg.Keys[i].RateLimit < 0 {
+			return fmt.Errorf("API key %q: ratelimit cannot be negative", cfg.Keys[i].Name)
+		}
+		if cfg.Keys[i].RateLimit == 0 {
+			cfg.Keys[i].RateLimit = cfg.RateLimit
+		}
+	}
+
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("API auth ratelimit cannot be negative")
+	}
+	if len(cfg.HeaderName) == 0 {
+		cfg.HeaderName = "X-API-Key"
+	}
+	return nil
+}
+
+// Authenticate returns the configured key matching the presented key.  Every configured key is compared in
+// constant time.
+func (cfg *APIAuthConfig) Authenticate(presented string) (*APIKey, bool) {
+	var (
+		sum256 [sha256.Size]byte
+		sum512 [sha512.Size]byte
+		match  *APIKey
+		i      int
+	)
+
+	sum256 = sha256.Sum256([]byte(presented))
+	sum512 = sha512.Sum512([]byte(presented))
+	for i = 0; i < len(cfg.Keys); i++ {
+		switch cfg.Keys[i].algorithm {
+		case "sha256":
+			if subtle.ConstantTimeCompare(sum256[:], cfg.Keys[i].digest) == 1 {
+				match = &cfg.Keys[i]
+			}
+		case "sha512":
+			if subtle.ConstantTimeCompare(sum512[:], cfg.Keys[i].digest) == 1 {
+				match = &cfg.Keys[i]
+			}
+		}
+	}
+	return match, match != nil
+}
+
+// Handler wraps next so that requests without a valid key in HeaderName are rejected with 401.
+func (cfg *APIAuthConfig) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+
+		_, ok = cfg.Authenticate(r.Header.Get(cfg.HeaderName))
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (key *APIKey) parseHash() error {
+	var (
+		algorithm string
+		encoded   string
+		found     bool
+		size      int
+		err       error
+	)
+
+	algorithm, encoded, found = strings.Cut(key.Hash, ":")
+	if !found {
+		return fmt.Errorf("hash must be of the form sha256:<hex> or sha512:<hex>")
+	}
+	algorithm = strings.ToLower(algorithm)
+	switch algorithm {
+	case "sha256":
+		size = sha256.Size
+	case "sha512":
+		size = sha512.Size
+	default:
+		return fmt.Errorf("unsupported hash algorithm %q (expected sha256 or sha512)", algorithm)
+	}
+	key.digest, err = hex.DecodeString(encoded)
+	if err != nil || len(key.digest) != size {
+		return fmt.Errorf("%s hash must be %d hex digits", algorithm, size*2)
+	}
+	key.algorithm = algorithm
+	return nil
+}
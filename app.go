@@ -0,0 +1,200 @@
+package serverconfig
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// currentApp is the App section of the configuration read last by Read, returned by CurrentApp.
+var currentApp atomic.Pointer[AppConfig]
+
+// AppConfig describes the running application.  Environment is dev, staging, or prod; the longer forms
+// development, stage, and production are accepted and stored in the short form.  Name defaults to the
+// program name and Environment to dev.  InstanceID defaults to the host name.
+//
+// Once Read succeeds the section is also available from CurrentApp, and is added to loggers made by
+// NewSlogLogger and to the resource attributes from OTelConfig.ExporterEnv.
+//
+//	app:
+//	  name: billing
+//	  environment: prod
+//	  version: 1.8.2
+//	  region: us-west-2
+type AppConfig struct {
+	Name        string `yaml:"name" env:"APPNAME"`
+	Environment string `yaml:"environment" env:"APPENV"`
+	Version     string `yaml:"version" env:"APPVERSION"`
+	InstanceID  string `yaml:"instanceid" env:"INSTANCEID"`
+	Region      string `yaml:"region" env:"REGION"`
+}
+
+// Verify applies the defaults and checks Environment.
+func (cfg *AppConfig) Verify() error {
+	var ok bool
+
+	if len(cfg.Name) == 0 {
+		cfg.Name = filepath.Base(os.Args[0])
+	}
+	if len(strings.TrimSpace(cfg.Environment)) == 0 {
+		cfg.Environment = "dev"
+	}
+	cfg.Environment, ok = normalizeEnvironment(cfg.Environment)
+	if !ok {
+		return fmt.Errorf("invalid app environment %q (expected dev, staging, or prod)", cfg.Environment)
+	}
+	if len(cfg.InstanceID) == 0 {
+		cfg.InstanceID, _ = os.Hostname()
+	}
+	return nil
+}
+
+// CurrentApp returns the App section of the configuration read last by Read, or a zero AppConfig when there
+// is none.  A configuration that fails verification does not change it.
+//
+//	if serverconfig.CurrentApp().IsProduction() {
+//		gin.SetMode(gin.ReleaseMode)
+//	}
+func CurrentApp() AppConfig {
+	var app *AppConfig
+
+	app = currentApp.Load()
+	if app == nil {
+		return AppConfig{}
+	}
+	return *app
+}
+
+// publishApp makes the App section of cfg, if it has one, the one returned by CurrentApp.
+func publishApp(cfg any) {
+	var (
+		app     *AppConfig
+		current AppConfig
+	)
+
+	app = appSection(cfg)
+	if app != nil {
+		current = *app
+		currentApp.Store(&current)
+	}
+}
+
+// rootApp returns the App section of root, for sections whose PostVerify depends on the environment, or
+// the one returned by CurrentApp when root has none.
+func rootApp(root any) AppConfig {
+	var app *AppConfig
+
+	app = appSection(root)
+	if app == nil {
+		return CurrentApp()
+	}
+	return *app
+}
+
+// appSection returns the first AppConfig in root, searching each level of nested structs before the next
+// as findSection does, or nil when there is none.
+func appSection(root any) *AppConfig {
+	var (
+		level []reflect.Value
+		next  []reflect.Value
+		value reflect.Value
+		field reflect.Value
+		i, j  int
+	)
+
+	level = []reflect.Value{reflect.ValueOf(root)}
+	for len(level) > 0 {
+		next = nil
+		for i = 0; i < len(level); i++ {
+			value = level[i]
+			for value.IsValid() && value.Kind() == reflect.Pointer && !value.IsNil() {
+				value = value.Elem()
+			}
+			if !value.IsValid() || value.Kind() != reflect.Struct {
+				continue
+			}
+			for j = 0; j < value.NumField(); j++ {
+				if len(value.Type().Field(j).PkgPath) > 0 {
+					continue
+				}
+				field = value.Field(j)
+				if field.Type() == reflect.TypeOf((*AppConfig)(nil)) && !field.IsNil() {
+					return field.Interface().(*AppConfig)
+				}
+				if field.Type() == reflect.TypeOf(AppConfig{}) && field.CanAddr() {
+					return field.Addr().Interface().(*AppConfig)
+				}
+				next = append(next, field)
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+// normalizeEnvironment returns the short form of an environment name, or false when it is not one of
+// dev, staging, or prod.
+func normalizeEnvironment(name string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "dev", "development":
+		return "dev", true
+	case "staging", "stage":
+		return "staging", true
+	case "prod", "production":
+		return "prod", true
+	default:
+		return name, false
+	}
+}
+
+// IsProduction reports whether Environment is prod.
+func (cfg AppConfig) IsProduction() bool {
+	return cfg.Environment == "prod"
+}
+
+// SlogAttrs returns the non-empty fields as log attributes.
+func (cfg AppConfig) SlogAttrs() []slog.Attr {
+	var attrs []slog.Attr
+
+	if len(cfg.Name) > 0 {
+		attrs = append(attrs, slog.String("app", cfg.Name))
+	}
+	if len(cfg.Environment) > 0 {
+		attrs = append(attrs, slog.String("env", cfg.Environment))
+	}
+	if len(cfg.Version) > 0 {
+		attrs = append(attrs, slog.String("version", cfg.Version))
+	}
+	if len(cfg.InstanceID) > 0 {
+		attrs = append(attrs, slog.String("instance", cfg.InstanceID))
+	}
+	if len(cfg.Region) > 0 {
+		attrs = append(attrs, slog.String("region", cfg.Region))
+	}
+	return attrs
+}
+
+// resourceAttributes returns the fields as OpenTelemetry resource attributes, using the semantic
+// convention names.
+func (cfg AppConfig) resourceAttributes() map[string]string {
+	var attrs map[string]string
+
+	attrs = make(map[string]string)
+	if len(cfg.Environment) > 0 {
+		attrs["deployment.environment.name"] = cfg.Environment
+	}
+	if len(cfg.InstanceID) > 0 {
+		attrs["service.instance.id"] = cfg.InstanceID
+	}
+	if len(cfg.Region) > 0 {
+		attrs["cloud.region"] = cfg.Region
+	}
+	if len(cfg.Version) > 0 {
+		attrs["service.version"] = cfg.Version
+	}
+	return attrs
+}
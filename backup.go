@@ -0,0 +1,124 @@
+package serverconfig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// BackupConfig describes the application's backups for maintenance tooling.  Schedule is a cron expression
+// as for JobConfig.  Destination is the YAML key of the object storage section (an ObjectStoreConfig,
+// GCSConfig, or AzureBlobConfig) that backups are written to, defaulting to "objectstore", and Prefix is
+// prepended to the backup object names.  Backups older than RetentionAge, or beyond the newest
+// RetentionCount, are removed; when neither is set the newest 7 are kept.  EncryptionKeyEnv names an
+// environment variable holding a base64 AES-256 key; backups are not encrypted when it is empty.
+//
+//	objectstore:
+//	  bucket: acme-backups
+//	backup:
+//	  schedule: "0 2 * * *"
+//	  destination: objectstore
+//	  prefix: billing/
+//	  retentioncount: 14
+//	  retentionage: 720h
+//	  encryptionkeyenv: BACKUP_KEY
+type BackupConfig struct {
+	Schedule         string        `yaml:"schedule"`
+	Destination      string        `yaml:"destination"`
+	Prefix           string        `yaml:"prefix"`
+	RetentionCount   int           `yaml:"retentioncount"`
+	RetentionAge     time.Duration `yaml:"retentionage"`
+	EncryptionKeyEnv string        `yaml:"encryptionkeyenv"`
+	schedule         cron.Schedule
+	encryptionKey    []byte
+	store            any
+}
+
+// Verify parses Schedule, checks the retention, and reads the encryption key.
+func (cfg *BackupConfig) Verify() error {
+	var (
+		envValue string
+		found    bool
+		err      error
+	)
+
+	if len(cfg.Schedule) == 0 {
+		return fmt.Errorf("missing backup schedule")
+	}
+	cfg.schedule, err = jobParser.Parse(cfg.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid backup schedule %q: %w", cfg.Schedule, err)
+	}
+	cfg.Destination = strings.ToLower(strings.TrimSpace(cfg.Destination))
+	if len(cfg.Destination) == 0 {
+		cfg.Destination = "objectstore"
+	}
+	cfg.Prefix = strings.TrimPrefix(cfg.Prefix, "/")
+	if cfg.RetentionCount < 0 || cfg.RetentionAge < 0 {
+		return fmt.Errorf("backup retentioncount and retentionage cannot be negative")
+	}
+	if cfg.RetentionCount == 0 && cfg.RetentionAge == 0 {
+		cfg.RetentionCount = 7
+	}
+	cfg.encryptionKey = nil
+	if len(cfg.EncryptionKeyEnv) > 0 {
+		envValue, found = os.LookupEnv(cfg.EncryptionKeyEnv)
+		if !found || len(envValue) == 0 {
+			return fmt.Errorf("missing backup encryption key (environment variable %s is not set)", cfg.EncryptionKeyEnv)
+		}
+		cfg.encryptionKey, err = base64.StdEncoding.DecodeString(strings.TrimSpace(envValue))
+		if err != nil || len(cfg.encryptionKey) != 32 {
+			return fmt.Errorf("backup encryption key in %s must be 32 bytes, base64 encoded", cfg.EncryptionKeyEnv)
+		}
+	}
+	return nil
+}
+
+// PostVerify checks that Destination names an object storage section of root.
+func (cfg *BackupConfig) PostVerify(root any) error {
+	var (
+		section any
+		found   bool
+	)
+
+	section, found = findSection(root, cfg.Destination)
+	if !found {
+		return fmt.Errorf("backup destination %q is not a section of the configuration", cfg.Destination)
+	}
+	switch section.(type) {
+	case *ObjectStoreConfig, *GCSConfig, *AzureBlobConfig:
+		cfg.store = section
+	default:
+		return fmt.Errorf("backup destination %q is not an object storage section", cfg.Destination)
+	}
+	return nil
+}
+
+// Store returns the section named by Destination: an *ObjectStoreConfig, *GCSConfig, or *AzureBlobConfig.
+// It is nil unless the configuration was loaded by Read.
+func (cfg *BackupConfig) Store() any {
+	return cfg.store
+}
+
+// Next returns the time of the next backup after t.
+func (cfg *BackupConfig) Next(t time.Time) time.Time {
+	return cfg.schedule.Next(t)
+}
+
+// EncryptionKey returns the key read from EncryptionKeyEnv, or nil when backups are not encrypted.
+func (cfg *BackupConfig) EncryptionKey() []byte {
+	return cfg.encryptionKey
+}
+
+// Expired reports whether a backup taken at created should be removed.  index is the backup's position
+// among all backups, newest first, starting at 0.
+func (cfg *BackupConfig) Expired(created time.Time, index int) bool {
+	if cfg.RetentionCount > 0 && index >= cfg.RetentionCount {
+		return true
+	}
+	return cfg.RetentionAge > 0 && time.Since(created) > cfg.RetentionAge
+}
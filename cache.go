@@ -0,0 +1,207 @@
+package serverconfig
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig describes an application cache.  Backend is memory (the default), an in-process cache
+// bounded by MaxEntries and MaxMemory, or redis, which needs the redis sub-section.  MaxMemory is a size such
+// as "256MiB" and counts the bytes of keys and values.  When neither limit is set the memory cache holds at
+// most 10000 entries.  Eviction is lru (the default) or fifo and applies to the memory backend; a redis
+// server evicts by its own maxmemory-policy.  DefaultTTL is used when Set is given no TTL, with entries kept
+// until evicted when it is zero.
+//
+//	cache:
+//	  backend: memory
+//	  maxmemory: 256MiB
+//	  defaultttl: 5m
+//	  eviction: lru
+type CacheConfig struct {
+	Backend    string        `yaml:"backend" env:"CACHEBACKEND"`
+	MaxEntries int           `yaml:"maxentries"`
+	MaxMemory  ByteSize      `yaml:"maxmemory"`
+	DefaultTTL time.Duration `yaml:"defaultttl"`
+	Eviction   string        `yaml:"eviction"`
+	Redis      *RedisConfig  `yaml:"redis"`
+}
+
+// Cache is the interface of the caches built by CacheConfig.NewCache.  A TTL of zero uses DefaultTTL.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Verify defaults Backend and Eviction and checks the limits.
+func (cfg *CacheConfig) Verify() error {
+	cfg.Backend = strings.ToLower(strings.TrimSpace(cfg.Backend))
+	if len(cfg.Backend) == 0 {
+		cfg.Backend = "memory"
+	}
+	if cfg.MaxEntries < 0 || cfg.MaxMemory < 0 || cfg.DefaultTTL < 0 {
+		return fmt.Errorf("cache maxentries, maxmemory, and defaultttl cannot be negative")
+	}
+	cfg.Eviction = strings.ToLower(strings.TrimSpace(cfg.Eviction))
+	switch cfg.Backend {
+	case "memory":
+		if len(cfg.Eviction) == 0 {
+			cfg.Eviction = "lru"
+		}
+		if cfg.Eviction != "lru" && cfg.Eviction != "fifo" {
+			return fmt.Errorf("invalid cache eviction %q (expected lru or fifo)", cfg.Eviction)
+		}
+		if cfg.MaxEntries == 0 && cfg.MaxMemory == 0 {
+			cfg.MaxEntries = 10000
+		}
+	case "redis":
+		if cfg.Redis == nil {
+			return fmt.Errorf("cache backend redis requires the cache.redis section")
+		}
+		if len(cfg.Eviction) > 0 || cfg.MaxEntries > 0 || cfg.MaxMemory > 0 {
+			warnf("cache eviction, maxentries, and maxmemory are ignored by the redis backend; set maxmemory-policy on the server")
+		}
+	default:
+		return fmt.Errorf("invalid cache backend %q (expected memory or redis)", cfg.Backend)
+	}
+	return nil
+}
+
+// NewCache returns the configured cache.  The redis backend is built by newRedis, which the application
+// provides so that this package does not depend on a redis client; it may be nil when redis is not used.
+//
+//	cache, err := gc.Cache.NewCache(func(cfg *serverconfig.CacheConfig) (serverconfig.Cache, error) {
+//		return newRedisCache(cfg.Redis, cfg.DefaultTTL)
+//	})
+func (cfg *CacheConfig) NewCache(newRedis func(cfg *CacheConfig) (Cache, error)) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return cfg.NewMemoryCache(), nil
+	case "redis":
+		if newRedis == nil {
+			return nil, fmt.Errorf("cache backend redis is not supported by this application")
+		}
+		return newRedis(cfg)
+	default:
+		return nil, fmt.Errorf("invalid cache backend %q", cfg.Backend)
+	}
+}
+
+// NewMemoryCache returns an in-process cache with the configured limits, TTL, and eviction.
+func (cfg *CacheConfig) NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		cfg:     *cfg,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// MemoryCache is the memory cache backend.  It is safe for concurrent use.
+type MemoryCache struct {
+	cfg     CacheConfig
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is evicted last
+	size    int64
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Get returns the value stored for key.  Expired entries are removed and reported as missing.
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var (
+		elem  *list.Element
+		entry *memoryCacheEntry
+		found bool
+	)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found = c.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+	entry = elem.Value.(*memoryCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	if c.cfg.Eviction != "fifo" {
+		c.order.MoveToFront(elem)
+	}
+	return entry.value, true, nil
+}
+
+// Set stores value for key, evicting entries as needed to stay within the limits.  A value larger than
+// MaxMemory is not stored.
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var (
+		elem  *list.Element
+		entry *memoryCacheEntry
+		found bool
+	)
+
+	if ttl == 0 {
+		ttl = c.cfg.DefaultTTL
+	}
+	entry = &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found = c.entries[key]
+	if found {
+		c.remove(elem)
+	}
+	if c.cfg.MaxMemory > 0 && int64(len(key)+len(value)) > int64(c.cfg.MaxMemory) {
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += int64(len(key) + len(value))
+	for c.order.Len() > 0 && ((c.cfg.MaxEntries > 0 && c.order.Len() > c.cfg.MaxEntries) ||
+		(c.cfg.MaxMemory > 0 && c.size > int64(c.cfg.MaxMemory))) {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Delete removes key.
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	var (
+		elem  *list.Element
+		found bool
+	)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found = c.entries[key]
+	if found {
+		c.remove(elem)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet removed.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *MemoryCache) remove(elem *list.Element) {
+	var entry *memoryCacheEntry
+
+	entry = c.order.Remove(elem).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.key) + len(entry.value))
+}
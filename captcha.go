@@ -0,0 +1,169 @@
+package serverconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CaptchaConfig holds the settings for a reCAPTCHA or hCaptcha challenge on forms such as login.  Provider
+// is recaptcha or hcaptcha.  SiteKey is embedded in pages and Secret is used by Check to verify responses
+// with the provider.  ScoreThreshold applies to scored responses and must be between 0 and 1: reCAPTCHA v3
+// scores closer to 1 are more likely human, so a response must score at least the threshold, which defaults
+// to 0.5; hCaptcha Enterprise scores closer to 1 are more likely bots, so a response must score at most the
+// threshold, which is not applied when zero.  Requests whose path begins with one of ExemptPaths are not
+// challenged.  VerifyURL overrides the provider's siteverify endpoint.
+//
+//	captcha:
+//	  enabled: true
+//	  provider: recaptcha
+//	  sitekey: 6LcXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX
+//	  scorethreshold: 0.7
+//	  exemptpaths: [/api/, /healthz]
+type CaptchaConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Provider       string        `yaml:"provider"`
+	SiteKey        string        `yaml:"sitekey" env:"CAPTCHASITEKEY"`
+	Secret         string        `yaml:"secret" env:"CAPTCHASECRET"`
+	ScoreThreshold float64       `yaml:"scorethreshold"`
+	ExemptPaths    []string      `yaml:"exemptpaths"`
+	VerifyURL      string        `yaml:"verifyurl"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// Verify checks Provider, the keys, ScoreThreshold, and ExemptPaths.  Timeout defaults to 5 seconds.
+// Nothing is checked when the captcha is not enabled.
+func (cfg *CaptchaConfig) Verify() error {
+	var (
+		err error
+		i   int
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	switch cfg.Provider {
+	case "recaptcha":
+		if len(cfg.VerifyURL) == 0 {
+			cfg.VerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+		}
+		if cfg.ScoreThreshold == 0 {
+			cfg.ScoreThreshold = 0.5
+		}
+	case "hcaptcha":
+		if len(cfg.VerifyURL) == 0 {
+			cfg.VerifyURL = "https://api.hcaptcha.com/siteverify"
+		}
+	case "":
+		return fmt.Errorf("missing captcha provider")
+	default:
+		return fmt.Errorf("invalid captcha provider %q (expected recaptcha or hcaptcha)", cfg.Provider)
+	}
+	if len(cfg.SiteKey) == 0 {
+		return fmt.Errorf("missing captcha sitekey (or CAPTCHASITEKEY environment variable)")
+	}
+	if len(cfg.Secret) == 0 {
+		return fmt.Errorf("missing captcha secret (or CAPTCHASECRET environment variable)")
+	}
+	if cfg.ScoreThreshold < 0 || cfg.ScoreThreshold > 1 {
+		return fmt.Errorf("captcha scorethreshold must be between 0 and 1, got %g", cfg.ScoreThreshold)
+	}
+	for i = 0; i < len(cfg.ExemptPaths); i++ {
+		if !strings.HasPrefix(cfg.ExemptPaths[i], "/") {
+			return fmt.Errorf("captcha exemptpaths entry %q must begin with '/'", cfg.ExemptPaths[i])
+		}
+	}
+	_, err = validateURL(cfg.VerifyURL, "http", "https")
+	if err != nil {
+		return fmt.Errorf("invalid captcha verifyurl: %w", err)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("captcha timeout cannot be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return nil
+}
+
+// Exempt reports whether a request for path is not challenged.
+func (cfg CaptchaConfig) Exempt(path string) bool {
+	var i int
+
+	for i = 0; i < len(cfg.ExemptPaths); i++ {
+		if strings.HasPrefix(path, cfg.ExemptPaths[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseField returns the name of the form field the provider's widget posts its response in.
+func (cfg CaptchaConfig) ResponseField() string {
+	if cfg.Provider == "hcaptcha" {
+		return "h-captcha-response"
+	}
+	return "g-recaptcha-response"
+}
+
+// Check verifies a widget response with the provider and reports whether it passed, including the
+// ScoreThreshold when the provider returns a score.  remoteIP may be empty.  client may be nil to use one
+// with the configured Timeout.
+//
+//	ok, err := gc.Captcha.Check(r.Context(), nil, r.FormValue(gc.Captcha.ResponseField()), ip.String())
+func (cfg CaptchaConfig) Check(ctx context.Context, client *http.Client, response, remoteIP string) (bool, error) {
+	var (
+		form   url.Values
+		req    *http.Request
+		resp   *http.Response
+		result struct {
+			Success    bool     `json:"success"`
+			Score      *float64 `json:"score"`
+			ErrorCodes []string `json:"error-codes"`
+		}
+		err error
+	)
+
+	if len(response) == 0 {
+		return false, nil
+	}
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	form = url.Values{"secret": {cfg.Secret}, "response": {response}}
+	if len(remoteIP) > 0 {
+		form.Set("remoteip", remoteIP)
+	}
+	if cfg.Provider == "hcaptcha" {
+		form.Set("sitekey", cfg.SiteKey)
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, cfg.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("captcha verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha verification failed: %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return false, fmt.Errorf("captcha verification failed: %w", err)
+	}
+	if !result.Success || result.Score == nil || cfg.ScoreThreshold == 0 {
+		return result.Success, nil
+	}
+	if cfg.Provider == "hcaptcha" {
+		return *result.Score <= cfg.ScoreThreshold, nil
+	}
+	return *result.Score >= cfg.ScoreThreshold, nil
+}
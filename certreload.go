@@ -0,0 +1,136 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair from disk and picks up replacements without a restart, as
+// happens when cert-manager rotates a mounted secret.  Set GetCertificate on the tls.Config and call Watch
+// to poll for changes, or Reload directly, e.g. on SIGHUP.  If a reload fails the previous pair remains in
+// use.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	stamp    string
+}
+
+// Reloader loads the static certificate and returns a CertReloader for it.
+func (cfg HTTPStaticCertConfig) Reloader() (*CertReloader, error) {
+	var (
+		r   *CertReloader
+		err error
+	)
+
+	r = &CertReloader{certFile: cfg.SSLCertFile, keyFile: cfg.SSLPrivateKeyFile}
+	err = r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key again if either file has changed since the last load.
+func (r *CertReloader) Reload() error {
+	var (
+		stamp string
+		pair  tls.Certificate
+		err   error
+	)
+
+	stamp, err = r.fileStamp()
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	if stamp == r.stamp {
+		r.mu.RUnlock()
+		return nil
+	}
+	r.mu.RUnlock()
+
+	pair, err = loadKeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &pair
+	r.stamp = stamp
+	r.mu.Unlock()
+	return nil
+}
+
+// fileStamp summarizes both files as statStamp does.
+func (r *CertReloader) fileStamp() (string, error) {
+	return statStamp(r.certFile, r.keyFile)
+}
+
+// statStamp summarizes the files at paths by the path each resolves to, its size, and its modification time,
+// so that polling notices when they change.  Kubernetes updates ConfigMap and Secret volumes by pointing the
+// ..data symlink at a new directory rather than by writing the files in place, which always changes the
+// resolved path even if the size and time happen to match.  A missing file is included as such rather than
+// being an error.
+func statStamp(paths ...string) (string, error) {
+	var (
+		stamp    strings.Builder
+		resolved string
+		info     os.FileInfo
+		err      error
+		i        int
+	)
+
+	for i = 0; i < len(paths); i++ {
+		resolved, err = filepath.EvalSymlinks(paths[i])
+		if err == nil {
+			info, err = os.Stat(resolved)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(&stamp, "%s/missing;", paths[i])
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%s/%d/%d;", resolved, info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp.String(), nil
+}
+
+// Watch calls Reload every interval until ctx is done.  Failures are reported through Warnf.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	var (
+		ticker *time.Ticker
+		err    error
+	)
+
+	ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err = r.Reload()
+			if err != nil {
+				warnf("certificate reload of %s failed, keeping the current certificate: %v", r.certFile, err)
+			}
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -1,13 +1,21 @@
 package serverconfig
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"maps"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,8 +23,32 @@ type Verifier interface {
 	Verify() error
 }
 
+// offlineVerifier is implemented by sections whose Verify makes network checks, such as a test connection,
+// to verify them without those checks.
+type offlineVerifier interface {
+	verifyOffline() error
+}
+
+// PostVerifier is implemented by sections whose settings depend on other sections.  PostVerify is called
+// after every section has been verified, with root being the configuration struct passed to Read.
+type PostVerifier interface {
+	PostVerify(root any) error
+}
+
 var (
 	durationType = reflect.TypeOf(time.Duration(0))
+
+	// Decompressors maps configuration file extensions to the decompressors Read uses for them, so that
+	// "config.yaml.gz" is read as "config.yaml".  Gzip and zstd are built in.  A decompressor returning an
+	// io.Closer is closed once the file has been read.
+	Decompressors = map[string]func(r io.Reader) (io.Reader, error){
+		".gz":  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		".zst": decompressZstd,
+	}
+
+	// Warnf is used by Verify methods to report settings which are allowed but are probably a mistake.
+	// It writes to the standard logger by default and may be replaced, or set to nil to discard warnings.
+	Warnf = log.Printf
 )
 
 type Config struct {
@@ -29,39 +61,165 @@ type Config struct {
 
 // Read reads a YAML file into a configuration struct.  Anything tagges with 'ENV' can have an overriding value
 // in the OS environment which, if existing, will override any values read from the YAML file.
-// Any sub-structs satisfying the Verifier interface will get that called to verify the data read.
-func Read(filename string, cfg any) error {
+// Any sub-structs satisfying the Verifier interface will get that called to verify the data read, and then
+// any satisfying PostVerifier will get that called to check settings which refer to other sections.
+// A filename of "-" reads the configuration from standard input.  Options such as WithSecretsDir add other
+// sources of overrides.  Once the configuration passes verification it becomes the one whose App section is
+// returned by CurrentApp and whose sources are returned by Provenance.
+func Read(filename string, cfg any, opts ...ReadOption) error {
 	var (
-		b   []byte
-		err error
+		options    readOptions
+		provenance map[string]string
+		err        error
+		i          int
 	)
 
-	err = validateConfigPointer(cfg)
+	for i = 0; i < len(opts); i++ {
+		opts[i](&options)
+	}
+	provenance, err = readConfig(filename, cfg, options)
 	if err != nil {
 		return err
 	}
+	lastProvenance.Store(&provenance)
+	if options.provenance != nil {
+		*options.provenance = maps.Clone(provenance)
+	}
+	publishApp(cfg)
+	return nil
+}
+
+// readConfig is Read without making the configuration the one returned by CurrentApp and Provenance.  It
+// returns the provenance of cfg.  With options.offline set, network checks such as SMTP test connections
+// are skipped, for reads which only look at the file.
+func readConfig(filename string, cfg any, options readOptions) (map[string]string, error) {
+	var (
+		b          []byte
+		doc        yaml.Node
+		secrets    overrideLookup
+		provenance map[string]string
+		err        error
+	)
+
+	err = validateConfigPointer(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	b, err = os.ReadFile(filename)
+	b, err = readConfigFile(filename)
 	if err != nil {
-		return fmt.Errorf("unable to read configuration file: %s, error: %w", filename, err)
+		return nil, fmt.Errorf("unable to read configuration file: %s, error: %w", filename, err)
 	}
 
-	err = yaml.Unmarshal(b, cfg)
+	err = decodeConfig(filename, b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration file: %s, error: %w", filename, err)
+	}
+	if len(options.cueSchema) > 0 {
+		err = validateCUE(options.cueSchema, filename, b, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("configuration file %s does not match its schema: %w", filename, err)
+		}
+	}
+	err = doc.Decode(cfg)
 	if err != nil {
-		return fmt.Errorf("unable to parse configuration file: %s, error: %w", filename, err)
+		return nil, fmt.Errorf("unable to parse configuration file: %s, error: %w", filename, err)
+	}
+	provenance = make(map[string]string)
+	fileProvenance(&doc, "", provenance)
+
+	if len(options.secretsDir) > 0 {
+		secrets, err = secretsDirLookup(options.secretsDir)
+		if err == nil {
+			err = applyOverrides(cfg, secrets)
+		}
+		if err != nil {
+			return nil, err
+		}
+		overrideProvenance(reflect.ValueOf(cfg), "", provenance, secrets)
 	}
 
 	err = applyEnvOverrides(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	overrideProvenance(reflect.ValueOf(cfg), "", provenance, lookupEnv)
 
-	err = verifySubStructs(cfg)
+	if options.offline {
+		err = verifySubStructsOffline(cfg)
+	} else {
+		err = verifySubStructs(cfg)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	err = postVerifySubStructs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultProvenance(reflect.ValueOf(cfg), "", provenance)
+	_ = walkSubStructs(cfg, func(value reflect.Value, path string) error {
+		callKeepProvenance(value, provenance)
+		return nil
+	})
+	return provenance, nil
+}
+
+// ReadStdin reads the configuration from standard input, as when it is piped from a templating tool
+// such as consul-template, and is the same as Read("-", cfg, opts...).
+func ReadStdin(cfg any, opts ...ReadOption) error {
+	return Read("-", cfg, opts...)
+}
+
+// readConfigFile returns the contents of filename, or of standard input when filename is "-", decompressed
+// when its extension is in Decompressors.
+func readConfigFile(filename string) ([]byte, error) {
+	var (
+		f          *os.File
+		r          io.Reader
+		closer     io.Closer
+		decompress func(r io.Reader) (io.Reader, error)
+		found      bool
+		err        error
+	)
+
+	if filename == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	decompress, found = Decompressors[filepath.Ext(filename)]
+	if !found {
+		return os.ReadFile(filename)
+	}
+	f, err = os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err = decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	closer, found = r.(io.Closer)
+	if found {
+		defer closer.Close()
+	}
+	return io.ReadAll(r)
+}
+
+// decompressZstd decodes a zstd stream on the calling goroutine; the decoder is released when closed.
+func decompressZstd(r io.Reader) (io.Reader, error) {
+	var (
+		decoder *zstd.Decoder
+		err     error
+	)
+
+	decoder, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
 }
 
 func validateConfigPointer(cfg any) error {
@@ -78,14 +236,33 @@ func validateConfigPointer(cfg any) error {
 	return nil
 }
 
+// overrideLookup finds the override for a setting by the name in its env tag, returning the value and
+// where it came from, such as "env:DBPASS", as recorded by Provenance.
+type overrideLookup func(name string) (value string, source string, found bool)
+
+// lookupEnv is the overrideLookup for environment variables.
+func lookupEnv(name string) (string, string, bool) {
+	var (
+		value string
+		found bool
+	)
+
+	value, found = os.LookupEnv(name)
+	return value, "env:" + name, found
+}
+
 func applyEnvOverrides(cfg any) error {
+	return applyOverrides(cfg, lookupEnv)
+}
+
+func applyOverrides(cfg any, lookup overrideLookup) error {
 	var (
 		value reflect.Value
 		err   error
 	)
 
 	value = reflect.ValueOf(cfg)
-	err = applyEnvOverridesValue(value, "")
+	err = applyOverridesValue(value, "", lookup)
 	if err != nil {
 		return err
 	}
@@ -93,7 +270,7 @@ func applyEnvOverrides(cfg any) error {
 	return nil
 }
 
-func applyEnvOverridesValue(value reflect.Value, path string) error {
+func applyOverridesValue(value reflect.Value, path string, lookup overrideLookup) error {
 	var (
 		err       error
 		i         int
@@ -102,6 +279,7 @@ func applyEnvOverridesValue(value reflect.Value, path string) error {
 		fieldPath string
 		envName   string
 		envValue  string
+		source    string
 		found     bool
 	)
 
@@ -131,16 +309,16 @@ func applyEnvOverridesValue(value reflect.Value, path string) error {
 
 		envName = fieldDef.Tag.Get("env")
 		if len(envName) > 0 {
-			envValue, found = os.LookupEnv(envName)
+			envValue, source, found = lookup(envName)
 			if found {
 				err = setValueFromEnv(field, envValue)
 				if err != nil {
-					return fmt.Errorf("invalid value for env %s (%s): %w", envName, fieldPath, err)
+					return fmt.Errorf("invalid value for %s (%s): %w", source, fieldPath, err)
 				}
 			}
 		}
 
-		err = applyEnvOverridesValue(field, fieldPath)
+		err = applyOverridesValue(field, fieldPath, lookup)
 		if err != nil {
 			return err
 		}
@@ -157,6 +335,7 @@ func setValueFromEnv(field reflect.Value, raw string) error {
 		parsedUint  uint64
 		parsedFloat float64
 		duration    time.Duration
+		size        ByteSize
 		parts       []string
 		slice       reflect.Value
 		i           int
@@ -193,6 +372,14 @@ func setValueFromEnv(field reflect.Value, raw string) error {
 			field.SetInt(int64(duration))
 			return nil
 		}
+		if field.Type() == byteSizeType {
+			size, err = ParseByteSize(raw)
+			if err != nil {
+				return fmt.Errorf("expected size, got %q", raw)
+			}
+			field.SetInt(int64(size))
+			return nil
+		}
 		parsedInt, err = strconv.ParseInt(raw, 10, field.Type().Bits())
 		if err != nil {
 			return fmt.Errorf("expected integer, got %q", raw)
@@ -234,6 +421,24 @@ func setValueFromEnv(field reflect.Value, raw string) error {
 }
 
 func verifySubStructs(cfg any) error {
+	return walkSubStructs(cfg, callVerify)
+}
+
+// verifySubStructsOffline is verifySubStructs without the network checks of sections satisfying
+// offlineVerifier.
+func verifySubStructsOffline(cfg any) error {
+	return walkSubStructs(cfg, callVerifyOffline)
+}
+
+// postVerifySubStructs calls PostVerify on every sub-struct satisfying PostVerifier, once all of them have
+// been verified.
+func postVerifySubStructs(cfg any) error {
+	return walkSubStructs(cfg, func(value reflect.Value, path string) error {
+		return callPostVerify(value, path, cfg)
+	})
+}
+
+func walkSubStructs(cfg any, call func(reflect.Value, string) error) error {
 	var (
 		value reflect.Value
 		err   error
@@ -251,7 +456,7 @@ func verifySubStructs(cfg any) error {
 		return fmt.Errorf("config must point to a struct")
 	}
 
-	err = verifyStructValues(value, value.Type().Name())
+	err = verifyStructValues(value, value.Type().Name(), call)
 	if err != nil {
 		return err
 	}
@@ -259,8 +464,11 @@ func verifySubStructs(cfg any) error {
 	return nil
 }
 
-func verifyStructValues(value reflect.Value, path string) error {
+// verifyStructValues calls call on each field of value and walks into it, collecting the errors of every
+// section.  The fields of a section whose own call failed are skipped, since they may depend on it.
+func verifyStructValues(value reflect.Value, path string, call func(reflect.Value, string) error) error {
 	var (
+		errs      []error
 		err       error
 		i         int
 		field     reflect.Value
@@ -291,18 +499,110 @@ func verifyStructValues(value reflect.Value, path string) error {
 			fieldPath = path + "." + fieldDef.Name
 		}
 
-		err = callVerify(field, fieldPath)
+		if disabledSection(field, fieldDef.Tag.Get("optional") == "true") {
+			continue
+		}
+
+		err = call(field, fieldPath)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
 		}
 
-		err = verifyStructValues(field, fieldPath)
+		err = verifyStructValues(field, fieldPath, call)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+		}
+
+		if field.Kind() == reflect.Map {
+			err = verifyMapValues(field, fieldPath, call)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// verifyMapValues verifies each struct value held in a map.  Map values are not addressable, so each
+// value is copied, verified, and stored back so that any defaults set by Verify are kept.
+func verifyMapValues(value reflect.Value, path string, call func(reflect.Value, string) error) error {
+	var (
+		errs     []error
+		err      error
+		keys     []reflect.Value
+		elemType reflect.Type
+		elem     reflect.Value
+		elemPath string
+		i        int
+	)
+
+	elemType = value.Type().Elem()
+	for elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct || value.Len() == 0 {
+		return nil
+	}
+
+	keys = value.MapKeys()
+	sort.Slice(keys, func(a, b int) bool {
+		return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+	})
+
+	for i = 0; i < len(keys); i++ {
+		elem = reflect.New(value.Type().Elem()).Elem()
+		elem.Set(value.MapIndex(keys[i]))
+		elemPath = fmt.Sprintf("%s[%v]", path, keys[i].Interface())
+		if disabledSection(elem, false) {
+			value.SetMapIndex(keys[i], elem)
+			continue
+		}
+
+		err = call(elem, elemPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = verifyStructValues(elem, elemPath, call)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		value.SetMapIndex(keys[i], elem)
+	}
+
+	return errors.Join(errs...)
+}
+
+// disabledSection reports whether value is a section which has been switched off, either by an Enabled bool
+// field set to false or, when optional is set by an optional:"true" tag, by being left empty.  A disabled
+// section is zeroed, so that nothing half configured is used by mistake, and is neither verified nor
+// walked, so an unused section need not be filled in just to pass Verify.
+func disabledSection(value reflect.Value, optional bool) bool {
+	var enabled reflect.Value
+
+	for value.IsValid() && value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return false
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.Kind() != reflect.Struct {
+		return false
+	}
+	enabled = value.FieldByName("Enabled")
+	if enabled.IsValid() && enabled.Kind() == reflect.Bool && enabled.CanInterface() {
+		if enabled.Bool() {
+			return false
+		}
+	} else if !optional || !value.IsZero() {
+		return false
+	}
+	if value.CanSet() {
+		value.Set(reflect.Zero(value.Type()))
+	}
+	return true
 }
 
 func callVerify(value reflect.Value, path string) error {
@@ -356,3 +656,115 @@ func callVerify(value reflect.Value, path string) error {
 
 	return nil
 }
+
+// callVerifyOffline is callVerify, calling verifyOffline in place of Verify where there is one.
+func callVerifyOffline(value reflect.Value, path string) error {
+	var (
+		err      error
+		verifier offlineVerifier
+		ok       bool
+	)
+
+	if value.Kind() != reflect.Pointer && value.CanAddr() {
+		value = value.Addr()
+	}
+	if value.IsValid() && !(value.Kind() == reflect.Pointer && value.IsNil()) && value.CanInterface() {
+		verifier, ok = value.Interface().(offlineVerifier)
+		if ok {
+			err = verifier.verifyOffline()
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return nil
+		}
+	}
+	return callVerify(value, path)
+}
+
+func callPostVerify(value reflect.Value, path string, root any) error {
+	var (
+		err          error
+		postVerifier PostVerifier
+		ok           bool
+	)
+
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+	} else if value.CanAddr() {
+		value = value.Addr()
+	}
+	if value.CanInterface() {
+		postVerifier, ok = value.Interface().(PostVerifier)
+		if ok {
+			err = postVerifier.PostVerify(root)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findSection returns the section of root whose YAML key is name, searching each level of nested structs
+// before the next.  The value returned is a pointer to the section.
+func findSection(root any, name string) (any, bool) {
+	var (
+		level []reflect.Value
+		next  []reflect.Value
+		value reflect.Value
+		field reflect.Value
+		key   string
+		i, j  int
+	)
+
+	level = []reflect.Value{reflect.ValueOf(root)}
+	for len(level) > 0 {
+		next = nil
+		for i = 0; i < len(level); i++ {
+			value = level[i]
+			for value.IsValid() && value.Kind() == reflect.Pointer && !value.IsNil() {
+				value = value.Elem()
+			}
+			if !value.IsValid() || value.Kind() != reflect.Struct {
+				continue
+			}
+			for j = 0; j < value.NumField(); j++ {
+				if len(value.Type().Field(j).PkgPath) > 0 {
+					continue
+				}
+				field = value.Field(j)
+				key, _, _ = strings.Cut(value.Type().Field(j).Tag.Get("yaml"), ",")
+				if len(key) == 0 {
+					key = strings.ToLower(value.Type().Field(j).Name)
+				}
+				if key == name {
+					if field.Kind() == reflect.Pointer {
+						if field.IsNil() {
+							return nil, false
+						}
+						return field.Interface(), true
+					}
+					if field.CanAddr() {
+						return field.Addr().Interface(), true
+					}
+					return nil, false
+				}
+				next = append(next, field)
+			}
+		}
+		level = next
+	}
+	return nil, false
+}
+
+func warnf(format string, args ...any) {
+	if Warnf != nil {
+		Warnf("serverconfig: "+format, args...)
+	}
+}
@@ -1,14 +1,57 @@
 package serverconfig
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"log/syslog"
+	"html/template"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/klauspost/compress/zstd"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gopkg.in/yaml.v3"
 )
 
 var errVerifyBoom = errors.New("verify boom")
@@ -162,12 +205,18 @@ func TestReadWithDefaultConfig(t *testing.T) {
 	var (
 		yamlBody  string
 		path      string
+		certFile  string
+		keyFile   string
+		templates string
 		cfg       Config
 		err       error
-		expectedP syslog.Priority
+		expectedP int
 	)
 
-	yamlBody = "logging:\n  syslog_enabled: true\ndatabase:\n  server: db.local:3306\n  user: app\n  password: from-yaml\n  db: maindb\nredis:\n  server: redis.local:6379\nsmtp:\n  server: smtp.local\n  port: 587\n  from: noreply@example.com\nhttp:\n  bindaddr: :80\n  sslbindaddr: :443\n  templatepath: ./templates\n  externalhostname:\n    - example.com\n  skiphostnametest: true\n  static_cert:\n    certfile: /tmp/cert.pem\n    privatekeyfile: /tmp/key.pem\n"
+	certFile, keyFile = writeTestCertificate(t, []string{"example.com"}, time.Now().Add(30*24*time.Hour))
+	templates = t.TempDir()
+	_ = os.WriteFile(filepath.Join(templates, "layout.html"), []byte("{{.}}"), 0o644)
+	yamlBody = "logging:\n  syslog_enabled: true\ndatabase:\n  server: db.local:3306\n  user: app\n  password: from-yaml\n  db: maindb\nredis:\n  server: redis.local:6379\nsmtp:\n  server: smtp.local\n  port: 587\n  from: noreply@example.com\nhttp:\n  bindaddr: :80\n  sslbindaddr: :443\n  templatepath: " + templates + "\n  externalhostname:\n    - example.com\n  skiphostnametest: true\n  static_cert:\n    certfile: " + certFile + "\n    privatekeyfile: " + keyFile + "\n"
 	path = writeTempConfig(t, yamlBody)
 
 	t.Setenv("DBPASS", "from-env")
@@ -177,6 +226,9 @@ func TestReadWithDefaultConfig(t *testing.T) {
 		t.Fatalf("Read returned error: %v", err)
 	}
 
+	if cfg.HTTP.Templates.Path != templates {
+		t.Fatalf("expected templatepath to carry over to templates.path, got %q", cfg.HTTP.Templates.Path)
+	}
 	if cfg.Database.Password != "from-env" {
 		t.Fatalf("expected env-overridden DB password, got %q", cfg.Database.Password)
 	}
@@ -184,9 +236,9 @@ func TestReadWithDefaultConfig(t *testing.T) {
 		t.Fatalf("unexpected connect string: %q", cfg.Database.ConnectString)
 	}
 
-	expectedP = syslog.Priority(int(syslog.LOG_LOCAL5) | int(syslog.LOG_INFO))
-	if cfg.Logging.Syslog.Priority() != expectedP {
-		t.Fatalf("unexpected default logging priority: %d", cfg.Logging.Syslog.Priority())
+	expectedP = logFacilityString2Int["LOG_LOCAL5"] | logSeverityString2Int["LOG_INFO"]
+	if cfg.Logging.Syslog.priority != expectedP {
+		t.Fatalf("unexpected default logging priority: %d", cfg.Logging.Syslog.priority)
 	}
 }
 
@@ -303,7 +355,7 @@ func TestLoggingConfigVerify(t *testing.T) {
 	var (
 		cfg       LoggingConfig
 		err       error
-		expectedP syslog.Priority
+		expectedP int
 	)
 
 	err = cfg.Verify()
@@ -318,9 +370,9 @@ func TestLoggingConfigVerify(t *testing.T) {
 		t.Fatalf("unexpected default severity: %q", cfg.Syslog.SeverityString)
 	}
 
-	expectedP = syslog.Priority(int(syslog.LOG_LOCAL5) | int(syslog.LOG_INFO))
-	if cfg.Syslog.Priority() != expectedP {
-		t.Fatalf("unexpected priority: %d", cfg.Syslog.Priority())
+	expectedP = logFacilityString2Int["LOG_LOCAL5"] | logSeverityString2Int["LOG_INFO"]
+	if cfg.Syslog.priority != expectedP {
+		t.Fatalf("unexpected priority: %d", cfg.Syslog.priority)
 	}
 
 	cfg.Syslog.FacilityString = "INVALID"
@@ -411,21 +463,6697 @@ func TestHTTPConfigVerify(t *testing.T) {
 	}
 }
 
-func writeTempConfig(t *testing.T, yamlBody string) string {
+func TestMetricsConfigVerify(t *testing.T) {
 	var (
-		dir  string
-		path string
-		err  error
+		testCases []struct {
+			name       string
+			cfg        MetricsConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        MetricsConfig
+			wantSubstr string
+		}
+		err error
 	)
 
-	t.Helper()
+	testCases = []struct {
+		name       string
+		cfg        MetricsConfig
+		wantSubstr string
+	}{
+		{name: "disabled", cfg: MetricsConfig{Path: "bogus"}, wantSubstr: ""},
+		{name: "defaults", cfg: MetricsConfig{Enabled: true}, wantSubstr: ""},
+		{name: "bad-path", cfg: MetricsConfig{Enabled: true, Path: "metrics"}, wantSubstr: "must begin with"},
+		{name: "bad-bindaddr", cfg: MetricsConfig{Enabled: true, BindAddr: "localhost"}, wantSubstr: "should specify a port"},
+		{name: "bad-namespace", cfg: MetricsConfig{Enabled: true, Namespace: "my-app"}, wantSubstr: "invalid metrics namespace"},
+		{name: "partial-auth", cfg: MetricsConfig{Enabled: true, User: "prom"}, wantSubstr: "requires both user and password"},
+	}
 
-	dir = t.TempDir()
-	path = filepath.Join(dir, "config.yaml")
-	err = os.WriteFile(path, []byte(yamlBody), 0o600)
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestMetricsConfigHandlerBasicAuth(t *testing.T) {
+	var (
+		cfg     MetricsConfig
+		path    string
+		handler http.Handler
+		req     *http.Request
+		rec     *httptest.ResponseRecorder
+		err     error
+	)
+
+	cfg = MetricsConfig{Enabled: true, User: "prom", Password: "secret"}
+	err = cfg.Verify()
 	if !errors.Is(err, nil) {
-		t.Fatalf("failed writing temp config file: %v", err)
+		t.Fatalf("Verify returned error: %v", err)
 	}
 
-	return path
+	path, handler = cfg.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	if path != "/metrics" {
+		t.Fatalf("unexpected metrics path: %q", path)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetBasicAuth("prom", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("expected 200 with credentials, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOTelConfigVerify(t *testing.T) {
+	var (
+		half      float64
+		tooBig    float64
+		testCases []struct {
+			name       string
+			cfg        OTelConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        OTelConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	half = 0.5
+	tooBig = 1.5
+	testCases = []struct {
+		name       string
+		cfg        OTelConfig
+		wantSubstr string
+	}{
+		{name: "disabled", cfg: OTelConfig{}, wantSubstr: ""},
+		{name: "grpc-hostport", cfg: OTelConfig{Enabled: true, Endpoint: "collector:4317", ServiceName: "svc"}, wantSubstr: ""},
+		{name: "http-url", cfg: OTelConfig{Enabled: true, Protocol: "HTTP", Endpoint: "https://collector:4318", ServiceName: "svc", SampleRatio: &half}, wantSubstr: ""},
+		{name: "bad-protocol", cfg: OTelConfig{Enabled: true, Protocol: "thrift", Endpoint: "collector:4317", ServiceName: "svc"}, wantSubstr: "invalid otel protocol"},
+		{name: "missing-endpoint", cfg: OTelConfig{Enabled: true, ServiceName: "svc"}, wantSubstr: "missing otel endpoint"},
+		{name: "http-needs-url", cfg: OTelConfig{Enabled: true, Protocol: "http", Endpoint: "collector:4318", ServiceName: "svc"}, wantSubstr: "must be a URL"},
+		{name: "missing-port", cfg: OTelConfig{Enabled: true, Endpoint: "collector", ServiceName: "svc"}, wantSubstr: "invalid otel endpoint"},
+		{name: "bad-ratio", cfg: OTelConfig{Enabled: true, Endpoint: "collector:4317", ServiceName: "svc", SampleRatio: &tooBig}, wantSubstr: "between 0 and 1"},
+		{name: "missing-service", cfg: OTelConfig{Enabled: true, Endpoint: "collector:4317"}, wantSubstr: "missing otel servicename"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestOTelConfigExporterEnv(t *testing.T) {
+	var (
+		cfg OTelConfig
+		env map[string]string
+		err error
+	)
+
+	cfg = OTelConfig{
+		Enabled:        true,
+		Protocol:       "http",
+		Endpoint:       "http://collector:4318",
+		Headers:        map[string]string{"x-token": "abc", "a": "b c"},
+		ServiceName:    "svc",
+		ServiceVersion: "1.2.3",
+		Insecure:       true,
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+
+	env = cfg.ExporterEnv()
+	if env["OTEL_EXPORTER_OTLP_PROTOCOL"] != "http/protobuf" {
+		t.Fatalf("unexpected protocol: %q", env["OTEL_EXPORTER_OTLP_PROTOCOL"])
+	}
+	if env["OTEL_EXPORTER_OTLP_HEADERS"] != "a=b%20c,x-token=abc" {
+		t.Fatalf("unexpected headers: %q", env["OTEL_EXPORTER_OTLP_HEADERS"])
+	}
+	if env["OTEL_TRACES_SAMPLER_ARG"] != "1" {
+		t.Fatalf("expected default sample ratio of 1, got %q", env["OTEL_TRACES_SAMPLER_ARG"])
+	}
+	if env["OTEL_RESOURCE_ATTRIBUTES"] != "service.version=1.2.3" {
+		t.Fatalf("unexpected resource attributes: %q", env["OTEL_RESOURCE_ATTRIBUTES"])
+	}
+	if env["OTEL_EXPORTER_OTLP_ENDPOINT"] != "http://collector:4318" {
+		t.Fatalf("expected the endpoint URL unchanged, got %q", env["OTEL_EXPORTER_OTLP_ENDPOINT"])
+	}
+
+	cfg = OTelConfig{Enabled: true, Endpoint: "otel-collector:4317", ServiceName: "svc"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	env = cfg.ExporterEnv()
+	if env["OTEL_EXPORTER_OTLP_ENDPOINT"] != "https://otel-collector:4317" {
+		t.Fatalf("expected an https URL for a grpc host:port, got %q", env["OTEL_EXPORTER_OTLP_ENDPOINT"])
+	}
+	cfg.Insecure = true
+	env = cfg.ExporterEnv()
+	if env["OTEL_EXPORTER_OTLP_ENDPOINT"] != "http://otel-collector:4317" {
+		t.Fatalf("expected an http URL for an insecure grpc host:port, got %q", env["OTEL_EXPORTER_OTLP_ENDPOINT"])
+	}
+}
+
+func TestSentryConfigVerify(t *testing.T) {
+	var (
+		negative  float64
+		testCases []struct {
+			name       string
+			cfg        SentryConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        SentryConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	negative = -0.1
+	testCases = []struct {
+		name       string
+		cfg        SentryConfig
+		wantSubstr string
+	}{
+		{name: "disabled", cfg: SentryConfig{}, wantSubstr: ""},
+		{name: "valid", cfg: SentryConfig{DSN: "https://abc123@o1.ingest.sentry.io/42"}, wantSubstr: ""},
+		{name: "bad-scheme", cfg: SentryConfig{DSN: "ftp://abc123@sentry.local/42"}, wantSubstr: "unsupported scheme"},
+		{name: "missing-key", cfg: SentryConfig{DSN: "https://sentry.local/42"}, wantSubstr: "missing public key"},
+		{name: "missing-project", cfg: SentryConfig{DSN: "https://abc123@sentry.local/"}, wantSubstr: "missing project id"},
+		{name: "bad-rate", cfg: SentryConfig{SampleRate: &negative}, wantSubstr: "between 0 and 1"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestStatsdConfigVerify(t *testing.T) {
+	var (
+		testCases []struct {
+			name       string
+			cfg        StatsdConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        StatsdConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        StatsdConfig
+		wantSubstr string
+	}{
+		{name: "empty", cfg: StatsdConfig{}, wantSubstr: ""},
+		{name: "plain-udp", cfg: StatsdConfig{Address: "127.0.0.1:8125"}, wantSubstr: ""},
+		{name: "udp-scheme", cfg: StatsdConfig{Address: "udp://statsd:8125"}, wantSubstr: ""},
+		{name: "uds", cfg: StatsdConfig{Address: "unix:///var/run/datadog/dsd.socket"}, wantSubstr: ""},
+		{name: "uds-relative", cfg: StatsdConfig{Address: "unix://dsd.socket"}, wantSubstr: "must be absolute"},
+		{name: "tcp-scheme", cfg: StatsdConfig{Address: "tcp://statsd:8125"}, wantSubstr: "invalid statsd address"},
+		{name: "missing-port", cfg: StatsdConfig{Address: "statsd"}, wantSubstr: "invalid statsd address"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestStatsdConfigClientOptions(t *testing.T) {
+	var (
+		cfg  StatsdConfig
+		opts StatsdClientOptions
+	)
+
+	cfg = StatsdConfig{Address: "unix:///tmp/dsd.sock", Prefix: "app.", Tags: map[string]string{"env": "prod", "az": "b"}}
+	opts = cfg.ClientOptions()
+	if opts.Network != "unixgram" || opts.Address != "/tmp/dsd.sock" {
+		t.Fatalf("unexpected network/address: %q %q", opts.Network, opts.Address)
+	}
+	if len(opts.Tags) != 2 || opts.Tags[0] != "az:b" || opts.Tags[1] != "env:prod" {
+		t.Fatalf("unexpected tags: %#v", opts.Tags)
+	}
+	if opts.SampleRate != 1 {
+		t.Fatalf("expected default sample rate of 1, got %g", opts.SampleRate)
+	}
+}
+
+func TestDebugConfigVerify(t *testing.T) {
+	var (
+		cfg      DebugConfig
+		warnings []string
+		err      error
+	)
+
+	captureWarnings(t, &warnings)
+
+	cfg = DebugConfig{Enabled: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.BindAddr != "localhost:6060" {
+		t.Fatalf("unexpected default bindaddr: %q", cfg.BindAddr)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %#v", warnings)
+	}
+
+	cfg = DebugConfig{Enabled: true, BindAddr: "0.0.0.0:6060"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "without an authtoken") {
+		t.Fatalf("expected open bind warning, got %#v", warnings)
+	}
+
+	cfg = DebugConfig{Enabled: true, BindAddr: "6060"}
+	err = cfg.Verify()
+	checkError(t, err, "invalid debug bindaddr")
+}
+
+func TestDebugConfigHandler(t *testing.T) {
+	var (
+		cfg DebugConfig
+		req *http.Request
+		rec *httptest.ResponseRecorder
+	)
+
+	cfg = DebugConfig{}
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when disabled, got %d", rec.Code)
+	}
+
+	cfg = DebugConfig{Enabled: true, AuthToken: "tok"}
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+	req.Header.Set("Authorization", "tok")
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a token without the Bearer scheme, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Fatalf("expected goroutine profile, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/symbol", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "num_symbols:") {
+		t.Fatalf("expected symbol lookup, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHealthConfigHandlers(t *testing.T) {
+	var (
+		cfg    HealthConfig
+		health *Health
+		mux    *http.ServeMux
+		rec    *httptest.ResponseRecorder
+		dbErr  error
+		err    error
+	)
+
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.LivenessPath != "/healthz" || cfg.ReadinessPath != "/readyz" {
+		t.Fatalf("unexpected default paths: %q %q", cfg.LivenessPath, cfg.ReadinessPath)
+	}
+
+	health = cfg.NewHealth()
+	health.AddReadinessCheck("db", func(ctx context.Context) error {
+		return dbErr
+	})
+	mux = http.NewServeMux()
+	health.Register(mux)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected ready, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	dbErr = errors.New("connection refused")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "connection refused") {
+		t.Fatalf("expected not ready, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected alive, got %d", rec.Code)
+	}
+
+	dbErr = nil
+	health.Shutdown(context.Background())
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready after shutdown, got %d", rec.Code)
+	}
+}
+
+func TestGRPCConfigVerify(t *testing.T) {
+	var (
+		testCases []struct {
+			name       string
+			cfg        GRPCConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        GRPCConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        GRPCConfig
+		wantSubstr string
+	}{
+		{name: "valid", cfg: GRPCConfig{BindAddr: ":50051"}, wantSubstr: ""},
+		{name: "missing-bindaddr", cfg: GRPCConfig{}, wantSubstr: "missing grpc bindaddr"},
+		{name: "bad-bindaddr", cfg: GRPCConfig{BindAddr: "50051"}, wantSubstr: "invalid grpc bindaddr"},
+		{name: "partial-cert", cfg: GRPCConfig{BindAddr: ":50051", StaticCert: HTTPStaticCertConfig{SSLCertFile: "c.pem"}}, wantSubstr: "requires both"},
+		{name: "cert-and-http", cfg: GRPCConfig{BindAddr: ":50051", UseHTTPCertificates: true, StaticCert: HTTPStaticCertConfig{SSLCertFile: "c.pem", SSLPrivateKeyFile: "k.pem"}}, wantSubstr: "mutually exclusive"},
+		{name: "negative-size", cfg: GRPCConfig{BindAddr: ":50051", MaxRecvMsgSize: -1}, wantSubstr: "cannot be negative"},
+		{name: "short-keepalive", cfg: GRPCConfig{BindAddr: ":50051", Keepalive: GRPCKeepaliveConfig{Time: time.Millisecond}}, wantSubstr: "at least 1s"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestGRPCConfigNewServer(t *testing.T) {
+	var (
+		cfg   GRPCConfig
+		opts  []grpc.ServerOption
+		srv   *grpc.Server
+		lis   *bufconn.Listener
+		conn  *grpc.ClientConn
+		desc  grpc.ServiceDesc
+		found bool
+		err   error
+	)
+
+	cfg = GRPCConfig{BindAddr: ":50051", MaxRecvMsgSize: 1 << 20, Keepalive: GRPCKeepaliveConfig{Time: time.Minute}}
+	opts, err = cfg.NewServerOptions()
+	checkError(t, err, "")
+	if len(opts) != 4 {
+		t.Errorf("expected 4 server options, got %d", len(opts))
+	}
+
+	cfg.Interceptors.Metrics = true
+	_, err = cfg.NewServerOptions()
+	checkError(t, err, "grpc interceptor \"metrics\" is enabled but not registered in serverconfig.GRPCInterceptorOptions")
+	_, err = cfg.NewServer()
+	checkError(t, err, "not registered")
+
+	cfg.Interceptors = GRPCInterceptors{Logging: true, Recovery: true}
+	opts, err = cfg.NewServerOptions()
+	checkError(t, err, "")
+	if len(opts) != 8 {
+		t.Errorf("expected 8 server options with logging and recovery, got %d", len(opts))
+	}
+
+	cfg.Interceptors = GRPCInterceptors{Recovery: true}
+	cfg.Reflection = true
+	srv, err = cfg.NewServer()
+	checkError(t, err, "")
+	_, found = srv.GetServiceInfo()["grpc.reflection.v1.ServerReflection"]
+	if !found {
+		t.Errorf("expected the reflection service to be registered, got %v", srv.GetServiceInfo())
+	}
+
+	desc = grpc.ServiceDesc{
+		ServiceName: "test.Panic",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Panic",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				var in emptypb.Empty
+
+				if dec(&in) != nil {
+					return nil, status.Error(codes.InvalidArgument, "bad request")
+				}
+				return interceptor(ctx, &in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Panic/Panic"}, func(context.Context, any) (any, error) {
+					panic("boom")
+				})
+			},
+		}},
+	}
+	srv.RegisterService(&desc, struct{}{})
+	lis = bufconn.Listen(1 << 16)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err = grpc.NewClient("passthrough:///bufconn", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	checkError(t, err, "")
+	defer conn.Close()
+	err = conn.Invoke(t.Context(), "/test.Panic/Panic", &emptypb.Empty{}, &emptypb.Empty{})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected a panic to be returned as Internal, got %v", err)
+	}
+}
+
+func TestGRPCClientConfigVerify(t *testing.T) {
+	var (
+		testCases []struct {
+			name       string
+			cfg        GRPCClientConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        GRPCClientConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        GRPCClientConfig
+		wantSubstr string
+	}{
+		{name: "host-port", cfg: GRPCClientConfig{Target: "billing:50051"}, wantSubstr: ""},
+		{name: "dns", cfg: GRPCClientConfig{Target: "dns:///billing.internal:50051"}, wantSubstr: ""},
+		{name: "unix", cfg: GRPCClientConfig{Target: "unix:///run/billing.sock"}, wantSubstr: ""},
+		{name: "missing-target", cfg: GRPCClientConfig{}, wantSubstr: "missing grpc client target"},
+		{name: "bad-host-port", cfg: GRPCClientConfig{Target: "billing"}, wantSubstr: "invalid grpc client target"},
+		{name: "unknown-scheme", cfg: GRPCClientConfig{Target: "consul:///billing"}, wantSubstr: "unknown scheme"},
+		{name: "cafile-without-tls", cfg: GRPCClientConfig{Target: "billing:50051", CAFile: "ca.pem"}, wantSubstr: "tls is not enabled"},
+		{name: "retry-missing-backoff", cfg: GRPCClientConfig{Target: "billing:50051", Retry: GRPCClientRetryPolicy{MaxAttempts: 3}}, wantSubstr: "requires initialbackoff"},
+		{name: "retry-too-many", cfg: GRPCClientConfig{Target: "billing:50051", Retry: GRPCClientRetryPolicy{MaxAttempts: 9}}, wantSubstr: "cannot exceed 5"},
+		{name: "retry-bad-code", cfg: GRPCClientConfig{Target: "billing:50051", Retry: GRPCClientRetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second,
+			RetryableStatusCodes: []string{"UNAVAILBLE"}}}, wantSubstr: "invalid grpc client retry retryablestatuscodes entry \"UNAVAILBLE\""},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+
+	tc.cfg = GRPCClientConfig{Target: "billing:50051", Retry: GRPCClientRetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second,
+		RetryableStatusCodes: []string{"unavailable", " Resource_Exhausted"}}}
+	err = tc.cfg.Verify()
+	checkError(t, err, "")
+	if tc.cfg.Retry.RetryableStatusCodes[0] != "UNAVAILABLE" || tc.cfg.Retry.RetryableStatusCodes[1] != "RESOURCE_EXHAUSTED" {
+		t.Errorf("expected upper-cased status codes, got %v", tc.cfg.Retry.RetryableStatusCodes)
+	}
+}
+
+func TestReadVerifiesMapValues(t *testing.T) {
+	var (
+		yamlBody string
+		path     string
+		cfg      struct {
+			Clients GRPCClients `yaml:"grpcclients"`
+		}
+		err error
+	)
+
+	yamlBody = "grpcclients:\n  billing:\n    target: billing:50051\n  inventory:\n    target: inventory:50051\n    timeout: 3s\n"
+	path = writeTempConfig(t, yamlBody)
+
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Clients["billing"].Timeout != 10*time.Second {
+		t.Fatalf("expected default timeout to be stored back into map, got %s", cfg.Clients["billing"].Timeout)
+	}
+	if cfg.Clients["inventory"].Timeout != 3*time.Second {
+		t.Fatalf("unexpected inventory timeout: %s", cfg.Clients["inventory"].Timeout)
+	}
+
+	yamlBody = "grpcclients:\n  billing:\n    target: billing\n"
+	path = writeTempConfig(t, yamlBody)
+
+	err = Read(path, &cfg)
+	checkError(t, err, "Clients[billing]")
+}
+
+func TestObjectStoreConfigVerify(t *testing.T) {
+	var (
+		testCases []struct {
+			name       string
+			cfg        ObjectStoreConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        ObjectStoreConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        ObjectStoreConfig
+		wantSubstr string
+	}{
+		{name: "default-creds", cfg: ObjectStoreConfig{Bucket: "my-uploads"}, wantSubstr: ""},
+		{name: "minio", cfg: ObjectStoreConfig{Endpoint: "http://minio:9000", Bucket: "uploads", AccessKey: "a", SecretKey: "s", PathStyle: true}, wantSubstr: ""},
+		{name: "missing-bucket", cfg: ObjectStoreConfig{}, wantSubstr: "missing object store bucket"},
+		{name: "uppercase-bucket", cfg: ObjectStoreConfig{Bucket: "Uploads"}, wantSubstr: "invalid bucket name"},
+		{name: "short-bucket", cfg: ObjectStoreConfig{Bucket: "ab"}, wantSubstr: "invalid bucket name"},
+		{name: "double-dot-bucket", cfg: ObjectStoreConfig{Bucket: "my..bucket"}, wantSubstr: "adjacent periods"},
+		{name: "ip-bucket", cfg: ObjectStoreConfig{Bucket: "192.168.1.1"}, wantSubstr: "IP address"},
+		{name: "bad-endpoint", cfg: ObjectStoreConfig{Bucket: "uploads", Endpoint: "minio:9000"}, wantSubstr: "invalid object store endpoint"},
+		{name: "missing-secret", cfg: ObjectStoreConfig{Bucket: "uploads", AccessKey: "a"}, wantSubstr: "without secretkey"},
+		{name: "missing-access", cfg: ObjectStoreConfig{Bucket: "uploads", SecretKey: "s"}, wantSubstr: "without accesskey"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestGCSConfigVerify(t *testing.T) {
+	var (
+		credsFile string
+		testCases []struct {
+			name       string
+			cfg        GCSConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        GCSConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	credsFile = writeTempConfig(t, "{}")
+	testCases = []struct {
+		name       string
+		cfg        GCSConfig
+		wantSubstr string
+	}{
+		{name: "adc", cfg: GCSConfig{Bucket: "acme_uploads"}, wantSubstr: ""},
+		{name: "creds-file", cfg: GCSConfig{Bucket: "acme-uploads", CredentialsFile: credsFile}, wantSubstr: ""},
+		{name: "missing-bucket", cfg: GCSConfig{}, wantSubstr: "missing GCS bucket"},
+		{name: "bad-bucket", cfg: GCSConfig{Bucket: "google-stuff"}, wantSubstr: "invalid GCS bucket name"},
+		{name: "missing-creds", cfg: GCSConfig{Bucket: "acme-uploads", CredentialsFile: filepath.Join(t.TempDir(), "nope.json")}, wantSubstr: "GCS credentialsfile"},
+		{name: "creds-dir", cfg: GCSConfig{Bucket: "acme-uploads", CredentialsFile: t.TempDir()}, wantSubstr: "is a directory"},
+		{name: "ttl-too-long", cfg: GCSConfig{Bucket: "acme-uploads", SignedURLTTL: 8 * 24 * time.Hour}, wantSubstr: "between 0 and 7 days"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestAzureBlobConfigVerify(t *testing.T) {
+	var (
+		cfg       AzureBlobConfig
+		testCases []struct {
+			name       string
+			cfg        AzureBlobConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        AzureBlobConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        AzureBlobConfig
+		wantSubstr string
+	}{
+		{name: "managed-identity", cfg: AzureBlobConfig{Account: "acmeuploads", Container: "uploads"}, wantSubstr: ""},
+		{name: "account-key", cfg: AzureBlobConfig{Account: "acmeuploads", Container: "uploads", AccountKey: "c2VjcmV0"}, wantSubstr: ""},
+		{name: "missing-account", cfg: AzureBlobConfig{Container: "uploads"}, wantSubstr: "missing Azure storage account"},
+		{name: "bad-account", cfg: AzureBlobConfig{Account: "Acme-Uploads", Container: "uploads"}, wantSubstr: "invalid Azure storage account"},
+		{name: "missing-container", cfg: AzureBlobConfig{Account: "acmeuploads"}, wantSubstr: "missing Azure storage container"},
+		{name: "bad-container", cfg: AzureBlobConfig{Account: "acmeuploads", Container: "up--loads"}, wantSubstr: "invalid Azure container name"},
+		{name: "sas-and-key", cfg: AzureBlobConfig{Account: "acmeuploads", Container: "uploads", SASToken: "sv=1", AccountKey: "c2VjcmV0"}, wantSubstr: "only one of"},
+		{name: "bad-key", cfg: AzureBlobConfig{Account: "acmeuploads", Container: "uploads", AccountKey: "not base64!"}, wantSubstr: "invalid Azure accountkey"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+
+	cfg = AzureBlobConfig{Account: "acmeuploads", Container: "uploads", SASToken: "?sv=2022&sig=x"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.ServiceURL() != "https://acmeuploads.blob.core.windows.net/?sv=2022&sig=x" {
+		t.Fatalf("unexpected service URL: %q", cfg.ServiceURL())
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	var (
+		testCases []struct {
+			in   string
+			want ByteSize
+		}
+		i   int
+		got ByteSize
+		err error
+	)
+
+	testCases = []struct {
+		in   string
+		want ByteSize
+	}{
+		{in: "512", want: 512},
+		{in: "100MB", want: 100000000},
+		{in: "100 mb", want: 100000000},
+		{in: "1.5GiB", want: 1610612736},
+		{in: "64k", want: 65536},
+		{in: "2T", want: 2 << 40},
+		{in: "8388607TiB", want: 8388607 << 40},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		got, err = ParseByteSize(testCases[i].in)
+		if !errors.Is(err, nil) {
+			t.Fatalf("ParseByteSize(%q) returned error: %v", testCases[i].in, err)
+		}
+		if got != testCases[i].want {
+			t.Fatalf("ParseByteSize(%q) = %d, want %d", testCases[i].in, got, testCases[i].want)
+		}
+	}
+
+	_, err = ParseByteSize("12 parsecs")
+	checkError(t, err, "invalid size unit")
+	_, err = ParseByteSize("MB")
+	checkError(t, err, "invalid size")
+	_, err = ParseByteSize("8388608TiB")
+	checkError(t, err, "is too large")
+
+	if ByteSize(3<<20).String() != "3MiB" || ByteSize(1500).String() != "1500B" {
+		t.Fatalf("unexpected String(): %s %s", ByteSize(3<<20), ByteSize(1500))
+	}
+}
+
+func TestFileStorageConfigVerify(t *testing.T) {
+	var (
+		root     string
+		yamlBody string
+		path     string
+		cfg      struct {
+			Files FileStorageConfig `yaml:"files"`
+		}
+		bad FileStorageConfig
+		err error
+	)
+
+	root = t.TempDir()
+	yamlBody = "files:\n  root: " + root + "\n  maxuploadsize: 25MB\n  allowedextensions: [JPG, .png]\n"
+	path = writeTempConfig(t, yamlBody)
+	t.Setenv("FILESTORAGEROOT", root)
+
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Files.MaxUploadSize != 25000000 {
+		t.Fatalf("unexpected maxuploadsize: %d", cfg.Files.MaxUploadSize)
+	}
+	if cfg.Files.FileMode() != 0o640 {
+		t.Fatalf("unexpected default file mode: %o", cfg.Files.FileMode())
+	}
+	if !cfg.Files.ExtensionAllowed("photo.JPG") || cfg.Files.ExtensionAllowed("script.sh") {
+		t.Fatalf("unexpected extension matching with %#v", cfg.Files.AllowedExtensions)
+	}
+
+	bad = FileStorageConfig{Root: filepath.Join(root, "missing")}
+	err = bad.Verify()
+	checkError(t, err, "file storage root")
+
+	bad = FileStorageConfig{Root: path}
+	err = bad.Verify()
+	checkError(t, err, "is not a directory")
+
+	bad = FileStorageConfig{Root: root, Permissions: "rw-r-----"}
+	err = bad.Verify()
+	checkError(t, err, "invalid file storage permissions")
+}
+
+func TestSMTPConfigVerify(t *testing.T) {
+	var (
+		cfg       SMTPConfig
+		testCases []struct {
+			name       string
+			cfg        SMTPConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        SMTPConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        SMTPConfig
+		wantSubstr string
+	}{
+		{name: "valid", cfg: SMTPConfig{Server: "smtp.local", From: "Acme <noreply@example.com>"}, wantSubstr: ""},
+		{name: "missing-server", cfg: SMTPConfig{From: "noreply@example.com"}, wantSubstr: "missing SMTP server"},
+		{name: "server-with-port", cfg: SMTPConfig{Server: "smtp.local:25", From: "noreply@example.com"}, wantSubstr: "should not include a port"},
+		{name: "bad-tlsmode", cfg: SMTPConfig{Server: "smtp.local", From: "noreply@example.com", TLSMode: "ssl"}, wantSubstr: "invalid SMTP tlsmode"},
+		{name: "bad-port", cfg: SMTPConfig{Server: "smtp.local", From: "noreply@example.com", Port: 70000}, wantSubstr: "invalid SMTP port"},
+		{name: "missing-from", cfg: SMTPConfig{Server: "smtp.local"}, wantSubstr: "missing SMTP from"},
+		{name: "bad-from", cfg: SMTPConfig{Server: "smtp.local", From: "noreply-at-example.com"}, wantSubstr: "invalid SMTP from address"},
+		{name: "bad-auth", cfg: SMTPConfig{Server: "smtp.local", From: "noreply@example.com", User: "u", Password: "p", AuthMechanism: "xoauth2"}, wantSubstr: "invalid SMTP authmechanism"},
+		{name: "auth-missing-password", cfg: SMTPConfig{Server: "smtp.local", From: "noreply@example.com", User: "u"}, wantSubstr: "requires user and password"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+
+	cfg = SMTPConfig{Server: "smtp.local", From: "noreply@example.com", TLSMode: "Implicit", User: "u", Password: "p"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Port != 465 || cfg.AuthMechanism != "plain" || cfg.Timeout != 30*time.Second {
+		t.Fatalf("unexpected defaults: port=%d auth=%q timeout=%s", cfg.Port, cfg.AuthMechanism, cfg.Timeout)
+	}
+}
+
+func TestSMTPConfigTestConnection(t *testing.T) {
+	var (
+		port int
+		cfg  SMTPConfig
+		err  error
+	)
+
+	port = startFakeSMTPServer(t, "secret")
+
+	cfg = SMTPConfig{Server: "127.0.0.1", Port: port, From: "noreply@example.com", TLSMode: "none", User: "u", Password: "secret", Timeout: 5 * time.Second}
+	captureWarnings(t, new([]string))
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	err = cfg.TestConnection(context.Background())
+	if !errors.Is(err, nil) {
+		t.Fatalf("TestConnection returned error: %v", err)
+	}
+
+	cfg.AuthMechanism = "login"
+	err = cfg.TestConnection(context.Background())
+	if !errors.Is(err, nil) {
+		t.Fatalf("TestConnection with LOGIN returned error: %v", err)
+	}
+
+	cfg.AuthMechanism = "plain"
+	cfg.Password = "wrong"
+	cfg.VerifyConnection = true
+	err = cfg.Verify()
+	checkError(t, err, "authentication failed")
+}
+
+func TestEmailConfigVerify(t *testing.T) {
+	var (
+		yamlBody  string
+		path      string
+		readCfg   struct{ Email EmailConfig }
+		testCases []struct {
+			name       string
+			cfg        EmailConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        EmailConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        EmailConfig
+		wantSubstr string
+	}{
+		{name: "sendgrid", cfg: EmailConfig{Provider: "SendGrid", From: "noreply@acme.com", SendGrid: &EmailSendGridConfig{APIKey: "SG.x"}}, wantSubstr: ""},
+		{name: "ses-default-creds", cfg: EmailConfig{Provider: "ses", From: "noreply@acme.com", SES: &EmailSESConfig{Region: "us-west-2"}}, wantSubstr: ""},
+		{name: "missing-from", cfg: EmailConfig{Provider: "sendgrid"}, wantSubstr: "missing email from"},
+		{name: "bad-replyto", cfg: EmailConfig{Provider: "sendgrid", From: "noreply@acme.com", ReplyTo: "support"}, wantSubstr: "invalid email replyto"},
+		{name: "missing-provider", cfg: EmailConfig{From: "noreply@acme.com"}, wantSubstr: "missing email provider"},
+		{name: "unknown-provider", cfg: EmailConfig{Provider: "postmark", From: "noreply@acme.com"}, wantSubstr: "invalid email provider"},
+		{name: "smtp-missing-section", cfg: EmailConfig{Provider: "smtp", From: "noreply@acme.com"}, wantSubstr: "email.smtp section is missing"},
+		{name: "sendgrid-missing-key", cfg: EmailConfig{Provider: "sendgrid", From: "noreply@acme.com", SendGrid: &EmailSendGridConfig{}}, wantSubstr: "SENDGRID_API_KEY"},
+		{name: "mailgun-bad-region", cfg: EmailConfig{Provider: "mailgun", From: "noreply@acme.com", Mailgun: &EmailMailgunConfig{Domain: "mg.acme.com", APIKey: "k", Region: "ap"}}, wantSubstr: "invalid email mailgun region"},
+		{name: "ses-partial-creds", cfg: EmailConfig{Provider: "ses", From: "noreply@acme.com", SES: &EmailSESConfig{Region: "us-west-2", AccessKey: "a"}}, wantSubstr: "both accesskey and secretkey"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+
+	yamlBody = "email:\n  provider: smtp\n  from: noreply@acme.com\n  smtp:\n    server: smtp.acme.com\n"
+	path = writeTempConfig(t, yamlBody)
+	err = Read(path, &readCfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if readCfg.Email.SMTP.From != "noreply@acme.com" || readCfg.Email.SMTP.Port != 587 {
+		t.Fatalf("expected smtp section to inherit from and be verified, got %#v", readCfg.Email.SMTP)
+	}
+}
+
+func TestDKIMConfigVerify(t *testing.T) {
+	var (
+		keyPEM  string
+		keyFile string
+		cfg     DKIMConfig
+		err     error
+	)
+
+	keyPEM = generateEd25519PEM(t)
+	keyFile = writeTempConfig(t, keyPEM)
+
+	cfg = DKIMConfig{Domain: "acme.com", Selector: "mail2024", PrivateKeyFile: keyFile}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Signer() == nil {
+		t.Fatalf("expected signer to be loaded")
+	}
+
+	t.Setenv("DKIMPRIVATEKEY", keyPEM)
+	cfg = DKIMConfig{Domain: "acme.com", Selector: "mail2024"}
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify with key from env returned error: %v", err)
+	}
+
+	cfg = DKIMConfig{Domain: "acme..com", Selector: "s", PrivateKey: keyPEM}
+	checkError(t, cfg.Verify(), "DKIM domain")
+
+	cfg = DKIMConfig{Domain: "acme.com", Selector: "s"}
+	checkError(t, cfg.Verify(), "missing DKIM privatekeyfile")
+
+	cfg = DKIMConfig{Domain: "acme.com", Selector: "s", PrivateKey: "not a key"}
+	checkError(t, cfg.Verify(), "no PEM data")
+}
+
+func TestSMSConfigVerify(t *testing.T) {
+	var (
+		sid       string
+		testCases []struct {
+			name       string
+			cfg        SMSConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        SMSConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	sid = "AC" + strings.Repeat("0a", 16)
+	testCases = []struct {
+		name       string
+		cfg        SMSConfig
+		wantSubstr string
+	}{
+		{name: "from-number", cfg: SMSConfig{AccountSID: sid, AuthToken: "t", FromNumber: "+14155550100"}, wantSubstr: ""},
+		{name: "messaging-service", cfg: SMSConfig{AccountSID: sid, AuthToken: "t", MessagingServiceSID: "MG" + strings.Repeat("f", 32)}, wantSubstr: ""},
+		{name: "bad-provider", cfg: SMSConfig{Provider: "nexmo"}, wantSubstr: "invalid sms provider"},
+		{name: "missing-sid", cfg: SMSConfig{AuthToken: "t", FromNumber: "+14155550100"}, wantSubstr: "missing sms accountsid"},
+		{name: "bad-sid", cfg: SMSConfig{AccountSID: "AC123", AuthToken: "t", FromNumber: "+14155550100"}, wantSubstr: "invalid sms accountsid"},
+		{name: "missing-token", cfg: SMSConfig{AccountSID: sid, FromNumber: "+14155550100"}, wantSubstr: "TWILIO_AUTH_TOKEN"},
+		{name: "missing-sender", cfg: SMSConfig{AccountSID: sid, AuthToken: "t"}, wantSubstr: "either fromnumber or messagingservicesid"},
+		{name: "not-e164", cfg: SMSConfig{AccountSID: sid, AuthToken: "t", FromNumber: "(415) 555-0100"}, wantSubstr: "E.164"},
+		{name: "leading-zero", cfg: SMSConfig{AccountSID: sid, AuthToken: "t", FromNumber: "+04155550100"}, wantSubstr: "E.164"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestNotifyConfigVerify(t *testing.T) {
+	var (
+		yamlBody string
+		path     string
+		cfg      struct {
+			Notify NotifyConfig `yaml:"notify"`
+		}
+		channel NotifyChannel
+		err     error
+	)
+
+	yamlBody = "notify:\n  defaultchannel: ops\n  channels:\n    ops:\n      webhookurlenv: TEST_OPS_WEBHOOK\n    releases:\n      webhookurl: https://discord.com/api/webhooks/1/abc\n"
+	path = writeTempConfig(t, yamlBody)
+	t.Setenv("TEST_OPS_WEBHOOK", "https://hooks.slack.com/services/T0/B0/xyz")
+
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Notify.Channels["ops"].Type != "slack" || cfg.Notify.Channels["ops"].WebhookURL != "https://hooks.slack.com/services/T0/B0/xyz" {
+		t.Fatalf("unexpected ops channel: %#v", cfg.Notify.Channels["ops"])
+	}
+	if cfg.Notify.Channels["releases"].Type != "discord" || cfg.Notify.RateLimit != 20 {
+		t.Fatalf("unexpected defaults: %#v", cfg.Notify)
+	}
+
+	cfg.Notify.DefaultChannel = "alerts"
+	checkError(t, cfg.Notify.Verify(), "not one of the configured channels")
+
+	channel = NotifyChannel{WebhookURL: "http://hooks.slack.com/services/x"}
+	checkError(t, channel.Verify(), "unsupported scheme")
+
+	channel = NotifyChannel{WebhookURL: "https://example.com/hook"}
+	checkError(t, channel.Verify(), "unable to infer channel type")
+
+	channel = NotifyChannel{WebhookURL: "https://notdiscord.com/api/webhooks/1/abc"}
+	checkError(t, channel.Verify(), "unable to infer channel type from notdiscord.com")
+
+	channel = NotifyChannel{WebhookURL: "https://canary.discordapp.com/api/webhooks/1/abc"}
+	if channel.Verify() != nil || channel.Type != "discord" {
+		t.Fatalf("expected a discordapp.com subdomain to be discord, got %q", channel.Type)
+	}
+
+	channel = NotifyChannel{WebhookURLEnv: "TEST_UNSET_WEBHOOK"}
+	checkError(t, channel.Verify(), "TEST_UNSET_WEBHOOK is not set")
+}
+
+func TestRetryConfigBackoff(t *testing.T) {
+	var (
+		cfg RetryConfig
+		err error
+	)
+
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.MaxAttempts != 3 || cfg.Backoff(1) != 500*time.Millisecond || cfg.Backoff(3) != 2*time.Second {
+		t.Fatalf("unexpected defaults: %#v backoff(3)=%s", cfg, cfg.Backoff(3))
+	}
+	if cfg.Backoff(20) != 30*time.Second {
+		t.Fatalf("expected backoff to be capped, got %s", cfg.Backoff(20))
+	}
+
+	cfg = RetryConfig{InitialBackoff: time.Minute, MaxBackoff: time.Second}
+	checkError(t, cfg.Verify(), "less than initialbackoff")
+}
+
+func TestWebhookConfigVerify(t *testing.T) {
+	var (
+		cfg       WebhookConfig
+		testCases []struct {
+			name       string
+			cfg        WebhookConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        WebhookConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        WebhookConfig
+		wantSubstr string
+	}{
+		{name: "valid", cfg: WebhookConfig{URL: "https://example.com/hook"}, wantSubstr: ""},
+		{name: "missing-url", cfg: WebhookConfig{}, wantSubstr: "missing webhook url"},
+		{name: "bad-scheme", cfg: WebhookConfig{URL: "ftp://example.com/hook"}, wantSubstr: "unsupported scheme"},
+		{name: "signing-without-secret", cfg: WebhookConfig{URL: "https://example.com/hook", Signing: true}, wantSubstr: "signingsecret is missing"},
+		{name: "short-secret", cfg: WebhookConfig{URL: "https://example.com/hook", Signing: true, SigningSecret: "abc"}, wantSubstr: "at least 16"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+
+	cfg = WebhookConfig{SigningSecret: "0123456789abcdef"}
+	if cfg.Sign([]byte("{}"), time.Unix(1700000000, 0)) != "t=1700000000,v1=e4f8e2ecae2295b2ddb2f0b5584c8275e226c0ebe9b3b819e70156bb67122e3e" {
+		t.Fatalf("unexpected signature: %s", cfg.Sign([]byte("{}"), time.Unix(1700000000, 0)))
+	}
+}
+
+func TestAlertingConfigVerify(t *testing.T) {
+	var (
+		pdKey     string
+		ogKey     string
+		testCases []struct {
+			name       string
+			cfg        AlertingConfig
+			wantSubstr string
+		}
+		i  int
+		tc struct {
+			name       string
+			cfg        AlertingConfig
+			wantSubstr string
+		}
+		err error
+	)
+
+	pdKey = strings.Repeat("a1", 16)
+	ogKey = "3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+	testCases = []struct {
+		name       string
+		cfg        AlertingConfig
+		wantSubstr string
+	}{
+		{name: "pagerduty", cfg: AlertingConfig{Provider: "PagerDuty", Key: pdKey, SeverityMap: map[string]string{"LOG_CRIT": "critical"}}, wantSubstr: ""},
+		{name: "opsgenie", cfg: AlertingConfig{Provider: "opsgenie", Key: ogKey, Region: "EU", SeverityMap: map[string]string{"LOG_CRIT": "P1"}}, wantSubstr: ""},
+		{name: "bad-provider", cfg: AlertingConfig{Provider: "victorops", Key: pdKey}, wantSubstr: "invalid alerting provider"},
+		{name: "missing-key", cfg: AlertingConfig{Provider: "pagerduty"}, wantSubstr: "missing alerting key"},
+		{name: "bad-pd-key", cfg: AlertingConfig{Provider: "pagerduty", Key: "short"}, wantSubstr: "invalid pagerduty integration key"},
+		{name: "bad-og-key", cfg: AlertingConfig{Provider: "opsgenie", Key: pdKey}, wantSubstr: "invalid opsgenie api key"},
+		{name: "bad-og-region", cfg: AlertingConfig{Provider: "opsgenie", Key: ogKey, Region: "apac"}, wantSubstr: "invalid opsgenie region"},
+		{name: "bad-severity", cfg: AlertingConfig{Provider: "pagerduty", Key: pdKey, SeverityMap: map[string]string{"LOG_CRIT": "P1"}}, wantSubstr: "invalid pagerduty severity"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		tc = testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err = tc.cfg.Verify()
+			checkError(t, err, tc.wantSubstr)
+		})
+	}
+}
+
+func TestValidateLDAPFilter(t *testing.T) {
+	var (
+		valid   []string
+		invalid []string
+		i       int
+	)
+
+	valid = []string{
+		"(uid=jdoe)",
+		"(&(objectClass=user)(sAMAccountName=jdoe))",
+		"(|(cn=a*)(!(cn=b)))",
+		"(createTimestamp>=20240101000000Z)",
+	}
+	invalid = []string{
+		"uid=jdoe",
+		"(uid=jdoe",
+		"(&)",
+		"(!(a=1)(b=2))",
+		"(=jdoe)",
+		"(uid=jdoe))",
+		"(uid=(jdoe))",
+	}
+
+	for i = 0; i < len(valid); i++ {
+		if !errors.Is(validateLDAPFilter(valid[i]), nil) {
+			t.Fatalf("expected %q to be valid: %v", valid[i], validateLDAPFilter(valid[i]))
+		}
+	}
+	for i = 0; i < len(invalid); i++ {
+		if errors.Is(validateLDAPFilter(invalid[i]), nil) {
+			t.Fatalf("expected %q to be invalid", invalid[i])
+		}
+	}
+}
+
+func TestLDAPConfigVerify(t *testing.T) {
+	var (
+		base      LDAPConfig
+		testCases []struct {
+			name       string
+			modify     func(cfg *LDAPConfig)
+			wantSubstr string
+		}
+		i      int
+		cfg    LDAPConfig
+		filter string
+		want   string
+		err    error
+	)
+
+	base = LDAPConfig{
+		URL:          "ldaps://dc1.corp.example.com:636",
+		BindDN:       "CN=svc-app,OU=Service Accounts,DC=corp,DC=example,DC=com",
+		BindPassword: "secret",
+		BaseDN:       "DC=corp,DC=example,DC=com",
+		UserFilter:   "(&(objectClass=user)(sAMAccountName=%s))",
+	}
+	testCases = []struct {
+		name       string
+		modify     func(cfg *LDAPConfig)
+		wantSubstr string
+	}{
+		{name: "valid", modify: func(cfg *LDAPConfig) {}, wantSubstr: ""},
+		{name: "bad-scheme", modify: func(cfg *LDAPConfig) { cfg.URL = "https://dc1" }, wantSubstr: "unsupported scheme"},
+		{name: "ldaps-starttls", modify: func(cfg *LDAPConfig) { cfg.StartTLS = true }, wantSubstr: "cannot be used with an ldaps"},
+		{name: "bad-binddn", modify: func(cfg *LDAPConfig) { cfg.BindDN = "svc-app" }, wantSubstr: "invalid LDAP binddn"},
+		{name: "missing-password", modify: func(cfg *LDAPConfig) { cfg.BindPassword = "" }, wantSubstr: "LDAPBINDPASS"},
+		{name: "missing-basedn", modify: func(cfg *LDAPConfig) { cfg.BaseDN = "" }, wantSubstr: "missing LDAP basedn"},
+		{name: "filter-without-placeholder", modify: func(cfg *LDAPConfig) { cfg.UserFilter = "(uid=jdoe)" }, wantSubstr: "must contain %s"},
+		{name: "filter-with-two-placeholders", modify: func(cfg *LDAPConfig) { cfg.UserFilter = "(|(uid=%s)(mail=%s))" }, wantSubstr: ""},
+		{name: "bad-userfilter", modify: func(cfg *LDAPConfig) { cfg.UserFilter = "(uid=%s" }, wantSubstr: "invalid LDAP userfilter"},
+		{name: "bad-groupfilter", modify: func(cfg *LDAPConfig) { cfg.GroupFilter = "member=%s" }, wantSubstr: "invalid LDAP groupfilter"},
+		{name: "missing-cafile", modify: func(cfg *LDAPConfig) { cfg.CAFile = filepath.Join(t.TempDir(), "ca.pem") }, wantSubstr: "unable to read LDAP cafile"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		cfg = base
+		testCases[i].modify(&cfg)
+		err = cfg.Verify()
+		checkError(t, err, testCases[i].wantSubstr)
+	}
+
+	cfg = base
+	cfg.UserFilter = "(|(uid=%s)(mail=%s))"
+	filter = cfg.UserFilterFor("j*)(uid=\\x00é")
+	want = `(|(uid=j\2a\29\28uid=\5cx00\c3\a9)(mail=j\2a\29\28uid=\5cx00\c3\a9))`
+	if filter != want {
+		t.Errorf("unexpected user filter %q, want %q", filter, want)
+	}
+}
+
+func TestOIDCConfigVerify(t *testing.T) {
+	var (
+		server *httptest.Server
+		issuer string
+		cfg    OIDCConfig
+		err    error
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/auth",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/keys",
+		})
+	}))
+	defer server.Close()
+	issuer = server.URL
+
+	cfg = OIDCConfig{
+		IssuerURL:      issuer,
+		ClientID:       "client",
+		ClientSecret:   "secret",
+		RedirectURL:    "https://www.acme.com/auth/callback",
+		AllowedDomains: []string{"@Acme.com"},
+		Discover:       true,
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Metadata() == nil || cfg.Metadata().TokenEndpoint != issuer+"/token" {
+		t.Fatalf("unexpected metadata: %#v", cfg.Metadata())
+	}
+	if len(cfg.Scopes) != 3 || !cfg.DomainAllowed("jdoe@ACME.com") || cfg.DomainAllowed("jdoe@evil.com") {
+		t.Fatalf("unexpected scopes/domains: %#v %#v", cfg.Scopes, cfg.AllowedDomains)
+	}
+
+	cfg.IssuerURL = issuer + "/other"
+	checkError(t, cfg.Verify(), "OIDC discovery failed")
+
+	cfg = OIDCConfig{IssuerURL: "http://accounts.example.com", ClientID: "c", ClientSecret: "s", RedirectURL: "https://acme.com/cb"}
+	checkError(t, cfg.Verify(), "must use https")
+
+	cfg = OIDCConfig{IssuerURL: "https://accounts.example.com", ClientID: "c", ClientSecret: "s", RedirectURL: "https://acme.com/cb", Scopes: []string{"email"}}
+	checkError(t, cfg.Verify(), "must include openid")
+
+	cfg = OIDCConfig{IssuerURL: "https://accounts.example.com", ClientID: "c", RedirectURL: "https://acme.com/cb"}
+	checkError(t, cfg.Verify(), "OIDCCLIENTSECRET")
+}
+
+func TestSAMLConfigVerify(t *testing.T) {
+	var (
+		certFile     string
+		keyFile      string
+		otherKey     string
+		expiredCert  string
+		expiredKey   string
+		metadataFile string
+		cfg          SAMLConfig
+		err          error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"www.acme.com"}, time.Now().Add(365*24*time.Hour))
+	_, otherKey = writeTestCertificate(t, []string{"www.acme.com"}, time.Now().Add(365*24*time.Hour))
+	expiredCert, expiredKey = writeTestCertificate(t, []string{"www.acme.com"}, time.Now().Add(-time.Hour))
+	metadataFile = writeTempConfig(t, `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com"/>`)
+
+	cfg = SAMLConfig{IdPMetadataFile: metadataFile, EntityID: "https://www.acme.com/saml", ACSURL: "https://www.acme.com/saml/acs", CertFile: certFile, KeyFile: keyFile}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.KeyPair().Leaf == nil {
+		t.Fatalf("expected key pair to be loaded")
+	}
+
+	cfg.KeyFile = otherKey
+	checkError(t, cfg.Verify(), "SAML certificate")
+
+	cfg.CertFile, cfg.KeyFile = expiredCert, expiredKey
+	checkError(t, cfg.Verify(), "expired")
+
+	cfg = SAMLConfig{IdPMetadataFile: certFile}
+	checkError(t, cfg.Verify(), "unable to parse SAML idpmetadatafile")
+
+	cfg = SAMLConfig{IdPMetadataURL: "https://idp/md", IdPMetadataFile: metadataFile}
+	checkError(t, cfg.Verify(), "only one of")
+
+	cfg = SAMLConfig{IdPMetadataURL: "https://idp.example.com/md", EntityID: "x", ACSURL: "http://www.acme.com/acs"}
+	checkError(t, cfg.Verify(), "must use https")
+}
+
+func TestJWTConfigVerify(t *testing.T) {
+	var (
+		certFile string
+		keyFile  string
+		edKey    string
+		cfg      JWTConfig
+		err      error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"auth.acme.com"}, time.Now().Add(time.Hour))
+	edKey = writeTempConfig(t, generateEd25519PEM(t))
+
+	cfg = JWTConfig{Algorithm: "hs256", Secret: strings.Repeat("k", 32), PreviousKeys: []JWTPreviousKey{{Secret: strings.Repeat("o", 32)}}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Algorithm != "HS256" || len(cfg.VerificationKeys()) != 2 || cfg.AccessTTL != 15*time.Minute {
+		t.Fatalf("unexpected HMAC config: %#v", cfg)
+	}
+
+	cfg = JWTConfig{Algorithm: "HS512", Secret: strings.Repeat("k", 32)}
+	checkError(t, cfg.Verify(), "at least 64 bytes")
+
+	cfg = JWTConfig{Algorithm: "ES256", PrivateKeyFile: keyFile, PreviousKeys: []JWTPreviousKey{{PublicKeyFile: certFile}}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.SigningKey() == nil || len(cfg.VerificationKeys()) != 2 {
+		t.Fatalf("expected signing key and two verification keys")
+	}
+
+	cfg = JWTConfig{Algorithm: "ES384", PublicKeyFile: certFile}
+	checkError(t, cfg.Verify(), "requires an ECDSA P-384 key")
+
+	cfg = JWTConfig{Algorithm: "RS256", PrivateKeyFile: keyFile}
+	checkError(t, cfg.Verify(), "requires an RSA key")
+
+	cfg = JWTConfig{Algorithm: "EdDSA", PrivateKeyFile: edKey}
+	checkError(t, cfg.Verify(), "")
+
+	cfg = JWTConfig{Algorithm: "none"}
+	checkError(t, cfg.Verify(), "invalid JWT algorithm")
+
+	cfg = JWTConfig{Algorithm: "PS256"}
+	checkError(t, cfg.Verify(), "requires privatekeyfile or publickeyfile")
+
+	cfg = JWTConfig{Algorithm: "XS256", PublicKeyFile: certFile}
+	checkError(t, cfg.Verify(), "invalid JWT algorithm")
+
+	cfg = JWTConfig{Algorithm: "HS256", Secret: strings.Repeat("k", 32), AccessTTL: time.Hour, RefreshTTL: time.Minute}
+	checkError(t, cfg.Verify(), "shorter than accessttl")
+}
+
+func TestAPIAuthConfigVerify(t *testing.T) {
+	var (
+		keysFile string
+		cfg      APIAuthConfig
+		key      *APIKey
+		ok       bool
+		req      *http.Request
+		rec      *httptest.ResponseRecorder
+		err      error
+	)
+
+	// sha256("test") and sha512("other")
+	keysFile = writeTempConfig(t, "# service keys\n\nbilling sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n")
+	cfg = APIAuthConfig{
+		KeysFile:  keysFile,
+		RateLimit: 60,
+		Keys: []APIKey{{
+			Name:      "reports",
+			Hash:      "SHA512:" + fmt.Sprintf("%x", sha512.Sum512([]byte("other"))),
+			RateLimit: 5,
+		}},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if len(cfg.Keys) != 2 || cfg.HeaderName != "X-API-Key" || cfg.Keys[1].RateLimit != 60 {
+		t.Fatalf("unexpected config after Verify: %#v", cfg)
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(cfg.Keys) != 2 {
+		t.Fatalf("expected Verify to be repeatable, got %v with %d keys", err, len(cfg.Keys))
+	}
+
+	key, ok = cfg.Authenticate("test")
+	if !ok || key.Name != "billing" {
+		t.Fatalf("expected billing key to authenticate")
+	}
+	key, ok = cfg.Authenticate("other")
+	if !ok || key.Name != "reports" || key.RateLimit != 5 {
+		t.Fatalf("expected reports key to authenticate")
+	}
+	_, ok = cfg.Authenticate("wrong")
+	if ok {
+		t.Fatalf("expected unknown key to be rejected")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	rec = httptest.NewRecorder()
+	cfg.Handler(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+
+	cfg = APIAuthConfig{Keys: []APIKey{{Name: "a", Hash: "md5:abcd"}}}
+	checkError(t, cfg.Verify(), "unsupported hash algorithm")
+
+	cfg = APIAuthConfig{Keys: []APIKey{{Name: "a", Hash: "sha256:abcd"}}}
+	checkError(t, cfg.Verify(), "must be 64 hex digits")
+
+	cfg = APIAuthConfig{Keys: []APIKey{{Name: "a", Hash: "9f86d081"}}}
+	checkError(t, cfg.Verify(), "must be of the form")
+
+	cfg = APIAuthConfig{}
+	checkError(t, cfg.Verify(), "at least one key")
+}
+
+func TestHTTPCORSConfig(t *testing.T) {
+	var (
+		cfg     HTTPCORSConfig
+		handler http.Handler
+		req     *http.Request
+		rec     *httptest.ResponseRecorder
+		err     error
+	)
+
+	cfg = HTTPCORSConfig{
+		AllowedOrigins:   []string{"https://app.acme.com/", "https://*.acme-preview.com"},
+		AllowedMethods:   []string{"get", "put"},
+		AllowedHeaders:   []string{"Authorization"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	handler = cfg.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req = httptest.NewRequest(http.MethodOptions, "/api", nil)
+	req.Header.Set("Origin", "https://pr-12.acme-preview.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://pr-12.acme-preview.com" ||
+		rec.Header().Get("Access-Control-Max-Age") != "600" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("unexpected preflight response: %d %#v", rec.Code, rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers for disallowed origin")
+	}
+
+	cfg = HTTPCORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	checkError(t, cfg.Verify(), "cannot be combined with allowcredentials")
+
+	cfg = HTTPCORSConfig{AllowedOrigins: []string{"https://app.*.com"}}
+	checkError(t, cfg.Verify(), "wildcard must be the first label")
+
+	cfg = HTTPCORSConfig{AllowedOrigins: []string{"https://app.acme.com/api"}}
+	checkError(t, cfg.Verify(), "cannot include a path")
+
+	cfg = HTTPCORSConfig{AllowedOrigins: []string{"app.acme.com"}}
+	checkError(t, cfg.Verify(), "invalid CORS origin")
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	var (
+		cfg RateLimitConfig
+		req *http.Request
+		err error
+	)
+
+	cfg = RateLimitConfig{Enabled: true, RequestsPerSecond: 2.5, ExemptCIDRs: []string{"10.0.0.0/8", " 2001:db8::/32"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Burst != 3 || cfg.KeyStrategy != "ip" {
+		t.Fatalf("unexpected defaults: burst %d strategy %q", cfg.Burst, cfg.KeyStrategy)
+	}
+	if !cfg.Exempt(net.ParseIP("10.1.2.3")) || !cfg.Exempt(net.ParseIP("2001:db8::1")) || cfg.Exempt(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("unexpected exempt results")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.9:4123"
+	if cfg.Key(req) != "192.0.2.9" {
+		t.Fatalf("unexpected key %q", cfg.Key(req))
+	}
+
+	cfg = RateLimitConfig{Enabled: true, RequestsPerSecond: 5, KeyStrategy: "Header", KeyHeader: "X-API-Key"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	req.Header.Set("X-API-Key", "abc")
+	if cfg.Key(req) != "abc" {
+		t.Fatalf("unexpected key %q", cfg.Key(req))
+	}
+
+	cfg = RateLimitConfig{Enabled: true, RequestsPerSecond: 5, ExemptCIDRs: []string{"10.0.0.0/33"}}
+	checkError(t, cfg.Verify(), "invalid ratelimit exemptcidrs")
+
+	cfg = RateLimitConfig{Enabled: true, RequestsPerSecond: 5, KeyStrategy: "cookie"}
+	checkError(t, cfg.Verify(), "invalid ratelimit keystrategy")
+
+	cfg = RateLimitConfig{Enabled: true, RequestsPerSecond: 5, KeyStrategy: "header"}
+	checkError(t, cfg.Verify(), "requires keyheader")
+
+	cfg = RateLimitConfig{Enabled: true}
+	checkError(t, cfg.Verify(), "requestspersecond must be greater than zero")
+
+	cfg = RateLimitConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify of disabled config returned error: %v", err)
+	}
+}
+
+func TestHTTPCSRFConfig(t *testing.T) {
+	var (
+		cfg HTTPCSRFConfig
+		err error
+	)
+
+	cfg = HTTPCSRFConfig{
+		Enabled:        true,
+		AuthKey:        strings.Repeat("ab", 32),
+		TrustedOrigins: []string{"Admin.Acme.com", "localhost:8443"},
+		SameSite:       "strict",
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if len(cfg.Key()) != 32 || cfg.Key()[0] != 0xab {
+		t.Fatalf("unexpected key %x", cfg.Key())
+	}
+	if cfg.CookieName != "_csrf" || cfg.RequestHeader != "X-CSRF-Token" || cfg.SameSiteMode() != http.SameSiteStrictMode {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.TrustedOrigins[0] != "admin.acme.com" {
+		t.Fatalf("trusted origin not normalized: %q", cfg.TrustedOrigins[0])
+	}
+
+	cfg = HTTPCSRFConfig{Enabled: true, AuthKey: "0123456789abcdefghijklmnopqrstuv"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.SameSiteMode() != http.SameSiteLaxMode {
+		t.Fatalf("Verify of raw key returned %v, samesite %v", err, cfg.SameSiteMode())
+	}
+
+	cfg = HTTPCSRFConfig{Enabled: true, AuthKey: "too-short"}
+	checkError(t, cfg.Verify(), "must be 32 bytes")
+
+	cfg = HTTPCSRFConfig{Enabled: true}
+	checkError(t, cfg.Verify(), "CSRFAUTHKEY")
+
+	cfg = HTTPCSRFConfig{Enabled: true, AuthKey: strings.Repeat("ab", 32), TrustedOrigins: []string{"https://acme.com"}}
+	checkError(t, cfg.Verify(), "should be a host")
+
+	cfg = HTTPCSRFConfig{Enabled: true, AuthKey: strings.Repeat("ab", 32), SameSite: "sometimes"}
+	checkError(t, cfg.Verify(), "invalid CSRF samesite")
+}
+
+func TestHTTPSecurityHeaders(t *testing.T) {
+	var (
+		cfg HTTPSecurityHeaders
+		rec *httptest.ResponseRecorder
+		err error
+	)
+
+	cfg = HTTPSecurityHeaders{ContentSecurityPolicy: "default-src 'self'", XFrameOptions: "sameorigin"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	cfg.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Strict-Transport-Security") != "max-age=15552000" ||
+		rec.Header().Get("X-Frame-Options") != "SAMEORIGIN" ||
+		rec.Header().Get("Referrer-Policy") != "strict-origin-when-cross-origin" ||
+		rec.Header().Get("Content-Security-Policy") != "default-src 'self'" ||
+		rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("unexpected headers: %#v", rec.Header())
+	}
+
+	cfg = HTTPSecurityHeaders{HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubdomains: true, HSTSPreload: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	cfg.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains; preload" {
+		t.Fatalf("unexpected HSTS header %q", rec.Header().Get("Strict-Transport-Security"))
+	}
+
+	cfg = HTTPSecurityHeaders{DisableHSTS: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	cfg.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(rec.Header().Get("Strict-Transport-Security")) > 0 {
+		t.Fatalf("HSTS header sent while disabled")
+	}
+
+	cfg = HTTPSecurityHeaders{HSTSPreload: true}
+	checkError(t, cfg.Verify(), "hstspreload requires")
+
+	cfg = HTTPSecurityHeaders{XFrameOptions: "ALLOW-FROM https://acme.com"}
+	checkError(t, cfg.Verify(), "invalid securityheaders xframeoptions")
+
+	cfg = HTTPSecurityHeaders{ReferrerPolicy: "everywhere"}
+	checkError(t, cfg.Verify(), "invalid securityheaders referrerpolicy")
+}
+
+func TestHTTPConfigClientIP(t *testing.T) {
+	var (
+		testCases []struct {
+			name   string
+			header string
+			remote string
+			value  string
+			wantIP string
+		}
+		i   int
+		cfg HTTPConfig
+		req *http.Request
+		ip  net.IP
+		err error
+	)
+
+	cfg = HTTPConfig{
+		SkipHostNameTest: true,
+		ExternalHostName: []string{"example.com"},
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: "/tmp/cert.pem", SSLPrivateKeyFile: "/tmp/key.pem"},
+		TrustedProxies:   []string{"10.0.0.0/8", "192.0.2.1"},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.RealIPHeader != "X-Forwarded-For" {
+		t.Fatalf("unexpected default realipheader %q", cfg.RealIPHeader)
+	}
+
+	testCases = []struct {
+		name   string
+		header string
+		remote string
+		value  string
+		wantIP string
+	}{
+		{name: "untrusted-peer", remote: "203.0.113.5:1234", value: "198.51.100.1", wantIP: "203.0.113.5"},
+		{name: "trusted-peer", remote: "10.1.1.1:1234", value: "198.51.100.1", wantIP: "198.51.100.1"},
+		{name: "spoofed-chain", remote: "10.1.1.1:1234", value: "1.2.3.4, 198.51.100.1, 10.2.2.2", wantIP: "198.51.100.1"},
+		{name: "all-trusted", remote: "192.0.2.1:1234", value: "10.3.3.3", wantIP: "10.3.3.3"},
+		{name: "garbage", remote: "10.1.1.1:1234", value: "unknown", wantIP: "10.1.1.1"},
+		{name: "single-header", header: "cf-connecting-ip", remote: "10.1.1.1:1234", value: "2001:db8::1", wantIP: "2001:db8::1"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		if len(testCases[i].header) > 0 {
+			cfg.RealIPHeader = testCases[i].header
+			err = cfg.Verify()
+			if !errors.Is(err, nil) {
+				t.Fatalf("Verify returned error: %v", err)
+			}
+		}
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = testCases[i].remote
+		req.Header.Set(cfg.RealIPHeader, testCases[i].value)
+		ip = cfg.ClientIP(req)
+		if ip.String() != testCases[i].wantIP {
+			t.Fatalf("%s: expected %s, got %s", testCases[i].name, testCases[i].wantIP, ip)
+		}
+	}
+
+	cfg.TrustedProxies = []string{"10.0.0.0/40"}
+	checkError(t, cfg.Verify(), "invalid http trustedproxies")
+	cfg.TrustedProxies = []string{"proxy.local"}
+	checkError(t, cfg.Verify(), "invalid http trustedproxies")
+}
+
+func TestHTTPTimeoutsConfig(t *testing.T) {
+	var (
+		cfg      HTTPTimeoutsConfig
+		path     string
+		certFile string
+		keyFile  string
+		gc       struct {
+			HTTP HTTPConfig `yaml:"http"`
+		}
+		err error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"example.com"}, time.Now().Add(30*24*time.Hour))
+	path = writeTempConfig(t, `
+http:
+  externalhostname: [example.com]
+  skiphostnametest: true
+  static_cert:
+    certfile: `+certFile+`
+    privatekeyfile: `+keyFile+`
+  timeouts:
+    write: 5m
+`)
+	err = Read(path, &gc)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if gc.HTTP.Timeouts.Write != 5*time.Minute || gc.HTTP.Timeouts.Read != 30*time.Second ||
+		gc.HTTP.Timeouts.ReadHeader != 10*time.Second || gc.HTTP.Timeouts.Idle != 120*time.Second ||
+		gc.HTTP.Timeouts.ShutdownGrace != 15*time.Second {
+		t.Fatalf("unexpected timeouts: %+v", gc.HTTP.Timeouts)
+	}
+
+	cfg = HTTPTimeoutsConfig{Read: 5 * time.Second, ReadHeader: 10 * time.Second}
+	checkError(t, cfg.Verify(), "readheader (10s) is greater than read (5s)")
+
+	cfg = HTTPTimeoutsConfig{Idle: -time.Second}
+	checkError(t, cfg.Verify(), "cannot be negative")
+}
+
+func TestHTTPConfigLimitHandler(t *testing.T) {
+	var (
+		path     string
+		certFile string
+		keyFile  string
+		gc       struct {
+			HTTP HTTPConfig `yaml:"http"`
+		}
+		handler http.Handler
+		release chan struct{}
+		started chan struct{}
+		done    chan struct{}
+		rec     *httptest.ResponseRecorder
+		err     error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"example.com"}, time.Now().Add(30*24*time.Hour))
+	path = writeTempConfig(t, `
+http:
+  externalhostname: [example.com]
+  skiphostnametest: true
+  static_cert:
+    certfile: `+certFile+`
+    privatekeyfile: `+keyFile+`
+  maxbodysize: 1KiB
+  maxconcurrentrequests: 1
+`)
+	err = Read(path, &gc)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if gc.HTTP.MaxBodySize != 1024 || gc.HTTP.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+		t.Fatalf("unexpected limits: body %d header %d", gc.HTTP.MaxBodySize, gc.HTTP.MaxHeaderBytes)
+	}
+
+	release = make(chan struct{})
+	started = make(chan struct{})
+	handler = gc.HTTP.LimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		var readErr error
+
+		_, readErr = io.ReadAll(r.Body)
+		if readErr != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 2048))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized body, got %d", rec.Code)
+	}
+
+	done = make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(done)
+	}()
+	<-started
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while at the concurrency limit, got %d", rec.Code)
+	}
+	close(release)
+	<-done
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the slot was released, got %d", rec.Code)
+	}
+}
+
+func TestHTTP2Config(t *testing.T) {
+	var (
+		cfg      HTTP2Config
+		disabled bool
+		srv      *http.Server
+		ts       *httptest.Server
+		client   *http.Client
+		resp     *http.Response
+		err      error
+	)
+
+	cfg = HTTP2Config{H2C: true, MaxConcurrentStreams: 50}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Enabled == nil || !*cfg.Enabled {
+		t.Fatalf("Verify returned %v, enabled %v", err, cfg.Enabled)
+	}
+
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	cfg.ConfigureServer(ts.Config)
+	ts.Start()
+	defer ts.Close()
+	if ts.Config.HTTP2 == nil || ts.Config.HTTP2.MaxConcurrentStreams != 50 {
+		t.Fatalf("HTTP2 settings not applied")
+	}
+	client = &http.Client{Transport: &http.Transport{Protocols: new(http.Protocols)}}
+	client.Transport.(*http.Transport).Protocols.SetUnencryptedHTTP2(true)
+	resp, err = client.Get(ts.URL)
+	if !errors.Is(err, nil) {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2 response over h2c, got %s", resp.Proto)
+	}
+
+	disabled = false
+	cfg = HTTP2Config{Enabled: &disabled}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	srv = &http.Server{}
+	cfg.ConfigureServer(srv)
+	if srv.Protocols.HTTP2() || !srv.Protocols.HTTP1() {
+		t.Fatalf("unexpected protocols %s", srv.Protocols)
+	}
+
+	cfg = HTTP2Config{Enabled: &disabled, H2C: true}
+	checkError(t, cfg.Verify(), "h2c cannot be used")
+}
+
+func TestHTTP3Config(t *testing.T) {
+	var (
+		path     string
+		certFile string
+		keyFile  string
+		gc       struct {
+			HTTP HTTPConfig `yaml:"http"`
+		}
+		req *http.Request
+		rec *httptest.ResponseRecorder
+		cfg HTTP3Config
+		err error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"example.com"}, time.Now().Add(30*24*time.Hour))
+	path = writeTempConfig(t, `
+http:
+  externalhostname: [example.com]
+  skiphostnametest: true
+  sslbindaddr: ":8443"
+  static_cert:
+    certfile: `+certFile+`
+    privatekeyfile: `+keyFile+`
+  http3:
+    enabled: true
+    advertisealtsvc: true
+`)
+	err = Read(path, &gc)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if gc.HTTP.HTTP3.BindAddr != ":8443" || gc.HTTP.HTTP3.AltSvcMaxAge != 24*time.Hour {
+		t.Fatalf("unexpected http3 settings: %+v", gc.HTTP.HTTP3)
+	}
+	req = httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	rec = httptest.NewRecorder()
+	gc.HTTP.HTTP3.AltSvcHandler(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Header().Get("Alt-Svc") != `h3=":8443"; ma=86400` {
+		t.Fatalf("unexpected Alt-Svc header %q", rec.Header().Get("Alt-Svc"))
+	}
+
+	cfg = HTTP3Config{Enabled: true, BindAddr: "localhost"}
+	checkError(t, cfg.Verify(), "invalid http3 bindaddr")
+
+	gc.HTTP.SSLBindAddr = ""
+	gc.HTTP.HTTP3.BindAddr = ""
+	checkError(t, gc.HTTP.Verify(), "neither http3.bindaddr nor sslbindaddr")
+}
+
+func TestHTTPConfigNewServer(t *testing.T) {
+	var (
+		cfg           HTTPConfig
+		certFile      string
+		keyFile       string
+		plain, secure *http.Server
+		ln            net.Listener
+		client        *http.Client
+		resp          *http.Response
+		body          []byte
+		err           error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(24*time.Hour))
+	cfg = HTTPConfig{
+		BindAddr:         "127.0.0.1:0",
+		SSLBindAddr:      "127.0.0.1:0",
+		ExternalHostName: []string{"localhost"},
+		SkipHostNameTest: true,
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile},
+	}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	plain, secure, err = cfg.NewServer(t.Context(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewServer returned error: %v", err)
+	}
+	if plain == nil || secure == nil || secure.ReadHeaderTimeout != 10*time.Second || secure.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+		t.Fatalf("unexpected servers: %+v %+v", plain, secure)
+	}
+
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go func() { _ = secure.ServeTLS(ln, "", "") }()
+	client = &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err = client.Get("https://" + ln.Addr().String() + "/")
+	if !errors.Is(err, nil) {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "hello" || resp.ProtoMajor != 2 {
+		t.Fatalf("unexpected response %s %q", resp.Proto, body)
+	}
+	err = cfg.Shutdown(plain, secure)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	cfg.StaticCert = HTTPStaticCertConfig{}
+	cfg.ACME = HTTPACMEConfig{Email: "admin@example.com", DiskCache: t.TempDir()}
+	plain, secure, err = cfg.NewServer(t.Context(), http.NotFoundHandler())
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewServer returned error: %v", err)
+	}
+	if secure.TLSConfig.GetCertificate == nil || !containsString(secure.TLSConfig.NextProtos, "acme-tls/1") {
+		t.Fatalf("ACME certificate source not configured")
+	}
+
+	cfg.BindAddr = ""
+	cfg.SSLBindAddr = ""
+	_, _, err = cfg.NewServer(t.Context(), http.NotFoundHandler())
+	checkError(t, err, "neither http bindaddr nor sslbindaddr")
+}
+
+func TestHTTPConfigRun(t *testing.T) {
+	var (
+		cfg      HTTPConfig
+		certFile string
+		keyFile  string
+		ctx      context.Context
+		cancel   context.CancelFunc
+		done     chan error
+		client   *http.Client
+		resp     *http.Response
+		port     string
+		h3       *http3.Transport
+		err      error
+		i        int
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(24*time.Hour))
+	cfg = HTTPConfig{
+		BindAddr:         "127.0.0.1:" + strconv.Itoa(freeTCPPort(t)),
+		SSLBindAddr:      "127.0.0.1:" + strconv.Itoa(freeTCPPort(t)),
+		RedirectToHTTPS:  true,
+		ExternalHostName: []string{"localhost"},
+		SkipHostNameTest: true,
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile},
+		HTTP3:            HTTP3Config{Enabled: true, AdvertiseAltSvc: true},
+	}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan error, 1)
+	go func() {
+		done <- cfg.Run(ctx, http.NotFoundHandler())
+	}()
+
+	client = &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for i = 0; i < 50; i++ {
+		resp, err = client.Get("http://" + cfg.BindAddr + "/path?q=1")
+		if errors.Is(err, nil) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("plaintext request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	_, port, _ = net.SplitHostPort(cfg.SSLBindAddr)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://127.0.0.1:"+port+"/path?q=1" {
+		t.Fatalf("unexpected redirect %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// HTTPS responses advertise the HTTP/3 listener, which answers on the same port
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err = client.Get("https://" + cfg.SSLBindAddr + "/")
+	if !errors.Is(err, nil) {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.Header.Get("Alt-Svc") != `h3=":`+port+`"; ma=86400` {
+		t.Fatalf("unexpected Alt-Svc header %q", resp.Header.Get("Alt-Svc"))
+	}
+	h3 = &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer h3.Close()
+	resp, err = (&http.Client{Transport: h3, Timeout: 5 * time.Second}).Get("https://" + cfg.SSLBindAddr + "/")
+	if !errors.Is(err, nil) {
+		t.Fatalf("HTTP/3 request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.ProtoMajor != 3 || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected HTTP/3 response %s %d", resp.Proto, resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err = <-done:
+		if !errors.Is(err, nil) {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after cancellation")
+	}
+
+	cfg.BindAddr = "bad address"
+	cfg.SSLBindAddr = ""
+	checkError(t, cfg.Run(context.Background(), http.NotFoundHandler()), "bad address")
+}
+
+func TestHTTPACMEConfigManager(t *testing.T) {
+	var (
+		cfg     HTTPConfig
+		manager *autocert.Manager
+		rec     *httptest.ResponseRecorder
+		err     error
+	)
+
+	cfg = HTTPConfig{
+		ExternalHostName: []string{"www.example.com", "example.com"},
+		SkipHostNameTest: true,
+		ACME: HTTPACMEConfig{
+			Email:     "admin@example.com",
+			DiskCache: t.TempDir(),
+			CADirURL:  "https://acme.example.net/directory",
+		},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	manager = cfg.ACME.Manager()
+	if manager != cfg.ACME.Manager() {
+		t.Fatalf("expected the same manager on each call")
+	}
+	if manager.Email != "admin@example.com" || manager.Client == nil || manager.Client.DirectoryURL != "https://acme.example.net/directory" {
+		t.Fatalf("unexpected manager settings: %+v", manager)
+	}
+	err = manager.HostPolicy(context.Background(), "example.com")
+	if !errors.Is(err, nil) {
+		t.Fatalf("HostPolicy rejected a configured host: %v", err)
+	}
+	err = manager.HostPolicy(context.Background(), "evil.com")
+	if errors.Is(err, nil) {
+		t.Fatalf("HostPolicy accepted an unknown host")
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.ACME.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/page", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://example.com/page" {
+		t.Fatalf("unexpected fallback response %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestHTTPACMEDNSConfig(t *testing.T) {
+	var (
+		testCases []struct {
+			name       string
+			cfg        HTTPACMEDNSConfig
+			wantSubstr string
+		}
+		i        int
+		cfg      HTTPACMEDNSConfig
+		hc       HTTPConfig
+		tlsCfg   *tls.Config
+		cert     *tls.Certificate
+		certFile string
+		keyFile  string
+		certPEM  []byte
+		keyPEM   []byte
+		err      error
+	)
+
+	testCases = []struct {
+		name       string
+		cfg        HTTPACMEDNSConfig
+		wantSubstr string
+	}{
+		{name: "route53-instance-role", cfg: HTTPACMEDNSConfig{Provider: "Route53"}},
+		{name: "route53-half-credentials", cfg: HTTPACMEDNSConfig{Provider: "route53", AccessKeyID: "AKIA"}, wantSubstr: "requires both accesskeyid"},
+		{name: "cloudflare", cfg: HTTPACMEDNSConfig{Provider: "cloudflare", APIToken: "token"}},
+		{name: "cloudflare-no-token", cfg: HTTPACMEDNSConfig{Provider: "cloudflare"}, wantSubstr: "CF_DNS_API_TOKEN"},
+		{name: "gcloud-no-project", cfg: HTTPACMEDNSConfig{Provider: "gcloud"}, wantSubstr: "GCE_PROJECT"},
+		{name: "gcloud-missing-file", cfg: HTTPACMEDNSConfig{Provider: "gcloud", Project: "p", ServiceAccountFile: "/nonexistent/sa.json"}, wantSubstr: "serviceaccountfile"},
+		{name: "rfc2136", cfg: HTTPACMEDNSConfig{Provider: "rfc2136", Nameserver: "ns1.example.com", TSIGKey: "k", TSIGSecret: "s"}},
+		{name: "rfc2136-bad-algorithm", cfg: HTTPACMEDNSConfig{Provider: "rfc2136", Nameserver: "ns1.example.com", TSIGAlgorithm: "rot13"}, wantSubstr: "invalid ACME rfc2136 tsigalgorithm"},
+		{name: "missing-provider", cfg: HTTPACMEDNSConfig{}, wantSubstr: "missing ACME dns provider"},
+		{name: "unknown-provider", cfg: HTTPACMEDNSConfig{Provider: "bind"}, wantSubstr: "unsupported ACME dns provider"},
+	}
+
+	for i = 0; i < len(testCases); i++ {
+		cfg = testCases[i].cfg
+		err = cfg.Verify()
+		if len(testCases[i].wantSubstr) == 0 {
+			if !errors.Is(err, nil) {
+				t.Fatalf("%s: expected no error, got: %v", testCases[i].name, err)
+			}
+			continue
+		}
+		checkError(t, err, testCases[i].wantSubstr)
+	}
+
+	cfg = HTTPACMEDNSConfig{Provider: "rfc2136", Nameserver: "10.0.0.53", TSIGKey: "k", TSIGSecret: "s"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Nameserver != "10.0.0.53:53" || cfg.TSIGAlgorithm != "hmac-sha256" {
+		t.Fatalf("unexpected rfc2136 defaults: %+v", cfg)
+	}
+
+	hc = HTTPConfig{
+		ExternalHostName: []string{"*.example.com"},
+		SkipHostNameTest: true,
+		ACME:             HTTPACMEConfig{Email: "admin@example.com", DiskCache: t.TempDir(), RenewBefore: 24 * time.Hour},
+	}
+	checkError(t, hc.Verify(), "wildcard externalhostname \"*.example.com\" requires a static_cert or the ACME dns-01 challenge")
+	hc.ACME.DNS = &cfg
+	hc.ExternalHostName = []string{"*.example.com", "www.example.org"}
+	err = hc.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify with dns-01 returned error: %v", err)
+	}
+	if len(hc.ACME.dnsHosts) != 1 || hc.ACME.dnsHosts[0] != "*.example.com" || len(hc.ACME.hosts) != 1 || hc.ACME.hosts[0] != "www.example.org" {
+		t.Fatalf("expected the wildcard to be issued through dns-01, got dns %v and autocert %v", hc.ACME.dnsHosts, hc.ACME.hosts)
+	}
+
+	_, err = hc.ACME.newDNSIssuer().GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	checkError(t, err, "no ACME dns-01 certificate for a.example.com yet")
+
+	certFile, keyFile = writeTestCertificate(t, []string{"*.example.com"}, time.Now().Add(90*24*time.Hour))
+	certPEM, err = os.ReadFile(certFile)
+	if errors.Is(err, nil) {
+		keyPEM, err = os.ReadFile(keyFile)
+	}
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(hc.ACME.DiskCache, dnsIssuerCacheKey("*.example.com")), append(keyPEM, certPEM...), 0o600)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing cached certificate: %v", err)
+	}
+	tlsCfg, err = hc.BuildTLSConfig(t.Context())
+	if !errors.Is(err, nil) {
+		t.Fatalf("BuildTLSConfig returned error: %v", err)
+	}
+	cert, err = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	if !errors.Is(err, nil) || cert == nil || cert.Leaf.DNSNames[0] != "*.example.com" {
+		t.Fatalf("expected the cached wildcard certificate, got %v, %v", cert, err)
+	}
+}
+
+func TestHTTPACMEConfigCA(t *testing.T) {
+	var (
+		cfg     HTTPACMEConfig
+		manager *autocert.Manager
+		err     error
+	)
+
+	cfg = HTTPACMEConfig{CA: "ZeroSSL", EABKeyID: "kid-1", EABHMACKey: base64.RawURLEncoding.EncodeToString([]byte("hmac-secret"))}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.CADirURL != "https://acme.zerossl.com/v2/DV90" {
+		t.Fatalf("unexpected cadirurl %q", cfg.CADirURL)
+	}
+	manager = cfg.Manager()
+	if manager.ExternalAccountBinding == nil || manager.ExternalAccountBinding.KID != "kid-1" ||
+		string(manager.ExternalAccountBinding.Key) != "hmac-secret" || manager.Client.DirectoryURL != cfg.CADirURL {
+		t.Fatalf("unexpected manager settings: %+v", manager)
+	}
+
+	cfg = HTTPACMEConfig{CADirURL: "https://dv.acme-v02.api.pki.goog/directory"}
+	checkError(t, cfg.Verify(), "ACME ca google requires external account binding")
+
+	cfg = HTTPACMEConfig{CA: "buypass"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.CADirURL != "https://api.buypass.com/acme/directory" {
+		t.Fatalf("Verify returned %v, cadirurl %q", err, cfg.CADirURL)
+	}
+
+	cfg = HTTPACMEConfig{CA: "letsencrypt", CADirURL: "https://acme.example.net/directory"}
+	checkError(t, cfg.Verify(), "conflicts with cadirurl")
+
+	cfg = HTTPACMEConfig{CA: "digicert"}
+	checkError(t, cfg.Verify(), "unknown ACME ca")
+
+	cfg = HTTPACMEConfig{CADirURL: "http://acme.example.net/directory"}
+	checkError(t, cfg.Verify(), "invalid ACME cadirurl")
+
+	cfg = HTTPACMEConfig{EABKeyID: "kid-1"}
+	checkError(t, cfg.Verify(), "requires both eabkeyid and eabhmackey")
+
+	cfg = HTTPACMEConfig{EABKeyID: "kid-1", EABHMACKey: "not base64!"}
+	checkError(t, cfg.Verify(), "must be base64url encoded")
+}
+
+func TestHTTPACMEConfigStaging(t *testing.T) {
+	var (
+		cfg      HTTPACMEConfig
+		warnings []string
+		err      error
+	)
+
+	cfg = HTTPACMEConfig{Staging: true, RenewBefore: 14 * 24 * time.Hour}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.CADirURL != "https://acme-staging-v02.api.letsencrypt.org/directory" {
+		t.Fatalf("unexpected cadirurl %q", cfg.CADirURL)
+	}
+	if cfg.Manager().RenewBefore != 14*24*time.Hour || cfg.Manager().Client.DirectoryURL != cfg.CADirURL {
+		t.Fatalf("staging settings not passed to the manager")
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("second Verify returned error: %v", err)
+	}
+
+	cfg = HTTPACMEConfig{Staging: true, CA: "zerossl"}
+	checkError(t, cfg.Verify(), "only available with the letsencrypt ca")
+
+	cfg = HTTPACMEConfig{RenewBefore: -time.Hour}
+	checkError(t, cfg.Verify(), "renewbefore cannot be negative")
+
+	captureWarnings(t, &warnings)
+	cfg = HTTPACMEConfig{RenewBefore: 80 * 24 * time.Hour}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(warnings) != 1 || !strings.Contains(warnings[0], "more than 60 days") {
+		t.Fatalf("expected a renewbefore warning, got %v %v", err, warnings)
+	}
+}
+
+func TestHTTPTLSConfig(t *testing.T) {
+	var (
+		cfg      HTTPTLSConfig
+		hc       HTTPConfig
+		tlsCfg   *tls.Config
+		certFile string
+		keyFile  string
+		warnings []string
+		err      error
+	)
+
+	cfg = HTTPTLSConfig{
+		MinVersion:       "TLS1.2",
+		MaxVersion:       "1.3",
+		CipherSuites:     []string{"tls_ecdhe_rsa_with_aes_256_gcm_sha384", "TLS_AES_128_GCM_SHA256"},
+		CurvePreferences: []string{"X25519", "P-256"},
+		ALPNProtocols:    []string{"h2", "http/1.1"},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	tlsCfg = cfg.Config()
+	if tlsCfg.MinVersion != tls.VersionTLS12 || tlsCfg.MaxVersion != tls.VersionTLS13 ||
+		len(tlsCfg.CipherSuites) != 2 || tlsCfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 ||
+		len(tlsCfg.CurvePreferences) != 2 || tlsCfg.CurvePreferences[1] != tls.CurveP256 || len(tlsCfg.NextProtos) != 2 {
+		t.Fatalf("unexpected tls config: %+v", tlsCfg)
+	}
+
+	certFile, keyFile = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(24*time.Hour))
+	hc = HTTPConfig{TLS: cfg, StaticCert: HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile}}
+	tlsCfg, err = hc.BuildTLSConfig(t.Context())
+	if !errors.Is(err, nil) || len(tlsCfg.Certificates) != 1 || tlsCfg.MaxVersion != tls.VersionTLS13 {
+		t.Fatalf("BuildTLSConfig returned %v, %+v", err, tlsCfg)
+	}
+	hc.StaticCert = HTTPStaticCertConfig{}
+	hc.ACME = HTTPACMEConfig{DiskCache: t.TempDir()}
+	tlsCfg, err = hc.BuildTLSConfig(t.Context())
+	if !errors.Is(err, nil) || tlsCfg.GetCertificate == nil || tlsCfg.NextProtos[len(tlsCfg.NextProtos)-1] != "acme-tls/1" {
+		t.Fatalf("BuildTLSConfig with ACME returned %v, %+v", err, tlsCfg)
+	}
+
+	cfg = HTTPTLSConfig{MinVersion: "1.3", MaxVersion: "1.2"}
+	checkError(t, cfg.Verify(), "lower than minversion")
+
+	cfg = HTTPTLSConfig{MinVersion: "ssl3"}
+	checkError(t, cfg.Verify(), "invalid http tls minversion")
+
+	cfg = HTTPTLSConfig{CipherSuites: []string{"TLS_MADE_UP"}}
+	checkError(t, cfg.Verify(), "unknown http tls cipher suite")
+
+	cfg = HTTPTLSConfig{CurvePreferences: []string{"secp256k1"}}
+	checkError(t, cfg.Verify(), "unknown http tls curve")
+
+	captureWarnings(t, &warnings)
+	cfg = HTTPTLSConfig{MinVersion: "1.0", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(warnings) != 2 {
+		t.Fatalf("expected two warnings, got %v %v", err, warnings)
+	}
+}
+
+func TestHTTPClientAuthConfig(t *testing.T) {
+	var (
+		caKey    *ecdsa.PrivateKey
+		caCert   *x509.Certificate
+		leaf     *x509.Certificate
+		revoked  *x509.Certificate
+		template x509.Certificate
+		der      []byte
+		dir      string
+		caFile   string
+		crlFile  string
+		cfg      HTTPClientAuthConfig
+		tlsCfg   *tls.Config
+		err      error
+	)
+
+	caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template = x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, _ = x509.CreateCertificate(rand.Reader, &template, &template, &caKey.PublicKey, caKey)
+	caCert, _ = x509.ParseCertificate(der)
+	dir = t.TempDir()
+	caFile = filepath.Join(dir, "ca.pem")
+	_ = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+
+	leaf = &x509.Certificate{SerialNumber: big.NewInt(10), Subject: pkix.Name{CommonName: "billing"}, DNSNames: []string{"billing.internal"}}
+	revoked = &x509.Certificate{SerialNumber: big.NewInt(11), Subject: pkix.Name{CommonName: "billing"}, DNSNames: []string{"billing.internal"}}
+	der, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Hour),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: big.NewInt(11), RevocationTime: time.Now()}},
+	}, caCert, caKey)
+	if err != nil {
+		t.Fatalf("CreateRevocationList failed: %v", err)
+	}
+	crlFile = filepath.Join(dir, "ca.crl")
+	_ = os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600)
+
+	cfg = HTTPClientAuthConfig{
+		Mode:        "require-and-verify",
+		CAFiles:     []string{caFile},
+		AllowedSANs: []string{"billing.internal"},
+		CRLFile:     crlFile,
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	tlsCfg = &tls.Config{}
+	cfg.apply(tlsCfg)
+	if tlsCfg.ClientAuth != tls.RequireAndVerifyClientCert || tlsCfg.ClientCAs == nil || tlsCfg.VerifyConnection == nil {
+		t.Fatalf("client auth not applied: %+v", tlsCfg)
+	}
+	err = tlsCfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}})
+	if !errors.Is(err, nil) {
+		t.Fatalf("allowed certificate refused: %v", err)
+	}
+	checkError(t, tlsCfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{revoked}}), "has been revoked")
+	leaf.DNSNames = []string{"payroll.internal"}
+	checkError(t, tlsCfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}), "not in the allowed names")
+
+	cfg = HTTPClientAuthConfig{Mode: "require-and-verify"}
+	checkError(t, cfg.Verify(), "requires at least one entry in cafiles")
+
+	cfg = HTTPClientAuthConfig{Mode: "request", AllowedCNs: []string{"billing"}}
+	checkError(t, cfg.Verify(), "does not verify certificates")
+
+	cfg = HTTPClientAuthConfig{Mode: "verify-if-given", CAFiles: []string{crlFile}}
+	checkError(t, cfg.Verify(), "no PEM certificates found")
+
+	cfg = HTTPClientAuthConfig{Mode: "optional"}
+	checkError(t, cfg.Verify(), "invalid http clientauth mode")
+
+	cfg = HTTPClientAuthConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify of empty config returned error: %v", err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	var (
+		certFile, keyFile       string
+		newCertFile, newKeyFile string
+		reloader                *CertReloader
+		cert                    *tls.Certificate
+		first                   *big.Int
+		b                       []byte
+		ctx                     context.Context
+		cancel                  context.CancelFunc
+		i                       int
+		err                     error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(24*time.Hour))
+	reloader, err = HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile}.Reloader()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Reloader returned error: %v", err)
+	}
+	cert, _ = reloader.GetCertificate(nil)
+	first = cert.Leaf.SerialNumber
+
+	err = os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("write failed: %v", err)
+	}
+	checkError(t, reloader.Reload(), "unable to load certificate")
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.SerialNumber.Cmp(first) != 0 {
+		t.Fatalf("certificate replaced after a failed reload")
+	}
+
+	newCertFile, newKeyFile = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(48*time.Hour))
+	b, _ = os.ReadFile(newCertFile)
+	_ = os.WriteFile(certFile, b, 0o600)
+	b, _ = os.ReadFile(newKeyFile)
+	_ = os.WriteFile(keyFile, b, 0o600)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+	for i = 0; i < 100; i++ {
+		cert, _ = reloader.GetCertificate(nil)
+		if cert.Leaf.SerialNumber.Cmp(first) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cert.Leaf.SerialNumber.Cmp(first) == 0 {
+		t.Fatalf("certificate was not reloaded")
+	}
+}
+
+func TestHTTPStaticCertConfigVerify(t *testing.T) {
+	var (
+		certFile, keyFile   string
+		otherCert, otherKey string
+		cfg                 HTTPConfig
+		sc                  HTTPStaticCertConfig
+		warnings            []string
+		err                 error
+	)
+
+	certFile, keyFile = writeTestCertificate(t, []string{"www.example.com", "api.example.com"}, time.Now().Add(5*24*time.Hour))
+	otherCert, otherKey = writeTestCertificate(t, []string{"www.example.com"}, time.Now().Add(-time.Hour))
+
+	captureWarnings(t, &warnings)
+	cfg = HTTPConfig{
+		ExternalHostName: []string{"api.example.com"},
+		SkipHostNameTest: true,
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile},
+	}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "expires on") {
+		t.Fatalf("expected an expiry warning, got %v", warnings)
+	}
+
+	cfg.ExternalHostName = []string{"shop.example.com"}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	checkError(t, err, "does not cover any externalhostname")
+
+	sc = HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: otherKey}
+	checkError(t, sc.Verify(), "private key does not match public key")
+
+	sc = HTTPStaticCertConfig{SSLCertFile: otherCert, SSLPrivateKeyFile: otherKey}
+	checkError(t, sc.Verify(), "expired on")
+
+	sc = HTTPStaticCertConfig{SSLCertFile: certFile}
+	checkError(t, sc.Verify(), "requires both certfile and privatekeyfile")
+
+	sc = HTTPStaticCertConfig{SSLCertFile: certFile + ".typo", SSLPrivateKeyFile: keyFile}
+	checkError(t, sc.Verify(), "no such file or directory")
+}
+
+func TestHTTPOCSPStapling(t *testing.T) {
+	var (
+		caKey     *ecdsa.PrivateKey
+		leafKey   *ecdsa.PrivateKey
+		caCert    *x509.Certificate
+		template  x509.Certificate
+		caDER     []byte
+		leafDER   []byte
+		keyDER    []byte
+		responder *httptest.Server
+		dir       string
+		certFile  string
+		keyFile   string
+		cfg       HTTPConfig
+		tlsCfg    *tls.Config
+		cert      *tls.Certificate
+		i         int
+		err       error
+	)
+
+	caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template = x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ = x509.CreateCertificate(rand.Reader, &template, &template, &caKey.PublicKey, caKey)
+	caCert, _ = x509.ParseCertificate(caDER)
+
+	responder = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body    []byte
+			ocspReq *ocsp.Request
+			resp    []byte
+			rerr    error
+		)
+
+		body, _ = io.ReadAll(r.Body)
+		ocspReq, rerr = ocsp.ParseRequest(body)
+		if rerr != nil {
+			http.Error(w, rerr.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, rerr = ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, caKey)
+		if rerr != nil {
+			http.Error(w, rerr.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer responder.Close()
+
+	leafKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template = x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}
+	leafDER, _ = x509.CreateCertificate(rand.Reader, &template, caCert, &leafKey.PublicKey, caKey)
+	keyDER, _ = x509.MarshalECPrivateKey(leafKey)
+	dir = t.TempDir()
+	certFile = filepath.Join(dir, "chain.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	cfg = HTTPConfig{
+		ExternalHostName: []string{"www.example.com"},
+		SkipHostNameTest: true,
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: certFile, SSLPrivateKeyFile: keyFile},
+		OCSP:             HTTPOCSPConfig{Enabled: true},
+	}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.OCSP.RefreshInterval != time.Hour {
+		t.Fatalf("unexpected refreshinterval %s", cfg.OCSP.RefreshInterval)
+	}
+	tlsCfg, err = cfg.BuildTLSConfig(t.Context())
+	if !errors.Is(err, nil) {
+		t.Fatalf("BuildTLSConfig returned error: %v", err)
+	}
+	for i = 0; i < 100; i++ {
+		cert, _ = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+		if len(cert.OCSPStaple) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(cert.OCSPStaple) == 0 {
+		t.Fatalf("no OCSP staple was attached")
+	}
+
+	cfg.StaticCert = HTTPStaticCertConfig{}
+	cfg.ACME = HTTPACMEConfig{Email: "admin@example.com", DiskCache: dir}
+	checkError(t, cfg.Verify(), "requires a static certificate")
+
+	cfg.OCSP = HTTPOCSPConfig{Enabled: true, RefreshInterval: time.Second}
+	checkError(t, cfg.OCSP.Verify(), "at least 1m")
+
+	cfg.OCSP = HTTPOCSPConfig{Enabled: true, ResponderURL: "ocsp.example.com"}
+	checkError(t, cfg.OCSP.Verify(), "invalid http ocsp responderurl")
+}
+
+func TestHTTPConfigExternalIP(t *testing.T) {
+	var (
+		good, bad *httptest.Server
+		stun      net.PacketConn
+		cfg       HTTPConfig
+		ip        net.IP
+		err       error
+	)
+
+	good = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "127.0.0.1\n")
+	}))
+	defer good.Close()
+	bad = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "<html>rate limited</html>")
+	}))
+	defer bad.Close()
+
+	cfg = HTTPConfig{
+		ExternalHostName:    []string{"localhost"},
+		ExternalIPProviders: []string{bad.URL, good.URL},
+		ACME:                HTTPACMEConfig{Email: "admin@example.com", DiskCache: t.TempDir()},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.ExternalIPMethod != "http" {
+		t.Fatalf("unexpected externalipmethod %q", cfg.ExternalIPMethod)
+	}
+
+	cfg.ExternalIPProviders = []string{bad.URL}
+	_, err = cfg.ExternalIP(context.Background())
+	checkError(t, err, "not an IPv4 address")
+
+	stun, err = net.ListenPacket("udp4", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer stun.Close()
+	go func() {
+		var (
+			buf  [512]byte
+			resp []byte
+			n    int
+			addr net.Addr
+			rerr error
+		)
+
+		n, addr, rerr = stun.ReadFrom(buf[:])
+		if rerr != nil || n < 20 {
+			return
+		}
+		// XOR-MAPPED-ADDRESS for 203.0.113.7:4242
+		resp = append([]byte{0x01, 0x01, 0x00, 0x0c}, buf[4:20]...)
+		resp = append(resp, 0x00, 0x20, 0x00, 0x08, 0x00, 0x01, 0x10^0x21, 0x92^0x12,
+			203^0x21, 0^0x12, 113^0xA4, 7^0x42)
+		_, _ = stun.WriteTo(resp, addr)
+	}()
+	cfg = HTTPConfig{ExternalIPMethod: "STUN", ExternalIPProviders: []string{stun.LocalAddr().String()}}
+	err = cfg.verifyExternalIPProviders()
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifyExternalIPProviders returned error: %v", err)
+	}
+	ip, err = cfg.ExternalIP(context.Background())
+	if !errors.Is(err, nil) || ip.String() != "203.0.113.7" {
+		t.Fatalf("STUN lookup returned %v, %v", ip, err)
+	}
+
+	cfg = HTTPConfig{ExternalIPMethod: "dns"}
+	checkError(t, cfg.verifyExternalIPProviders(), "invalid http externalipmethod")
+
+	cfg = HTTPConfig{ExternalIPMethod: "stun", ExternalIPProviders: []string{"stun.example.com"}}
+	checkError(t, cfg.verifyExternalIPProviders(), "invalid http externalipproviders")
+
+	cfg = HTTPConfig{ExternalIPProviders: []string{"ipecho.net/plain"}}
+	checkError(t, cfg.verifyExternalIPProviders(), "invalid http externalipproviders")
+}
+
+func TestResolverConfig(t *testing.T) {
+	var (
+		udp   net.PacketConn
+		doh   *httptest.Server
+		cfg   ResolverConfig
+		addrs []string
+		err   error
+	)
+
+	udp, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer udp.Close()
+	go func() {
+		var (
+			buf  [512]byte
+			n    int
+			addr net.Addr
+			rerr error
+		)
+
+		for {
+			n, addr, rerr = udp.ReadFrom(buf[:])
+			if rerr != nil {
+				return
+			}
+			_, _ = udp.WriteTo(fakeDNSAnswer(buf[:n], net.IPv4(192, 0, 2, 10)), addr)
+		}
+	}()
+
+	cfg = ResolverConfig{Address: udp.LocalAddr().String()}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	addrs, err = cfg.Resolver().LookupHost(context.Background(), "www.example.com")
+	if !errors.Is(err, nil) || len(addrs) == 0 || addrs[0] != "192.0.2.10" {
+		t.Fatalf("udp lookup returned %v, %v", addrs, err)
+	}
+
+	doh = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(fakeDNSAnswer(body, net.IPv4(192, 0, 2, 20)))
+	}))
+	defer doh.Close()
+	cfg = ResolverConfig{Protocol: "doh", Address: doh.URL}
+	addrs, err = cfg.Resolver().LookupHost(context.Background(), "www.example.com")
+	if !errors.Is(err, nil) || len(addrs) == 0 || addrs[0] != "192.0.2.20" {
+		t.Fatalf("doh lookup returned %v, %v", addrs, err)
+	}
+
+	cfg = ResolverConfig{Protocol: "dot", Address: "dns.quad9.net"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Address != "dns.quad9.net:853" || cfg.ServerName != "dns.quad9.net" {
+		t.Fatalf("Verify returned %v, %+v", err, cfg)
+	}
+
+	cfg = ResolverConfig{Protocol: "dot", Address: "1.1.1.1"}
+	checkError(t, cfg.Verify(), "requires servername")
+
+	cfg = ResolverConfig{Protocol: "doh", Address: "http://dns.example.com/dns-query"}
+	checkError(t, cfg.Verify(), "invalid resolver address")
+
+	cfg = ResolverConfig{Protocol: "mdns", Address: "10.0.0.1"}
+	checkError(t, cfg.Verify(), "invalid resolver protocol")
+
+	cfg = ResolverConfig{}
+	if cfg.Resolver() != net.DefaultResolver {
+		t.Fatalf("expected the default resolver when no address is set")
+	}
+}
+
+func TestHTTPConfigExternalHostNames(t *testing.T) {
+	var (
+		provider *httptest.Server
+		cfg      HTTPConfig
+		err      error
+	)
+
+	cfg = HTTPConfig{ExternalHostName: []string{"www.example.com", "*.example.com", "api.example.com."}}
+	err = cfg.verifyExternalHostNames()
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifyExternalHostNames returned error: %v", err)
+	}
+
+	cfg = HTTPConfig{ExternalHostName: []string{"www.example.com", "bad_host.example.com", "WWW.example.com."}}
+	err = cfg.verifyExternalHostNames()
+	checkError(t, err, "invalid character")
+	checkError(t, err, "duplicate externalhostname \"WWW.example.com.\"")
+
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "127.0.0.1")
+	}))
+	defer provider.Close()
+	cfg = HTTPConfig{
+		ExternalHostName:    []string{"localhost", "*.localhost", "example.invalid"},
+		ExternalIPProviders: []string{provider.URL},
+		StaticCert:          HTTPStaticCertConfig{SSLCertFile: "c.pem", SSLPrivateKeyFile: "k.pem"},
+	}
+	err = cfg.Verify()
+	checkError(t, err, "example.invalid")
+	if strings.Contains(err.Error(), "host name localhost") {
+		t.Fatalf("localhost should have matched: %v", err)
+	}
+
+	cfg.ExternalHostName = []string{"localhost"}
+	cfg.OutboundProxy = ProxyConfig{HTTPProxy: "ftp://proxy.corp.example"}
+	checkError(t, cfg.Verify(), "invalid proxy httpproxy")
+}
+
+func TestHTTPProxyConfig(t *testing.T) {
+	var (
+		api, web *httptest.Server
+		cfg      HTTPProxyConfig
+		handler  http.Handler
+		req      *http.Request
+		rec      *httptest.ResponseRecorder
+		rt       *proxyRetryTransport
+		attempts int
+		err      error
+	)
+
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "api "+r.Host+" "+r.URL.Path)
+	}))
+	defer api.Close()
+	web = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "web "+r.URL.Path)
+	}))
+	defer web.Close()
+
+	cfg = HTTPProxyConfig{
+		PreserveHost: true,
+		Routes: []HTTPProxyRoute{
+			{PathPrefix: "/", Upstream: web.URL},
+			{PathPrefix: "/api/", Upstream: api.URL, StripPrefix: true},
+			{Host: "Static.Example.com", Upstream: web.URL},
+		},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.DialTimeout != 10*time.Second || cfg.ResponseTimeout != 60*time.Second || !*cfg.Buffering {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	handler = cfg.Handler()
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/api/v1/users", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "api www.example.com /v1/users" {
+		t.Fatalf("unexpected api response %q", rec.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodGet, "http://static.example.com:8080/api/logo.png", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "web /api/logo.png" {
+		t.Fatalf("host route should win, got %q", rec.Body.String())
+	}
+
+	rt = &proxyRetryTransport{retries: 2, next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, fmt.Errorf("connection refused")
+	})}
+	_, err = rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://upstream/", nil))
+	if errors.Is(err, nil) || attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d (%v)", attempts, err)
+	}
+	attempts = 0
+	_, _ = rt.RoundTrip(httptest.NewRequest(http.MethodPost, "http://upstream/", strings.NewReader("x")))
+	if attempts != 1 {
+		t.Fatalf("POST should not be retried, got %d attempts", attempts)
+	}
+
+	cfg = HTTPProxyConfig{Routes: []HTTPProxyRoute{{PathPrefix: "/a", Upstream: api.URL}, {PathPrefix: "/a", Upstream: web.URL}}}
+	checkError(t, cfg.Verify(), "routes 1 and 2 have the same host and pathprefix")
+
+	cfg = HTTPProxyConfig{Routes: []HTTPProxyRoute{{PathPrefix: "api", Upstream: api.URL}}}
+	checkError(t, cfg.Verify(), "must begin with '/'")
+
+	cfg = HTTPProxyConfig{Routes: []HTTPProxyRoute{{PathPrefix: "/", Upstream: "ftp://files.internal"}}}
+	checkError(t, cfg.Verify(), "unsupported scheme")
+
+	cfg = HTTPProxyConfig{Routes: []HTTPProxyRoute{{Upstream: api.URL}}}
+	checkError(t, cfg.Verify(), "needs a host or pathprefix")
+
+	cfg = HTTPProxyConfig{}
+	checkError(t, cfg.Verify(), "at least one route")
+}
+
+func TestHTTPStaticConfig(t *testing.T) {
+	var (
+		dir     string
+		cfg     HTTPStaticConfig
+		pattern string
+		handler http.Handler
+		req     *http.Request
+		rec     *httptest.ResponseRecorder
+		err     error
+	)
+
+	dir = t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>app</html>"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzipped"), 0o644)
+
+	cfg = HTTPStaticConfig{Root: dir, URLPrefix: "/assets", CacheMaxAge: time.Hour, Precompressed: true, SPAFallback: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	pattern, handler = cfg.Handler()
+	if pattern != "/assets/" {
+		t.Fatalf("unexpected pattern %q", pattern)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "gzipped" || rec.Header().Get("Content-Encoding") != "gzip" ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Fatalf("expected precompressed app.js, got %q %v", rec.Body.String(), rec.Header())
+	}
+	if rec.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/app.js", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "console.log(1)" || len(rec.Header().Get("Content-Encoding")) > 0 {
+		t.Fatalf("expected plain app.js, got %q", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/users/42", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "<html>app</html>" || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected SPA fallback, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/missing.css", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing asset should be 404, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/../../etc/passwd", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "<html>app</html>" {
+		t.Fatalf("path traversal should stay inside root, got %q", rec.Body.String())
+	}
+
+	cfg = HTTPStaticConfig{Root: filepath.Join(dir, "app.js")}
+	checkError(t, cfg.Verify(), "is not a directory")
+
+	cfg = HTTPStaticConfig{Root: filepath.Join(dir, "nope")}
+	checkError(t, cfg.Verify(), "static root")
+
+	cfg = HTTPStaticConfig{Root: dir, URLPrefix: "assets/"}
+	checkError(t, cfg.Verify(), "must begin with '/'")
+
+	cfg = HTTPStaticConfig{}
+	checkError(t, cfg.Verify(), "missing static root")
+}
+
+func TestHTTPListen(t *testing.T) {
+	var (
+		cfg   HTTPConfig
+		sock  string
+		ln    net.Listener
+		info  os.FileInfo
+		index int
+		err   error
+	)
+
+	sock = filepath.Join(t.TempDir(), "http.sock")
+	cfg.UnixSocket = HTTPUnixSocketConfig{Mode: "0600", Group: strconv.Itoa(os.Getgid())}
+	err = cfg.UnixSocket.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	ln, err = cfg.Listen("unix:" + sock)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Listen returned error: %v", err)
+	}
+	info, err = os.Stat(sock)
+	if !errors.Is(err, nil) || info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected socket mode %v (%v)", info.Mode(), err)
+	}
+	// a socket left behind by a previous run is replaced
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = ln.Close()
+	ln, err = cfg.Listen("unix:" + sock)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Listen over a stale socket returned error: %v", err)
+	}
+	_ = ln.Close()
+
+	cfg.UnixSocket = HTTPUnixSocketConfig{Mode: "rw-rw----"}
+	checkError(t, cfg.UnixSocket.Verify(), "invalid unixsocket mode")
+
+	checkError(t, verifyBindAddr("http bindaddr", "unix:"), "missing the socket path")
+	checkError(t, verifyBindAddr("http bindaddr", "localhost"), "invalid http bindaddr")
+	checkError(t, verifyBindAddr("http bindaddr", "systemd:http"), "LISTEN_PID")
+	if !errors.Is(verifyBindAddr("http bindaddr", ":8080"), nil) {
+		t.Fatalf("expected :8080 to be accepted")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "http:https")
+	index, err = systemdListenerIndex("https")
+	if !errors.Is(err, nil) || index != 1 {
+		t.Fatalf("expected https at index 1, got %d (%v)", index, err)
+	}
+	index, err = systemdListenerIndex("")
+	if !errors.Is(err, nil) || index != 0 {
+		t.Fatalf("expected bare systemd at index 0, got %d (%v)", index, err)
+	}
+	_, err = systemdListenerIndex("2")
+	checkError(t, err, "out of range")
+	_, err = systemdListenerIndex("admin")
+	checkError(t, err, "no systemd socket named")
+}
+
+func TestHTTPVirtualHosts(t *testing.T) {
+	var (
+		mainCert, mainKey string
+		tenantCert        string
+		tenantKey         string
+		templates         string
+		cfg               HTTPConfig
+		tlsCfg            *tls.Config
+		cert              *tls.Certificate
+		vh                *HTTPVirtualHost
+		err               error
+	)
+
+	mainCert, mainKey = writeTestCertificate(t, []string{"www.example.com"}, time.Now().Add(365*24*time.Hour))
+	tenantCert, tenantKey = writeTestCertificate(t, []string{"*.tenant.example.net"}, time.Now().Add(365*24*time.Hour))
+	templates = t.TempDir()
+	_ = os.WriteFile(filepath.Join(templates, "index.html"), []byte("tenant"), 0o644)
+
+	cfg = HTTPConfig{
+		ExternalHostName: []string{"www.example.com"},
+		SkipHostNameTest: true,
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: mainCert, SSLPrivateKeyFile: mainKey},
+		VirtualHosts: []HTTPVirtualHost{
+			{Name: "tenant", HostNames: []string{"*.tenant.example.net"}, TemplatePath: templates,
+				StaticCert: &HTTPStaticCertConfig{SSLCertFile: tenantCert, SSLPrivateKeyFile: tenantKey}},
+		},
+	}
+	err = verifySubStructs(&struct{ HTTP *HTTPConfig }{HTTP: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.usesACME() {
+		t.Fatalf("no certificate should come from ACME")
+	}
+	tlsCfg, err = cfg.BuildTLSConfig(t.Context())
+	if !errors.Is(err, nil) {
+		t.Fatalf("BuildTLSConfig returned error: %v", err)
+	}
+	cert, err = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "shop.tenant.example.net"})
+	if !errors.Is(err, nil) || cert == nil || cert.Leaf.VerifyHostname("shop.tenant.example.net") != nil {
+		t.Fatalf("expected the tenant certificate, got %v", err)
+	}
+	cert, _ = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	if cert != nil {
+		t.Fatalf("the default site should fall back to tls.Config.Certificates")
+	}
+
+	vh = cfg.VirtualHost(httptest.NewRequest(http.MethodGet, "https://Shop.Tenant.example.net:8443/", nil))
+	if vh == nil || vh.TemplatePath != templates {
+		t.Fatalf("expected the tenant virtual host, got %+v", vh)
+	}
+	if cfg.VirtualHost(httptest.NewRequest(http.MethodGet, "https://a.b.tenant.example.net/", nil)) != nil {
+		t.Fatalf("a wildcard should match only one label")
+	}
+
+	// a virtual host without a certificate is added to the ACME host policy
+	cfg.VirtualHosts = append(cfg.VirtualHosts, HTTPVirtualHost{Name: "acme", HostNames: []string{"shop.example.org"}})
+	checkError(t, cfg.Verify(), "missing http.acme.email")
+	cfg.ACME = HTTPACMEConfig{Email: "admin@example.com", DiskCache: t.TempDir()}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if !cfg.usesACME() || strings.Join(cfg.ACME.hosts, ",") != "shop.example.org" {
+		t.Fatalf("unexpected ACME hosts %v", cfg.ACME.hosts)
+	}
+
+	cfg.VirtualHosts = []HTTPVirtualHost{
+		{Name: "a", HostNames: []string{"*.example.com"}, StaticCert: &HTTPStaticCertConfig{SSLCertFile: tenantCert, SSLPrivateKeyFile: tenantKey}},
+	}
+	checkError(t, cfg.Verify(), `hostname "*.example.com" overlaps "www.example.com" of externalhostname`)
+
+	cfg.VirtualHosts = []HTTPVirtualHost{
+		{Name: "a", HostNames: []string{"a.example.org"}},
+		{Name: "b", HostNames: []string{"A.example.org."}},
+	}
+	checkError(t, cfg.Verify(), `overlaps "a.example.org" of virtualhost "a"`)
+
+	cfg.VirtualHosts = []HTTPVirtualHost{{Name: "a", HostNames: []string{"*.example.org"}}}
+	checkError(t, cfg.Verify(), "wildcard hostname \"*.example.org\" requires a static_cert")
+	cfg.ACME.DNS = &HTTPACMEDNSConfig{Provider: "cloudflare", APIToken: "token"}
+	cfg.ACME.Email = "admin@example.com"
+	cfg.ACME.DiskCache = t.TempDir()
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(cfg.ACME.dnsHosts) != 1 || cfg.ACME.dnsHosts[0] != "*.example.org" {
+		t.Fatalf("expected the wildcard virtual host to be issued through dns-01, got %v and %v", cfg.ACME.dnsHosts, err)
+	}
+	cfg.ACME = HTTPACMEConfig{}
+
+	cfg.VirtualHosts = []HTTPVirtualHost{{Name: "a"}}
+	checkError(t, cfg.Verify(), `virtualhost "a" has no hostnames`)
+
+	cfg.VirtualHosts = []HTTPVirtualHost{{HostNames: []string{"b.example.org"}, StaticCert: &HTTPStaticCertConfig{SSLCertFile: tenantCert, SSLPrivateKeyFile: tenantKey}}}
+	checkError(t, cfg.Verify(), "virtualhost 1: static certificate")
+}
+
+func TestHTTPTemplatesConfig(t *testing.T) {
+	var (
+		dir string
+		cfg HTTPTemplatesConfig
+		ts  *TemplateSet
+		sb  strings.Builder
+		err error
+	)
+
+	dir = t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "page.html"), []byte(`[[define "page"]][[upper .]][[end]]`), 0o644)
+
+	cfg = HTTPTemplatesConfig{Path: dir, Reload: true, LeftDelim: "[[", RightDelim: "]]", Funcs: []string{"upper"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Glob() != filepath.Join(dir, "*") {
+		t.Fatalf("unexpected glob %q", cfg.Glob())
+	}
+	_, err = cfg.Load(nil, template.FuncMap{"lower": strings.ToLower})
+	checkError(t, err, `func "upper" is allowed but not provided`)
+	ts, err = cfg.Load(nil, template.FuncMap{"upper": strings.ToUpper, "lower": strings.ToLower})
+	if !errors.Is(err, nil) {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	executeTemplate(t, ts, &sb, "page", "hi")
+	if sb.String() != "HI" {
+		t.Fatalf("unexpected output %q", sb.String())
+	}
+
+	// with reload set, edits are picked up on the next Get
+	_ = os.WriteFile(filepath.Join(dir, "page.html"), []byte(`[[define "page"]]v2 [[.]][[end]]`), 0o644)
+	sb.Reset()
+	executeTemplate(t, ts, &sb, "page", "hi")
+	if sb.String() != "v2 hi" {
+		t.Fatalf("expected reloaded template, got %q", sb.String())
+	}
+
+	// functions outside the allowlist are not available
+	_ = os.WriteFile(filepath.Join(dir, "page.html"), []byte(`[[lower .]]`), 0o644)
+	_, err = ts.Get()
+	checkError(t, err, `function "lower" not defined`)
+
+	cfg = HTTPTemplatesConfig{Path: filepath.Join(dir, "*.tmpl")}
+	checkError(t, cfg.Verify(), "does not match any files")
+
+	cfg = HTTPTemplatesConfig{Path: filepath.Join(dir, "missing")}
+	checkError(t, cfg.Verify(), "does not match any files")
+
+	cfg = HTTPTemplatesConfig{Path: "templates/*.html", Embed: true}
+	if !errors.Is(cfg.Verify(), nil) {
+		t.Fatalf("embedded templates should not be checked on disk")
+	}
+	_, err = cfg.Load(nil, nil)
+	checkError(t, err, "no fs.FS was given")
+
+	cfg = HTTPTemplatesConfig{Path: dir, LeftDelim: "<%"}
+	checkError(t, cfg.Verify(), "must be set together")
+
+	cfg = HTTPTemplatesConfig{Path: dir, Funcs: []string{"to-upper"}}
+	checkError(t, cfg.Verify(), "invalid templates func name")
+}
+
+func TestHTTPSessionStore(t *testing.T) {
+	var (
+		cfg    HTTPConfig
+		stores SessionStores[string]
+		store  string
+		err    error
+	)
+
+	err = yaml.Unmarshal([]byte("sessioncookie:\n  hashkey: "+strings.Repeat("h", 32)+"\n  store: Redis\n  ttl: 12h\n  redis:\n    server: redis.internal:6379\n"), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Session.Store != "redis" || cfg.Session.TTL != 12*time.Hour || cfg.Session.Redis.Server != "redis.internal:6379" {
+		t.Fatalf("unexpected session config %+v", cfg.Session)
+	}
+
+	stores = SessionStores[string]{
+		Cookie: func(c *HTTPSessionCookieConfig, keyPairs ...[]byte) (string, error) {
+			return "cookie", nil
+		},
+		Redis: func(c *HTTPSessionCookieConfig, keyPairs ...[]byte) (string, error) {
+			return "redis " + c.Redis.Server + " " + string(keyPairs[0]), nil
+		},
+	}
+	store, err = NewSessionStore(&cfg.Session, stores)
+	if !errors.Is(err, nil) || store != "redis redis.internal:6379 "+strings.Repeat("h", 32) {
+		t.Fatalf("unexpected store %q (%v)", store, err)
+	}
+	cfg.Session.Store = "memstore"
+	_, err = NewSessionStore(&cfg.Session, stores)
+	checkError(t, err, `session store "memstore" is not supported`)
+
+	cfg.Session = HTTPSessionCookieConfig{MaxAgeSeconds: 3600}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) || cfg.Session.Store != "cookie" || cfg.Session.TTL != time.Hour {
+		t.Fatalf("unexpected defaults %+v (%v)", cfg.Session, err)
+	}
+
+	cfg.Session = HTTPSessionCookieConfig{Store: "redis"}
+	checkError(t, cfg.Session.Verify(), "requires the sessioncookie.redis section")
+
+	cfg.Session = HTTPSessionCookieConfig{Store: "filesystem"}
+	checkError(t, cfg.Session.Verify(), "invalid session store")
+
+	_, err = NewSessionStore(&HTTPSessionCookieConfig{Store: "cookie"}, stores)
+	checkError(t, err, "missing session hashkey")
+}
+
+func TestHTTPSessionKeys(t *testing.T) {
+	var (
+		cfg        HTTPSessionCookieConfig
+		hashKey    string
+		encryptKey string
+		pairs      [][]byte
+		err        error
+	)
+
+	hashKey, encryptKey, err = GenerateSessionKeys()
+	if !errors.Is(err, nil) {
+		t.Fatalf("GenerateSessionKeys returned error: %v", err)
+	}
+	cfg = HTTPSessionCookieConfig{HashKey: SessionKeys{hashKey}, EncryptKey: SessionKeys{encryptKey}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	pairs = cfg.KeyPairs()
+	if len(pairs) != 2 || len(pairs[0]) != 64 || len(pairs[1]) != 32 {
+		t.Fatalf("unexpected key pairs %d", len(pairs))
+	}
+
+	cfg = HTTPSessionCookieConfig{HashKey: SessionKeys{strings.Repeat("ab", 32)}, EncryptKey: SessionKeys{"0123456789abcdef"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	pairs = cfg.KeyPairs()
+	if len(pairs[0]) != 32 || string(pairs[1]) != "0123456789abcdef" {
+		t.Fatalf("expected hex hash key and raw encrypt key, got %d and %q", len(pairs[0]), pairs[1])
+	}
+
+	cfg = HTTPSessionCookieConfig{HashKey: SessionKeys{"secret"}}
+	checkError(t, cfg.Verify(), "session hashkey 1 must be 32 or 64 bytes, got 6")
+
+	cfg = HTTPSessionCookieConfig{HashKey: SessionKeys{hashKey}, EncryptKey: SessionKeys{base64.StdEncoding.EncodeToString(make([]byte, 20))}}
+	checkError(t, cfg.Verify(), "session encryptkey 1 must be 16, 24, or 32 bytes")
+
+	cfg = HTTPSessionCookieConfig{EncryptKey: SessionKeys{encryptKey}}
+	checkError(t, cfg.Verify(), "requires a hashkey")
+}
+
+func TestHTTPSessionKeyRotation(t *testing.T) {
+	var (
+		cfg        HTTPConfig
+		newH, newE string
+		oldH, oldE string
+		pairs      [][]byte
+		err        error
+	)
+
+	newH, newE, _ = GenerateSessionKeys()
+	oldH, oldE, _ = GenerateSessionKeys()
+	err = yaml.Unmarshal([]byte("sessioncookie:\n  hashkey: ["+newH+", "+oldH+"]\n  encryptkey: ["+newE+", "+oldE+"]\n"), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	pairs = cfg.Session.KeyPairs()
+	if len(pairs) != 4 || base64.StdEncoding.EncodeToString(pairs[0]) != newH || base64.StdEncoding.EncodeToString(pairs[3]) != oldE {
+		t.Fatalf("unexpected key pair order")
+	}
+
+	// a single key may still be a plain string, and the environment takes a comma separated list
+	cfg = HTTPConfig{}
+	err = yaml.Unmarshal([]byte("sessioncookie:\n  hashkey: "+newH+"\n"), &cfg)
+	if !errors.Is(err, nil) || len(cfg.Session.HashKey) != 1 {
+		t.Fatalf("unexpected hashkey %v (%v)", cfg.Session.HashKey, err)
+	}
+	t.Setenv("SESSIONHASHKEY", newH+","+oldH)
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	pairs = cfg.Session.KeyPairs()
+	if len(pairs) != 4 || pairs[1] != nil || pairs[3] != nil {
+		t.Fatalf("expected two hash keys without encryption, got %d entries", len(pairs))
+	}
+
+	cfg.Session = HTTPSessionCookieConfig{HashKey: SessionKeys{newH, oldH}, EncryptKey: SessionKeys{newE}}
+	checkError(t, cfg.Session.Verify(), "encryptkey has 1 entries, but hashkey has 2")
+
+	cfg.Session = HTTPSessionCookieConfig{HashKey: SessionKeys{newH, newH}}
+	checkError(t, cfg.Session.Verify(), "session hashkey 2 is a duplicate")
+}
+
+func TestHTTPSessionCookieAttributes(t *testing.T) {
+	var (
+		cfg    HTTPConfig
+		cookie *http.Cookie
+		err    error
+	)
+
+	err = yaml.Unmarshal([]byte("sessioncookie:\n  name: __Host-sid\n  secure: true\n  httponly: true\n  samesite: none\n  maxageseconds: 600\n"), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	cookie = cfg.Session.NewCookie("abc")
+	if cookie.Name != "__Host-sid" || cookie.Path != "/" || !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteNoneMode || cookie.MaxAge != 600 {
+		t.Fatalf("unexpected cookie %+v", cookie)
+	}
+
+	cfg.Session = HTTPSessionCookieConfig{}
+	err = cfg.Session.Verify()
+	if !errors.Is(err, nil) || cfg.Session.Name != "session" || cfg.Session.Path != "/" {
+		t.Fatalf("unexpected defaults %+v (%v)", cfg.Session, err)
+	}
+
+	cfg.Session = HTTPSessionCookieConfig{SameSite: http.SameSiteNoneMode}
+	checkError(t, cfg.Session.Verify(), "samesite none requires secure")
+
+	cfg.Session = HTTPSessionCookieConfig{Name: "__Secure-sid"}
+	checkError(t, cfg.Session.Verify(), `name "__Secure-sid" requires secure`)
+
+	cfg.Session = HTTPSessionCookieConfig{Name: "__Host-sid", Secure: true, Domain: "example.com"}
+	checkError(t, cfg.Session.Verify(), "requires secure, path")
+
+	cfg.Session = HTTPSessionCookieConfig{Name: "my session"}
+	checkError(t, cfg.Session.Verify(), "invalid session cookie")
+
+	cfg.Session = HTTPSessionCookieConfig{Path: "app"}
+	checkError(t, cfg.Session.Verify(), "must begin with '/'")
+}
+
+func TestLoggingNewSlogLogger(t *testing.T) {
+	var (
+		cfg    LoggingConfig
+		logger *slog.Logger
+		line   map[string]any
+		b      []byte
+		err    error
+	)
+
+	cfg = LoggingConfig{Handler: "JSON", Level: "debug", Output: "file", AddSource: true,
+		File: LoggingFileConfig{Path: filepath.Join(t.TempDir(), "app.log")}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.LogLevel() != slog.LevelDebug {
+		t.Fatalf("unexpected level %s", cfg.LogLevel())
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.Debug("started", "port", 8080)
+	b, _ = os.ReadFile(cfg.File.Path)
+	err = json.Unmarshal(b, &line)
+	if !errors.Is(err, nil) || line["msg"] != "started" || line["port"] != float64(8080) || line["source"] == nil {
+		t.Fatalf("unexpected log line %s (%v)", b, err)
+	}
+
+	cfg = LoggingConfig{SyslogEnabled: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Output != systemLogOutput || cfg.Handler != "text" || cfg.LogLevel() != slog.LevelInfo {
+		t.Fatalf("unexpected defaults %+v (%v)", cfg, err)
+	}
+
+	cfg = LoggingConfig{Handler: "xml"}
+	checkError(t, cfg.Verify(), "invalid logging handler")
+
+	cfg = LoggingConfig{Level: "verbose"}
+	checkError(t, cfg.Verify(), "invalid logging level")
+
+	cfg = LoggingConfig{Output: "file"}
+	checkError(t, cfg.Verify(), "requires file.path")
+
+	cfg = LoggingConfig{Output: "kafka"}
+	checkError(t, cfg.Verify(), "invalid logging output")
+}
+
+func TestLoggingFileConfig(t *testing.T) {
+	var (
+		dir     string
+		cfg     LoggingFileConfig
+		w       io.WriteCloser
+		lj      *lumberjack.Logger
+		line    []byte
+		matches []string
+		i       int
+		err     error
+	)
+
+	dir = t.TempDir()
+	cfg = LoggingFileConfig{Path: filepath.Join(dir, "app.log"), MaxSize: 1 << 20, MaxBackups: 2, MaxAge: 36 * time.Hour}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	w = cfg.Writer()
+	lj = w.(*lumberjack.Logger)
+	if lj.MaxSize != 1 || lj.MaxBackups != 2 || lj.MaxAge != 2 {
+		t.Fatalf("unexpected lumberjack settings %+v", lj)
+	}
+	line = []byte(strings.Repeat("x", 1023) + "\n")
+	for i = 0; i < 1100; i++ {
+		_, _ = w.Write(line)
+	}
+	_ = w.Close()
+	matches, _ = filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one rotated file, got %v", matches)
+	}
+
+	cfg = LoggingFileConfig{Path: filepath.Join(dir, "app.log")}
+	_ = cfg.Verify()
+	if cfg.MaxSize != 100<<20 {
+		t.Fatalf("unexpected default maxsize %d", cfg.MaxSize)
+	}
+
+	cfg = LoggingFileConfig{Path: filepath.Join(dir, "missing", "app.log")}
+	checkError(t, cfg.Verify(), "directory is not writable")
+
+	cfg = LoggingFileConfig{Path: dir}
+	checkError(t, cfg.Verify(), "is a directory")
+}
+
+func TestLoggingJournald(t *testing.T) {
+	var (
+		cfg      LoggingConfig
+		logger   *slog.Logger
+		sent     []map[string]string
+		priority []journal.Priority
+		err      error
+	)
+
+	journalSend = func(message string, p journal.Priority, vars map[string]string) error {
+		var (
+			fields map[string]string
+			name   string
+		)
+
+		fields = map[string]string{"MESSAGE": message}
+		for name = range vars {
+			fields[name] = vars[name]
+		}
+		sent = append(sent, fields)
+		priority = append(priority, p)
+		return nil
+	}
+	defer func() { journalSend = journal.Send }()
+
+	cfg = LoggingConfig{Level: "debug", Journald: LoggingJournaldConfig{Enabled: true, Fields: map[string]string{"DEPLOYMENT": "blue"}}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.Output != "journald" || len(cfg.Journald.Identifier) == 0 {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.With("user-id", 7).WithGroup("req").Warn("slow request", "path", "/api", slog.Group("db", "ms", 250))
+	if len(sent) != 1 || priority[0] != journal.PriWarning {
+		t.Fatalf("expected one warning entry, got %v %v", sent, priority)
+	}
+	if sent[0]["MESSAGE"] != "slow request" || sent[0]["USER_ID"] != "7" || sent[0]["REQ_PATH"] != "/api" ||
+		sent[0]["REQ_DB_MS"] != "250" || sent[0]["DEPLOYMENT"] != "blue" || sent[0]["SYSLOG_IDENTIFIER"] != cfg.Journald.Identifier {
+		t.Fatalf("unexpected journal fields %v", sent[0])
+	}
+
+	_, _ = cfg.Journald.Writer().Write([]byte("plain line\n"))
+	if len(sent) != 2 || sent[1]["MESSAGE"] != "plain line" || priority[1] != journal.PriInfo {
+		t.Fatalf("unexpected writer entry %v", sent[1])
+	}
+
+	cfg = LoggingConfig{Journald: LoggingJournaldConfig{Enabled: true, Fields: map[string]string{"deployment": "blue"}}}
+	checkError(t, cfg.Journald.Verify(), "invalid logging journald field name")
+}
+
+func TestLoggingGELF(t *testing.T) {
+	var (
+		cfg    LoggingConfig
+		conn   net.PacketConn
+		logger *slog.Logger
+		buf    []byte
+		n      int
+		zr     io.ReadCloser
+		body   []byte
+		msg    map[string]any
+		chunks int
+		err    error
+	)
+
+	conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("ListenPacket returned error: %v", err)
+	}
+	defer conn.Close()
+
+	cfg = LoggingConfig{Output: "gelf", GELF: LoggingGELFConfig{Address: conn.LocalAddr().String(), Fields: map[string]string{"environment": "test"}}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.GELF.Protocol != "udp" || cfg.GELF.Compression != "gzip" || len(cfg.GELF.Host) == 0 {
+		t.Fatalf("unexpected defaults %+v", cfg.GELF)
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.WithGroup("http").Error("request failed", "status", 502, "id", "abc")
+
+	buf = make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = conn.ReadFrom(buf)
+	if !errors.Is(err, nil) {
+		t.Fatalf("ReadFrom returned error: %v", err)
+	}
+	zr, err = gzip.NewReader(bytes.NewReader(buf[:n]))
+	if !errors.Is(err, nil) {
+		t.Fatalf("expected a gzip payload: %v", err)
+	}
+	body, _ = io.ReadAll(zr)
+	err = json.Unmarshal(body, &msg)
+	if !errors.Is(err, nil) || msg["version"] != "1.1" || msg["short_message"] != "request failed" || msg["level"] != float64(3) ||
+		msg["_http_status"] != float64(502) || msg["_http_id"] != "abc" || msg["_environment"] != "test" {
+		t.Fatalf("unexpected gelf message %s (%v)", body, err)
+	}
+
+	// messages too large for one datagram are chunked
+	cfg.GELF.Compression = "none"
+	logger = slog.New(cfg.GELF.Handler(nil))
+	logger.Info(strings.Repeat("x", 3*gelfChunkSize))
+	for chunks = 0; chunks < 4; chunks++ {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err = conn.ReadFrom(buf)
+		if !errors.Is(err, nil) {
+			t.Fatalf("ReadFrom returned error: %v", err)
+		}
+		if n > gelfChunkSize || buf[0] != 0x1e || buf[1] != 0x0f || buf[10] != byte(chunks) || buf[11] != 4 {
+			t.Fatalf("unexpected chunk %d header % x", chunks, buf[:12])
+		}
+	}
+
+	cfg = LoggingConfig{GELF: LoggingGELFConfig{Address: "graylog.internal", Protocol: "tcp", Compression: "gzip"}}
+	checkError(t, cfg.GELF.Verify(), "not supported over tcp")
+
+	cfg = LoggingConfig{GELF: LoggingGELFConfig{Address: "graylog.internal", Fields: map[string]string{"id": "x"}}}
+	checkError(t, cfg.GELF.Verify(), `invalid logging gelf field name "id"`)
+
+	cfg = LoggingConfig{Output: "gelf"}
+	checkError(t, cfg.Verify(), "requires gelf.address")
+}
+
+func TestLoggingLoki(t *testing.T) {
+	var (
+		cfg    LoggingConfig
+		server *httptest.Server
+		pushes chan map[string]any
+		logger *slog.Logger
+		push   map[string]any
+		stream map[string]any
+		err    error
+	)
+
+	pushes = make(chan map[string]any, 4)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body map[string]any
+			user string
+			pass string
+		)
+
+		user, pass, _ = r.BasicAuth()
+		if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("X-Scope-OrgID") != "edge" || user != "shipper" || pass != "s3cret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		pushes <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg = LoggingConfig{Output: "loki", Loki: LoggingLokiConfig{URL: server.URL, TenantID: "edge", BatchSize: 2,
+		BatchInterval: time.Hour, User: "shipper", Password: "s3cret", Labels: map[string]string{"site": "store-42"}}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if len(cfg.Loki.Labels["job"]) == 0 {
+		t.Fatalf("expected a default job label")
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.Info("one")
+	logger.Info("two", "n", 2)
+
+	// a full batch is pushed without waiting for the interval
+	select {
+	case push = <-pushes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no push received")
+	}
+	stream = push["streams"].([]any)[0].(map[string]any)
+	if stream["stream"].(map[string]any)["site"] != "store-42" || len(stream["values"].([]any)) != 2 ||
+		stream["values"].([]any)[1].([]any)[1] != "level=INFO msg=two n=2" {
+		t.Fatalf("unexpected push %v", push)
+	}
+
+	// Close sends what is left
+	logger.Warn("three")
+	err = logger.Handler().(*LokiHandler).Close()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	push = <-pushes
+	if len(push["streams"].([]any)[0].(map[string]any)["values"].([]any)) != 1 {
+		t.Fatalf("unexpected final push %v", push)
+	}
+
+	cfg = LoggingConfig{Loki: LoggingLokiConfig{URL: "ftp://loki.internal"}}
+	checkError(t, cfg.Loki.Verify(), "invalid logging loki url")
+
+	cfg = LoggingConfig{Loki: LoggingLokiConfig{URL: server.URL, Labels: map[string]string{"__name__": "x"}}}
+	checkError(t, cfg.Loki.Verify(), "invalid logging loki label name")
+
+	cfg = LoggingConfig{Loki: LoggingLokiConfig{URL: server.URL, User: "shipper"}}
+	checkError(t, cfg.Loki.Verify(), "must be set together")
+
+	cfg = LoggingConfig{Output: "loki"}
+	checkError(t, cfg.Verify(), "requires loki.url")
+}
+
+func TestLoggingZapZerolog(t *testing.T) {
+	var (
+		cfg LoggingConfig
+		zc  zap.Config
+		zo  ZerologOptions
+		ok  bool
+		err error
+	)
+
+	cfg = LoggingConfig{Level: "warn", Output: "stdout", AddSource: true}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	zc, err = cfg.ToZapConfig()
+	if !errors.Is(err, nil) {
+		t.Fatalf("ToZapConfig returned error: %v", err)
+	}
+	if zc.Level.Level() != zapcore.WarnLevel || zc.Encoding != "console" || zc.DisableCaller ||
+		len(zc.OutputPaths) != 1 || zc.OutputPaths[0] != "stdout" {
+		t.Fatalf("unexpected zap config %+v", zc)
+	}
+	zo, err = cfg.ToZerologOptions()
+	if !errors.Is(err, nil) {
+		t.Fatalf("ToZerologOptions returned error: %v", err)
+	}
+	if zo.Level != zerolog.WarnLevel || !zo.Caller {
+		t.Fatalf("unexpected zerolog options %+v", zo)
+	}
+	_, ok = zo.Writer.(zerolog.ConsoleWriter)
+	if !ok {
+		t.Fatalf("expected a ConsoleWriter for the text handler, got %T", zo.Writer)
+	}
+
+	cfg = LoggingConfig{Handler: "json", Level: "debug"}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	zc, err = cfg.ToZapConfig()
+	if !errors.Is(err, nil) {
+		t.Fatalf("ToZapConfig returned error: %v", err)
+	}
+	if zc.Level.Level() != zapcore.DebugLevel || zc.Encoding != "json" || !zc.DisableCaller || zc.OutputPaths[0] != "stderr" {
+		t.Fatalf("unexpected zap config %+v", zc)
+	}
+	zo, err = cfg.ToZerologOptions()
+	if !errors.Is(err, nil) {
+		t.Fatalf("ToZerologOptions returned error: %v", err)
+	}
+	if zo.Level != zerolog.DebugLevel || zo.Writer != os.Stderr {
+		t.Fatalf("unexpected zerolog options %+v", zo)
+	}
+
+	cfg = LoggingConfig{Output: "gelf", GELF: LoggingGELFConfig{Address: "graylog.internal"}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	_, err = cfg.ToZapConfig()
+	checkError(t, err, "not supported by zap")
+	_, err = cfg.ToZerologOptions()
+	checkError(t, err, "not supported by zerolog")
+}
+
+func TestHTTPAccessLog(t *testing.T) {
+	var (
+		cfg     HTTPConfig
+		dir     string
+		handler http.Handler
+		rec     *httptest.ResponseRecorder
+		req     *http.Request
+		data    []byte
+		entry   map[string]any
+		err     error
+	)
+
+	dir = t.TempDir()
+	cfg = HTTPConfig{AccessLog: HTTPAccessLogConfig{Enabled: true, Output: filepath.Join(dir, "access.log"),
+		Redact: []string{"token", "UserAgent"}}}
+	err = cfg.AccessLog.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	handler = cfg.AccessLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	}))
+	req = httptest.NewRequest(http.MethodGet, "/brew?token=s3cret&kind=earl", nil)
+	req.RemoteAddr = "192.0.2.10:4711"
+	req.Header.Set("User-Agent", "kettle/1.0")
+	req.SetBasicAuth("alice", "pw")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	data, err = os.ReadFile(filepath.Join(dir, "access.log"))
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to read access log: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "192.0.2.10 - alice [") ||
+		!strings.HasSuffix(string(data), "] \"GET /brew?token=REDACTED&kind=earl HTTP/1.1\" 418 15 \"\" \"\"\n") {
+		t.Fatalf("unexpected combined log line %q", data)
+	}
+
+	// json with a server error, which is logged despite sampling
+	cfg = HTTPConfig{AccessLog: HTTPAccessLogConfig{Enabled: true, Format: "json", Output: filepath.Join(dir, "access.json"),
+		SampleRate: 0.000001}}
+	err = cfg.AccessLog.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	handler = cfg.AccessLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", nil))
+	data, err = os.ReadFile(filepath.Join(dir, "access.json"))
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to read access log: %v", err)
+	}
+	err = json.Unmarshal(data, &entry)
+	if !errors.Is(err, nil) {
+		t.Fatalf("access log is not json: %v: %s", err, data)
+	}
+	if entry["method"] != "POST" || entry["uri"] != "/fail" || entry["status"] != float64(500) {
+		t.Fatalf("unexpected json entry %v", entry)
+	}
+
+	// custom template
+	cfg = HTTPConfig{AccessLog: HTTPAccessLogConfig{Enabled: true, Format: "{{.Method}} {{.URI}} {{.Status}}",
+		Output: filepath.Join(dir, "access.txt")}}
+	err = cfg.AccessLog.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	cfg.AccessLogHandler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	data, _ = os.ReadFile(filepath.Join(dir, "access.txt"))
+	if string(data) != "GET /missing 404\n" {
+		t.Fatalf("unexpected template log line %q", data)
+	}
+
+	handler = http.NotFoundHandler()
+	cfg = HTTPConfig{}
+	if cfg.AccessLogHandler(handler) == nil {
+		t.Fatalf("expected next to be returned when the access log is disabled")
+	}
+
+	cfg = HTTPConfig{AccessLog: HTTPAccessLogConfig{Enabled: true, Format: "{{.Nope}}"}}
+	checkError(t, cfg.AccessLog.Verify(), "invalid accesslog format")
+
+	cfg = HTTPConfig{AccessLog: HTTPAccessLogConfig{Enabled: true, SampleRate: 2}}
+	checkError(t, cfg.AccessLog.Verify(), "accesslog samplerate must be between 0 and 1")
+}
+
+func TestLoggingSyslogNames(t *testing.T) {
+	var (
+		cfg LoggingConfig
+		err error
+	)
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{FacilityString: " local3", SeverityString: "Warn"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Syslog.FacilityString != "LOG_LOCAL3" || cfg.Syslog.SeverityString != "LOG_WARNING" || cfg.Syslog.priority != 19<<3|4 {
+		t.Fatalf("unexpected syslog settings %+v", cfg.Syslog)
+	}
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{FacilityString: "log_daemon", SeverityString: "error"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Syslog.priority != 3<<3|3 {
+		t.Fatalf("unexpected priority %d", cfg.Syslog.priority)
+	}
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{FacilityString: "local9"}}
+	checkError(t, cfg.Verify(), "(expected one of kern, user, mail, daemon, auth, syslog, lpr, news, uucp, cron, authpriv, ftp, local0,")
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{SeverityString: "verbose"}}
+	checkError(t, cfg.Verify(), "(expected one of emerg, alert, crit, err, warning, notice, info, debug)")
+}
+
+func TestLoggingSampling(t *testing.T) {
+	var (
+		cfg     LoggingConfig
+		path    string
+		logger  *slog.Logger
+		zc      zap.Config
+		zlogger *zap.Logger
+		data    []byte
+		i       int
+		err     error
+	)
+
+	path = filepath.Join(t.TempDir(), "app.log")
+	cfg = LoggingConfig{Output: "file", File: LoggingFileConfig{Path: path},
+		Sampling: &LoggingSamplingConfig{Initial: 2, Thereafter: 3, PerSecond: 4}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	// records 1, 2, and 5 of the flood are sampled, then one other message fills the cap of 4
+	for i = 0; i < 7; i++ {
+		logger.Debug("ignored below the level")
+		logger.Info("flood", "i", i)
+	}
+	logger.Info("other")
+	logger.Info("over the cap")
+	data, _ = os.ReadFile(path)
+	if strings.Count(string(data), "msg=flood") != 3 || !strings.Contains(string(data), "i=4") ||
+		!strings.Contains(string(data), "msg=other") || strings.Contains(string(data), "over the cap") {
+		t.Fatalf("unexpected sampled log %s", data)
+	}
+
+	cfg = LoggingConfig{Output: "file", File: LoggingFileConfig{Path: filepath.Join(t.TempDir(), "zap.log")},
+		Sampling: &LoggingSamplingConfig{Initial: 1, Thereafter: 100}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	zc, err = cfg.ToZapConfig()
+	if !errors.Is(err, nil) {
+		t.Fatalf("ToZapConfig returned error: %v", err)
+	}
+	zlogger, err = zc.Build(cfg.ZapOptions()...)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Build returned error: %v", err)
+	}
+	for i = 0; i < 5; i++ {
+		zlogger.Info("flood")
+	}
+	_ = zlogger.Sync()
+	data, _ = os.ReadFile(cfg.File.Path)
+	if strings.Count(string(data), "flood") != 1 {
+		t.Fatalf("unexpected sampled zap log %s", data)
+	}
+
+	cfg = LoggingConfig{Sampling: &LoggingSamplingConfig{}}
+	err = verifySubStructs(&struct{ Logging *LoggingConfig }{Logging: &cfg})
+	if !errors.Is(err, nil) || cfg.Sampling.Initial != 100 || cfg.Sampling.Thereafter != 100 {
+		t.Fatalf("unexpected sampling defaults %+v (%v)", cfg.Sampling, err)
+	}
+
+	cfg = LoggingConfig{Sampling: &LoggingSamplingConfig{PerSecond: -1}}
+	checkError(t, cfg.Sampling.Verify(), "cannot be negative")
+}
+
+func TestJobsConfig(t *testing.T) {
+	var (
+		cfg   JobsConfig
+		job   *JobConfig
+		start time.Time
+		next  time.Time
+		ctx   context.Context
+		stop  context.CancelFunc
+		runs  chan time.Duration
+		left  time.Duration
+		err   error
+	)
+
+	err = yaml.Unmarshal([]byte("cleanup: \"0 3 * * *\"\nreport:\n  schedule: \"CRON_TZ=America/Phoenix 0 7 * * 1-5\"\n  timeout: 10m\n  jitter: 2m\nreindex:\n  schedule: \"@every 6h\"\n  enabled: false\n"), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("yaml.Unmarshal returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Jobs *JobsConfig }{Jobs: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if len(cfg.Jobs) != 3 || !cfg.Job("cleanup").IsEnabled() || cfg.Job("reindex").IsEnabled() || cfg.Job("missing") != nil {
+		t.Fatalf("unexpected jobs %+v", cfg.Jobs)
+	}
+	start = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	next = cfg.Job("cleanup").Next(start)
+	if !next.Equal(time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next cleanup %s", next)
+	}
+	// 07:00 in Phoenix is 14:00 UTC, delayed by up to two minutes of jitter
+	next = cfg.Job("report").Next(start)
+	if next.Before(time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)) || !next.Before(time.Date(2026, 3, 2, 14, 2, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next report %s", next)
+	}
+
+	// Run calls the function on schedule with the timeout applied
+	job = &JobConfig{Schedule: "@every 1s", Timeout: time.Minute, name: "tick"}
+	err = job.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	runs = make(chan time.Duration, 1)
+	ctx, stop = context.WithCancel(context.Background())
+	defer stop()
+	go job.Run(ctx, func(ctx context.Context) error {
+		var deadline time.Time
+
+		deadline, _ = ctx.Deadline()
+		runs <- time.Until(deadline)
+		stop()
+		return nil
+	})
+	select {
+	case left = <-runs:
+		if left <= 0 || left > time.Minute {
+			t.Fatalf("unexpected run deadline %s", left)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job did not run")
+	}
+
+	cfg = JobsConfig{Jobs: map[string]*JobConfig{"broken": {Schedule: "61 * * * *"}}}
+	checkError(t, cfg.Verify(), `invalid schedule "61 * * * *" for job "broken"`)
+
+	cfg = JobsConfig{Jobs: map[string]*JobConfig{"empty": {}}}
+	checkError(t, cfg.Verify(), `job "empty" has no schedule`)
+
+	cfg = JobsConfig{Jobs: map[string]*JobConfig{"late": {Schedule: "@hourly", Jitter: -time.Second}}}
+	checkError(t, cfg.Verify(), "cannot be negative")
+}
+
+func TestCacheConfig(t *testing.T) {
+	var (
+		cfg   CacheConfig
+		cache Cache
+		mc    *MemoryCache
+		value []byte
+		found bool
+		ctx   context.Context
+		err   error
+	)
+
+	ctx = context.Background()
+	err = yaml.Unmarshal([]byte("maxentries: 2\nmaxmemory: 1KiB\ndefaultttl: 50ms\n"), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("yaml.Unmarshal returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Cache *CacheConfig }{Cache: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.Backend != "memory" || cfg.Eviction != "lru" || cfg.MaxMemory != 1024 {
+		t.Fatalf("unexpected cache defaults %+v", cfg)
+	}
+	cache, err = cfg.NewCache(nil)
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewCache returned error: %v", err)
+	}
+
+	// lru: reading a keeps it, so b is evicted
+	_ = cache.Set(ctx, "a", []byte("1"), time.Hour)
+	_ = cache.Set(ctx, "b", []byte("2"), time.Hour)
+	_, _, _ = cache.Get(ctx, "a")
+	_ = cache.Set(ctx, "c", []byte("3"), time.Hour)
+	_, found, _ = cache.Get(ctx, "b")
+	if found {
+		t.Fatalf("expected b to be evicted")
+	}
+	value, found, _ = cache.Get(ctx, "a")
+	if !found || string(value) != "1" {
+		t.Fatalf("expected a to be kept, got %q %v", value, found)
+	}
+
+	// the default ttl applies when none is given
+	_ = cache.Set(ctx, "short", []byte("x"), 0)
+	time.Sleep(80 * time.Millisecond)
+	_, found, _ = cache.Get(ctx, "short")
+	if found {
+		t.Fatalf("expected short to expire")
+	}
+
+	// maxmemory evicts by size, and an oversized value is not stored
+	cfg = CacheConfig{MaxMemory: 10, Eviction: "FIFO"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	mc = cfg.NewMemoryCache()
+	_ = mc.Set(ctx, "k1", []byte("aaa"), 0)
+	_ = mc.Set(ctx, "k2", []byte("bbb"), 0)
+	_, _, _ = mc.Get(ctx, "k1")
+	_ = mc.Set(ctx, "k3", []byte("c"), 0)
+	_, found, _ = mc.Get(ctx, "k1")
+	if found || mc.Len() != 2 {
+		t.Fatalf("expected k1 to be evicted first with fifo, len %d", mc.Len())
+	}
+	_ = mc.Set(ctx, "big", []byte("0123456789"), 0)
+	_, found, _ = mc.Get(ctx, "big")
+	if found {
+		t.Fatalf("expected an oversized value not to be stored")
+	}
+	_ = mc.Delete(ctx, "k2")
+	if mc.Len() != 1 {
+		t.Fatalf("expected 1 entry after delete, got %d", mc.Len())
+	}
+
+	cfg = CacheConfig{Backend: "redis", Redis: &RedisConfig{Server: "redis.local:6379"}}
+	err = verifySubStructs(&struct{ Cache *CacheConfig }{Cache: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	_, err = cfg.NewCache(nil)
+	checkError(t, err, "not supported by this application")
+
+	cfg = CacheConfig{Backend: "redis"}
+	checkError(t, cfg.Verify(), "requires the cache.redis section")
+
+	cfg = CacheConfig{Eviction: "lfu"}
+	checkError(t, cfg.Verify(), "invalid cache eviction")
+
+	cfg = CacheConfig{Backend: "memcached"}
+	checkError(t, cfg.Verify(), "invalid cache backend")
+}
+
+func TestProxyConfig(t *testing.T) {
+	var (
+		cfg     ProxyConfig
+		httpCfg HTTPConfig
+		proxy   *httptest.Server
+		seen    chan string
+		ip      net.IP
+		req     *http.Request
+		u       *url.URL
+		err     error
+	)
+
+	seen = make(chan string, 1)
+	proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.URL.String()
+		_, _ = w.Write([]byte("203.0.113.9\n"))
+	}))
+	defer proxy.Close()
+
+	// the external IP probe goes through the proxy
+	httpCfg = HTTPConfig{ExternalIPProviders: []string{"http://ip.provider.test/raw"},
+		OutboundProxy: ProxyConfig{HTTPProxy: proxy.URL}}
+	err = httpCfg.OutboundProxy.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	ip, err = httpCfg.ExternalIP(context.Background())
+	if !errors.Is(err, nil) || !ip.Equal(net.ParseIP("203.0.113.9")) {
+		t.Fatalf("unexpected external IP %s (%v)", ip, err)
+	}
+	if <-seen != "http://ip.provider.test/raw" {
+		t.Fatalf("expected the proxy to receive the provider request")
+	}
+
+	// noproxy hosts are reached directly
+	cfg = ProxyConfig{HTTPSProxy: "http://proxy.corp.example:3128", NoProxy: []string{".corp.example", "10.0.0.0/8"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Environment {
+		t.Fatalf("unexpected Verify result %+v (%v)", cfg, err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "https://api.vendor.example/v1", nil)
+	u, err = cfg.ProxyFunc()(req)
+	if !errors.Is(err, nil) || u == nil || u.Host != "proxy.corp.example:3128" {
+		t.Fatalf("expected the https proxy, got %v (%v)", u, err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "https://wiki.corp.example/", nil)
+	u, _ = cfg.ProxyFunc()(req)
+	if u != nil {
+		t.Fatalf("expected a direct connection for a noproxy domain, got %v", u)
+	}
+	req = httptest.NewRequest(http.MethodGet, "https://10.1.2.3/", nil)
+	u, _ = cfg.ProxyFunc()(req)
+	if u != nil {
+		t.Fatalf("expected a direct connection for a noproxy range, got %v", u)
+	}
+
+	// with nothing set the environment is used
+	t.Setenv("HTTPS_PROXY", "http://envproxy.example:8080")
+	t.Setenv("NO_PROXY", "")
+	cfg = ProxyConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || !cfg.Environment {
+		t.Fatalf("expected environment to default to true (%v)", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "https://api.vendor.example/v1", nil)
+	u, _ = cfg.Transport().Proxy(req)
+	if u == nil || u.Host != "envproxy.example:8080" {
+		t.Fatalf("expected the environment proxy, got %v", u)
+	}
+
+	cfg = ProxyConfig{HTTPProxy: "ftp://proxy.corp.example"}
+	checkError(t, cfg.Verify(), "invalid proxy httpproxy")
+}
+
+func TestAppConfig(t *testing.T) {
+	type appRoot struct {
+		App AppConfig `yaml:"app"`
+	}
+	var (
+		cfg     AppConfig
+		root    appRoot
+		path    string
+		logging LoggingConfig
+		otelCfg OTelConfig
+		logger  *slog.Logger
+		env     map[string]string
+		data    []byte
+		err     error
+	)
+
+	defer currentApp.Store(nil)
+	if len(CurrentApp().Name) > 0 {
+		t.Fatalf("expected no current app before Read")
+	}
+
+	t.Setenv("APPENV", "Production")
+	path = writeTempConfig(t, "app:\n  name: billing\n  version: 1.8.2\n  instanceid: billing-7\n  region: us-west-2\n")
+	err = Read(path, &root)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if root.App.Environment != "prod" || !CurrentApp().IsProduction() || CurrentApp().Name != "billing" {
+		t.Fatalf("unexpected app %+v", CurrentApp())
+	}
+
+	// loggers carry the app fields
+	logging = LoggingConfig{Output: "file", File: LoggingFileConfig{Path: filepath.Join(t.TempDir(), "app.log")}}
+	err = logging.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	logger, err = logging.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.Info("started")
+	data, _ = os.ReadFile(logging.File.Path)
+	if !strings.Contains(string(data), "msg=started app=billing env=prod version=1.8.2 instance=billing-7 region=us-west-2") {
+		t.Fatalf("unexpected log line %s", data)
+	}
+
+	// and so do the tracing resource attributes
+	otelCfg = OTelConfig{Enabled: true, Endpoint: "otel-collector:4317", ServiceName: "billing"}
+	env = otelCfg.ExporterEnv()
+	if env["OTEL_RESOURCE_ATTRIBUTES"] != "cloud.region=us-west-2,deployment.environment.name=prod,service.instance.id=billing-7,service.version=1.8.2" {
+		t.Fatalf("unexpected resource attributes %q", env["OTEL_RESOURCE_ATTRIBUTES"])
+	}
+
+	cfg = AppConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Environment != "dev" || len(cfg.Name) == 0 {
+		t.Fatalf("unexpected app defaults %+v (%v)", cfg, err)
+	}
+	if !CurrentApp().IsProduction() {
+		t.Fatalf("Verify alone should not change the current app")
+	}
+
+	t.Setenv("APPENV", "qa")
+	checkError(t, Read(path, &appRoot{}), "invalid app environment")
+	if !CurrentApp().IsProduction() {
+		t.Fatalf("a failed Read should not change the current app")
+	}
+}
+
+func TestProcessConfig(t *testing.T) {
+	var (
+		cfg   ProcessConfig
+		dir   string
+		me    *user.User
+		procs int
+		data  []byte
+		err   error
+	)
+
+	dir = t.TempDir()
+	procs = runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(procs)
+
+	t.Setenv("PIDFILE", filepath.Join(dir, "billing.pid"))
+	cfg = ProcessConfig{WorkingDir: dir, GOMAXPROCS: 2}
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Process *ProcessConfig }{Process: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	cfg.WorkingDir = ""
+	err = cfg.Apply()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	data, _ = os.ReadFile(cfg.PIDFile)
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" || runtime.GOMAXPROCS(0) != 2 {
+		t.Fatalf("unexpected pidfile %q or GOMAXPROCS %d", data, runtime.GOMAXPROCS(0))
+	}
+	err = cfg.RemovePIDFile()
+	if !errors.Is(err, nil) {
+		t.Fatalf("RemovePIDFile returned error: %v", err)
+	}
+	if _, err = os.Stat(cfg.PIDFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected pidfile to be removed, got %v", err)
+	}
+
+	// a pidfile held by a running process is refused, a stale one is replaced
+	_ = os.WriteFile(cfg.PIDFile, []byte(strconv.Itoa(os.Getppid())+"\n"), 0o644)
+	checkError(t, cfg.Apply(), "belongs to running process")
+	_ = os.WriteFile(cfg.PIDFile, []byte("not a pid\n"), 0o644)
+	err = cfg.Apply()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+
+	cfg = ProcessConfig{PIDFile: filepath.Join(dir, "missing", "billing.pid")}
+	checkError(t, cfg.Verify(), "process pidfile directory is not writable")
+	cfg = ProcessConfig{WorkingDir: filepath.Join(dir, "billing.pid")}
+	checkError(t, cfg.Verify(), "is not a directory")
+	cfg = ProcessConfig{GOMAXPROCS: -1}
+	checkError(t, cfg.Verify(), "gomaxprocs cannot be negative")
+
+	if runtime.GOOS == "windows" {
+		cfg = ProcessConfig{Umask: "027"}
+		checkError(t, cfg.Verify(), "not supported on windows")
+		return
+	}
+	me, err = user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	cfg = ProcessConfig{Umask: "027", User: me.Username}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.umask != 0o27 || strconv.Itoa(cfg.uid) != me.Uid || strconv.Itoa(cfg.gid) != me.Gid {
+		t.Fatalf("unexpected umask %o, uid %d, or gid %d", cfg.umask, cfg.uid, cfg.gid)
+	}
+	cfg = ProcessConfig{User: "1234", Group: "5678"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.uid != 1234 || cfg.gid != 5678 {
+		t.Fatalf("unexpected uid %d or gid %d (%v)", cfg.uid, cfg.gid, err)
+	}
+	cfg = ProcessConfig{Umask: "899"}
+	checkError(t, cfg.Verify(), "invalid process umask")
+	cfg = ProcessConfig{User: "no-such-user-serverconfig"}
+	checkError(t, cfg.Verify(), "invalid process user")
+	cfg = ProcessConfig{Group: "no-such-group-serverconfig"}
+	checkError(t, cfg.Verify(), "invalid process group")
+}
+
+func TestShutdownConfig(t *testing.T) {
+	var (
+		cfg      ShutdownConfig
+		orch     *Orchestrator
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopped  []string
+		stop     func(name string, err error) StopFunc
+		mu       sync.Mutex
+		warnings []string
+		err      error
+	)
+
+	err = yaml.Unmarshal([]byte(`
+signals: [term, SIGHUP]
+graceperiod: 2s
+order:
+  - name: health
+    timeout: 50ms
+  - http
+  - database
+`), &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Shutdown *ShutdownConfig }{Shutdown: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if strings.Join(cfg.Signals, ",") != "SIGTERM,SIGHUP" || len(cfg.OSSignals()) != 2 || cfg.Order[1].Name != "http" {
+		t.Fatalf("unexpected shutdown config %+v", cfg)
+	}
+
+	stop = func(name string, err error) StopFunc {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			stopped = append(stopped, name)
+			mu.Unlock()
+			return err
+		}
+	}
+	orch = cfg.NewOrchestrator()
+	orch.Register("cache", stop("cache", nil))
+	orch.Register("database", stop("database", errors.New("close failed")))
+	orch.Register("http", stop("http", nil))
+	orch.Register("health", func(ctx context.Context) error {
+		<-time.After(time.Second)
+		return nil
+	})
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = orch.Wait(ctx)
+	checkError(t, err, "shutdown of health: context deadline exceeded")
+	checkError(t, err, "shutdown of database: close failed")
+	mu.Lock()
+	if strings.Join(stopped, ",") != "http,database,cache" {
+		t.Fatalf("unexpected shutdown order %v", stopped)
+	}
+	mu.Unlock()
+
+	cfg = ShutdownConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.GracePeriod != 30*time.Second || strings.Join(cfg.Signals, ",") != "SIGINT,SIGTERM" {
+		t.Fatalf("unexpected shutdown defaults %+v (%v)", cfg, err)
+	}
+
+	captureWarnings(t, &warnings)
+	cfg = ShutdownConfig{GracePeriod: time.Second, Order: []ShutdownStepConfig{{Name: "http", Timeout: time.Minute}}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(warnings) != 1 {
+		t.Fatalf("expected a graceperiod warning, got %v (%v)", warnings, err)
+	}
+
+	cfg = ShutdownConfig{Signals: []string{"SIGUSR9"}}
+	checkError(t, cfg.Verify(), "invalid shutdown signal")
+	cfg = ShutdownConfig{Order: []ShutdownStepConfig{{Name: "http"}, {Name: "http"}}}
+	checkError(t, cfg.Verify(), "more than once")
+	cfg = ShutdownConfig{Order: []ShutdownStepConfig{{Timeout: time.Second}}}
+	checkError(t, cfg.Verify(), "has no name")
+}
+
+func TestBackupConfig(t *testing.T) {
+	type backupRoot struct {
+		Storage struct {
+			Primary ObjectStoreConfig `yaml:"objectstore"`
+			Archive GCSConfig         `yaml:"archive"`
+		} `yaml:"storage"`
+		Health HealthConfig `yaml:"health"`
+		Backup BackupConfig `yaml:"backup"`
+	}
+	var (
+		yamlBody string
+		path     string
+		cfg      backupRoot
+		key      string
+		err      error
+	)
+
+	key = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	t.Setenv("BACKUP_KEY", key)
+	yamlBody = "storage:\n  objectstore:\n    bucket: acme-backups\n  archive:\n    bucket: acme-archive\nbackup:\n  schedule: \"0 2 * * *\"\n  prefix: /billing/\n  retentioncount: 3\n  encryptionkeyenv: BACKUP_KEY\n"
+	path = writeTempConfig(t, yamlBody)
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Backup.Store() != &cfg.Storage.Primary || cfg.Backup.Prefix != "billing/" || len(cfg.Backup.EncryptionKey()) != 32 {
+		t.Fatalf("unexpected backup config %+v", cfg.Backup)
+	}
+	if !cfg.Backup.Next(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)).Equal(time.Date(2026, 1, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next backup time")
+	}
+	if cfg.Backup.Expired(time.Now(), 2) || !cfg.Backup.Expired(time.Now(), 3) {
+		t.Fatalf("unexpected retention by count")
+	}
+
+	cfg = backupRoot{}
+	path = writeTempConfig(t, strings.Replace(yamlBody, "prefix:", "destination: archive\n  prefix:", 1))
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) || cfg.Backup.Store() != &cfg.Storage.Archive {
+		t.Fatalf("expected archive destination, got %v (%v)", cfg.Backup.Store(), err)
+	}
+
+	cfg = backupRoot{}
+	path = writeTempConfig(t, strings.Replace(yamlBody, "prefix:", "destination: health\n  prefix:", 1))
+	checkError(t, Read(path, &cfg), "is not an object storage section")
+	cfg = backupRoot{}
+	path = writeTempConfig(t, strings.Replace(yamlBody, "prefix:", "destination: azureblob\n  prefix:", 1))
+	checkError(t, Read(path, &cfg), "Backup: backup destination \"azureblob\" is not a section")
+
+	cfg.Backup = BackupConfig{Schedule: "@daily", RetentionAge: 48 * time.Hour}
+	err = cfg.Backup.Verify()
+	if !errors.Is(err, nil) || cfg.Backup.RetentionCount != 0 || cfg.Backup.EncryptionKey() != nil {
+		t.Fatalf("unexpected backup defaults %+v (%v)", cfg.Backup, err)
+	}
+	if cfg.Backup.Expired(time.Now().Add(-time.Hour), 100) || !cfg.Backup.Expired(time.Now().Add(-72*time.Hour), 0) {
+		t.Fatalf("unexpected retention by age")
+	}
+	cfg.Backup = BackupConfig{Schedule: "@daily"}
+	err = cfg.Backup.Verify()
+	if !errors.Is(err, nil) || cfg.Backup.RetentionCount != 7 || cfg.Backup.Destination != "objectstore" {
+		t.Fatalf("unexpected backup defaults %+v (%v)", cfg.Backup, err)
+	}
+
+	cfg.Backup = BackupConfig{}
+	checkError(t, cfg.Backup.Verify(), "missing backup schedule")
+	cfg.Backup = BackupConfig{Schedule: "every night"}
+	checkError(t, cfg.Backup.Verify(), "invalid backup schedule")
+	cfg.Backup = BackupConfig{Schedule: "@daily", RetentionCount: -1}
+	checkError(t, cfg.Backup.Verify(), "cannot be negative")
+	cfg.Backup = BackupConfig{Schedule: "@daily", EncryptionKeyEnv: "NO_SUCH_BACKUP_KEY"}
+	checkError(t, cfg.Backup.Verify(), "NO_SUCH_BACKUP_KEY is not set")
+	t.Setenv("BACKUP_KEY", "c2hvcnQ=")
+	cfg.Backup = BackupConfig{Schedule: "@daily", EncryptionKeyEnv: "BACKUP_KEY"}
+	checkError(t, cfg.Backup.Verify(), "must be 32 bytes")
+}
+
+func TestI18nConfig(t *testing.T) {
+	var (
+		cfg      I18nConfig
+		dir      string
+		msg      string
+		found    bool
+		warnings []string
+		err      error
+	)
+
+	dir = t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "en.yaml"), []byte("login:\n  title: Sign in\n  submit: Continue\ngreeting: Hello\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "pt-br.yml"), []byte("login:\n  title: Entrar\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("translations"), 0o644)
+
+	captureWarnings(t, &warnings)
+	t.Setenv("LOCALESDIR", dir)
+	cfg = I18nConfig{Format: "yaml", Locales: []string{"pt-BR"}}
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ I18n *I18nConfig }{I18n: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if strings.Join(cfg.AvailableLocales(), ",") != "en,pt-BR" || cfg.FallbackLocale != "en" {
+		t.Fatalf("unexpected locales %v", cfg.AvailableLocales())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "locale pt-BR is missing 2 of the messages in en") {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	msg, found = cfg.Message("pt-BR", "login.title")
+	if !found || msg != "Entrar" {
+		t.Fatalf("unexpected message %q", msg)
+	}
+	msg, found = cfg.Message("pt-BR", "login.submit")
+	if !found || msg != "Continue" {
+		t.Fatalf("expected the fallback message, got %q", msg)
+	}
+	_, found = cfg.Message("pt-BR", "logout.title")
+	if found || len(cfg.Bundle("en")) != 3 {
+		t.Fatalf("unexpected en bundle %v", cfg.Bundle("en"))
+	}
+
+	cfg = I18nConfig{LocalesDir: dir}
+	checkError(t, cfg.Verify(), "holds no json bundles")
+	cfg = I18nConfig{LocalesDir: dir, Format: "yaml", FallbackLocale: "de"}
+	checkError(t, cfg.Verify(), "missing i18n bundle for fallbacklocale de")
+	cfg = I18nConfig{LocalesDir: dir, Format: "yaml", Locales: []string{"es"}}
+	checkError(t, cfg.Verify(), "missing i18n bundle for locale es")
+	cfg = I18nConfig{LocalesDir: dir, Format: "toml"}
+	checkError(t, cfg.Verify(), "invalid i18n format")
+	cfg = I18nConfig{LocalesDir: filepath.Join(dir, "missing")}
+	checkError(t, cfg.Verify(), "invalid i18n localesdir")
+
+	dir = t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"count": 3}`), 0o644)
+	cfg = I18nConfig{LocalesDir: dir}
+	checkError(t, cfg.Verify(), "message count is not a string")
+	_ = os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"title": "Sign in",}`), 0o644)
+	checkError(t, cfg.Verify(), "unable to parse i18n bundle en.json")
+	_ = os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{}`), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "strings.json"), []byte(`{}`), 0o644)
+	checkError(t, cfg.Verify(), "i18n bundle strings.json is not named for a locale")
+}
+
+func TestCaptchaConfig(t *testing.T) {
+	var (
+		cfg    CaptchaConfig
+		server *httptest.Server
+		reply  string
+		form   url.Values
+		ok     bool
+		err    error
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		_, _ = io.WriteString(w, reply)
+	}))
+	defer server.Close()
+
+	t.Setenv("CAPTCHASECRET", "captcha-secret")
+	cfg = CaptchaConfig{Enabled: true, Provider: "reCAPTCHA", SiteKey: "site-key", ExemptPaths: []string{"/api/"}, VerifyURL: server.URL}
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Captcha *CaptchaConfig }{Captcha: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.Provider != "recaptcha" || cfg.ScoreThreshold != 0.5 || cfg.Timeout != 5*time.Second || cfg.ResponseField() != "g-recaptcha-response" {
+		t.Fatalf("unexpected captcha defaults %+v", cfg)
+	}
+	if !cfg.Exempt("/api/orders") || cfg.Exempt("/login") {
+		t.Fatalf("unexpected exempt paths")
+	}
+
+	reply = `{"success": true, "score": 0.9}`
+	ok, err = cfg.Check(context.Background(), nil, "token", "203.0.113.9")
+	if !errors.Is(err, nil) || !ok || form.Get("secret") != "captcha-secret" || form.Get("remoteip") != "203.0.113.9" {
+		t.Fatalf("unexpected check %v (%v) with form %v", ok, err, form)
+	}
+	reply = `{"success": true, "score": 0.2}`
+	ok, err = cfg.Check(context.Background(), nil, "token", "")
+	if !errors.Is(err, nil) || ok {
+		t.Fatalf("expected a low score to fail, got %v (%v)", ok, err)
+	}
+	ok, err = cfg.Check(context.Background(), nil, "", "")
+	if !errors.Is(err, nil) || ok {
+		t.Fatalf("expected an empty response to fail, got %v (%v)", ok, err)
+	}
+
+	// hCaptcha scores are risk scores, so lower is better
+	cfg = CaptchaConfig{Enabled: true, Provider: "hcaptcha", SiteKey: "site-key", Secret: "s", ScoreThreshold: 0.6, VerifyURL: server.URL}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.ResponseField() != "h-captcha-response" {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	ok, err = cfg.Check(context.Background(), nil, "token", "")
+	if !errors.Is(err, nil) || !ok || form.Get("sitekey") != "site-key" {
+		t.Fatalf("unexpected hcaptcha check %v (%v)", ok, err)
+	}
+	reply = `{"success": false, "error-codes": ["invalid-input-response"]}`
+	ok, err = cfg.Check(context.Background(), nil, "token", "")
+	if !errors.Is(err, nil) || ok {
+		t.Fatalf("expected a failed response, got %v (%v)", ok, err)
+	}
+
+	cfg = CaptchaConfig{}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("disabled captcha should not be checked: %v", err)
+	}
+	cfg = CaptchaConfig{Enabled: true, Provider: "turnstile"}
+	checkError(t, cfg.Verify(), "invalid captcha provider")
+	cfg = CaptchaConfig{Enabled: true, Provider: "hcaptcha", SiteKey: "k"}
+	checkError(t, cfg.Verify(), "missing captcha secret")
+	cfg = CaptchaConfig{Enabled: true, Provider: "recaptcha", SiteKey: "k", Secret: "s", ScoreThreshold: 1.5}
+	checkError(t, cfg.Verify(), "scorethreshold must be between 0 and 1")
+	cfg = CaptchaConfig{Enabled: true, Provider: "recaptcha", SiteKey: "k", Secret: "s", ExemptPaths: []string{"api"}}
+	checkError(t, cfg.Verify(), "must begin with '/'")
+}
+
+func TestPaymentConfig(t *testing.T) {
+	type paymentRoot struct {
+		App     AppConfig     `yaml:"app"`
+		Payment PaymentConfig `yaml:"payment"`
+	}
+	var (
+		cfg      paymentRoot
+		payment  PaymentConfig
+		path     string
+		warnings []string
+		err      error
+	)
+
+	defer currentApp.Store(nil)
+	captureWarnings(t, &warnings)
+
+	t.Setenv("STRIPESECRETKEY", "sk_live_abc123")
+	path = writeTempConfig(t, "app:\n  name: billing\n  environment: production\npayment:\n  publishablekey: pk_live_def456\n  webhooksecret: whsec_789\n  apiversion: 2025-03-31.basil\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Payment.Provider != "stripe" || !cfg.Payment.LiveMode() || len(warnings) != 0 {
+		t.Fatalf("unexpected payment config %+v (warnings %v)", cfg.Payment, warnings)
+	}
+
+	// test keys are refused in prod
+	t.Setenv("STRIPESECRETKEY", "sk_test_abc123")
+	cfg = paymentRoot{}
+	path = writeTempConfig(t, "app:\n  environment: prod\npayment:\n  publishablekey: pk_test_def456\n")
+	checkError(t, Read(path, &cfg), "Payment: payment keys are test mode keys but the app environment is prod")
+
+	// and live keys elsewhere are a warning
+	t.Setenv("STRIPESECRETKEY", "rk_live_abc123")
+	cfg = paymentRoot{}
+	path = writeTempConfig(t, "app:\n  environment: staging\npayment:\n  provider: stripe\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) || len(warnings) != 1 || !strings.Contains(warnings[0], "live mode keys but the app environment is \"staging\"") {
+		t.Fatalf("expected a live key warning, got %v (%v)", warnings, err)
+	}
+
+	payment = PaymentConfig{SecretKey: "sk_test_1", PublishableKey: "pk_live_2"}
+	checkError(t, payment.Verify(), "mix live and test modes")
+	payment = PaymentConfig{SecretKey: "pk_test_1"}
+	checkError(t, payment.Verify(), "expected a key beginning sk_live_ or sk_test_")
+	payment = PaymentConfig{SecretKey: "sk_test_1", WebhookSecret: "secret"}
+	checkError(t, payment.Verify(), "expected whsec_ prefix")
+	payment = PaymentConfig{SecretKey: "sk_test_1", APIVersion: "latest"}
+	checkError(t, payment.Verify(), "invalid payment apiversion")
+	payment = PaymentConfig{Provider: "paypal", SecretKey: "sk_test_1"}
+	checkError(t, payment.Verify(), "invalid payment provider")
+	payment = PaymentConfig{}
+	checkError(t, payment.Verify(), "missing payment secretkey")
+}
+
+func TestPushConfig(t *testing.T) {
+	var (
+		cfg     PushConfig
+		dir     string
+		keyPath string
+		account []byte
+		err     error
+	)
+
+	dir = t.TempDir()
+	_, keyPath = writeTestCertificate(t, []string{"localhost"}, time.Now().Add(time.Hour))
+	account, _ = json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "acme-mobile",
+		"private_key":  generateEd25519PEM(t),
+		"client_email": "push@acme-mobile.iam.gserviceaccount.com",
+	})
+	_ = os.WriteFile(filepath.Join(dir, "fcm.json"), account, 0o600)
+
+	t.Setenv("APNSKEYFILE", keyPath)
+	cfg = PushConfig{
+		FCM:  &PushFCMConfig{CredentialsFile: filepath.Join(dir, "fcm.json")},
+		APNs: &PushAPNsConfig{KeyID: "ABC123DEFG", TeamID: "DEF123GHIJ", Topic: "com.acme.app", Sandbox: true},
+	}
+	err = applyEnvOverrides(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("applyEnvOverrides returned error: %v", err)
+	}
+	err = verifySubStructs(&struct{ Push *PushConfig }{Push: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.FCM.ProjectID != "acme-mobile" || cfg.FCM.ClientEmail() != "push@acme-mobile.iam.gserviceaccount.com" ||
+		cfg.FCM.SendURL() != "https://fcm.googleapis.com/v1/projects/acme-mobile/messages:send" {
+		t.Fatalf("unexpected FCM config %+v", cfg.FCM)
+	}
+	if cfg.APNs.Key() == nil || cfg.APNs.Host() != "api.sandbox.push.apple.com" {
+		t.Fatalf("unexpected APNs config %+v", cfg.APNs)
+	}
+
+	cfg = PushConfig{}
+	checkError(t, cfg.Verify(), "push requires an fcm or apns section")
+
+	_ = os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"type": "authorized_user"}`), 0o600)
+	cfg.FCM = &PushFCMConfig{CredentialsFile: filepath.Join(dir, "user.json")}
+	checkError(t, cfg.FCM.Verify(), "is not a service account key")
+	_ = os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"type": "service_account", "client_email": "a@b", "private_key": "nope"}`), 0o600)
+	cfg.FCM = &PushFCMConfig{CredentialsFile: filepath.Join(dir, "bad.json")}
+	checkError(t, cfg.FCM.Verify(), "invalid private_key")
+	cfg.FCM = &PushFCMConfig{CredentialsFile: filepath.Join(dir, "missing.json")}
+	checkError(t, cfg.FCM.Verify(), "unable to read FCM credentialsfile")
+
+	cfg.APNs = &PushAPNsConfig{KeyID: "abc", TeamID: "DEF123GHIJ", Topic: "com.acme.app", KeyFile: keyPath}
+	checkError(t, cfg.APNs.Verify(), "invalid APNs keyid")
+	cfg.APNs = &PushAPNsConfig{KeyID: "ABC123DEFG", TeamID: "DEF123GHIJ", Topic: "acme", KeyFile: keyPath}
+	checkError(t, cfg.APNs.Verify(), "invalid APNs topic")
+	_ = os.WriteFile(filepath.Join(dir, "ed25519.p8"), []byte(generateEd25519PEM(t)), 0o600)
+	cfg.APNs = &PushAPNsConfig{KeyID: "ABC123DEFG", TeamID: "DEF123GHIJ", Topic: "com.acme.app.voip", KeyFile: filepath.Join(dir, "ed25519.p8")}
+	checkError(t, cfg.APNs.Verify(), "must hold a P-256 ECDSA key")
+}
+
+func TestWebAuthnConfig(t *testing.T) {
+	var (
+		cfg      HTTPConfig
+		webauthn WebAuthnConfig
+		err      error
+	)
+
+	cfg = HTTPConfig{
+		SkipHostNameTest: true,
+		ExternalHostName: []string{"www.acme.com", "login.acme.com", "*.cdn.acme.com", "acme.example.org"},
+		StaticCert:       HTTPStaticCertConfig{SSLCertFile: "c.pem", SSLPrivateKeyFile: "k.pem"},
+		WebAuthn:         &WebAuthnConfig{RPID: "ACME.com"},
+	}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	err = cfg.WebAuthn.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if strings.Join(cfg.WebAuthn.Origins, ",") != "https://www.acme.com,https://login.acme.com" || cfg.WebAuthn.RPDisplayName != "acme.com" {
+		t.Fatalf("unexpected webauthn config %+v", cfg.WebAuthn)
+	}
+	if !cfg.WebAuthn.AllowedOrigin("https://login.acme.com/") || cfg.WebAuthn.AllowedOrigin("https://acme.example.org") {
+		t.Fatalf("unexpected allowed origins")
+	}
+
+	// the rpid defaults to the first host name
+	cfg.WebAuthn = &WebAuthnConfig{hosts: []string{"*.acme.com", "login.acme.com"}}
+	err = cfg.WebAuthn.Verify()
+	if !errors.Is(err, nil) || cfg.WebAuthn.RPID != "login.acme.com" || strings.Join(cfg.WebAuthn.Origins, ",") != "https://login.acme.com" {
+		t.Fatalf("unexpected webauthn defaults %+v (%v)", cfg.WebAuthn, err)
+	}
+
+	webauthn = WebAuthnConfig{RPID: "auth.acme.com", hosts: []string{"www.acme.com"}}
+	checkError(t, webauthn.Verify(), "does not match any externalhostname")
+	webauthn = WebAuthnConfig{RPID: "acme.com", Origins: []string{"https://www.other.com"}}
+	checkError(t, webauthn.Verify(), "is not within rpid")
+	webauthn = WebAuthnConfig{RPID: "acme.com", Origins: []string{"http://www.acme.com"}}
+	checkError(t, webauthn.Verify(), "must use https")
+	webauthn = WebAuthnConfig{RPID: "localhost", Origins: []string{"http://localhost:8080"}}
+	err = webauthn.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error for localhost: %v", err)
+	}
+	webauthn = WebAuthnConfig{RPID: "co.uk", Origins: []string{"https://acme.co.uk"}}
+	checkError(t, webauthn.Verify(), "is a public suffix")
+	webauthn = WebAuthnConfig{RPID: "https://acme.com"}
+	checkError(t, webauthn.Verify(), "should be a domain")
+	webauthn = WebAuthnConfig{RPID: "acme.com"}
+	checkError(t, webauthn.Verify(), "missing webauthn origins")
+	webauthn = WebAuthnConfig{}
+	checkError(t, webauthn.Verify(), "missing webauthn rpid")
+}
+
+func TestTwoFactorConfig(t *testing.T) {
+	type twoFactorRoot struct {
+		App       AppConfig        `yaml:"app"`
+		TwoFactor *TwoFactorConfig `yaml:"twofactor"`
+	}
+	var (
+		cfg    TwoFactorConfig
+		root   twoFactorRoot
+		skew   int
+		secret []byte
+		sealed []byte
+		opened []byte
+		now    time.Time
+		err    error
+	)
+
+	// RFC 6238 test vectors
+	now = time.Unix(59, 0)
+	cfg = TwoFactorConfig{Issuer: "Acme", Digits: 8, Algorithm: "sha-256"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Algorithm != "SHA256" || cfg.Period != 30*time.Second || *cfg.Skew != 1 {
+		t.Fatalf("unexpected twofactor defaults %+v", cfg)
+	}
+	if cfg.Code([]byte("12345678901234567890123456789012"), now) != "46119246" {
+		t.Fatalf("unexpected SHA256 code %s", cfg.Code([]byte("12345678901234567890123456789012"), now))
+	}
+	cfg = TwoFactorConfig{Issuer: "Acme", Digits: 8}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Code([]byte("12345678901234567890"), now) != "94287082" {
+		t.Fatalf("unexpected SHA1 code (%v)", err)
+	}
+
+	// codes from the neighbouring periods are accepted within the skew
+	t.Setenv("TOTP_KEY", strings.Repeat("ab", 32))
+	cfg = TwoFactorConfig{EncryptionKeyEnv: "TOTP_KEY"}
+	root = twoFactorRoot{App: AppConfig{Name: "billing"}, TwoFactor: &cfg}
+	err = verifySubStructs(&root)
+	if errors.Is(err, nil) {
+		err = postVerifySubStructs(&root)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifying returned error: %v", err)
+	}
+	if cfg.Issuer != "billing" || cfg.Digits != 6 {
+		t.Fatalf("unexpected twofactor defaults %+v", cfg)
+	}
+	secret, err = cfg.GenerateSecret()
+	if !errors.Is(err, nil) || len(secret) != 20 {
+		t.Fatalf("unexpected secret length %d (%v)", len(secret), err)
+	}
+	now = time.Now()
+	if !cfg.Validate(secret, cfg.Code(secret, now.Add(-30*time.Second)), now) || cfg.Validate(secret, cfg.Code(secret, now.Add(-90*time.Second)), now) {
+		t.Fatalf("unexpected validation within skew")
+	}
+	skew = 0
+	cfg.Skew = &skew
+	if cfg.Validate(secret, cfg.Code(secret, now.Add(-30*time.Second)), now) || !cfg.Validate(secret, cfg.Code(secret, now), now) {
+		t.Fatalf("unexpected validation without skew")
+	}
+	if !strings.HasPrefix(cfg.KeyURI("ann@acme.com", []byte("12345678901234567890")), "otpauth://totp/billing:ann@acme.com?algorithm=SHA1&digits=6&issuer=billing&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") {
+		t.Fatalf("unexpected key uri %s", cfg.KeyURI("ann@acme.com", []byte("12345678901234567890")))
+	}
+
+	sealed, err = cfg.Seal(secret)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Seal returned error: %v", err)
+	}
+	opened, err = cfg.Open(sealed)
+	if !errors.Is(err, nil) || !bytes.Equal(opened, secret) || bytes.Contains(sealed, secret) {
+		t.Fatalf("unexpected sealed secret (%v)", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	_, err = cfg.Open(sealed)
+	if errors.Is(err, nil) {
+		t.Fatalf("expected a tampered secret to fail")
+	}
+
+	cfg = TwoFactorConfig{Issuer: "Acme"}
+	_ = cfg.Verify()
+	_, err = cfg.Seal(secret)
+	checkError(t, err, "encryptionkeyenv is not set")
+	cfg = TwoFactorConfig{Issuer: "Acme", Digits: 7}
+	checkError(t, cfg.Verify(), "digits must be 6 or 8")
+	cfg = TwoFactorConfig{Issuer: "Acme", Period: 10 * time.Second}
+	checkError(t, cfg.Verify(), "period must be whole seconds")
+	skew = 9
+	cfg = TwoFactorConfig{Issuer: "Acme", Skew: &skew}
+	checkError(t, cfg.Verify(), "skew must be between 0 and 5")
+	cfg = TwoFactorConfig{Issuer: "Acme", Algorithm: "MD5"}
+	checkError(t, cfg.Verify(), "invalid twofactor algorithm")
+	cfg = TwoFactorConfig{Issuer: "Acme:Corp"}
+	checkError(t, cfg.Verify(), "cannot contain ':'")
+	t.Setenv("TOTP_KEY", "short")
+	cfg = TwoFactorConfig{Issuer: "Acme", EncryptionKeyEnv: "TOTP_KEY"}
+	checkError(t, cfg.Verify(), "must be 32 bytes")
+	cfg = TwoFactorConfig{}
+	checkError(t, cfg.PostVerify(&struct{}{}), "missing twofactor issuer")
+}
+
+func TestPasswordHashConfig(t *testing.T) {
+	var (
+		cfg      PasswordHashConfig
+		hasher   PasswordHasher
+		bcrypted PasswordHasher
+		hash     string
+		oldHash  string
+		ok       bool
+		warnings []string
+		err      error
+	)
+
+	captureWarnings(t, &warnings)
+	cfg = PasswordHashConfig{}
+	err = verifySubStructs(&struct{ PasswordHash *PasswordHashConfig }{PasswordHash: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	if cfg.Algorithm != "argon2id" || cfg.Memory != 64<<20 || cfg.Iterations != 3 || cfg.Parallelism != 2 {
+		t.Fatalf("unexpected passwordhash defaults %+v", cfg)
+	}
+
+	cfg = PasswordHashConfig{Memory: 19 << 20, Iterations: 2, Parallelism: 1}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	hasher = cfg.NewHasher()
+	hash, err = hasher.Hash("correct horse")
+	if !errors.Is(err, nil) || !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("unexpected hash %q (%v)", hash, err)
+	}
+	ok, err = hasher.Compare(hash, "correct horse")
+	if !errors.Is(err, nil) || !ok || hasher.NeedsRehash(hash) {
+		t.Fatalf("expected the password to match (%v)", err)
+	}
+	ok, err = hasher.Compare(hash, "battery staple")
+	if !errors.Is(err, nil) || ok {
+		t.Fatalf("expected the password not to match (%v)", err)
+	}
+
+	// hashes from the other algorithm still compare, and are due for rehashing
+	cfg = PasswordHashConfig{Algorithm: "BCrypt", Cost: 10}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	bcrypted = cfg.NewHasher()
+	oldHash, err = bcrypted.Hash("correct horse")
+	if !errors.Is(err, nil) || !strings.HasPrefix(oldHash, "$2a$10$") {
+		t.Fatalf("unexpected hash %q (%v)", oldHash, err)
+	}
+	ok, err = hasher.Compare(oldHash, "correct horse")
+	if !errors.Is(err, nil) || !ok || !hasher.NeedsRehash(oldHash) || !bcrypted.NeedsRehash(hash) {
+		t.Fatalf("expected the bcrypt hash to match and need rehashing (%v)", err)
+	}
+	ok, err = bcrypted.Compare(oldHash, "battery staple")
+	if !errors.Is(err, nil) || ok {
+		t.Fatalf("expected the password not to match (%v)", err)
+	}
+	cfg.Cost = 11
+	if !cfg.NewHasher().NeedsRehash(oldHash) {
+		t.Fatalf("expected a cost change to need rehashing")
+	}
+	_, err = hasher.Compare("$argon2id$v=19$m=99999999,t=1,p=1$c2FsdA$a2V5", "x")
+	checkError(t, err, "invalid argon2id parameters")
+	_, err = hasher.Compare("plaintext", "x")
+	checkError(t, err, "unrecognized password hash format")
+
+	cfg = PasswordHashConfig{Algorithm: "bcrypt", Iterations: 3}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(warnings) != 1 {
+		t.Fatalf("expected a warning for argon2id settings, got %v (%v)", warnings, err)
+	}
+	cfg = PasswordHashConfig{Algorithm: "bcrypt", Cost: 8}
+	checkError(t, cfg.Verify(), "cost must be between 10")
+	cfg = PasswordHashConfig{Memory: 8 << 20}
+	checkError(t, cfg.Verify(), "memory must be between 19MiB and 4GiB")
+	cfg = PasswordHashConfig{Iterations: 1}
+	checkError(t, cfg.Verify(), "iterations must be between 2 and 100")
+	cfg = PasswordHashConfig{Algorithm: "scrypt"}
+	checkError(t, cfg.Verify(), "invalid passwordhash algorithm")
+}
+
+func TestCryptoConfig(t *testing.T) {
+	var (
+		cfg    CryptoConfig
+		key    CryptoKey
+		legacy []CryptoKey
+		found  bool
+		err    error
+	)
+
+	t.Setenv("APP_DATA_KEYS", "2026-10="+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))+", 2026-07="+strings.Repeat("ab", 16))
+	cfg = CryptoConfig{
+		ActiveKeyID:      "2026-10",
+		KeysEnv:          "APP_DATA_KEYS",
+		Keys:             map[string]string{"2026-04": "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		RotationSchedule: "@monthly",
+	}
+	err = verifySubStructs(&struct{ Crypto *CryptoConfig }{Crypto: &cfg})
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	key = cfg.ActiveKey()
+	if key.ID != "2026-10" || len(key.Key) != 32 || len(key.KMSARN) > 0 {
+		t.Fatalf("unexpected active key %+v", key)
+	}
+	legacy = cfg.LegacyKeys()
+	if len(legacy) != 2 || legacy[0].ID != "2026-04" || len(legacy[0].KMSARN) == 0 || legacy[1].ID != "2026-07" || len(legacy[1].Key) != 16 {
+		t.Fatalf("unexpected legacy keys %+v", legacy)
+	}
+	key, found = cfg.Key("2026-07")
+	if !found || len(key.Key) != 16 {
+		t.Fatalf("unexpected key %+v", key)
+	}
+	if !cfg.NextRotation(time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local)).Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected next rotation %s", cfg.NextRotation(time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local)))
+	}
+
+	cfg = CryptoConfig{ActiveKeyID: "a", Keys: map[string]string{"a": strings.Repeat("ab", 32)}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || !cfg.NextRotation(time.Now()).IsZero() || len(cfg.LegacyKeys()) != 0 {
+		t.Fatalf("unexpected crypto config (%v)", err)
+	}
+
+	cfg = CryptoConfig{ActiveKeyID: "b", Keys: map[string]string{"a": strings.Repeat("ab", 32)}}
+	checkError(t, cfg.Verify(), "activekeyid \"b\" is not one of the keys")
+	cfg = CryptoConfig{ActiveKeyID: "a", Keys: map[string]string{"a": "c2hvcnQ="}}
+	checkError(t, cfg.Verify(), "must be 16, 24, or 32 bytes")
+	cfg = CryptoConfig{ActiveKeyID: "a", Keys: map[string]string{"a": "arn:aws:s3:::bucket"}}
+	checkError(t, cfg.Verify(), "is not a valid KMS key ARN")
+	cfg = CryptoConfig{ActiveKeyID: "a", KeysEnv: "NO_SUCH_KEYS"}
+	checkError(t, cfg.Verify(), "NO_SUCH_KEYS is not set")
+	cfg = CryptoConfig{}
+	checkError(t, cfg.Verify(), "crypto requires at least one key")
+	cfg = CryptoConfig{Keys: map[string]string{"a": strings.Repeat("ab", 32)}}
+	checkError(t, cfg.Verify(), "missing crypto activekeyid")
+	cfg = CryptoConfig{ActiveKeyID: "a", Keys: map[string]string{"a": strings.Repeat("ab", 32)}, RotationSchedule: "monthly"}
+	checkError(t, cfg.Verify(), "invalid crypto rotationschedule")
+}
+
+func TestResilienceConfig(t *testing.T) {
+	type resilienceRoot struct {
+		Resilience ResilienceConfig `yaml:"resilience"`
+	}
+	var (
+		cfg     resilienceRoot
+		policy  ResiliencePolicy
+		retry   RetryConfig
+		breaker *CircuitBreaker
+		d       time.Duration
+		path    string
+		err     error
+		i       int
+	)
+
+	path = writeTempConfig(t, "resilience:\n  retry:\n    maxattempts: 4\n    initialbackoff: 100ms\n    jitter: 0.5\n  circuitbreaker:\n    failurethreshold: 2\n    opentimeout: 1h\n  dependencies:\n    payments:\n      retry:\n        maxattempts: 1\n    search:\n      circuitbreaker:\n        halfopenrequests: 3\n        successthreshold: 2\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	policy = cfg.Resilience.Policy("payments")
+	if policy.Retry.MaxAttempts != 1 || policy.Retry.InitialBackoff != 100*time.Millisecond || policy.Retry.MaxBackoff != 30*time.Second ||
+		policy.Retry.Jitter != 0.5 || policy.CircuitBreaker.FailureThreshold != 2 || policy.CircuitBreaker.OpenTimeout != time.Hour {
+		t.Fatalf("unexpected payments policy %+v %+v", *policy.Retry, *policy.CircuitBreaker)
+	}
+	policy = cfg.Resilience.Policy("search")
+	if policy.Retry.MaxAttempts != 4 || policy.CircuitBreaker.HalfOpenRequests != 3 || policy.CircuitBreaker.SuccessThreshold != 2 ||
+		policy.CircuitBreaker.FailureThreshold != 2 {
+		t.Fatalf("unexpected search policy %+v %+v", *policy.Retry, *policy.CircuitBreaker)
+	}
+	policy = cfg.Resilience.Policy("unknown")
+	if policy.Retry != &cfg.Resilience.Retry || policy.CircuitBreaker.HalfOpenRequests != 1 || policy.CircuitBreaker.SuccessThreshold != 1 {
+		t.Fatalf("unexpected default policy %+v %+v", *policy.Retry, *policy.CircuitBreaker)
+	}
+
+	retry = cfg.Resilience.Retry
+	for i = 0; i < 100; i++ {
+		d = retry.JitteredBackoff(2)
+		if d < 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Fatalf("jittered backoff %s outside 100ms..200ms", d)
+		}
+	}
+
+	breaker = cfg.Resilience.CircuitBreaker.NewCircuitBreaker()
+	breaker.Record(fmt.Errorf("failed"))
+	if breaker.Allow() != nil || breaker.Open() {
+		t.Fatalf("breaker opened before failurethreshold")
+	}
+	breaker.Record(fmt.Errorf("failed"))
+	if !errors.Is(breaker.Allow(), ErrCircuitOpen) || !breaker.Open() {
+		t.Fatalf("breaker did not open at failurethreshold")
+	}
+
+	cfg = resilienceRoot{}
+	path = writeTempConfig(t, "resilience:\n  dependencies:\n    payments:\n      retry:\n        jitter: 2\n")
+	checkError(t, Read(path, &cfg), "resilience dependency \"payments\": retry jitter must be between 0 and 1")
+	cfg = resilienceRoot{}
+	path = writeTempConfig(t, "resilience:\n  circuitbreaker:\n    successthreshold: 2\n")
+	checkError(t, Read(path, &cfg), "successthreshold (2) exceeds halfopenrequests (1)")
+	cfg = resilienceRoot{}
+	path = writeTempConfig(t, "resilience:\n  circuitbreaker:\n    failurethreshold: -1\n")
+	checkError(t, Read(path, &cfg), "circuitbreaker settings cannot be negative")
+}
+
+func TestHTTPClients(t *testing.T) {
+	var (
+		srv     *httptest.Server
+		caFile  string
+		cfg     struct{ Clients HTTPClients }
+		client  *http.Client
+		resp    *http.Response
+		body    []byte
+		profile HTTPClientConfig
+		err     error
+	)
+
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get("X-Api-Key"))
+	}))
+	defer srv.Close()
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing ca file: %v", err)
+	}
+
+	t.Setenv("BILLING_KEY", "secret")
+	cfg.Clients = HTTPClients{
+		"billing": {BaseURL: srv.URL + "/api/", AuthHeader: "X-Api-Key", AuthHeaderEnv: "BILLING_KEY", TLS: HTTPClientTLSConfig{CAFile: caFile}},
+	}
+	err = verifySubStructs(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("verifySubStructs returned error: %v", err)
+	}
+	profile = cfg.Clients["billing"]
+	if profile.Timeout != 30*time.Second || profile.MaxIdleConns != 100 || profile.MaxIdleConnsPerHost != 10 || !profile.Proxy.Environment {
+		t.Fatalf("unexpected defaults %+v", profile)
+	}
+	client, err = cfg.Clients.NewClient("billing")
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	resp, err = client.Get("invoices")
+	if !errors.Is(err, nil) {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !errors.Is(err, nil) || string(body) != "/api/invoices secret" {
+		t.Fatalf("unexpected response %q (%v)", body, err)
+	}
+
+	_, err = cfg.Clients.NewClient("missing")
+	checkError(t, err, "no http client named \"missing\"")
+
+	profile = HTTPClientConfig{BaseURL: "ftp://example.com"}
+	checkError(t, profile.Verify(), "invalid http client baseurl")
+	profile = HTTPClientConfig{AuthHeaderEnv: "NO_SUCH_TOKEN"}
+	checkError(t, profile.Verify(), "NO_SUCH_TOKEN is not set")
+	profile = HTTPClientConfig{MaxIdleConns: 5, MaxIdleConnsPerHost: 10}
+	checkError(t, profile.Verify(), "maxidleconnsperhost (10) exceeds maxidleconns (5)")
+	checkError(t, (&HTTPClientTLSConfig{CertFile: caFile}).Verify(), "requires both certfile and keyfile")
+	checkError(t, (&HTTPClientTLSConfig{MinVersion: "2.0"}).Verify(), "invalid http client tls minversion")
+}
+
+func TestGraphQLConfig(t *testing.T) {
+	type graphQLRoot struct {
+		App     AppConfig     `yaml:"app"`
+		GraphQL GraphQLConfig `yaml:"graphql"`
+	}
+	var (
+		cfg      graphQLRoot
+		path     string
+		warnings []string
+		err      error
+	)
+
+	defer currentApp.Store(nil)
+	captureWarnings(t, &warnings)
+
+	path = writeTempConfig(t, "app:\n  environment: dev\ngraphql:\n  playground: true\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.GraphQL.Path != "/graphql" || cfg.GraphQL.PlaygroundPath != "/playground" || cfg.GraphQL.MaxDepth != 15 ||
+		cfg.GraphQL.MaxComplexity != 1000 || !cfg.GraphQL.IntrospectionEnabled() || len(warnings) != 0 {
+		t.Fatalf("unexpected graphql config %+v (warnings %v)", cfg.GraphQL, warnings)
+	}
+
+	// introspection defaults off in prod, and the playground is refused
+	cfg = graphQLRoot{}
+	path = writeTempConfig(t, "app:\n  environment: production\ngraphql:\n  maxdepth: 8\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) || cfg.GraphQL.IntrospectionEnabled() || cfg.GraphQL.MaxDepth != 8 {
+		t.Fatalf("unexpected graphql config %+v (%v)", cfg.GraphQL, err)
+	}
+	cfg = graphQLRoot{}
+	path = writeTempConfig(t, "app:\n  environment: prod\ngraphql:\n  playground: true\n")
+	checkError(t, Read(path, &cfg), "GraphQL: graphql playground cannot be enabled when the app environment is prod")
+
+	cfg = graphQLRoot{}
+	path = writeTempConfig(t, "app:\n  environment: prod\ngraphql:\n  playground: true\n  allowproductionplayground: true\n  introspection: true\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) || len(warnings) != 2 || !cfg.GraphQL.IntrospectionEnabled() {
+		t.Fatalf("expected playground and introspection warnings, got %v (%v)", warnings, err)
+	}
+
+	checkError(t, (&GraphQLConfig{Path: "graphql"}).Verify(), "graphql path \"graphql\" must begin with /")
+	checkError(t, (&GraphQLConfig{Playground: true, PlaygroundPath: "/graphql"}).Verify(), "cannot both be /graphql")
+	checkError(t, (&GraphQLConfig{MaxComplexity: -1}).Verify(), "cannot be negative")
+}
+
+func TestOpenAPIConfig(t *testing.T) {
+	var (
+		cfg      OpenAPIConfig
+		dir      string
+		rec      *httptest.ResponseRecorder
+		req      *http.Request
+		handler  http.Handler
+		warnings []string
+		err      error
+	)
+
+	defer currentApp.Store(nil)
+	captureWarnings(t, &warnings)
+
+	dir = t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "openapi.yaml"), []byte("openapi: 3.1.0\ninfo:\n  title: Billing\n  version: 1.0.0\npaths: {}\n"), 0o600)
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("openapi: 3.1.0\ninfo: [\n"), 0o600)
+	}
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(dir, "notapi.json"), []byte(`{"name": "package"}`), 0o600)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing spec files: %v", err)
+	}
+
+	cfg = OpenAPIConfig{Enabled: true, SpecFile: filepath.Join(dir, "openapi.yaml"), Environments: []string{"development", "Stage"}, User: "docs", Password: "pw"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.SpecPath != "/openapi.yaml" || cfg.UIPath != "/docs" || cfg.Environments[0] != "dev" || cfg.Environments[1] != "staging" {
+		t.Fatalf("unexpected openapi config %+v", cfg)
+	}
+
+	currentApp.Store(&AppConfig{Environment: "staging"})
+	if !cfg.Active() {
+		t.Fatalf("expected openapi to be active in staging")
+	}
+	handler = cfg.Handler()
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil)
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	req.SetBasicAuth("docs", "pw")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/yaml" || !strings.Contains(rec.Body.String(), "title: Billing") {
+		t.Fatalf("unexpected spec response %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/docs", nil)
+	req.SetBasicAuth("docs", "pw")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `url: "/openapi.yaml"`) {
+		t.Fatalf("unexpected ui response %d %q", rec.Code, rec.Body.String())
+	}
+
+	currentApp.Store(&AppConfig{Environment: "prod"})
+	if cfg.Active() {
+		t.Fatalf("expected openapi to be inactive in prod")
+	}
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 in prod, got %d", rec.Code)
+	}
+
+	cfg = OpenAPIConfig{Enabled: true, Embedded: true}
+	err = cfg.Verify()
+	if errors.Is(err, nil) {
+		err = cfg.SetSpec([]byte(`{"swagger": "2.0", "info": {"title": "Legacy"}}`))
+	}
+	if !errors.Is(err, nil) || cfg.SpecPath != "/openapi.json" || !cfg.specJSON {
+		t.Fatalf("unexpected embedded openapi config %+v (%v)", cfg, err)
+	}
+	checkError(t, cfg.SetSpec([]byte(`{"openapi": "3.0.3", "info": {}}`)), "missing info title")
+
+	checkError(t, (&OpenAPIConfig{Enabled: true, SpecFile: filepath.Join(dir, "broken.yaml")}).Verify(), "broken.yaml: unable to parse")
+	checkError(t, (&OpenAPIConfig{Enabled: true, SpecFile: filepath.Join(dir, "notapi.json")}).Verify(), "not an OpenAPI 3.x or Swagger 2.0 document")
+	checkError(t, (&OpenAPIConfig{Enabled: true, SpecFile: filepath.Join(dir, "missing.yaml")}).Verify(), "unable to read openapi specfile")
+	checkError(t, (&OpenAPIConfig{Enabled: true}).Verify(), "missing openapi specfile")
+	checkError(t, (&OpenAPIConfig{Enabled: true, Embedded: true, Environments: []string{"qa"}}).Verify(), "invalid openapi environments entry \"qa\"")
+	checkError(t, (&OpenAPIConfig{Enabled: true, Embedded: true, User: "docs"}).Verify(), "requires both user and password")
+	checkError(t, (&OpenAPIConfig{}).Verify(), "")
+}
+
+func TestRedact(t *testing.T) {
+	var (
+		cfg struct {
+			Database PostgresDatabase `yaml:"database"`
+			Redis    RedisConfig      `yaml:"redis"`
+			Crypto   CryptoConfig     `yaml:"crypto"`
+			Clients  map[string]RetryConfig
+			Proxy    *ProxyConfig    `yaml:"proxy"`
+			Size     ByteSize        `yaml:"size"`
+			Skip     string          `yaml:"-"`
+			OTel     OTelConfig      `yaml:"otel"`
+			Webhooks []WebhookConfig `yaml:"webhooks"`
+		}
+		out  map[string]any
+		b    []byte
+		text string
+		err  error
+	)
+
+	cfg.Database = PostgresDatabase{Server: "db:5432", User: "app", Password: "hunter2", ConnectString: "postgres://app:hunter2@db:5432/app"}
+	cfg.Redis.Server = "redis://:hunter2@cache:6379/0"
+	cfg.Crypto = CryptoConfig{ActiveKeyID: "k1", KeysEnv: "APP_KEYS", Keys: map[string]string{"k1": "hunter2"}}
+	cfg.Clients = map[string]RetryConfig{"billing": {MaxAttempts: 2, InitialBackoff: time.Second}}
+	cfg.Size = 64 << 20
+	cfg.Skip = "hunter2"
+	cfg.OTel.Headers = map[string]string{"Authorization": "Bearer hunter2"}
+	cfg.Webhooks = []WebhookConfig{{URL: "https://hooks.example.com/notify", Headers: map[string]string{"X-Api-Key": "hunter2"}}}
+
+	out = Redact(&cfg).(map[string]any)
+	b, err = json.Marshal(out)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	text = string(b)
+	if strings.Contains(text, "hunter2") {
+		t.Fatalf("secret leaked in %s", text)
+	}
+	if out["database"].(map[string]any)["password"] != Redacted || out["database"].(map[string]any)["user"] != "app" ||
+		out["crypto"].(map[string]any)["activekeyid"] != "k1" || out["crypto"].(map[string]any)["keysenv"] != "APP_KEYS" {
+		t.Fatalf("unexpected redaction %s", text)
+	}
+	if out["otel"].(map[string]any)["headers"].(map[string]any)["Authorization"] != Redacted ||
+		!strings.Contains(text, `"X-Api-Key":"REDACTED"`) || !strings.Contains(text, "hooks.example.com") {
+		t.Fatalf("unexpected header redaction %s", text)
+	}
+	if !strings.Contains(text, `"size":"64MiB"`) || !strings.Contains(text, `"initialbackoff":"1s"`) || !strings.Contains(text, `"proxy":null`) ||
+		!strings.Contains(text, "cache:6379") || strings.Contains(text, `"Skip"`) {
+		t.Fatalf("unexpected redacted output %s", text)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	type adminRoot struct {
+		Admin AdminConfig `yaml:"admin"`
+		SSO   *OIDCConfig `yaml:"sso"`
+	}
+	var (
+		cfg      AdminConfig
+		root     adminRoot
+		handler  http.Handler
+		rec      *httptest.ResponseRecorder
+		req      *http.Request
+		reloads  int
+		warnings []string
+		path     string
+		err      error
+	)
+
+	captureWarnings(t, &warnings)
+
+	cfg = AdminConfig{Enabled: true, AllowedCIDRs: []string{"10.0.0.0/8", "192.0.2.1"}, User: "ops", Password: "pw"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.BindAddr != "localhost:9090" || cfg.PathPrefix != "/admin" || cfg.Auth != "basic" || len(cfg.Endpoints) != 3 || len(warnings) != 0 {
+		t.Fatalf("unexpected admin config %+v (warnings %v)", cfg, warnings)
+	}
+	handler, err = cfg.Handler(AdminHandlers{
+		Config: &cfg,
+		Reload: func(ctx context.Context) error {
+			reloads++
+			if reloads > 1 {
+				return fmt.Errorf("bad config")
+			}
+			return nil
+		},
+	})
+	if !errors.Is(err, nil) {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	req.SetBasicAuth("ops", "pw")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside allowedcidrs, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	req.RemoteAddr = "10.1.2.3:4000"
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"password":"REDACTED"`) || strings.Contains(rec.Body.String(), `"pw"`) {
+		t.Fatalf("unexpected config response %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/health", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+	req.SetBasicAuth("ops", "pw")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ok"`) {
+		t.Fatalf("unexpected health response %d %s", rec.Code, rec.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.SetBasicAuth("ops", "pw")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || reloads != 1 {
+		t.Fatalf("unexpected reload response %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"errors":["bad config"]`) {
+		t.Fatalf("unexpected failed reload response %d %s", rec.Code, rec.Body.String())
+	}
+
+	// the oidc section is looked up by yaml key
+	path = writeTempConfig(t, "admin:\n  enabled: true\n  auth: oidc\n  oidcsection: sso\n  endpoints: [health]\nsso:\n  issuerurl: https://login.acme.com\n  clientid: admin\n  clientsecret: s3cret\n  redirecturl: https://admin.acme.com/callback\n")
+	err = Read(path, &root)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	_, err = root.Admin.Handler(AdminHandlers{})
+	checkError(t, err, "requires AdminHandlers.Authenticate")
+	root = adminRoot{}
+	path = writeTempConfig(t, "admin:\n  enabled: true\n  auth: oidc\n")
+	checkError(t, Read(path, &root), "admin oidcsection \"oidc\" was not found")
+
+	cfg = AdminConfig{Enabled: true, BindAddr: ":9090"}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || len(warnings) != 1 || !strings.Contains(warnings[0], "without auth or allowedcidrs") {
+		t.Fatalf("expected an open admin warning, got %v (%v)", warnings, err)
+	}
+	_, err = cfg.Handler(AdminHandlers{})
+	checkError(t, err, "requires AdminHandlers.Config")
+	checkError(t, (&AdminConfig{Enabled: true, Auth: "basic"}).Verify(), "requires both user and password")
+	checkError(t, (&AdminConfig{Enabled: true, Auth: "saml"}).Verify(), "invalid admin auth \"saml\"")
+	checkError(t, (&AdminConfig{Enabled: true, Endpoints: []string{"pprof"}}).Verify(), "invalid admin endpoints entry \"pprof\"")
+	checkError(t, (&AdminConfig{Enabled: true, AllowedCIDRs: []string{"10.0.0.0/33"}}).Verify(), "invalid admin allowedcidrs entry")
+}
+
+func TestConfigReloader(t *testing.T) {
+	type reloadRoot struct {
+		App   AppConfig   `yaml:"app"`
+		Admin AdminConfig `yaml:"admin"`
+		HTTP  *HTTPConfig `yaml:"http"`
+	}
+	var (
+		reloader *ConfigReloader[reloadRoot]
+		handler  http.Handler
+		rec      *httptest.ResponseRecorder
+		req      *http.Request
+		reloaded *reloadRoot
+		body     struct {
+			Status string   `json:"status"`
+			Errors []string `json:"errors"`
+		}
+		path string
+		err  error
+	)
+
+	defer currentApp.Store(nil)
+	t.Setenv("ADMINPASS", "pw")
+
+	path = writeTempConfig(t, "app:\n  name: billing\n  environment: staging\nadmin:\n  enabled: true\n  user: ops\n")
+	reloader, err = NewConfigReloader[reloadRoot](path)
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewConfigReloader returned error: %v", err)
+	}
+	reloader.OnReload(func(cfg *reloadRoot) { reloaded = cfg })
+	handler, err = reloader.Current().Admin.Handler(AdminHandlers{Config: reloader, Reload: reloader.Reload})
+	if !errors.Is(err, nil) {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// a broken file is reported, with each joined error listed, and the current config kept
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: prod\nhttp:\n  externalhostname: [www.acme.com, www.acme.com, bad_host]\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed rewriting config: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.SetBasicAuth("ops", "pw")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	if !errors.Is(err, nil) || rec.Code != http.StatusUnprocessableEntity || body.Status != "fail" || len(body.Errors) != 2 ||
+		!strings.HasPrefix(body.Errors[0], "reloadRoot.HTTP: duplicate externalhostname") || !strings.HasPrefix(body.Errors[1], "reloadRoot.HTTP: invalid externalhostname") {
+		t.Fatalf("unexpected reload response %d %s", rec.Code, rec.Body.String())
+	}
+	if reloaded != nil || reloader.Current().App.Environment != "staging" || CurrentApp().Environment != "staging" {
+		t.Fatalf("failed reload replaced the configuration")
+	}
+
+	// every broken section is reported, not just the first
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: moon\nadmin:\n  enabled: true\n  user: ops\n  auth: saml\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed rewriting config: %v", err)
+	}
+	body.Errors = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	if !errors.Is(err, nil) || rec.Code != http.StatusUnprocessableEntity || len(body.Errors) != 2 ||
+		!strings.HasPrefix(body.Errors[0], "reloadRoot.App: invalid app environment") || !strings.HasPrefix(body.Errors[1], "reloadRoot.Admin: invalid admin auth") {
+		t.Fatalf("unexpected reload response %d %s", rec.Code, rec.Body.String())
+	}
+
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: prod\nadmin:\n  enabled: true\n  user: ops\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed rewriting config: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || reloaded != reloader.Current() || reloaded.App.Environment != "prod" || CurrentApp().Environment != "prod" {
+		t.Fatalf("unexpected reload response %d %s", rec.Code, rec.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	req.SetBasicAuth("ops", "pw")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"environment":"prod"`) || strings.Contains(rec.Body.String(), `"pw"`) {
+		t.Fatalf("unexpected config response %d %s", rec.Code, rec.Body.String())
+	}
+	_ = Read(writeTempConfig(t, "app:\n  name: other\n"), &reloadRoot{})
+	if reloader.Provenance()["admin.user"] != "file" ||
+		EffectiveConfig(reloader, nil)["provenance"].(map[string]string)["admin.user"] != "file" {
+		t.Fatalf("unexpected reloader provenance %v", reloader.Provenance())
+	}
+
+	rec = httptest.NewRecorder()
+	reloader.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+
+	_, err = NewConfigReloader[reloadRoot](filepath.Join(t.TempDir(), "missing.yaml"))
+	checkError(t, err, "unable to read configuration file")
+}
+
+func TestProvenance(t *testing.T) {
+	type provenanceRoot struct {
+		App   AppConfig   `yaml:"app"`
+		Debug DebugConfig `yaml:"debug"`
+		Redis RedisConfig `yaml:"redis"`
+	}
+	var (
+		cfg        provenanceRoot
+		provenance map[string]string
+		rec        *httptest.ResponseRecorder
+		body       struct {
+			Config     map[string]map[string]any `json:"config"`
+			Provenance map[string]string         `json:"provenance"`
+		}
+		path string
+		err  error
+	)
+
+	defer currentApp.Store(nil)
+	t.Setenv("APPENV", "staging")
+	t.Setenv("REDISPASS", "hunter2")
+
+	path = writeTempConfig(t, "defaults: &defaults\n  name: billing\napp:\n  <<: *defaults\n  environment: dev\ndebug:\n  enabled: true\n  publishconfig: true\nredis:\n  server: cache:6379\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	provenance = Provenance()
+	if provenance["app.name"] != "file" || provenance["app.environment"] != "env:APPENV" || provenance["debug.bindaddr"] != "default" ||
+		provenance["redis.password"] != "env:REDISPASS" || provenance["app.instanceid"] != "default" {
+		t.Fatalf("unexpected provenance %v", provenance)
+	}
+	if len(provenance["debug.authtoken"]) > 0 {
+		t.Fatalf("zero setting listed in provenance %v", provenance)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.Debug.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	if !errors.Is(err, nil) || rec.Code != http.StatusOK || body.Config["app"]["environment"] != "staging" ||
+		body.Config["redis"]["password"] != Redacted || body.Provenance["app.environment"] != "env:APPENV" {
+		t.Fatalf("unexpected /debug/config response %d %s", rec.Code, rec.Body.String())
+	}
+
+	// a failed Read leaves the provenance of the last good one
+	path = writeTempConfig(t, "app:\n  environment: qa\n")
+	t.Setenv("APPENV", "qa")
+	checkError(t, Read(path, &provenanceRoot{}), "invalid app environment")
+	if Provenance()["debug.bindaddr"] != "default" {
+		t.Fatalf("provenance replaced by a failed read: %v", Provenance())
+	}
+
+	// each configuration keeps its own provenance once another is read
+	t.Setenv("APPENV", "prod")
+	provenance = nil
+	err = Read(writeTempConfig(t, "redis:\n  server: other:6379\n"), &provenanceRoot{}, WithProvenance(&provenance))
+	if !errors.Is(err, nil) || provenance["redis.server"] != "file" || len(provenance["debug.bindaddr"]) > 0 || Provenance()["redis.server"] != "file" {
+		t.Fatalf("unexpected provenance %v (%v)", provenance, err)
+	}
+	rec = httptest.NewRecorder()
+	cfg.Debug.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	body.Provenance = nil
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	if !errors.Is(err, nil) || body.Provenance["debug.bindaddr"] != "default" || body.Provenance["app.environment"] != "env:APPENV" {
+		t.Fatalf("/debug/config shows another configuration's provenance %s", rec.Body.String())
+	}
+	if EffectiveConfig(&cfg, provenance)["provenance"].(map[string]string)["redis.server"] != "file" {
+		t.Fatalf("EffectiveConfig should show the provenance it is given")
+	}
+
+	cfg.Debug.PublishConfig = false
+	err = cfg.Debug.PostVerify(&cfg)
+	rec = httptest.NewRecorder()
+	cfg.Debug.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if !errors.Is(err, nil) || rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without publishconfig, got %d", rec.Code)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var (
+		before  Config
+		after   Config
+		changes []ConfigChange
+	)
+
+	before.SMTP = SMTPConfig{Server: "mail:25", Password: "old"}
+	before.HTTP.ExternalHostName = []string{"www.acme.com"}
+	before.HTTP.Timeouts.Read = time.Second
+	after = before
+	after.SMTP.Password = "new"
+	after.SMTP.Server = ""
+	after.HTTP.ExternalHostName = []string{"www.acme.com", "acme.com"}
+	after.HTTP.Timeouts.Read = 2 * time.Second
+
+	changes = Diff(&before, &after)
+	if len(changes) != 4 || changes[0].String() != "http.externalhostname: [www.acme.com] -> [www.acme.com acme.com]" ||
+		changes[1].String() != "http.timeouts.read: 1s -> 2s" || changes[2].String() != "smtp.password: REDACTED -> REDACTED" ||
+		changes[3].Path != "smtp.server" || changes[3].Old != "mail:25" || changes[3].New != nil {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	if len(Diff(&before, &before)) != 0 {
+		t.Fatalf("expected no changes comparing a config with itself")
+	}
+
+	changes = Diff(&OTelConfig{Headers: map[string]string{"Authorization": "Bearer old"}}, &OTelConfig{Headers: map[string]string{"Authorization": "Bearer new"}})
+	if len(changes) != 1 || changes[0].String() != "headers.Authorization: REDACTED -> REDACTED" {
+		t.Fatalf("unexpected header changes %v", changes)
+	}
+}
+
+func TestDriftMonitor(t *testing.T) {
+	type driftRoot struct {
+		App   AppConfig   `yaml:"app"`
+		Retry RetryConfig `yaml:"retry"`
+	}
+	type smtpRoot struct {
+		SMTP SMTPConfig `yaml:"smtp"`
+	}
+	var (
+		running  driftRoot
+		monitor  *DriftMonitor
+		changes  []ConfigChange
+		reported [][]ConfigChange
+		path     string
+		err      error
+	)
+
+	defer currentApp.Store(nil)
+	path = writeTempConfig(t, "app:\n  name: billing\n  environment: prod\nretry:\n  maxattempts: 2\n")
+	err = Read(path, &running)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	monitor = NewDriftMonitor(path, &running, func(changes []ConfigChange) { reported = append(reported, changes) })
+	changes, err = monitor.Check()
+	if !errors.Is(err, nil) || len(changes) != 0 {
+		t.Fatalf("unexpected drift %v (%v)", changes, err)
+	}
+
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: staging\nretry:\n  maxattempts: 2\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed rewriting config: %v", err)
+	}
+	err = monitor.check()
+	if errors.Is(err, nil) {
+		err = monitor.check()
+	}
+	if !errors.Is(err, nil) || len(reported) != 1 || len(reported[0]) != 1 || reported[0][0].String() != "app.environment: prod -> staging" {
+		t.Fatalf("unexpected drift reports %v (%v)", reported, err)
+	}
+	if CurrentApp().Environment != "prod" || Provenance()["app.environment"] != "file" {
+		t.Fatalf("drift check changed the current app or provenance")
+	}
+
+	err = os.WriteFile(path, []byte("app:\n  environment: qa\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed rewriting config: %v", err)
+	}
+	checkError(t, monitor.check(), "invalid app environment")
+	checkError(t, NewDriftMonitor(path, nil, nil).check(), "running configuration must be a non-nil pointer")
+
+	// network checks are skipped
+	path = writeTempConfig(t, "smtp:\n  server: 127.0.0.1\n  port: 1\n  from: app@acme.com\n  tlsmode: none\n  verifyconnection: true\n")
+	checkError(t, Read(path, &smtpRoot{}), "SMTP connection test failed")
+	changes, err = NewDriftMonitor(path, &smtpRoot{}, nil).Check()
+	if !errors.Is(err, nil) || len(changes) == 0 {
+		t.Fatalf("unexpected offline check %v (%v)", changes, err)
+	}
+}
+
+func TestReadStdin(t *testing.T) {
+	var (
+		cfg    readEnvConfig
+		stdin  *os.File
+		reader *os.File
+		writer *os.File
+		err    error
+	)
+
+	reader, writer, err = os.Pipe()
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed creating pipe: %v", err)
+	}
+	stdin = os.Stdin
+	os.Stdin = reader
+	defer func() {
+		os.Stdin = stdin
+		reader.Close()
+	}()
+	_, err = writer.WriteString("section:\n  name: from-stdin\n")
+	writer.Close()
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+
+	err = ReadStdin(&cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("ReadStdin returned error: %v", err)
+	}
+	if cfg.Section.Name != "from-stdin" || !cfg.Section.Verified {
+		t.Fatalf("expected verified section from standard input, got %#v", cfg.Section)
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	var (
+		cfg  readEnvConfig
+		buf  bytes.Buffer
+		zw   *gzip.Writer
+		zstw *zstd.Encoder
+		path string
+		err  error
+	)
+
+	zw = gzip.NewWriter(&buf)
+	_, err = zw.Write([]byte("section:\n  name: from-gzip\n"))
+	if errors.Is(err, nil) {
+		err = zw.Close()
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed compressing config: %v", err)
+	}
+	path = filepath.Join(t.TempDir(), "config.yaml.gz")
+	err = os.WriteFile(path, buf.Bytes(), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Section.Name != "from-gzip" {
+		t.Fatalf("expected section from compressed file, got %#v", cfg.Section)
+	}
+
+	path = filepath.Join(t.TempDir(), "config.yaml.zst")
+	err = os.WriteFile(path, buf.Bytes(), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "invalid input")
+
+	buf.Reset()
+	zstw, err = zstd.NewWriter(&buf)
+	if errors.Is(err, nil) {
+		_, err = zstw.Write([]byte("section:\n  name: from-zstd\n"))
+	}
+	if errors.Is(err, nil) {
+		err = zstw.Close()
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed compressing config: %v", err)
+	}
+	err = os.WriteFile(path, buf.Bytes(), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Section.Name != "from-zstd" {
+		t.Fatalf("expected section from zstd file, got %#v", cfg.Section)
+	}
+	err = os.WriteFile(filepath.Join(filepath.Dir(path), "config.yaml.gz"), []byte("section: {}\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(filepath.Join(filepath.Dir(path), "config.yaml.gz"), &cfg), "gzip: invalid header")
+}
+
+func TestReadWithSecretsDir(t *testing.T) {
+	var (
+		cfg  readEnvConfig
+		dir  string
+		path string
+		err  error
+	)
+
+	defer lastProvenance.Store(nil)
+	dir = t.TempDir()
+	err = os.Mkdir(filepath.Join(dir, "..data"), 0o700)
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(dir, "..data", "APP_HOSTS"), []byte("hidden"), 0o600)
+	}
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(dir, "app_port"), []byte("9292\n"), 0o600)
+	}
+	if errors.Is(err, nil) {
+		err = os.WriteFile(filepath.Join(dir, "APP_TIMEOUT"), []byte("10s\n"), 0o600)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing secrets: %v", err)
+	}
+	path = writeTempConfig(t, "section:\n  name: from-yaml\nruntime:\n  enabled: true\n  port: 8080\n  timeout: 5s\n  hosts: [host-a]\n")
+	t.Setenv("APP_TIMEOUT", "45s")
+
+	err = Read(path, &cfg, WithSecretsDir(dir))
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Runtime.Port != 9292 || cfg.Runtime.Timeout != 45*time.Second || len(cfg.Runtime.Hosts) != 1 {
+		t.Fatalf("unexpected runtime overrides %#v", cfg.Runtime)
+	}
+	if Provenance()["runtime.port"] != "secret:"+filepath.Join(dir, "app_port") || Provenance()["runtime.timeout"] != "env:APP_TIMEOUT" {
+		t.Fatalf("unexpected provenance %v", Provenance())
+	}
+
+	err = Read(path, &cfg, WithSecretsDir(filepath.Join(dir, "missing")))
+	if !errors.Is(err, nil) {
+		t.Fatalf("expected a missing secrets directory to be ignored, got %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "APP_PORT"), []byte("many"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing secret: %v", err)
+	}
+	checkError(t, Read(path, &cfg, WithSecretsDir(dir)), "invalid value for secret:"+filepath.Join(dir, "APP_PORT")+" (Runtime.Port)")
+}
+
+func TestConfigReloaderWatchFollowsKubernetesVolume(t *testing.T) {
+	type watchRoot struct {
+		Retry RetryConfig `yaml:"retry"`
+	}
+	var (
+		reloader  *ConfigReloader[watchRoot]
+		dir       string
+		stamp     string
+		modTime   time.Time
+		reloaded  chan *watchRoot
+		cfg       *watchRoot
+		ctx       context.Context
+		cancel    context.CancelFunc
+		writeData func(name, body string)
+		err       error
+	)
+
+	dir = t.TempDir()
+	modTime = time.Now().Add(-time.Hour)
+	writeData = func(name, body string) {
+		var err error
+
+		err = os.Mkdir(filepath.Join(dir, name), 0o700)
+		if errors.Is(err, nil) {
+			err = os.WriteFile(filepath.Join(dir, name, "config.yaml"), []byte(body), 0o600)
+		}
+		if errors.Is(err, nil) {
+			err = os.Chtimes(filepath.Join(dir, name, "config.yaml"), modTime, modTime)
+		}
+		if errors.Is(err, nil) {
+			err = os.Symlink(name, filepath.Join(dir, "..data_tmp"))
+		}
+		if errors.Is(err, nil) {
+			err = os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+		}
+		if !errors.Is(err, nil) {
+			t.Skipf("unable to lay out a Kubernetes volume: %v", err)
+		}
+	}
+	writeData("..2026_01_01_00_00_00.1", "retry:\n  maxattempts: 2\n")
+	err = os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml"))
+	if !errors.Is(err, nil) {
+		t.Skipf("unable to lay out a Kubernetes volume: %v", err)
+	}
+
+	reloader, err = NewConfigReloader[watchRoot](filepath.Join(dir, "config.yaml"))
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewConfigReloader returned error: %v", err)
+	}
+	stamp, err = reloader.fileStamp()
+	if !errors.Is(err, nil) || stamp != reloader.stamp {
+		t.Fatalf("expected an unchanged stamp, got %q and %q (%v)", stamp, reloader.stamp, err)
+	}
+	reloaded = make(chan *watchRoot, 1)
+	reloader.OnReload(func(cfg *watchRoot) { reloaded <- cfg })
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	// Same size and modification time, so only the swapped ..data link tells the files apart.
+	writeData("..2026_01_01_00_00_00.2", "retry:\n  maxattempts: 3\n")
+	select {
+	case cfg = <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Watch to reload after the ..data link was swapped")
+	}
+	if cfg.Retry.MaxAttempts != 3 || reloader.Current().Retry.MaxAttempts != 3 {
+		t.Fatalf("expected the updated configuration, got %#v", cfg.Retry)
+	}
+}
+
+func TestLoadDotEnv(t *testing.T) {
+	var (
+		dir   string
+		first string
+		later string
+		names []string
+		err   error
+		i     int
+	)
+
+	names = []string{"DOTENV_PLAIN", "DOTENV_SINGLE", "DOTENV_DOUBLE", "DOTENV_EXPORTED", "DOTENV_SET", "DOTENV_LATER"}
+	for i = 0; i < len(names); i++ {
+		t.Setenv(names[i], "")
+		os.Unsetenv(names[i])
+	}
+	t.Setenv("DOTENV_SET", "from-env")
+
+	dir = t.TempDir()
+	first = filepath.Join(dir, ".env")
+	later = filepath.Join(dir, ".env.local")
+	err = os.WriteFile(first, []byte("# local settings\n\nDOTENV_PLAIN = plain value # comment\nDOTENV_SINGLE='a \\n # b'\n"+
+		"DOTENV_DOUBLE=\"line\\nnext\" # comment\nexport DOTENV_EXPORTED=yes\nDOTENV_SET=from-file\n"), 0o600)
+	if errors.Is(err, nil) {
+		err = os.WriteFile(later, []byte("DOTENV_PLAIN=overridden\nDOTENV_LATER=later\n"), 0o600)
+	}
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing env files: %v", err)
+	}
+
+	err = LoadDotEnv(first, later)
+	if !errors.Is(err, nil) {
+		t.Fatalf("LoadDotEnv returned error: %v", err)
+	}
+	if os.Getenv("DOTENV_PLAIN") != "plain value" || os.Getenv("DOTENV_SINGLE") != "a \\n # b" || os.Getenv("DOTENV_DOUBLE") != "line\nnext" ||
+		os.Getenv("DOTENV_EXPORTED") != "yes" || os.Getenv("DOTENV_SET") != "from-env" || os.Getenv("DOTENV_LATER") != "later" {
+		t.Fatalf("unexpected environment %q %q %q %q %q %q", os.Getenv("DOTENV_PLAIN"), os.Getenv("DOTENV_SINGLE"), os.Getenv("DOTENV_DOUBLE"),
+			os.Getenv("DOTENV_EXPORTED"), os.Getenv("DOTENV_SET"), os.Getenv("DOTENV_LATER"))
+	}
+
+	t.Chdir(dir)
+	err = os.Remove(first)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed removing env file: %v", err)
+	}
+	err = LoadDotEnv()
+	if !errors.Is(err, nil) {
+		t.Fatalf("expected a missing default .env to be ignored, got %v", err)
+	}
+	checkError(t, LoadDotEnv(first), "unable to read env file")
+	err = os.WriteFile(later, []byte("DOTENV_LATER='open\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing env file: %v", err)
+	}
+	checkError(t, LoadDotEnv(later), ".env.local:1: invalid value for DOTENV_LATER: missing closing quote")
+	err = os.WriteFile(later, []byte("JUST A LINE\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing env file: %v", err)
+	}
+	checkError(t, LoadDotEnv(later), ".env.local:1: expected NAME=value")
+}
+
+func TestReadINIAndProperties(t *testing.T) {
+	type formatHTTP struct {
+		BindAddr string        `yaml:"bindaddr"`
+		Hosts    []string      `yaml:"hosts"`
+		Timeout  time.Duration `yaml:"timeout"`
+		Debug    bool          `yaml:"debug"`
+		Port     int           `yaml:"port" env:"FORMAT_PORT"`
+	}
+	type formatRoot struct {
+		Name    string     `yaml:"name"`
+		Note    string     `yaml:"note"`
+		HTTP    formatHTTP `yaml:"http"`
+		Section readVerifySection
+	}
+	var (
+		cfg  formatRoot
+		dir  string
+		path string
+		err  error
+	)
+
+	defer lastProvenance.Store(nil)
+	dir = t.TempDir()
+	path = filepath.Join(dir, "app.ini")
+	err = os.WriteFile(path, []byte("; legacy settings\nname = billing ; trailing comment\nnote = \"a ; b\"\n\n[http]\nbindaddr: :8080\n"+
+		"hosts.0 = a.example.com\nhosts.1 = b.example.com\ntimeout = 5s\ndebug = true\nport = 80\n\n[section]\nname = from-ini\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	t.Setenv("FORMAT_PORT", "8443")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Name != "billing" || cfg.Note != "a ; b" || cfg.HTTP.BindAddr != ":8080" || len(cfg.HTTP.Hosts) != 2 || cfg.HTTP.Hosts[1] != "b.example.com" ||
+		cfg.HTTP.Timeout != 5*time.Second || !cfg.HTTP.Debug || cfg.HTTP.Port != 8443 || !cfg.Section.Verified || cfg.Section.Name != "from-ini" {
+		t.Fatalf("unexpected config from ini %#v", cfg)
+	}
+	if Provenance()["http.timeout"] != "file" || Provenance()["http.port"] != "env:FORMAT_PORT" {
+		t.Fatalf("unexpected provenance %v", Provenance())
+	}
+
+	cfg = formatRoot{}
+	path = filepath.Join(dir, "app.properties")
+	err = os.WriteFile(path, []byte("# legacy settings\n! also a comment\nname=billing\nnote = caf\\u00e9 \\\n    au lait\nhttp.bindaddr : :8080\n"+
+		"http.hosts.0 a.example.com\nhttp.timeout=5s\nsection.name=from-properties\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Name != "billing" || cfg.Note != "café au lait" || cfg.HTTP.BindAddr != ":8080" || len(cfg.HTTP.Hosts) != 1 ||
+		cfg.HTTP.Timeout != 5*time.Second || cfg.Section.Name != "from-properties" {
+		t.Fatalf("unexpected config from properties %#v", cfg)
+	}
+
+	err = os.WriteFile(path, []byte("http=plain\nhttp.port=80\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 2: http is both a value and a section")
+	err = os.WriteFile(path, []byte("name=\\u00zz\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 1: invalid \\u escape")
+	path = filepath.Join(dir, "bad.ini")
+	err = os.WriteFile(path, []byte("[http\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 1: invalid section header [http")
+}
+
+func TestReadHCL(t *testing.T) {
+	type hclRoot struct {
+		App         AppConfig   `yaml:"app"`
+		Retry       RetryConfig `yaml:"retry"`
+		HTTPClients HTTPClients `yaml:"httpclients"`
+		Listeners   []struct {
+			Addr string `yaml:"addr"`
+		} `yaml:"listeners"`
+		Tags    []string          `yaml:"tags"`
+		Labels  map[string]string `yaml:"labels"`
+		Section readVerifySection `yaml:"section"`
+	}
+	var (
+		cfg  hclRoot
+		path string
+		err  error
+	)
+
+	defer currentApp.Store(nil)
+	defer lastProvenance.Store(nil)
+	path = filepath.Join(t.TempDir(), "app.hcl")
+	err = os.WriteFile(path, []byte(`# application settings
+app {
+  name        = "billing"
+  environment = "staging"
+}
+retry {
+  maxattempts    = 4
+  initialbackoff = "250ms"
+}
+httpclients "billing" {
+  baseurl = "https://billing.example.com"
+  timeout = "5s"
+}
+httpclients "ledger" {
+  baseurl = "https://ledger.example.com"
+}
+listeners {
+  addr = ":8080"
+}
+listeners {
+  addr = ":8443"
+}
+tags   = ["a", "b"]
+labels = { team = "payments" }
+section {
+  name = "from-hcl"
+}
+`), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.App.Name != "billing" || cfg.Retry.MaxAttempts != 4 || cfg.Retry.InitialBackoff != 250*time.Millisecond ||
+		cfg.HTTPClients["billing"].Timeout != 5*time.Second || cfg.HTTPClients["ledger"].BaseURL != "https://ledger.example.com" ||
+		len(cfg.Listeners) != 2 || cfg.Listeners[1].Addr != ":8443" || len(cfg.Tags) != 2 || cfg.Labels["team"] != "payments" ||
+		!cfg.Section.Verified || cfg.Section.Name != "from-hcl" {
+		t.Fatalf("unexpected config from hcl %#v", cfg)
+	}
+	if Provenance()["httpclients.billing.baseurl"] != "file" || Provenance()["httpclients.ledger.timeout"] != "default" {
+		t.Fatalf("unexpected provenance %v", Provenance())
+	}
+
+	err = os.WriteFile(path, []byte("retry {\n  maxattempts = var.attempts\n}\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 2: Variables not allowed")
+	err = os.WriteFile(path, []byte("section \"a\" {\n}\nsection {\n}\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 3: Mixed blocks")
+	err = os.WriteFile(path, []byte("retry {\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg), "line 1: Unclosed configuration block")
+}
+
+func TestReadWithCUESchema(t *testing.T) {
+	const schema = `
+retry?: {
+	maxattempts?: int & >=1 & <=10
+	initialbackoff?: =~"^[0-9]+(ms|s)$"
+}
+app!: {
+	name!: string
+	environment?: "dev" | "staging" | "prod"
+}
+`
+	type schemaRoot struct {
+		App   AppConfig   `yaml:"app"`
+		Retry RetryConfig `yaml:"retry"`
+	}
+	var (
+		cfg  schemaRoot
+		dir  string
+		path string
+		err  error
+	)
+
+	defer currentApp.Store(nil)
+	dir = t.TempDir()
+	path = filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: staging\nretry:\n  maxattempts: 3\n  initialbackoff: 250ms\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	err = Read(path, &cfg, WithCUESchema(schema))
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if cfg.Retry.MaxAttempts != 3 {
+		t.Fatalf("unexpected retry %#v", cfg.Retry)
+	}
+
+	err = os.WriteFile(path, []byte("app:\n  name: billing\n  environment: staging\nretry:\n  maxattempts: 30\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg, WithCUESchema(schema)), "does not match its schema: line 5: retry.maxattempts: invalid value 30 (out of bound <=10)")
+
+	path = filepath.Join(dir, "config.properties")
+	err = os.WriteFile(path, []byte("app.environment=qa\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg, WithCUESchema(schema)), "line 2: app.environment: conflicting values \"prod\" and \"qa\"")
+	err = os.WriteFile(path, []byte("app.environment=prod\n"), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing config: %v", err)
+	}
+	checkError(t, Read(path, &cfg, WithCUESchema(schema)), "app.name: field is required but not present")
+	checkError(t, Read(path, &cfg, WithCUESchema("retry: {")), "invalid cue schema: line 1:")
+}
+
+func TestReadSkipsDisabledSections(t *testing.T) {
+	type optionalRoot struct {
+		Admin    AdminConfig                   `yaml:"admin"`
+		Metrics  *MetricsConfig                `yaml:"metrics"`
+		Redis    RedisConfig                   `yaml:"redis" optional:"true"`
+		Required RedisConfig                   `yaml:"required"`
+		Sections map[string]readRuntimeSection `yaml:"sections"`
+		Check    readVerifySection             `yaml:"check" optional:"true"`
+	}
+	var (
+		cfg  optionalRoot
+		path string
+		err  error
+	)
+
+	path = writeTempConfig(t, "admin:\n  enabled: false\n  bindaddr: not-an-address\nmetrics:\n  enabled: false\n  path: metrics\n"+
+		"required:\n  server: redis:6379\nsections:\n  off:\n    port: 80\n  on:\n    enabled: true\n    port: 81\n")
+	err = Read(path, &cfg)
+	if !errors.Is(err, nil) {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if len(cfg.Admin.BindAddr) > 0 || len(cfg.Admin.PathPrefix) > 0 || cfg.Metrics == nil || len(cfg.Metrics.Path) > 0 {
+		t.Fatalf("expected disabled sections to be zeroed, got %#v and %#v", cfg.Admin, cfg.Metrics)
+	}
+	if len(cfg.Redis.Server) > 0 || cfg.Required.MaxActive != 32 {
+		t.Fatalf("expected only the required redis section to be verified, got %#v and %#v", cfg.Redis, cfg.Required)
+	}
+	if cfg.Check.Verified || cfg.Sections["off"].Port != 0 || cfg.Sections["on"].Port != 81 {
+		t.Fatalf("unexpected sections %#v, %#v", cfg.Check, cfg.Sections)
+	}
+
+	path = writeTempConfig(t, "redis:\n  databaseindex: 1\nrequired:\n  server: redis:6379\n")
+	checkError(t, Read(path, &cfg), "optionalRoot.Redis: missing Redis Server")
+}
+
+func writeTempConfig(t *testing.T, yamlBody string) string {
+	var (
+		dir  string
+		path string
+		err  error
+	)
+
+	t.Helper()
+
+	dir = t.TempDir()
+	path = filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(path, []byte(yamlBody), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("failed writing temp config file: %v", err)
+	}
+
+	return path
+}
+
+func checkError(t *testing.T, err error, wantSubstr string) {
+	t.Helper()
+
+	if len(wantSubstr) == 0 {
+		if !errors.Is(err, nil) {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		return
+	}
+	if errors.Is(err, nil) {
+		t.Fatalf("expected error containing %q", wantSubstr)
+	}
+	if !strings.Contains(err.Error(), wantSubstr) {
+		t.Fatalf("expected error containing %q, got %q", wantSubstr, err.Error())
+	}
+}
+
+func captureWarnings(t *testing.T, warnings *[]string) {
+	var saved func(string, ...any)
+
+	t.Helper()
+
+	saved = Warnf
+	Warnf = func(format string, args ...any) {
+		*warnings = append(*warnings, fmt.Sprintf(format, args...))
+	}
+	t.Cleanup(func() {
+		Warnf = saved
+	})
+}
+
+// startFakeSMTPServer runs a minimal SMTP server on the loopback interface which accepts AUTH PLAIN and
+// AUTH LOGIN with any user and the given password.
+func startFakeSMTPServer(t *testing.T, password string) int {
+	var (
+		ln  net.Listener
+		err error
+	)
+
+	t.Helper()
+
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	go func() {
+		var (
+			conn net.Conn
+			err  error
+		)
+
+		for {
+			conn, err = ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeSMTP(conn, password)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func serveFakeSMTP(conn net.Conn, password string) {
+	var (
+		r       *bufio.Reader
+		line    string
+		decoded []byte
+		parts   []string
+		err     error
+	)
+
+	defer conn.Close()
+	r = bufio.NewReader(conn)
+	_, _ = fmt.Fprint(conn, "220 fake ESMTP\r\n")
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			_, _ = fmt.Fprint(conn, "250-fake\r\n250 AUTH PLAIN LOGIN\r\n")
+		case strings.HasPrefix(line, "AUTH PLAIN "):
+			decoded, _ = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			parts = strings.Split(string(decoded), "\x00")
+			if len(parts) == 3 && parts[2] == password {
+				_, _ = fmt.Fprint(conn, "235 ok\r\n")
+			} else {
+				_, _ = fmt.Fprint(conn, "535 bad credentials\r\n")
+			}
+		case line == "AUTH LOGIN":
+			_, _ = fmt.Fprint(conn, "334 "+base64.StdEncoding.EncodeToString([]byte("Username:"))+"\r\n")
+			_, _ = r.ReadString('\n')
+			_, _ = fmt.Fprint(conn, "334 "+base64.StdEncoding.EncodeToString([]byte("Password:"))+"\r\n")
+			line, _ = r.ReadString('\n')
+			decoded, _ = base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+			if string(decoded) == password {
+				_, _ = fmt.Fprint(conn, "235 ok\r\n")
+			} else {
+				_, _ = fmt.Fprint(conn, "535 bad credentials\r\n")
+			}
+		case line == "QUIT":
+			_, _ = fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			_, _ = fmt.Fprint(conn, "502 not implemented\r\n")
+		}
+	}
+}
+
+func generateEd25519PEM(t *testing.T) string {
+	var (
+		key ed25519.PrivateKey
+		der []byte
+		err error
+	)
+
+	t.Helper()
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	der, err = x509.MarshalPKCS8PrivateKey(key)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// writeTestCertificate writes a self-signed ECDSA certificate for the hosts and its key to temporary files,
+// returning their paths.
+func writeTestCertificate(t *testing.T, hosts []string, notAfter time.Time) (string, string) {
+	var (
+		key      *ecdsa.PrivateKey
+		template x509.Certificate
+		der      []byte
+		keyDER   []byte
+		dir      string
+		certFile string
+		keyFile  string
+		err      error
+	)
+
+	t.Helper()
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	template = x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		DNSNames:              hosts,
+		NotBefore:             notAfter.Add(-2 * 365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err = x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	keyDER, err = x509.MarshalPKCS8PrivateKey(key)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+
+	dir = t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to write certificate: %v", err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if !errors.Is(err, nil) {
+		t.Fatalf("unable to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func freeTCPPort(t *testing.T) int {
+	var (
+		ln  net.Listener
+		err error
+	)
+
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// fakeDNSAnswer answers a DNS query with a single A record for ip, or no records for other query types.
+func fakeDNSAnswer(query []byte, ip net.IP) []byte {
+	var (
+		resp  []byte
+		end   int
+		qtype uint16
+	)
+
+	end = 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	qtype = uint16(query[end-4])<<8 | uint16(query[end-3])
+	resp = append(resp, query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0)
+	resp = append(resp, query[12:end]...)
+	if qtype == 1 {
+		resp[7] = 1
+		resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		resp = append(resp, ip.To4()...)
+	}
+	return resp
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func executeTemplate(t *testing.T, ts *TemplateSet, w io.Writer, name string, data any) {
+	var (
+		tmpl *template.Template
+		err  error
+	)
+
+	t.Helper()
+	tmpl, err = ts.Get()
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	err = tmpl.ExecuteTemplate(w, name, data)
+	if err != nil {
+		t.Fatalf("ExecuteTemplate returned error: %v", err)
+	}
 }
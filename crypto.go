@@ -0,0 +1,152 @@
+package serverconfig
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var kmsKeyARNRE = regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:\d{12}:(key/[A-Za-z0-9-]+|alias/[A-Za-z0-9/_-]+)$`)
+
+// CryptoConfig holds the application's data encryption keys for envelope encryption.  Keys maps key ids to
+// either a base64 AES key of 16, 24, or 32 bytes, or the ARN of an AWS KMS key that wraps the data keys.
+// Since keys are secrets, KeysEnv may name an environment variable holding further "id=key" pairs,
+// separated by commas, which take precedence over the file.  ActiveKeyID selects the key used to encrypt;
+// the others are kept to decrypt data written before a rotation.  RotationSchedule is an optional cron
+// expression, as for JobConfig, for when a new key should be introduced.
+//
+//	crypto:
+//	  activekeyid: "2026-10"
+//	  keysenv: APP_DATA_KEYS
+//	  keys:
+//	    "2026-04": arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab
+//	  rotationschedule: "@monthly"
+type CryptoConfig struct {
+	ActiveKeyID      string            `yaml:"activekeyid" env:"ACTIVEKEYID"`
+	Keys             map[string]string `yaml:"keys"`
+	KeysEnv          string            `yaml:"keysenv"`
+	RotationSchedule string            `yaml:"rotationschedule"`
+	keys             map[string]CryptoKey
+	rotation         cron.Schedule
+}
+
+// CryptoKey is one key of a CryptoConfig.  Exactly one of Key and KMSARN is set.
+type CryptoKey struct {
+	ID     string
+	Key    []byte
+	KMSARN string
+}
+
+// Verify merges KeysEnv into Keys, decodes each key and checks its length, and checks that ActiveKeyID is
+// one of them.
+func (cfg *CryptoConfig) Verify() error {
+	var (
+		envValue string
+		found    bool
+		pairs    []string
+		id       string
+		value    string
+		key      CryptoKey
+		err      error
+		i        int
+	)
+
+	if len(cfg.KeysEnv) > 0 {
+		envValue, found = os.LookupEnv(cfg.KeysEnv)
+		if !found {
+			return fmt.Errorf("missing crypto keys (environment variable %s is not set)", cfg.KeysEnv)
+		}
+		if cfg.Keys == nil {
+			cfg.Keys = make(map[string]string)
+		}
+		pairs = strings.Split(envValue, ",")
+		for i = 0; i < len(pairs); i++ {
+			id, value, found = strings.Cut(strings.TrimSpace(pairs[i]), "=")
+			if !found || len(id) == 0 {
+				return fmt.Errorf("invalid crypto key in %s (expected id=key)", cfg.KeysEnv)
+			}
+			cfg.Keys[id] = value
+		}
+	}
+	if len(cfg.Keys) == 0 {
+		return fmt.Errorf("crypto requires at least one key")
+	}
+	cfg.keys = make(map[string]CryptoKey, len(cfg.Keys))
+	for id, value = range cfg.Keys {
+		value = strings.TrimSpace(value)
+		key = CryptoKey{ID: id}
+		if strings.HasPrefix(value, "arn:") {
+			if !kmsKeyARNRE.MatchString(value) {
+				return fmt.Errorf("crypto key %q is not a valid KMS key ARN", id)
+			}
+			key.KMSARN = value
+		} else {
+			key.Key = decodeSecretKey(value, 16, 24, 32)
+			if len(key.Key) != 16 && len(key.Key) != 24 && len(key.Key) != 32 {
+				return fmt.Errorf("crypto key %q must be 16, 24, or 32 bytes, got %d", id, len(key.Key))
+			}
+		}
+		cfg.keys[id] = key
+	}
+	if len(cfg.ActiveKeyID) == 0 {
+		return fmt.Errorf("missing crypto activekeyid (or ACTIVEKEYID environment variable)")
+	}
+	_, found = cfg.keys[cfg.ActiveKeyID]
+	if !found {
+		return fmt.Errorf("crypto activekeyid %q is not one of the keys", cfg.ActiveKeyID)
+	}
+	cfg.rotation = nil
+	if len(cfg.RotationSchedule) > 0 {
+		cfg.rotation, err = jobParser.Parse(cfg.RotationSchedule)
+		if err != nil {
+			return fmt.Errorf("invalid crypto rotationschedule %q: %w", cfg.RotationSchedule, err)
+		}
+	}
+	return nil
+}
+
+// ActiveKey returns the key to encrypt with.
+func (cfg *CryptoConfig) ActiveKey() CryptoKey {
+	return cfg.keys[cfg.ActiveKeyID]
+}
+
+// Key returns the key with the given id, as recorded alongside encrypted data.
+func (cfg *CryptoConfig) Key(id string) (CryptoKey, bool) {
+	var (
+		key   CryptoKey
+		found bool
+	)
+
+	key, found = cfg.keys[id]
+	return key, found
+}
+
+// LegacyKeys returns the keys other than the active one, sorted by id.
+func (cfg *CryptoConfig) LegacyKeys() []CryptoKey {
+	var (
+		keys []CryptoKey
+		id   string
+	)
+
+	for id = range cfg.keys {
+		if id != cfg.ActiveKeyID {
+			keys = append(keys, cfg.keys[id])
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// NextRotation returns the time of the next scheduled rotation after t, or the zero time when there is no
+// RotationSchedule.
+func (cfg *CryptoConfig) NextRotation(t time.Time) time.Time {
+	if cfg.rotation == nil {
+		return time.Time{}
+	}
+	return cfg.rotation.Next(t)
+}
@@ -0,0 +1,94 @@
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+	cueyaml "cuelang.org/go/encoding/yaml"
+	"gopkg.in/yaml.v3"
+)
+
+// WithCUESchema has Read validate the file against a CUE schema before decoding it, for constraints such as
+// ranges, enumerations, and rules between fields that are awkward to write as Verify methods.  The schema is
+// unified with the file as it was written, before environment overrides and defaults, and every setting it
+// names must then have a concrete value, so settings which may be left out are marked optional with ?.
+// Errors give the line in the file of the value at fault; for files which are not YAML, that is the line
+// in their YAML equivalent.
+//
+//	err := serverconfig.Read("config.yaml", &cfg, serverconfig.WithCUESchema(`
+//		http?: port?: int & >=1024 & <=65535
+//		logging?: level?: "debug" | "info" | "warn" | "error"
+//	`))
+func WithCUESchema(schema string) ReadOption {
+	return func(options *readOptions) {
+		options.cueSchema = schema
+	}
+}
+
+// validateCUE checks the file, given by its contents b and the document decoded from them, against schema.
+func validateCUE(schema, filename string, b []byte, doc *yaml.Node) error {
+	var (
+		ctx      *cue.Context
+		compiled cue.Value
+		file     *ast.File
+		found    bool
+		err      error
+	)
+
+	ctx = cuecontext.New()
+	compiled = ctx.CompileString(schema, cue.Filename("schema.cue"))
+	err = compiled.Err()
+	if err != nil {
+		return fmt.Errorf("invalid cue schema: %w", cueError(err, "schema.cue"))
+	}
+	_, found = formatDecoder(filename)
+	if found {
+		b, err = yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+	}
+	file, err = cueyaml.Extract(filename, b)
+	if err != nil {
+		return cueError(err, filename)
+	}
+	err = compiled.Unify(ctx.BuildFile(file)).Validate(cue.Concrete(true))
+	if err != nil {
+		return cueError(err, filename)
+	}
+	return nil
+}
+
+// cueError joins the errors in err, each with the line in filename it refers to, if any.
+func cueError(err error, filename string) error {
+	var (
+		list      []cueerrors.Error
+		positions []token.Pos
+		errs      []error
+		line      int
+		i         int
+		j         int
+	)
+
+	list = cueerrors.Errors(err)
+	for i = 0; i < len(list); i++ {
+		positions = append([]token.Pos{list[i].Position()}, list[i].InputPositions()...)
+		line = 0
+		for j = 0; j < len(positions) && line == 0; j++ {
+			if positions[j].IsValid() && positions[j].Filename() == filename {
+				line = positions[j].Line()
+			}
+		}
+		if line == 0 {
+			errs = append(errs, errors.New(list[i].Error()))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("line %d: %s", line, list[i].Error()))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+package serverconfig
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// DebugConfig controls the pprof debug endpoints.  The endpoints are served by Handler on a dedicated
+// listener at BindAddr, which defaults to localhost:6060 so that profiling data isn't exposed by accident.
+// If AuthToken is set, requests must carry it as "Authorization: Bearer <token>".  With PublishConfig set,
+// the configuration that contains this section is also served at /debug/config, as by ConfigHandler.
+//
+//	debug:
+//	  enabled: true
+//	  bindaddr: localhost:6060
+//	  publishconfig: true
+type DebugConfig struct {
+	Enabled       bool   `yaml:"enabled" env:"DEBUGENABLED"`
+	BindAddr      string `yaml:"bindaddr" env:"DEBUGBINDADDR"`
+	AuthToken     string `yaml:"authtoken" env:"DEBUGAUTHTOKEN"`
+	PublishConfig bool   `yaml:"publishconfig"`
+	root          any
+	provenance    map[string]string
+}
+
+// Verify defaults the BindAddr and checks it.  Binding to all interfaces without an AuthToken is allowed
+// but produces a warning.
+func (cfg *DebugConfig) Verify() error {
+	var (
+		host string
+		ip   net.IP
+		err  error
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.BindAddr) == 0 {
+		cfg.BindAddr = "localhost:6060"
+	}
+	err = validateHostPort(cfg.BindAddr)
+	if err != nil {
+		return fmt.Errorf("invalid debug bindaddr: %w", err)
+	}
+
+	if len(cfg.AuthToken) == 0 {
+		host, _, _ = net.SplitHostPort(cfg.BindAddr)
+		ip = net.ParseIP(host)
+		if len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+			warnf("debug endpoints bound to %s on all interfaces without an authtoken", cfg.BindAddr)
+		}
+	}
+	return nil
+}
+
+// PostVerify keeps the configuration containing the section for /debug/config when PublishConfig is set.
+func (cfg *DebugConfig) PostVerify(root any) error {
+	cfg.root = nil
+	if cfg.Enabled && cfg.PublishConfig {
+		cfg.root = root
+	}
+	return nil
+}
+
+// keepProvenance keeps the provenance of the configuration containing the section for /debug/config.
+func (cfg *DebugConfig) keepProvenance(provenance map[string]string) {
+	cfg.provenance = nil
+	if cfg.root != nil {
+		cfg.provenance = provenance
+	}
+}
+
+// Handler returns a handler serving the net/http/pprof endpoints under /debug/pprof/, and /debug/config when
+// PublishConfig is set.  If debugging isn't enabled the handler responds with 404 to everything.  Importing
+// net/http/pprof also registers its endpoints on http.DefaultServeMux, so that mux should not be served
+// publicly.
+func (cfg *DebugConfig) Handler() http.Handler {
+	var mux *http.ServeMux
+
+	if !cfg.Enabled {
+		return http.NotFoundHandler()
+	}
+
+	mux = http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	if cfg.root != nil {
+		mux.Handle("/debug/config", ConfigHandler(cfg.root, cfg.provenance))
+	}
+	if len(cfg.AuthToken) > 0 {
+		return bearerTokenHandler(cfg.AuthToken, mux)
+	}
+	return mux
+}
+
+// EffectiveConfig returns the configuration the process loaded, with secrets removed by Redact, along with
+// the provenance of each setting, as stored by WithProvenance when cfg was read.  cfg may be a
+// ConfigReloader, whose current configuration and its provenance are used in place of provenance.  It
+// suits expvar, which this package doesn't import since doing so registers /debug/vars on
+// http.DefaultServeMux:
+//
+//	expvar.Publish("config", expvar.Func(func() any { return serverconfig.EffectiveConfig(&gc, provenance) }))
+func EffectiveConfig(cfg any, provenance map[string]string) map[string]any {
+	var (
+		reloader interface {
+			currentWithProvenance() (any, map[string]string)
+		}
+		ok bool
+	)
+
+	reloader, ok = cfg.(interface {
+		currentWithProvenance() (any, map[string]string)
+	})
+	if ok {
+		cfg, provenance = reloader.currentWithProvenance()
+	}
+	return map[string]any{"config": Redact(cfg), "provenance": provenance}
+}
+
+// ConfigHandler returns a handler serving EffectiveConfig(cfg, provenance) as JSON.
+func ConfigHandler(cfg any, provenance map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, EffectiveConfig(cfg, provenance))
+	})
+}
+
+func bearerTokenHandler(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			got   string
+			found bool
+		)
+
+		got, found = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package serverconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigChange is one setting that differs between two configurations compared by Diff.  Path is the
+// dotted yaml path of the setting, and Old and New its values, which are nil when the setting is absent
+// and Redacted for secrets.
+type ConfigChange struct {
+	Path string
+	Old  any
+	New  any
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff compares two configurations of the same type, given as pointers to structs as for Read, and returns
+// the settings that differ, sorted by path.  Unexported fields are ignored.  A change to a secret field, as
+// recognized by Redact, is reported without its values.
+//
+//	for _, change := range serverconfig.Diff(&running, &onDisk) {
+//		log.Printf("config changed: %s", change)
+//	}
+func Diff(old, new any) []ConfigChange {
+	var (
+		before  map[string]any
+		after   map[string]any
+		secrets map[string]bool
+		paths   []string
+		path    string
+		found   bool
+		changes []ConfigChange
+		change  ConfigChange
+		i       int
+	)
+
+	before = make(map[string]any)
+	after = make(map[string]any)
+	secrets = make(map[string]bool)
+	flattenConfig(reflect.ValueOf(old), "", before, secrets)
+	flattenConfig(reflect.ValueOf(new), "", after, secrets)
+	for path = range before {
+		paths = append(paths, path)
+	}
+	for path = range after {
+		_, found = before[path]
+		if !found {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for i = 0; i < len(paths); i++ {
+		if reflect.DeepEqual(before[paths[i]], after[paths[i]]) {
+			continue
+		}
+		change = ConfigChange{Path: paths[i], Old: before[paths[i]], New: after[paths[i]]}
+		if secrets[paths[i]] {
+			if change.Old != nil {
+				change.Old = Redacted
+			}
+			if change.New != nil {
+				change.New = Redacted
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// flattenConfig records every non-zero setting under value by its dotted yaml path, marking secrets.
+// Structs and maps are descended into; anything else, including slices, is a single setting.
+func flattenConfig(value reflect.Value, path string, out map[string]any, secrets map[string]bool) {
+	var (
+		fieldDef reflect.StructField
+		key      string
+		keys     []reflect.Value
+		stringer fmt.Stringer
+		ok       bool
+		i        int
+		j        int
+	)
+
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.IsZero() {
+		return
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if secrets[path] {
+			break
+		}
+		for i = 0; i < value.NumField(); i++ {
+			fieldDef = value.Type().Field(i)
+			if len(fieldDef.PkgPath) > 0 {
+				continue
+			}
+			key, _ = yamlFieldName(fieldDef)
+			if key == "-" {
+				continue
+			}
+			if redactedFieldRE.MatchString(strings.ToLower(fieldDef.Name)) {
+				secrets[joinYAMLPath(path, key)] = true
+			}
+			if redactedValuesFieldRE.MatchString(strings.ToLower(fieldDef.Name)) && value.Field(i).Kind() == reflect.Map {
+				keys = value.Field(i).MapKeys()
+				for j = 0; j < len(keys); j++ {
+					secrets[joinYAMLPath(joinYAMLPath(path, key), fmt.Sprint(keys[j].Interface()))] = true
+				}
+			}
+			flattenConfig(value.Field(i), joinYAMLPath(path, key), out, secrets)
+		}
+		return
+	case reflect.Map:
+		if secrets[path] {
+			break
+		}
+		keys = value.MapKeys()
+		for i = 0; i < len(keys); i++ {
+			flattenConfig(value.MapIndex(keys[i]), joinYAMLPath(path, fmt.Sprint(keys[i].Interface())), out, secrets)
+		}
+		return
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return
+	}
+	if len(path) == 0 || !value.CanInterface() {
+		return
+	}
+	stringer, ok = value.Interface().(fmt.Stringer)
+	if ok {
+		out[path] = stringer.String()
+		return
+	}
+	out[path] = value.Interface()
+}
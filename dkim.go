@@ -0,0 +1,134 @@
+package serverconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// DKIMConfig holds the settings for DKIM-signing outbound mail.  The private key is PEM encoded (PKCS#1 or
+// PKCS#8, RSA or Ed25519) and is read from PrivateKeyFile, or given directly in PrivateKey, typically via
+// the DKIMPRIVATEKEY environment variable.
+//
+//	dkim:
+//	  domain: acme.com
+//	  selector: mail2024
+//	  privatekeyfile: /etc/acme/dkim.pem
+type DKIMConfig struct {
+	Domain         string `yaml:"domain"`
+	Selector       string `yaml:"selector"`
+	PrivateKeyFile string `yaml:"privatekeyfile"`
+	PrivateKey     string `yaml:"privatekey" env:"DKIMPRIVATEKEY"`
+	signer         crypto.Signer
+}
+
+// Verify checks the domain and selector and loads the private key.  RSA keys shorter than 1024 bits are
+// rejected and those shorter than 2048 bits produce a warning.
+func (cfg *DKIMConfig) Verify() error {
+	var (
+		pemBytes []byte
+		ok       bool
+		err      error
+	)
+
+	if len(cfg.Domain) == 0 {
+		return fmt.Errorf("missing DKIM domain")
+	}
+	err = validateHostname(cfg.Domain)
+	if err != nil {
+		return fmt.Errorf("DKIM domain: %w", err)
+	}
+	if len(cfg.Selector) == 0 {
+		return fmt.Errorf("missing DKIM selector")
+	}
+	err = validateHostname(cfg.Selector)
+	if err != nil {
+		return fmt.Errorf("DKIM selector: %w", err)
+	}
+
+	switch {
+	case len(cfg.PrivateKey) > 0:
+		pemBytes = []byte(cfg.PrivateKey)
+	case len(cfg.PrivateKeyFile) > 0:
+		pemBytes, err = os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read DKIM private key: %w", err)
+		}
+	default:
+		return fmt.Errorf("missing DKIM privatekeyfile (or DKIMPRIVATEKEY environment variable)")
+	}
+
+	cfg.signer, err = parsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return fmt.Errorf("invalid DKIM private key: %w", err)
+	}
+	if _, ok = cfg.signer.(*ecdsa.PrivateKey); ok {
+		cfg.signer = nil
+		return fmt.Errorf("invalid DKIM private key: ECDSA keys are not supported by DKIM, use RSA or Ed25519")
+	}
+	return nil
+}
+
+// Signer returns the private key loaded by Verify.
+func (cfg DKIMConfig) Signer() crypto.Signer {
+	return cfg.signer
+}
+
+// parsePrivateKeyPEM decodes an RSA, ECDSA, or Ed25519 private key from PEM in PKCS#1, SEC 1, or PKCS#8
+// form.
+func parsePrivateKeyPEM(pemBytes []byte) (crypto.Signer, error) {
+	var (
+		block  *pem.Block
+		parsed any
+		rsaKey *rsa.PrivateKey
+		err    error
+	)
+
+	block, _ = pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		rsaKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		parsed = rsaKey
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 1024 {
+			return nil, fmt.Errorf("RSA key of %d bits is too short", key.N.BitLen())
+		}
+		if key.N.BitLen() < 2048 {
+			warnf("RSA key of %d bits is weak, 2048 bits or more is recommended", key.N.BitLen())
+		}
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T (expected RSA, ECDSA, or Ed25519)", parsed)
+	}
+}
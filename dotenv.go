@@ -0,0 +1,148 @@
+package serverconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadDotEnv sets environment variables from .env files, for Read to apply as overrides, so local development
+// can keep settings out of the yaml file.  Variables already in the environment are left alone, as are those
+// set by an earlier file.  With no paths it loads .env from the working directory, if there is one; a named
+// file that does not exist is an error.
+//
+// Each line is NAME=value, optionally preceded by "export".  Blank lines and lines starting with # are
+// ignored, as is a # comment after an unquoted value.  Values in single quotes are taken literally, and values
+// in double quotes may use the escapes of a Go string, such as \n.  Variables are not expanded.
+//
+//	err := serverconfig.LoadDotEnv()
+//	if err == nil {
+//		err = serverconfig.Read("config.yaml", &cfg)
+//	}
+func LoadDotEnv(paths ...string) error {
+	var (
+		vars  map[string]string
+		name  string
+		found bool
+		err   error
+		i     int
+	)
+
+	if len(paths) == 0 {
+		_, err = os.Stat(".env")
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		paths = []string{".env"}
+	}
+	for i = 0; i < len(paths); i++ {
+		vars, err = parseDotEnv(paths[i])
+		if err != nil {
+			return err
+		}
+		for name = range vars {
+			_, found = os.LookupEnv(name)
+			if found {
+				continue
+			}
+			err = os.Setenv(name, vars[name])
+			if err != nil {
+				return fmt.Errorf("unable to set %s from %s: %w", name, paths[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseDotEnv returns the variables set by the .env file at path.
+func parseDotEnv(path string) (map[string]string, error) {
+	var (
+		f       *os.File
+		scanner *bufio.Scanner
+		vars    map[string]string
+		line    string
+		name    string
+		value   string
+		found   bool
+		lineNo  int
+		err     error
+	)
+
+	f, err = os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read env file: %w", err)
+	}
+	defer f.Close()
+
+	vars = make(map[string]string)
+	scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line = strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, found = strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || len(name) == 0 || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, lineNo)
+		}
+		value, err = parseDotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid value for %s: %w", path, lineNo, name, err)
+		}
+		vars[name] = value
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read env file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseDotEnvValue unquotes a value from a .env file, or strips any comment following it if it is unquoted.
+func parseDotEnvValue(raw string) (string, error) {
+	var (
+		quoted string
+		value  string
+		end    int
+		err    error
+	)
+
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end = strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		return raw[1 : end+1], checkDotEnvTrailer(raw[end+2:])
+	case strings.HasPrefix(raw, `"`):
+		quoted, err = strconv.QuotedPrefix(raw)
+		if err == nil {
+			value, err = strconv.Unquote(quoted)
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid double quoted string")
+		}
+		return value, checkDotEnvTrailer(raw[len(quoted):])
+	}
+	end = strings.Index(raw, " #")
+	if end >= 0 {
+		raw = strings.TrimSpace(raw[:end])
+	}
+	return raw, nil
+}
+
+// checkDotEnvTrailer checks that nothing but a comment follows a quoted value.
+func checkDotEnvTrailer(trailer string) error {
+	trailer = strings.TrimSpace(trailer)
+	if len(trailer) > 0 && !strings.HasPrefix(trailer, "#") {
+		return fmt.Errorf("unexpected %q after closing quote", trailer)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package serverconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriftMonitor detects when the configuration file no longer matches the configuration the process is
+// running with, such as after an edit that was never followed by a restart or reload, which would
+// otherwise only show up as a surprise on the next restart.
+//
+//	monitor := serverconfig.NewDriftMonitor("/etc/myapp/config.yaml", &gc, nil)
+//	go monitor.Watch(ctx, 5*time.Minute)
+type DriftMonitor struct {
+	filename string
+	options  []ReadOption
+	running  any
+	onDrift  func(changes []ConfigChange)
+	mu       sync.Mutex
+	reported string // changes last passed to onDrift
+}
+
+// NewDriftMonitor returns a DriftMonitor comparing filename against running, a pointer to the configuration
+// struct that was read from it, or a ConfigReloader.  onDrift is called with the differences when drift
+// is found; when it is nil the differences are reported through Warnf.  opts are passed to Read, and should
+// be those the running configuration was read with.
+func NewDriftMonitor(filename string, running any, onDrift func(changes []ConfigChange), opts ...ReadOption) *DriftMonitor {
+	return &DriftMonitor{filename: filename, options: opts, running: running, onDrift: onDrift}
+}
+
+// Check reads the file into a new configuration, as Read does but without changing CurrentApp or
+// Provenance and without network checks such as SMTP test connections or external host name tests, and
+// returns its differences from the running configuration.  Any warnings from verifying
+// the file are given again on each check.
+func (m *DriftMonitor) Check() ([]ConfigChange, error) {
+	var (
+		running any
+		onDisk  reflect.Value
+		options readOptions
+		err     error
+		i       int
+	)
+
+	running = resolveConfig(m.running)
+	if reflect.ValueOf(running).Kind() != reflect.Pointer || reflect.ValueOf(running).IsNil() {
+		return nil, fmt.Errorf("running configuration must be a non-nil pointer to a struct")
+	}
+	onDisk = reflect.New(reflect.TypeOf(running).Elem())
+	for i = 0; i < len(m.options); i++ {
+		m.options[i](&options)
+	}
+	options.offline = true
+	_, err = readConfig(m.filename, onDisk.Interface(), options)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(running, onDisk.Interface()), nil
+}
+
+// Watch calls Check every interval until ctx is done.  Drift is reported when first found and again only
+// if it changes.  Failures to read the file are reported through Warnf.
+func (m *DriftMonitor) Watch(ctx context.Context, interval time.Duration) {
+	var (
+		ticker *time.Ticker
+		err    error
+	)
+
+	ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err = m.check()
+			if err != nil {
+				warnf("configuration drift check of %s failed: %v", m.filename, err)
+			}
+		}
+	}
+}
+
+// check runs Check and reports any drift not already reported.
+func (m *DriftMonitor) check() error {
+	var (
+		changes []ConfigChange
+		list    []string
+		key     string
+		err     error
+		i       int
+	)
+
+	changes, err = m.Check()
+	if err != nil {
+		return err
+	}
+	for i = 0; i < len(changes); i++ {
+		list = append(list, changes[i].String())
+	}
+	key = strings.Join(list, "\n")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key == m.reported {
+		return nil
+	}
+	m.reported = key
+	if len(changes) == 0 {
+		return nil
+	}
+	if m.onDrift != nil {
+		m.onDrift(changes)
+		return nil
+	}
+	warnf("configuration file %s no longer matches the running configuration: %s", m.filename, strings.Join(list, "; "))
+	return nil
+}
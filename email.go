@@ -0,0 +1,109 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// EmailConfig selects a transactional email provider and holds its credentials.  Provider is one of
+// "smtp", "ses", "sendgrid", or "mailgun", and only the matching sub-section needs to be given.  From and
+// ReplyTo apply to every provider, as does the optional DKIM signing section.
+//
+//	email:
+//	  provider: sendgrid
+//	  from: Acme <noreply@acme.com>
+//	  sendgrid:
+//	    apikey: SG.xxxx
+type EmailConfig struct {
+	Provider string               `yaml:"provider" env:"EMAILPROVIDER"`
+	From     string               `yaml:"from"`
+	ReplyTo  string               `yaml:"replyto"`
+	SMTP     *SMTPConfig          `yaml:"smtp"`
+	SES      *EmailSESConfig      `yaml:"ses"`
+	SendGrid *EmailSendGridConfig `yaml:"sendgrid"`
+	Mailgun  *EmailMailgunConfig  `yaml:"mailgun"`
+	DKIM     *DKIMConfig          `yaml:"dkim"`
+}
+
+// EmailSESConfig holds Amazon SES settings.  If AccessKey and SecretKey are empty the AWS default
+// credential chain is used.
+type EmailSESConfig struct {
+	Region           string `yaml:"region" env:"AWS_REGION"`
+	AccessKey        string `yaml:"accesskey" env:"AWS_ACCESS_KEY_ID"`
+	SecretKey        string `yaml:"secretkey" env:"AWS_SECRET_ACCESS_KEY"`
+	ConfigurationSet string `yaml:"configurationset"`
+}
+
+// EmailSendGridConfig holds SendGrid settings.
+type EmailSendGridConfig struct {
+	APIKey string `yaml:"apikey" env:"SENDGRID_API_KEY"`
+}
+
+// EmailMailgunConfig holds Mailgun settings.  Region is "us" (the default) or "eu".
+type EmailMailgunConfig struct {
+	Domain string `yaml:"domain"`
+	APIKey string `yaml:"apikey" env:"MAILGUN_API_KEY"`
+	Region string `yaml:"region"`
+}
+
+// Verify checks the From/ReplyTo addresses and that the sub-section for the selected provider has the
+// fields that provider needs.  For the smtp provider, From is copied into the SMTP section if it has none.
+func (cfg *EmailConfig) Verify() error {
+	var err error
+
+	if len(cfg.From) == 0 {
+		return fmt.Errorf("missing email from address")
+	}
+	_, err = mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid email from address %q: %w", cfg.From, err)
+	}
+	if len(cfg.ReplyTo) > 0 {
+		_, err = mail.ParseAddress(cfg.ReplyTo)
+		if err != nil {
+			return fmt.Errorf("invalid email replyto address %q: %w", cfg.ReplyTo, err)
+		}
+	}
+
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	switch cfg.Provider {
+	case "smtp":
+		if cfg.SMTP == nil {
+			return fmt.Errorf("email provider is smtp but the email.smtp section is missing")
+		}
+		if len(cfg.SMTP.From) == 0 {
+			cfg.SMTP.From = cfg.From
+		}
+	case "ses":
+		if cfg.SES == nil || len(cfg.SES.Region) == 0 {
+			return fmt.Errorf("email provider is ses but email.ses.region is missing (or AWS_REGION environment variable)")
+		}
+		if (len(cfg.SES.AccessKey) == 0) != (len(cfg.SES.SecretKey) == 0) {
+			return fmt.Errorf("email ses requires both accesskey and secretkey, or neither for the default credential chain")
+		}
+	case "sendgrid":
+		if cfg.SendGrid == nil || len(cfg.SendGrid.APIKey) == 0 {
+			return fmt.Errorf("email provider is sendgrid but email.sendgrid.apikey is missing (or SENDGRID_API_KEY environment variable)")
+		}
+	case "mailgun":
+		if cfg.Mailgun == nil || len(cfg.Mailgun.Domain) == 0 {
+			return fmt.Errorf("email provider is mailgun but email.mailgun.domain is missing")
+		}
+		if len(cfg.Mailgun.APIKey) == 0 {
+			return fmt.Errorf("email provider is mailgun but email.mailgun.apikey is missing (or MAILGUN_API_KEY environment variable)")
+		}
+		cfg.Mailgun.Region = strings.ToLower(cfg.Mailgun.Region)
+		if len(cfg.Mailgun.Region) == 0 {
+			cfg.Mailgun.Region = "us"
+		}
+		if cfg.Mailgun.Region != "us" && cfg.Mailgun.Region != "eu" {
+			return fmt.Errorf("invalid email mailgun region %q (expected us or eu)", cfg.Mailgun.Region)
+		}
+	case "":
+		return fmt.Errorf("missing email provider (or EMAILPROVIDER environment variable)")
+	default:
+		return fmt.Errorf("invalid email provider %q (expected smtp, ses, sendgrid, or mailgun)", cfg.Provider)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	defaultExternalIPProviders = []string{
+		"https://ipv4.whatismyip.akamai.com",
+		"https://ipv4.myexternalip.com/raw",
+		"https://ipecho.net/plain",
+		"https://eth0.me",
+	}
+	defaultSTUNServers = []string{
+		"stun.l.google.com:19302",
+		"stun.cloudflare.com:3478",
+	}
+)
+
+const stunMagicCookie = 0x2112A442
+
+// verifyExternalIPProviders checks ExternalIPMethod and ExternalIPProviders, filling in the default
+// providers for the method when none are given.
+func (cfg *HTTPConfig) verifyExternalIPProviders() error {
+	var (
+		i   int
+		err error
+	)
+
+	cfg.ExternalIPMethod = strings.ToLower(strings.TrimSpace(cfg.ExternalIPMethod))
+	switch cfg.ExternalIPMethod {
+	case "", "http":
+		cfg.ExternalIPMethod = "http"
+		if len(cfg.ExternalIPProviders) == 0 {
+			cfg.ExternalIPProviders = append([]string(nil), defaultExternalIPProviders...)
+		}
+		for i = 0; i < len(cfg.ExternalIPProviders); i++ {
+			_, err = validateURL(cfg.ExternalIPProviders[i], "http", "https")
+			if err != nil {
+				return fmt.Errorf("invalid http externalipproviders entry: %w", err)
+			}
+		}
+	case "stun":
+		if len(cfg.ExternalIPProviders) == 0 {
+			cfg.ExternalIPProviders = append([]string(nil), defaultSTUNServers...)
+		}
+		for i = 0; i < len(cfg.ExternalIPProviders); i++ {
+			err = validateHostPort(cfg.ExternalIPProviders[i])
+			if err != nil {
+				return fmt.Errorf("invalid http externalipproviders entry: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid http externalipmethod %q (expected http or stun)", cfg.ExternalIPMethod)
+	}
+	return nil
+}
+
+// ExternalIP asks the configured providers, in parallel, for the IPv4 address this host appears as from the
+// outside, returning the first answer.  With the http method each provider is a URL returning the address
+// as plain text, fetched through OutboundProxy, and with the stun method each is a STUN server host:port.
+func (cfg *HTTPConfig) ExternalIP(ctx context.Context) (net.IP, error) {
+	type answer struct {
+		ip  net.IP
+		err error
+	}
+	var (
+		providers []string
+		method    string
+		client    *http.Client
+		cancel    context.CancelFunc
+		answers   chan answer
+		a         answer
+		errs      []string
+		i         int
+	)
+
+	providers = cfg.ExternalIPProviders
+	method = cfg.ExternalIPMethod
+	if len(providers) == 0 {
+		providers = defaultExternalIPProviders
+		if method == "stun" {
+			providers = defaultSTUNServers
+		}
+	}
+
+	client = &http.Client{Transport: cfg.OutboundProxy.Transport()}
+	defer client.CloseIdleConnections()
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	answers = make(chan answer, len(providers))
+	for i = 0; i < len(providers); i++ {
+		go func(provider string) {
+			var a answer
+
+			if method == "stun" {
+				a.ip, a.err = stunExternalIP(ctx, provider)
+			} else {
+				a.ip, a.err = httpExternalIP(ctx, client, provider)
+			}
+			if a.err != nil {
+				a.err = fmt.Errorf("%s: %w", provider, a.err)
+			}
+			answers <- a
+		}(providers[i])
+	}
+
+	for i = 0; i < len(providers); i++ {
+		a = <-answers
+		if a.err == nil {
+			return a.ip, nil
+		}
+		errs = append(errs, a.err.Error())
+	}
+	return nil, fmt.Errorf("unable to get external IP from any provider (%s)", strings.Join(errs, "; "))
+}
+
+func httpExternalIP(ctx context.Context, client *http.Client, provider string) (net.IP, error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+		body []byte
+		ip   net.IP
+		err  error
+	)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, provider, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 256))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	ip = net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("response is not an IPv4 address")
+	}
+	return ip, nil
+}
+
+// stunExternalIP sends an RFC 5389 Binding request over UDP and returns the mapped address.
+func stunExternalIP(ctx context.Context, server string) (net.IP, error) {
+	var (
+		dialer   net.Dialer
+		conn     net.Conn
+		request  [20]byte
+		response [1024]byte
+		n        int
+		deadline time.Time
+		ok       bool
+		err      error
+	)
+
+	conn, err = dialer.DialContext(ctx, "udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok = ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(4 * time.Second)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	binary.BigEndian.PutUint16(request[0:], 0x0001)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	_, err = rand.Read(request[8:20])
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(request[:])
+	if err != nil {
+		return nil, err
+	}
+	n, err = conn.Read(response[:])
+	if err != nil {
+		return nil, err
+	}
+	return parseSTUNBindingResponse(response[:n], request[8:20])
+}
+
+func parseSTUNBindingResponse(msg, transactionID []byte) (net.IP, error) {
+	var (
+		attrType uint16
+		attrLen  int
+		value    []byte
+		ip       net.IP
+		mapped   net.IP
+		cookie   [4]byte
+		i        int
+	)
+
+	binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+
+	if len(msg) < 20 || binary.BigEndian.Uint16(msg[0:]) != 0x0101 ||
+		binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie || !bytes.Equal(msg[8:20], transactionID) {
+		return nil, fmt.Errorf("invalid STUN binding response")
+	}
+	msg = msg[20:]
+	for len(msg) >= 4 {
+		attrType = binary.BigEndian.Uint16(msg[0:])
+		attrLen = int(binary.BigEndian.Uint16(msg[2:]))
+		if len(msg) < 4+attrLen {
+			break
+		}
+		value = msg[4 : 4+attrLen]
+		if attrLen >= 8 && value[1] == 0x01 {
+			ip = net.IP(append([]byte(nil), value[4:8]...))
+			switch attrType {
+			case 0x0020: // XOR-MAPPED-ADDRESS
+				for i = 0; i < 4; i++ {
+					ip[i] ^= cookie[i]
+				}
+				return ip, nil
+			case 0x0001: // MAPPED-ADDRESS
+				mapped = ip
+			}
+		}
+		msg = msg[4+(attrLen+3)&^3:]
+	}
+	if mapped != nil {
+		return mapped, nil
+	}
+	return nil, fmt.Errorf("STUN response has no IPv4 mapped address")
+}
@@ -0,0 +1,106 @@
+package serverconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileStorageConfig describes a local directory used for uploaded or generated files.  MaxUploadSize is a
+// size such as "100MB" (zero means unlimited), AllowedExtensions restricts the file types accepted (empty
+// allows all), and Permissions is the octal mode for created files, e.g. "0640".
+//
+//	filestorage:
+//	  root: /var/lib/myapp/uploads
+//	  maxuploadsize: 25MB
+//	  allowedextensions: [.jpg, .png, .pdf]
+//	  permissions: "0640"
+type FileStorageConfig struct {
+	Root              string   `yaml:"root" env:"FILESTORAGEROOT"`
+	MaxUploadSize     ByteSize `yaml:"maxuploadsize"`
+	AllowedExtensions []string `yaml:"allowedextensions"`
+	Permissions       string   `yaml:"permissions"`
+	fileMode          os.FileMode
+}
+
+// Verify checks that Root is an existing, writable directory, normalizes AllowedExtensions to lower case
+// with a leading dot, and parses Permissions (default 0640).
+func (cfg *FileStorageConfig) Verify() error {
+	var (
+		info os.FileInfo
+		f    *os.File
+		mode uint64
+		err  error
+		i    int
+		ext  string
+	)
+
+	if len(cfg.Root) == 0 {
+		return fmt.Errorf("missing file storage root (or FILESTORAGEROOT environment variable)")
+	}
+	info, err = os.Stat(cfg.Root)
+	if err != nil {
+		return fmt.Errorf("file storage root: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("file storage root %s is not a directory", cfg.Root)
+	}
+	f, err = os.CreateTemp(cfg.Root, ".verify-*")
+	if err != nil {
+		return fmt.Errorf("file storage root %s is not writable: %w", cfg.Root, err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	if cfg.MaxUploadSize < 0 {
+		return fmt.Errorf("file storage maxuploadsize cannot be negative")
+	}
+
+	for i = 0; i < len(cfg.AllowedExtensions); i++ {
+		ext = strings.ToLower(strings.TrimSpace(cfg.AllowedExtensions[i]))
+		if len(ext) > 0 && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) < 2 || strings.ContainsAny(ext[1:], "./\\") {
+			return fmt.Errorf("invalid file storage extension %q", cfg.AllowedExtensions[i])
+		}
+		cfg.AllowedExtensions[i] = ext
+	}
+
+	if len(cfg.Permissions) == 0 {
+		cfg.Permissions = "0640"
+	}
+	mode, err = strconv.ParseUint(cfg.Permissions, 8, 32)
+	if err != nil || mode > 0o777 {
+		return fmt.Errorf("invalid file storage permissions %q (expected octal such as 0640)", cfg.Permissions)
+	}
+	cfg.fileMode = os.FileMode(mode)
+	return nil
+}
+
+// FileMode returns the parsed Permissions.
+func (cfg FileStorageConfig) FileMode() os.FileMode {
+	return cfg.fileMode
+}
+
+// ExtensionAllowed reports whether the file name has one of the AllowedExtensions, or true if no
+// extensions are configured.
+func (cfg FileStorageConfig) ExtensionAllowed(name string) bool {
+	var (
+		ext string
+		i   int
+	)
+
+	if len(cfg.AllowedExtensions) == 0 {
+		return true
+	}
+	ext = strings.ToLower(filepath.Ext(name))
+	for i = 0; i < len(cfg.AllowedExtensions); i++ {
+		if cfg.AllowedExtensions[i] == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package serverconfig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats maps configuration file extensions to decoders for formats other than YAML.  A decoder converts
+// the file into a yaml document, which Read then decodes as it would a YAML file, so environment overrides,
+// Verify, and Provenance work the same whatever the format.  Files with other extensions are read as YAML, and
+// the extension of a compressed file is the one before its compression, such as .ini for "app.ini.gz".
+//
+// INI files, Java properties files, and HCL2 files are built in.  The keys of INI and properties files are
+// the dotted yaml paths of the settings, with INI sections giving the leading part of the path, so "port" in
+// section [http.listen] and "http.listen.port" in a properties file both set http.listen.port.  A list is
+// given by numbering its entries from zero, as in hosts.0 and hosts.1.  HCL blocks are sections, as
+// described for decodeHCL.
+var Formats = map[string]func(b []byte) (*yaml.Node, error){
+	".ini":        decodeINI,
+	".properties": decodeProperties,
+	".hcl":        decodeHCL,
+}
+
+// decodeConfig parses b, the contents of filename, into doc using the decoder in Formats for its extension,
+// or as YAML.
+func decodeConfig(filename string, b []byte, doc *yaml.Node) error {
+	var (
+		decode  func(b []byte) (*yaml.Node, error)
+		decoded *yaml.Node
+		found   bool
+		err     error
+	)
+
+	decode, found = formatDecoder(filename)
+	if !found {
+		return yaml.Unmarshal(b, doc)
+	}
+	decoded, err = decode(b)
+	if err != nil {
+		return err
+	}
+	*doc = *decoded
+	return nil
+}
+
+// formatDecoder returns the decoder in Formats for the extension of filename, ignoring any compression
+// extension, and whether there is one.
+func formatDecoder(filename string) (func(b []byte) (*yaml.Node, error), bool) {
+	var (
+		ext    string
+		decode func(b []byte) (*yaml.Node, error)
+		found  bool
+	)
+
+	ext = filepath.Ext(filename)
+	_, found = Decompressors[ext]
+	if found {
+		ext = filepath.Ext(strings.TrimSuffix(filename, ext))
+	}
+	decode, found = Formats[ext]
+	return decode, found
+}
+
+// decodeINI converts an INI file to a yaml document.  Keys before the first [section] are at the top level.
+// Values may be quoted, and comments start with ; or #, either on their own line or after an unquoted value.
+func decodeINI(b []byte) (*yaml.Node, error) {
+	var (
+		scanner *bufio.Scanner
+		root    *yaml.Node
+		section string
+		line    string
+		key     string
+		value   string
+		quoted  bool
+		lineNo  int
+		end     int
+		err     error
+	)
+
+	root = &yaml.Node{Kind: yaml.MappingNode, Line: 1}
+	scanner = bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		lineNo++
+		line = strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") || len(strings.TrimSpace(line[1:len(line)-1])) == 0 {
+				return nil, fmt.Errorf("line %d: invalid section header %s", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		end = strings.IndexAny(line, "=:")
+		if end <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.TrimSpace(line[:end])
+		value = strings.TrimSpace(line[end+1:])
+		quoted = false
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", lineNo, key)
+			}
+			quoted = true
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+			quoted = true
+		default:
+			for end = 0; end < len(value); end++ {
+				if (value[end] == ';' || value[end] == '#') && (end == 0 || value[end-1] == ' ' || value[end-1] == '\t') {
+					value = strings.TrimSpace(value[:end])
+					break
+				}
+			}
+		}
+		err = setFlatKey(root, joinYAMLPath(section, key), value, quoted, lineNo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return flatDocument(root), nil
+}
+
+// decodeProperties converts a Java properties file to a yaml document.  Keys are separated from values by =,
+// :, or whitespace, lines starting with # or ! are comments, a line ending in a backslash is continued on the
+// next, and backslash escapes including \uXXXX are recognized.
+func decodeProperties(b []byte) (*yaml.Node, error) {
+	var (
+		scanner *bufio.Scanner
+		root    *yaml.Node
+		logical strings.Builder
+		line    string
+		key     string
+		value   string
+		start   int
+		lineNo  int
+		end     int
+		err     error
+	)
+
+	root = &yaml.Node{Kind: yaml.MappingNode, Line: 1}
+	scanner = bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		lineNo++
+		line = strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical.Len() == 0 {
+			if len(line) == 0 || line[0] == '#' || line[0] == '!' {
+				continue
+			}
+			start = lineNo
+		}
+		if continuedLine(line) {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+		line = logical.String()
+		logical.Reset()
+
+		end = propertyKeyEnd(line)
+		key, err = unescapeProperty(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		line = strings.TrimLeft(line[end:], " \t\f")
+		if len(line) > 0 && (line[0] == '=' || line[0] == ':') {
+			line = strings.TrimLeft(line[1:], " \t\f")
+		}
+		value, err = unescapeProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		err = setFlatKey(root, key, value, false, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	if logical.Len() > 0 {
+		return nil, fmt.Errorf("line %d: continuation at end of file", lineNo)
+	}
+	return flatDocument(root), nil
+}
+
+// continuedLine reports whether line ends with an unescaped backslash.
+func continuedLine(line string) bool {
+	var n int
+
+	for n = 0; n < len(line) && line[len(line)-1-n] == '\\'; n++ {
+	}
+	return n%2 == 1
+}
+
+// propertyKeyEnd returns the index of the first unescaped =, :, or whitespace in line.
+func propertyKeyEnd(line string) int {
+	var i int
+
+	for i = 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':', ' ', '\t', '\f':
+			return i
+		}
+	}
+	return len(line)
+}
+
+// unescapeProperty replaces the backslash escapes in s.
+func unescapeProperty(s string) (string, error) {
+	var (
+		out  strings.Builder
+		code uint64
+		err  error
+		i    int
+	)
+
+	for i = 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid \\u escape")
+			}
+			code, err = strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\u escape")
+			}
+			out.WriteRune(rune(code))
+			i += 4
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// setFlatKey sets the dotted key under root to value, adding mappings for each part of the path as needed.
+// Quoted values are kept as strings rather than being resolved to numbers, booleans, or null.
+func setFlatKey(root *yaml.Node, key, value string, quoted bool, line int) error {
+	var (
+		parts []string
+		node  *yaml.Node
+		child *yaml.Node
+		i     int
+		j     int
+	)
+
+	parts = strings.Split(key, ".")
+	node = root
+	for i = 0; i < len(parts); i++ {
+		if len(parts[i]) == 0 {
+			return fmt.Errorf("line %d: invalid key %q", line, key)
+		}
+		child = nil
+		for j = 0; j < len(node.Content); j += 2 {
+			if node.Content[j].Value == parts[i] {
+				child = node.Content[j+1]
+				break
+			}
+		}
+		if i == len(parts)-1 {
+			if child != nil && child.Kind == yaml.MappingNode {
+				return fmt.Errorf("line %d: %s is both a value and a section", line, key)
+			}
+			if child == nil {
+				child = &yaml.Node{}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[i], Line: line}, child)
+			}
+			*child = yaml.Node{Kind: yaml.ScalarNode, Value: value, Line: line}
+			if quoted {
+				child.Tag = "!!str"
+				child.Style = yaml.DoubleQuotedStyle
+			}
+			return nil
+		}
+		if child != nil && child.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: %s is both a value and a section", line, strings.Join(parts[:i+1], "."))
+		}
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Line: line}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[i], Line: line}, child)
+		}
+		node = child
+	}
+	return nil
+}
+
+// flatDocument wraps root in a yaml document, first turning each mapping whose keys are 0, 1, 2, and so on
+// into a sequence.
+func flatDocument(root *yaml.Node) *yaml.Node {
+	flatSequences(root)
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Content: []*yaml.Node{root}}
+}
+
+func flatSequences(node *yaml.Node) {
+	var (
+		items []*yaml.Node
+		index int
+		err   error
+		i     int
+	)
+
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i = 0; i < len(node.Content); i += 2 {
+		flatSequences(node.Content[i+1])
+	}
+	if len(node.Content) == 0 {
+		return
+	}
+	items = make([]*yaml.Node, len(node.Content)/2)
+	for i = 0; i < len(node.Content); i += 2 {
+		index, err = strconv.Atoi(node.Content[i].Value)
+		if err != nil || index < 0 || index >= len(items) || items[index] != nil {
+			return
+		}
+		items[index] = node.Content[i+1]
+	}
+	node.Kind = yaml.SequenceNode
+	node.Content = items
+}
@@ -0,0 +1,88 @@
+package serverconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphQLConfig holds the settings for a GraphQL endpoint.  Path defaults to /graphql and PlaygroundPath,
+// where the GraphiQL playground is served when Playground is set, defaults to /playground.  MaxDepth and
+// MaxComplexity limit queries, defaulting to 15 and 1000.  Introspection defaults to on outside prod and
+// off in prod.
+//
+// The playground is refused when the App section's environment is prod unless AllowProductionPlayground is
+// also set.
+//
+//	graphql:
+//	  path: /api/graphql
+//	  playground: true
+//	  maxdepth: 10
+//	  maxcomplexity: 500
+type GraphQLConfig struct {
+	Path                      string `yaml:"path"`
+	Playground                bool   `yaml:"playground"`
+	PlaygroundPath            string `yaml:"playgroundpath"`
+	AllowProductionPlayground bool   `yaml:"allowproductionplayground"`
+	MaxDepth                  int    `yaml:"maxdepth"`
+	MaxComplexity             int    `yaml:"maxcomplexity"`
+	Introspection             *bool  `yaml:"introspection"`
+}
+
+// Verify checks the paths and applies the limit defaults.  The environment checks are made by PostVerify.
+func (cfg *GraphQLConfig) Verify() error {
+	if len(cfg.Path) == 0 {
+		cfg.Path = "/graphql"
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return fmt.Errorf("graphql path %q must begin with /", cfg.Path)
+	}
+	if len(cfg.PlaygroundPath) == 0 {
+		cfg.PlaygroundPath = "/playground"
+	}
+	if !strings.HasPrefix(cfg.PlaygroundPath, "/") {
+		return fmt.Errorf("graphql playgroundpath %q must begin with /", cfg.PlaygroundPath)
+	}
+	if cfg.Playground && cfg.PlaygroundPath == cfg.Path {
+		return fmt.Errorf("graphql playgroundpath and path cannot both be %s", cfg.Path)
+	}
+	if cfg.MaxDepth < 0 || cfg.MaxComplexity < 0 {
+		return fmt.Errorf("graphql maxdepth and maxcomplexity cannot be negative")
+	}
+	if cfg.MaxDepth == 0 {
+		cfg.MaxDepth = 15
+	}
+	if cfg.MaxComplexity == 0 {
+		cfg.MaxComplexity = 1000
+	}
+	return nil
+}
+
+// PostVerify applies the Introspection default and checks Playground against the environment of root's App
+// section.
+func (cfg *GraphQLConfig) PostVerify(root any) error {
+	var (
+		app           AppConfig
+		introspection bool
+	)
+
+	app = rootApp(root)
+	if cfg.Introspection == nil {
+		introspection = !app.IsProduction()
+		cfg.Introspection = &introspection
+	}
+	if cfg.Playground && app.IsProduction() {
+		if !cfg.AllowProductionPlayground {
+			return fmt.Errorf("graphql playground cannot be enabled when the app environment is prod (set allowproductionplayground to override)")
+		}
+		warnf("graphql playground is enabled in prod")
+	}
+	if *cfg.Introspection && app.IsProduction() {
+		warnf("graphql introspection is enabled in prod")
+	}
+	return nil
+}
+
+// IntrospectionEnabled reports whether introspection queries should be answered.
+func (cfg *GraphQLConfig) IntrospectionEnabled() bool {
+	return cfg.Introspection != nil && *cfg.Introspection
+}
@@ -0,0 +1,404 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCInterceptorOptions maps the names of the GRPCInterceptors toggles to the server options installing
+// them.  Logging, through slog.Default, and recovery are built in.  Metrics and tracing depend on the
+// libraries the application uses, so it registers them before calling NewServerOptions:
+//
+//	serverconfig.GRPCInterceptorOptions["tracing"] = func() []grpc.ServerOption {
+//		return []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}
+//	}
+var GRPCInterceptorOptions = map[string]func() []grpc.ServerOption{
+	"logging":  grpcLoggingOptions,
+	"recovery": grpcRecoveryOptions,
+}
+
+// GRPCConfig holds the settings for a gRPC server.  TLS is served from the static certificate files if
+// given, otherwise the server is plaintext unless UseHTTPCertificates is set, meaning the caller will reuse
+// the certificates (static or ACME) of the HTTP section.  The remaining fields map onto grpc server
+// options, as returned by NewServerOptions, and NewServer builds the server from them:
+//
+//	srv, err := gc.GRPC.NewServer()
+//	pb.RegisterBillingServer(srv, billing)
+//	ln, err := net.Listen("tcp", gc.GRPC.BindAddr)
+//	err = srv.Serve(ln)
+type GRPCConfig struct {
+	BindAddr            string               `yaml:"bindaddr" env:"GRPCBINDADDR"`
+	StaticCert          HTTPStaticCertConfig `yaml:"static_cert"`
+	UseHTTPCertificates bool                 `yaml:"usehttpcertificates"`
+	MaxRecvMsgSize      int                  `yaml:"maxrecvmsgsize"`
+	MaxSendMsgSize      int                  `yaml:"maxsendmsgsize"`
+	Keepalive           GRPCKeepaliveConfig  `yaml:"keepalive"`
+	Reflection          bool                 `yaml:"reflection"`
+	Interceptors        GRPCInterceptors     `yaml:"interceptors"`
+}
+
+// GRPCKeepaliveConfig mirrors grpc keepalive.ServerParameters and keepalive.EnforcementPolicy.
+type GRPCKeepaliveConfig struct {
+	MaxConnectionIdle   time.Duration `yaml:"maxconnectionidle"`
+	MaxConnectionAge    time.Duration `yaml:"maxconnectionage"`
+	Time                time.Duration `yaml:"time"`
+	Timeout             time.Duration `yaml:"timeout"`
+	MinTime             time.Duration `yaml:"mintime"`
+	PermitWithoutStream bool          `yaml:"permitwithoutstream"`
+}
+
+// GRPCInterceptors toggles the standard interceptors an application installs on its server.
+type GRPCInterceptors struct {
+	Logging  bool `yaml:"logging"`
+	Recovery bool `yaml:"recovery"`
+	Metrics  bool `yaml:"metrics"`
+	Tracing  bool `yaml:"tracing"`
+}
+
+// Verify checks the bind address and certificate settings, and defaults the message size limits to 4MB
+// and the keepalive Time/Timeout to 2 hours/20 seconds (the grpc defaults).
+func (cfg *GRPCConfig) Verify() error {
+	var err error
+
+	if len(cfg.BindAddr) == 0 {
+		return fmt.Errorf("missing grpc bindaddr (or GRPCBINDADDR environment variable)")
+	}
+	err = validateHostPort(cfg.BindAddr)
+	if err != nil {
+		return fmt.Errorf("invalid grpc bindaddr: %w", err)
+	}
+
+	if (len(cfg.StaticCert.SSLCertFile) == 0) != (len(cfg.StaticCert.SSLPrivateKeyFile) == 0) {
+		return fmt.Errorf("grpc static_cert requires both certfile and privatekeyfile")
+	}
+	if len(cfg.StaticCert.SSLCertFile) > 0 && cfg.UseHTTPCertificates {
+		return fmt.Errorf("grpc static_cert and usehttpcertificates are mutually exclusive")
+	}
+
+	if cfg.MaxRecvMsgSize < 0 || cfg.MaxSendMsgSize < 0 {
+		return fmt.Errorf("grpc message size limits cannot be negative")
+	}
+	if cfg.MaxRecvMsgSize == 0 {
+		cfg.MaxRecvMsgSize = 4 * 1024 * 1024
+	}
+	if cfg.MaxSendMsgSize == 0 {
+		cfg.MaxSendMsgSize = 4 * 1024 * 1024
+	}
+
+	if cfg.Keepalive.Time == 0 {
+		cfg.Keepalive.Time = 2 * time.Hour
+	}
+	if cfg.Keepalive.Timeout == 0 {
+		cfg.Keepalive.Timeout = 20 * time.Second
+	}
+	if cfg.Keepalive.Time < time.Second {
+		return fmt.Errorf("grpc keepalive time must be at least 1s, got %s", cfg.Keepalive.Time)
+	}
+	if cfg.Keepalive.Timeout < 0 || cfg.Keepalive.MinTime < 0 ||
+		cfg.Keepalive.MaxConnectionIdle < 0 || cfg.Keepalive.MaxConnectionAge < 0 {
+		return fmt.Errorf("grpc keepalive durations cannot be negative")
+	}
+	return nil
+}
+
+// TLSConfig returns a server TLS configuration built from the static certificate files, or nil if no
+// static certificate is configured.
+func (cfg *GRPCConfig) TLSConfig() (*tls.Config, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+
+	if len(cfg.StaticCert.SSLCertFile) == 0 {
+		return nil, nil
+	}
+	cert, err = tls.LoadX509KeyPair(cfg.StaticCert.SSLCertFile, cfg.StaticCert.SSLPrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load grpc certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2"},
+	}, nil
+}
+
+// NewServerOptions returns the grpc server options for the configuration: the message size limits, the
+// keepalive parameters and enforcement policy, credentials from the static certificate, and the
+// interceptors enabled in Interceptors from GRPCInterceptorOptions, outermost first in the order tracing,
+// metrics, logging, and recovery.  It is an error to enable an interceptor that has not been registered.
+// Reflection is a service rather than an option, so it is registered by NewServer.  With
+// UseHTTPCertificates the caller adds the credentials, such as from HTTPConfig.BuildTLSConfig:
+//
+//	opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+func (cfg *GRPCConfig) NewServerOptions() ([]grpc.ServerOption, error) {
+	var (
+		opts    []grpc.ServerOption
+		tlsCfg  *tls.Config
+		names   []string
+		enabled []bool
+		options func() []grpc.ServerOption
+		found   bool
+		err     error
+		i       int
+	)
+
+	opts = []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.MaxSendMsgSize),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: cfg.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:  cfg.Keepalive.MaxConnectionAge,
+			Time:              cfg.Keepalive.Time,
+			Timeout:           cfg.Keepalive.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Keepalive.MinTime,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}),
+	}
+
+	tlsCfg, err = cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	names = []string{"tracing", "metrics", "logging", "recovery"}
+	enabled = []bool{cfg.Interceptors.Tracing, cfg.Interceptors.Metrics, cfg.Interceptors.Logging, cfg.Interceptors.Recovery}
+	for i = 0; i < len(names); i++ {
+		if !enabled[i] {
+			continue
+		}
+		options, found = GRPCInterceptorOptions[names[i]]
+		if !found || options == nil {
+			return nil, fmt.Errorf("grpc interceptor %q is enabled but not registered in serverconfig.GRPCInterceptorOptions", names[i])
+		}
+		opts = append(opts, options()...)
+	}
+	return opts, nil
+}
+
+// NewServer returns a grpc server built with NewServerOptions followed by opts, with the reflection service
+// registered when Reflection is set.
+func (cfg *GRPCConfig) NewServer(opts ...grpc.ServerOption) (*grpc.Server, error) {
+	var (
+		options []grpc.ServerOption
+		srv     *grpc.Server
+		err     error
+	)
+
+	options, err = cfg.NewServerOptions()
+	if err != nil {
+		return nil, err
+	}
+	srv = grpc.NewServer(append(options, opts...)...)
+	if cfg.Reflection {
+		reflection.Register(srv)
+	}
+	return srv, nil
+}
+
+// grpcLoggingOptions logs each call with its method, status code, and duration through slog.Default.
+func grpcLoggingOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			var (
+				start time.Time
+				resp  any
+				err   error
+			)
+
+			start = time.Now()
+			resp, err = handler(ctx, req)
+			logGRPCCall(ctx, info.FullMethod, start, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			var (
+				start time.Time
+				err   error
+			)
+
+			start = time.Now()
+			err = handler(srv, ss)
+			logGRPCCall(ss.Context(), info.FullMethod, start, err)
+			return err
+		}),
+	}
+}
+
+func logGRPCCall(ctx context.Context, method string, start time.Time, err error) {
+	var level slog.Level
+
+	level = slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	slog.Default().Log(ctx, level, "grpc call", slog.String("method", method), slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)))
+}
+
+// grpcRecoveryOptions turns a panic in a handler into an Internal error, logging it with its stack.
+func grpcRecoveryOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+			defer recoverGRPCPanic(ctx, info.FullMethod, &err)
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer recoverGRPCPanic(ss.Context(), info.FullMethod, &err)
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func recoverGRPCPanic(ctx context.Context, method string, err *error) {
+	var r any
+
+	r = recover()
+	if r == nil {
+		return
+	}
+	slog.Default().ErrorContext(ctx, "grpc handler panic", slog.String("method", method), slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())))
+	*err = status.Error(codes.Internal, "internal error")
+}
+
+// GRPCClients holds named gRPC client endpoints for service-to-service calls, e.g.
+//
+//	grpcclients:
+//	  billing:
+//	    target: dns:///billing.internal:50051
+//	    tls: true
+//	    timeout: 3s
+//	  inventory:
+//	    target: inventory:50051
+type GRPCClients map[string]GRPCClientConfig
+
+// GRPCClientConfig describes one gRPC client endpoint.  Target uses the grpc name syntax: a plain
+// host:port, or scheme:///endpoint for the dns, unix, passthrough, and xds resolvers.  Timeout is the
+// default per-call deadline and Retry, if MaxAttempts is above 1, maps onto the grpc service config
+// retryPolicy.
+type GRPCClientConfig struct {
+	Target    string                `yaml:"target"`
+	TLS       bool                  `yaml:"tls"`
+	CAFile    string                `yaml:"cafile"`
+	Authority string                `yaml:"authority"`
+	Timeout   time.Duration         `yaml:"timeout"`
+	Retry     GRPCClientRetryPolicy `yaml:"retry"`
+}
+
+// GRPCClientRetryPolicy mirrors the retryPolicy of a grpc service config.
+type GRPCClientRetryPolicy struct {
+	MaxAttempts          int           `yaml:"maxattempts"`
+	InitialBackoff       time.Duration `yaml:"initialbackoff"`
+	MaxBackoff           time.Duration `yaml:"maxbackoff"`
+	BackoffMultiplier    float64       `yaml:"backoffmultiplier"`
+	RetryableStatusCodes []string      `yaml:"retryablestatuscodes"`
+}
+
+// Verify checks the target syntax and retry policy, and defaults Timeout to 10 seconds.  RetryableStatusCodes
+// are upper-cased and must be grpc status code names.
+func (cfg *GRPCClientConfig) Verify() error {
+	var (
+		code codes.Code
+		err  error
+		i    int
+	)
+
+	if len(cfg.Target) == 0 {
+		return fmt.Errorf("missing grpc client target")
+	}
+	err = validateGRPCTarget(cfg.Target)
+	if err != nil {
+		return err
+	}
+	if len(cfg.CAFile) > 0 && !cfg.TLS {
+		return fmt.Errorf("grpc client cafile given but tls is not enabled")
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("grpc client timeout cannot be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.Retry.MaxAttempts > 1 {
+		if cfg.Retry.MaxAttempts > 5 {
+			return fmt.Errorf("grpc client retry maxattempts cannot exceed 5 (grpc limit), got %d", cfg.Retry.MaxAttempts)
+		}
+		if cfg.Retry.InitialBackoff <= 0 || cfg.Retry.MaxBackoff <= 0 {
+			return fmt.Errorf("grpc client retry requires initialbackoff and maxbackoff")
+		}
+		if cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff {
+			return fmt.Errorf("grpc client retry maxbackoff is less than initialbackoff")
+		}
+		if cfg.Retry.BackoffMultiplier == 0 {
+			cfg.Retry.BackoffMultiplier = 2
+		}
+		if cfg.Retry.BackoffMultiplier < 1 {
+			return fmt.Errorf("grpc client retry backoffmultiplier must be at least 1")
+		}
+		if len(cfg.Retry.RetryableStatusCodes) == 0 {
+			cfg.Retry.RetryableStatusCodes = []string{"UNAVAILABLE"}
+		}
+		for i = 0; i < len(cfg.Retry.RetryableStatusCodes); i++ {
+			cfg.Retry.RetryableStatusCodes[i] = strings.ToUpper(strings.TrimSpace(cfg.Retry.RetryableStatusCodes[i]))
+			if code.UnmarshalJSON([]byte(strconv.Quote(cfg.Retry.RetryableStatusCodes[i]))) != nil {
+				return fmt.Errorf("invalid grpc client retry retryablestatuscodes entry %q (expected a grpc status code name such as UNAVAILABLE)", cfg.Retry.RetryableStatusCodes[i])
+			}
+		}
+	}
+	return nil
+}
+
+func validateGRPCTarget(target string) error {
+	var (
+		scheme   string
+		endpoint string
+		idx      int
+	)
+
+	idx = strings.Index(target, ":///")
+	if idx < 0 {
+		if strings.HasPrefix(target, "unix:") {
+			return nil
+		}
+		if validateHostPort(target) != nil {
+			return fmt.Errorf("invalid grpc client target %q (expected host:port or scheme:///endpoint)", target)
+		}
+		return nil
+	}
+
+	scheme = target[:idx]
+	endpoint = target[idx+4:]
+	if len(endpoint) == 0 {
+		return fmt.Errorf("invalid grpc client target %q: missing endpoint", target)
+	}
+	switch scheme {
+	case "dns", "passthrough":
+		if strings.ContainsAny(endpoint, "/ ") {
+			return fmt.Errorf("invalid grpc client target %q: endpoint should be host[:port]", target)
+		}
+	case "unix", "xds":
+	default:
+		return fmt.Errorf("invalid grpc client target %q: unknown scheme %q", target, scheme)
+	}
+	return nil
+}
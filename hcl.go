@@ -0,0 +1,218 @@
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeHCL converts an HCL2 file to a yaml document, so the yaml tags of the configuration structs apply to
+// it as well.  Attributes become settings, and a block becomes a section named by its type.  Labeled blocks of
+// the same type are collected into one section keyed by label, as for a map of sections:
+//
+//	http {
+//	  bindaddr = ":8080"
+//	}
+//	httpclients "billing" {
+//	  baseurl = "https://billing.example.com"
+//	}
+//
+// Repeated unlabeled blocks of one type make a list; a list of a single section is written as an attribute,
+// such as listeners = [{ addr = ":8080" }].  Expressions may not refer to variables or call functions.
+func decodeHCL(b []byte) (*yaml.Node, error) {
+	var (
+		file  *hcl.File
+		body  *hclsyntax.Body
+		root  *yaml.Node
+		diags hcl.Diagnostics
+		ok    bool
+	)
+
+	file, diags = hclsyntax.ParseConfig(b, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, hclError(diags)
+	}
+	body, ok = file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("unexpected hcl body %T", file.Body)
+	}
+	root, diags = hclBodyNode(body)
+	if diags.HasErrors() {
+		return nil, hclError(diags)
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Content: []*yaml.Node{root}}, nil
+}
+
+// hclBodyNode converts the attributes and blocks of body to a yaml mapping, in the order they appear.
+func hclBodyNode(body *hclsyntax.Body) (*yaml.Node, hcl.Diagnostics) {
+	var (
+		node     *yaml.Node
+		attrs    []*hclsyntax.Attribute
+		name     string
+		value    cty.Value
+		child    *yaml.Node
+		section  *yaml.Node
+		sections map[string]*yaml.Node
+		counts   map[string]int
+		labeled  map[string]bool
+		block    *hclsyntax.Block
+		diags    hcl.Diagnostics
+		more     hcl.Diagnostics
+		i        int
+		j        int
+	)
+
+	node = &yaml.Node{Kind: yaml.MappingNode, Line: body.SrcRange.Start.Line}
+	for name = range body.Attributes {
+		attrs = append(attrs, body.Attributes[name])
+	}
+	sort.Slice(attrs, func(a, b int) bool { return attrs[a].SrcRange.Start.Byte < attrs[b].SrcRange.Start.Byte })
+	for i = 0; i < len(attrs); i++ {
+		value, more = attrs[i].Expr.Value(nil)
+		diags = append(diags, more...)
+		if more.HasErrors() {
+			continue
+		}
+		node.Content = append(node.Content, hclKeyNode(attrs[i].Name, attrs[i].NameRange.Start.Line),
+			hclValueNode(value, attrs[i].SrcRange.Start.Line))
+	}
+
+	counts = make(map[string]int)
+	for i = 0; i < len(body.Blocks); i++ {
+		if len(body.Blocks[i].Labels) == 0 {
+			counts[body.Blocks[i].Type]++
+		}
+	}
+	sections = make(map[string]*yaml.Node)
+	labeled = make(map[string]bool)
+	for i = 0; i < len(body.Blocks); i++ {
+		block = body.Blocks[i]
+		if body.Attributes[block.Type] != nil {
+			diags = append(diags, &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Duplicate setting",
+				Detail: fmt.Sprintf("%s is set both as an attribute and as a block.", block.Type), Subject: block.TypeRange.Ptr()})
+			continue
+		}
+		child, more = hclBodyNode(block.Body)
+		diags = append(diags, more...)
+		section = sections[block.Type]
+		if section == nil {
+			section = &yaml.Node{Kind: yaml.MappingNode, Line: block.TypeRange.Start.Line}
+			if len(block.Labels) == 0 && counts[block.Type] > 1 {
+				section.Kind = yaml.SequenceNode
+			}
+			sections[block.Type] = section
+			labeled[block.Type] = len(block.Labels) > 0
+			node.Content = append(node.Content, hclKeyNode(block.Type, block.TypeRange.Start.Line), section)
+		} else if labeled[block.Type] != (len(block.Labels) > 0) {
+			diags = append(diags, &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Mixed blocks",
+				Detail: fmt.Sprintf("%s blocks must either all have labels or none.", block.Type), Subject: block.TypeRange.Ptr()})
+			continue
+		}
+		switch {
+		case section.Kind == yaml.SequenceNode:
+			section.Content = append(section.Content, child)
+		case len(block.Labels) == 0:
+			*section = *child
+		default:
+			for j = 0; j < len(block.Labels)-1; j++ {
+				section = hclLabelNode(section, block.Labels[j], block.LabelRanges[j].Start.Line)
+			}
+			if hclLabelValue(section, block.Labels[j]) != nil {
+				diags = append(diags, &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Duplicate block",
+					Detail: fmt.Sprintf("A %s block labeled %q was already given.", block.Type, block.Labels[j]), Subject: block.LabelRanges[j].Ptr()})
+				continue
+			}
+			section.Content = append(section.Content, hclKeyNode(block.Labels[j], block.LabelRanges[j].Start.Line), child)
+		}
+	}
+	return node, diags
+}
+
+// hclLabelNode returns the mapping under label in section, adding it if need be.
+func hclLabelNode(section *yaml.Node, label string, line int) *yaml.Node {
+	var child *yaml.Node
+
+	child = hclLabelValue(section, label)
+	if child == nil {
+		child = &yaml.Node{Kind: yaml.MappingNode, Line: line}
+		section.Content = append(section.Content, hclKeyNode(label, line), child)
+	}
+	return child
+}
+
+// hclLabelValue returns the value under label in section, or nil.
+func hclLabelValue(section *yaml.Node, label string) *yaml.Node {
+	var i int
+
+	for i = 0; i+1 < len(section.Content); i += 2 {
+		if section.Content[i].Value == label {
+			return section.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func hclKeyNode(name string, line int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, Line: line}
+}
+
+// hclValueNode converts an HCL value to yaml.  Strings stay strings, and numbers and bools are given as
+// untagged scalars so that yaml resolves them as it would in a yaml file.
+func hclValueNode(value cty.Value, line int) *yaml.Node {
+	var (
+		node *yaml.Node
+		it   cty.ElementIterator
+		key  cty.Value
+		elem cty.Value
+	)
+
+	switch {
+	case value.IsNull():
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null", Line: line}
+	case value.Type() == cty.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value.AsString(), Line: line}
+	case value.Type() == cty.Number:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value.AsBigFloat().Text('f', -1), Line: line}
+	case value.Type() == cty.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(value.True()), Line: line}
+	case value.Type().IsListType() || value.Type().IsSetType() || value.Type().IsTupleType():
+		node = &yaml.Node{Kind: yaml.SequenceNode, Line: line}
+		for it = value.ElementIterator(); it.Next(); {
+			_, elem = it.Element()
+			node.Content = append(node.Content, hclValueNode(elem, line))
+		}
+		return node
+	default:
+		node = &yaml.Node{Kind: yaml.MappingNode, Line: line}
+		for it = value.ElementIterator(); it.Next(); {
+			key, elem = it.Element()
+			node.Content = append(node.Content, hclKeyNode(key.AsString(), line), hclValueNode(elem, line))
+		}
+		return node
+	}
+}
+
+// hclError joins the errors in diags, each with the line it refers to.
+func hclError(diags hcl.Diagnostics) error {
+	var (
+		errs []error
+		i    int
+	)
+
+	for i = 0; i < len(diags); i++ {
+		if diags[i].Severity != hcl.DiagError {
+			continue
+		}
+		if diags[i].Subject == nil {
+			errs = append(errs, fmt.Errorf("%s; %s", diags[i].Summary, diags[i].Detail))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("line %d: %s; %s", diags[i].Subject.Start.Line, diags[i].Summary, diags[i].Detail))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,185 @@
+package serverconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthConfig describes the liveness and readiness probe endpoints.  If BindAddr is empty the probes are
+// mounted on the main HTTP server, otherwise on a dedicated listener.  GracePeriod is how long readiness
+// reports failure after shutdown begins, before the caller stops serving, so that load balancers have
+// time to notice.
+//
+//	health:
+//	  livenesspath: /healthz
+//	  readinesspath: /readyz
+//	  graceperiod: 5s
+type HealthConfig struct {
+	LivenessPath  string        `yaml:"livenesspath"`
+	ReadinessPath string        `yaml:"readinesspath"`
+	BindAddr      string        `yaml:"bindaddr" env:"HEALTHBINDADDR"`
+	GracePeriod   time.Duration `yaml:"graceperiod"`
+	CheckTimeout  time.Duration `yaml:"checktimeout"`
+}
+
+// HealthCheck reports whether a dependency is healthy by returning nil.
+type HealthCheck func(ctx context.Context) error
+
+// Health serves the probe endpoints for a HealthConfig using the registered checks.
+type Health struct {
+	cfg          HealthConfig
+	mu           sync.RWMutex
+	liveness     map[string]HealthCheck
+	readiness    map[string]HealthCheck
+	shuttingDown atomic.Bool
+}
+
+// Verify defaults the probe paths to /healthz and /readyz, and the check timeout to 2 seconds.
+func (cfg *HealthConfig) Verify() error {
+	var err error
+
+	if len(cfg.LivenessPath) == 0 {
+		cfg.LivenessPath = "/healthz"
+	}
+	if len(cfg.ReadinessPath) == 0 {
+		cfg.ReadinessPath = "/readyz"
+	}
+	if !strings.HasPrefix(cfg.LivenessPath, "/") || !strings.HasPrefix(cfg.ReadinessPath, "/") {
+		return fmt.Errorf("health probe paths must begin with '/'")
+	}
+	if cfg.LivenessPath == cfg.ReadinessPath {
+		return fmt.Errorf("health livenesspath and readinesspath must differ")
+	}
+	if len(cfg.BindAddr) > 0 {
+		err = validateHostPort(cfg.BindAddr)
+		if err != nil {
+			return fmt.Errorf("invalid health bindaddr: %w", err)
+		}
+	}
+	if cfg.GracePeriod < 0 {
+		return fmt.Errorf("health graceperiod cannot be negative")
+	}
+	if cfg.CheckTimeout <= 0 {
+		cfg.CheckTimeout = 2 * time.Second
+	}
+	return nil
+}
+
+// NewHealth returns a Health which serves the configured probes.  Register checks on it with
+// AddLivenessCheck and AddReadinessCheck, then mount it with Register.
+func (cfg *HealthConfig) NewHealth() *Health {
+	return &Health{
+		cfg:       *cfg,
+		liveness:  make(map[string]HealthCheck),
+		readiness: make(map[string]HealthCheck),
+	}
+}
+
+// AddLivenessCheck registers a check which must pass for the process to be considered alive.  Liveness
+// checks should only fail when a restart would fix the problem.
+func (h *Health) AddLivenessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	h.liveness[name] = check
+	h.mu.Unlock()
+}
+
+// AddReadinessCheck registers a check which must pass for the process to receive traffic.
+func (h *Health) AddReadinessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	h.readiness[name] = check
+	h.mu.Unlock()
+}
+
+// Register mounts the liveness and readiness handlers on mux.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc(h.livenessPath(), func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.liveness, false)
+	})
+	mux.HandleFunc(h.readinessPath(), func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.readiness, true)
+	})
+}
+
+// Shutdown marks the process as not ready and then waits for the configured GracePeriod, or until ctx
+// is done, before returning.  Call it before shutting down the HTTP servers.
+func (h *Health) Shutdown(ctx context.Context) {
+	var timer *time.Timer
+
+	h.shuttingDown.Store(true)
+	if h.cfg.GracePeriod <= 0 {
+		return
+	}
+	timer = time.NewTimer(h.cfg.GracePeriod)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func (h *Health) livenessPath() string {
+	if len(h.cfg.LivenessPath) == 0 {
+		return "/healthz"
+	}
+	return h.cfg.LivenessPath
+}
+
+func (h *Health) readinessPath() string {
+	if len(h.cfg.ReadinessPath) == 0 {
+		return "/readyz"
+	}
+	return h.cfg.ReadinessPath
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, checks map[string]HealthCheck, readiness bool) {
+	var (
+		ctx      context.Context
+		cancel   context.CancelFunc
+		timeout  time.Duration
+		failures map[string]string
+		names    []string
+		name     string
+		err      error
+	)
+
+	failures = make(map[string]string)
+	if readiness && h.shuttingDown.Load() {
+		failures["shutdown"] = "shutting down"
+	}
+
+	timeout = h.cfg.CheckTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel = context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	for name = range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name = range names {
+		err = checks[name](ctx)
+		if err != nil {
+			failures[name] = err.Error()
+		}
+	}
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "fail", "failures": failures})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
+}
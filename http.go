@@ -1,15 +1,18 @@
 package serverconfig
 
 import (
-	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/crypto/acme/autocert"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,36 +24,89 @@ import (
 //
 // If SkipHostNameTest is not true, then a DNS test for
 type HTTPConfig struct {
-	SSLBindAddr      string                  `yaml:"sslbindaddr" env:"SSLBINDADDR"`
-	BindAddr         string                  `yaml:"bindaddr" env:"BINDADDR"`
-	TemplatePath     string                  `yaml:"templatepath" env:"TEMPLATEPATH"`
-	ExternalHostName []string                `yaml:"externalhostname"`
-	SkipHostNameTest bool                    `yaml:"skiphostnametest"`
-	ProxyMode        bool                    `yaml:"proxymode" env:"PROXYMODE"`
-	Session          HTTPSessionCookieConfig `yaml:"sessioncookie"`
-	StaticCert       HTTPStaticCertConfig    `yaml:"static_cert"`
-	ACME             HTTPACMEConfig          `yaml:"acme"`
+	SSLBindAddr           string                  `yaml:"sslbindaddr" env:"SSLBINDADDR"`
+	BindAddr              string                  `yaml:"bindaddr" env:"BINDADDR"`
+	UnixSocket            HTTPUnixSocketConfig    `yaml:"unixsocket"`
+	TemplatePath          string                  `yaml:"templatepath" env:"TEMPLATEPATH"` // deprecated, use Templates.Path
+	Templates             HTTPTemplatesConfig     `yaml:"templates"`
+	ExternalHostName      []string                `yaml:"externalhostname"`
+	SkipHostNameTest      bool                    `yaml:"skiphostnametest"`
+	ExternalIPMethod      string                  `yaml:"externalipmethod"`
+	ExternalIPProviders   []string                `yaml:"externalipproviders"`
+	OutboundProxy         ProxyConfig             `yaml:"outboundproxy"`
+	Resolver              ResolverConfig          `yaml:"resolver"`
+	ProxyMode             bool                    `yaml:"proxymode" env:"PROXYMODE"`
+	RedirectToHTTPS       bool                    `yaml:"redirecttohttps"`
+	TrustedProxies        []string                `yaml:"trustedproxies"`
+	RealIPHeader          string                  `yaml:"realipheader"`
+	MaxHeaderBytes        ByteSize                `yaml:"maxheaderbytes"`
+	MaxBodySize           ByteSize                `yaml:"maxbodysize"`
+	MaxConcurrentRequests int                     `yaml:"maxconcurrentrequests"`
+	Session               HTTPSessionCookieConfig `yaml:"sessioncookie"`
+	StaticCert            HTTPStaticCertConfig    `yaml:"static_cert"`
+	ACME                  HTTPACMEConfig          `yaml:"acme"`
+	CORS                  HTTPCORSConfig          `yaml:"cors"`
+	CSRF                  HTTPCSRFConfig          `yaml:"csrf"`
+	SecurityHeaders       HTTPSecurityHeaders     `yaml:"securityheaders"`
+	Timeouts              HTTPTimeoutsConfig      `yaml:"timeouts"`
+	HTTP2                 HTTP2Config             `yaml:"http2"`
+	HTTP3                 HTTP3Config             `yaml:"http3"`
+	TLS                   HTTPTLSConfig           `yaml:"tls"`
+	ClientAuth            HTTPClientAuthConfig    `yaml:"clientauth"`
+	OCSP                  HTTPOCSPConfig          `yaml:"ocsp"`
+	VirtualHosts          []HTTPVirtualHost       `yaml:"virtualhosts"`
+	ReverseProxy          *HTTPProxyConfig        `yaml:"reverseproxy"`
+	Static                *HTTPStaticConfig       `yaml:"static"`
+	AccessLog             HTTPAccessLogConfig     `yaml:"accesslog"`
+	WebAuthn              *WebAuthnConfig         `yaml:"webauthn"`
+	trustedProxies        []*net.IPNet
 }
 
+// HTTPSessionCookieConfig holds the session keys and cookie attributes, and where session data is kept:
+// Store is cookie (the default, data in the cookie itself), redis, or memstore (process memory, for a
+// single replica).  TTL is how long server-side sessions live, defaulting to MaxAgeSeconds or 30 days.
+//
+// HashKey authenticates the cookie with HMAC-SHA256 and must be 32 or 64 bytes; EncryptKey is optional and
+// selects AES-128, AES-192, or AES-256 with 16, 24, or 32 bytes.  Keys are given as standard or URL-safe
+// base64, or hex, of random bytes; GenerateSessionKeys produces a suitable pair.  A value that does not
+// decode to a valid length is used as raw text, which is accepted only when it has a valid length itself.
+// To rotate keys, list them newest first; cookies are issued with the first pair and still accepted with
+// the others.  EncryptKey then needs one entry per HashKey entry.
+//
+//	sessioncookie:
+//	  hashkey: [<new hash key>, <old hash key>]
+//	  encryptkey: [<new encrypt key>, <old encrypt key>]
 type HTTPSessionCookieConfig struct {
-	HashKey       string        `yaml:"hashkey" env:"SESSIONHASHKEY"`
-	EncryptKey    string        `yaml:"encryptkey" env:"SESSIONENCRYPTKEY"`
+	HashKey       SessionKeys   `yaml:"hashkey" env:"SESSIONHASHKEY"`       // newest first, comma separated in the environment
+	EncryptKey    SessionKeys   `yaml:"encryptkey" env:"SESSIONENCRYPTKEY"` // newest first, comma separated in the environment
 	Domain        string        `yaml:"domain"`
 	MaxAgeSeconds int           `yaml:"maxageseconds"`
 	SameSite      http.SameSite `yaml:"samesite"` // 1 = default, 2 = lax, 3 = strict, 4 = none or "default", "lax", "strict", "none"
 	Secure        bool          `yaml:"secure"`   // true if cookie should only be sent over HTTPS
 	HttpOnly      bool          `yaml:"httponly"` // true if cookie should not be accessible via JavaScript
+	Name          string        `yaml:"name"`     // cookie name, "session" by default
+	Path          string        `yaml:"path"`     // cookie path, "/" by default
+	Store         string        `yaml:"store" env:"SESSIONSTORE"`
+	TTL           time.Duration `yaml:"ttl"`
+	Redis         *RedisConfig  `yaml:"redis"`
+	hashKeys      [][]byte
+	encryptKeys   [][]byte
 }
 
 func (cfg *HTTPSessionCookieConfig) UnmarshalYAML(value *yaml.Node) error {
 	type httpSessionCookieConfigYAML struct {
-		HashKey       string `yaml:"hashkey"`
-		EncryptKey    string `yaml:"encryptkey"`
-		Domain        string `yaml:"domain"`
-		MaxAgeSeconds int    `yaml:"maxageseconds"`
-		SameSite      any    `yaml:"samesite"`
-		Secure        bool   `yaml:"secure"`
-		HttpOnly      bool   `yaml:"httponly"`
+		HashKey       SessionKeys   `yaml:"hashkey"`
+		EncryptKey    SessionKeys   `yaml:"encryptkey"`
+		Domain        string        `yaml:"domain"`
+		MaxAgeSeconds int           `yaml:"maxageseconds"`
+		SameSite      any           `yaml:"samesite"`
+		Secure        bool          `yaml:"secure"`
+		HttpOnly      bool          `yaml:"httponly"`
+		Name          string        `yaml:"name"`
+		Path          string        `yaml:"path"`
+		Store         string        `yaml:"store"`
+		TTL           time.Duration `yaml:"ttl"`
+		Redis         *RedisConfig  `yaml:"redis"`
 	}
 	var (
 		raw      httpSessionCookieConfigYAML
@@ -69,6 +125,11 @@ func (cfg *HTTPSessionCookieConfig) UnmarshalYAML(value *yaml.Node) error {
 	cfg.MaxAgeSeconds = raw.MaxAgeSeconds
 	cfg.Secure = raw.Secure
 	cfg.HttpOnly = raw.HttpOnly
+	cfg.Name = raw.Name
+	cfg.Path = raw.Path
+	cfg.Store = raw.Store
+	cfg.TTL = raw.TTL
+	cfg.Redis = raw.Redis
 
 	if raw.SameSite == nil {
 		return nil
@@ -139,38 +200,241 @@ func httpSameSiteFromString(value string) (http.SameSite, error) {
 	}
 }
 
+// HTTPTimeoutsConfig holds the http.Server timeouts along with the grace period allowed for in-flight
+// requests on shutdown.  Unset values get defaults rather than Go's unlimited zero value.
+type HTTPTimeoutsConfig struct {
+	Read          time.Duration `yaml:"read"`
+	ReadHeader    time.Duration `yaml:"readheader"`
+	Write         time.Duration `yaml:"write"`
+	Idle          time.Duration `yaml:"idle"`
+	ShutdownGrace time.Duration `yaml:"shutdowngrace"`
+}
+
+// Verify defaults Read to 30s, ReadHeader to 10s, Write to 60s, Idle to 120s, and ShutdownGrace to 15s.
+func (cfg *HTTPTimeoutsConfig) Verify() error {
+	if cfg.Read < 0 || cfg.ReadHeader < 0 || cfg.Write < 0 || cfg.Idle < 0 || cfg.ShutdownGrace < 0 {
+		return fmt.Errorf("http timeouts cannot be negative")
+	}
+	if cfg.Read == 0 {
+		cfg.Read = 30 * time.Second
+	}
+	if cfg.ReadHeader == 0 {
+		cfg.ReadHeader = 10 * time.Second
+	}
+	if cfg.Write == 0 {
+		cfg.Write = 60 * time.Second
+	}
+	if cfg.Idle == 0 {
+		cfg.Idle = 120 * time.Second
+	}
+	if cfg.ShutdownGrace == 0 {
+		cfg.ShutdownGrace = 15 * time.Second
+	}
+	if cfg.ReadHeader > cfg.Read {
+		return fmt.Errorf("http timeouts readheader (%s) is greater than read (%s)", cfg.ReadHeader, cfg.Read)
+	}
+	return nil
+}
+
+// HTTPStaticCertConfig names a certificate and key on disk.  When ReloadInterval is set the files are polled
+// and a replaced pair is served without a restart.  A warning is logged when the certificate expires within
+// ExpiryWarning, 14 days by default.
 type HTTPStaticCertConfig struct {
-	SSLCertFile       string `yaml:"certfile"`
-	SSLPrivateKeyFile string `yaml:"privatekeyfile"`
+	SSLCertFile       string        `yaml:"certfile"`
+	SSLPrivateKeyFile string        `yaml:"privatekeyfile"`
+	ReloadInterval    time.Duration `yaml:"reloadinterval"`
+	ExpiryWarning     time.Duration `yaml:"expirywarning"`
+	hosts             []string
+}
+
+// Verify loads the certificate and key when configured, checking that they match, that the certificate is
+// currently valid, and, within an HTTPConfig, that it covers at least one ExternalHostName.
+func (cfg *HTTPStaticCertConfig) Verify() error {
+	var (
+		pair tls.Certificate
+		host string
+		i    int
+		ok   bool
+		err  error
+	)
+
+	if len(cfg.SSLCertFile) == 0 && len(cfg.SSLPrivateKeyFile) == 0 {
+		return nil
+	}
+	if len(cfg.SSLCertFile) == 0 || len(cfg.SSLPrivateKeyFile) == 0 {
+		return fmt.Errorf("static certificate requires both certfile and privatekeyfile")
+	}
+	if cfg.ReloadInterval < 0 || cfg.ExpiryWarning < 0 {
+		return fmt.Errorf("static certificate reloadinterval and expirywarning cannot be negative")
+	}
+	if cfg.ExpiryWarning == 0 {
+		cfg.ExpiryWarning = 14 * 24 * time.Hour
+	}
+
+	pair, err = loadKeyPair(cfg.SSLCertFile, cfg.SSLPrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("invalid static certificate: %w", err)
+	}
+	if len(cfg.hosts) > 0 {
+		for i = 0; i < len(cfg.hosts) && !ok; i++ {
+			host = cfg.hosts[i]
+			if strings.HasPrefix(host, "*.") {
+				host = "wildcard" + host[1:]
+			}
+			ok = pair.Leaf.VerifyHostname(host) == nil
+		}
+		if !ok {
+			return fmt.Errorf("static certificate %s does not cover any externalhostname (%s)", cfg.SSLCertFile, strings.Join(cfg.hosts, ", "))
+		}
+	}
+	if time.Until(pair.Leaf.NotAfter) < cfg.ExpiryWarning {
+		warnf("static certificate %s expires on %s", cfg.SSLCertFile, pair.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
 }
 
+// HTTPACMEConfig holds the settings for obtaining certificates through ACME.  CA selects a well-known CA
+// (letsencrypt, zerossl, buypass, or google) and CADirURL any other directory.  CAs that require External
+// Account Binding need EABKeyID and EABHMACKey from the CA's account dashboard.  Staging switches to the
+// Let's Encrypt staging directory, which issues untrusted certificates under much higher rate limits.
+// RenewBefore is how long before expiry certificates are renewed, 30 days by default.  Wildcard host names
+// need the dns-01 challenge, which is answered through the DNS provider when a dns section is given; see
+// HTTPACMEDNSConfig.
 type HTTPACMEConfig struct {
-	Email     string `yaml:"email"`
-	CADirURL  string `yaml:"cadirurl"`
-	DiskCache string `yaml:"diskcache"`
+	Email       string             `yaml:"email"`
+	CA          string             `yaml:"ca"`
+	CADirURL    string             `yaml:"cadirurl"`
+	DiskCache   string             `yaml:"diskcache"`
+	Staging     bool               `yaml:"staging" env:"ACMESTAGING"`
+	RenewBefore time.Duration      `yaml:"renewbefore"`
+	EABKeyID    string             `yaml:"eabkeyid" env:"ACMEEABKEYID"`
+	EABHMACKey  string             `yaml:"eabhmackey" env:"ACMEEABHMACKEY"`
+	DNS         *HTTPACMEDNSConfig `yaml:"dns"`
+	hosts       []string
+	dnsHosts    []string
+	eabKey      []byte
+	manager     *autocert.Manager
 }
 
 func (cfg *HTTPConfig) Verify() error {
-	var err error
+	return cfg.verify(true)
+}
+
+// verifyOffline is Verify without the external host name test.
+func (cfg *HTTPConfig) verifyOffline() error {
+	return cfg.verify(false)
+}
+
+// verify is Verify, running the external host name test only when probe is set.
+func (cfg *HTTPConfig) verify(probe bool) error {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		network   string
+		acmeHosts []string
+		err       error
+		i         int
+	)
 
 	if len(cfg.ExternalHostName) == 0 || len(cfg.ExternalHostName[0]) == 0 {
 		return fmt.Errorf("missing at least one externalhostname in configuration")
 	}
+	err = cfg.verifyExternalHostNames()
+	if err != nil {
+		return err
+	}
+	acmeHosts, err = cfg.verifyVirtualHosts()
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Templates.Path) == 0 {
+		cfg.Templates.Path = cfg.TemplatePath
+	}
+
+	err = cfg.verifyExternalIPProviders()
+	if err != nil {
+		return err
+	}
 
-	if !cfg.SkipHostNameTest {
-		err = TestExternalHostName(cfg.ExternalHostName[0])
+	err = errors.Join(verifyBindAddr("http bindaddr", cfg.BindAddr), verifyBindAddr("http sslbindaddr", cfg.SSLBindAddr))
+	if err != nil {
+		return err
+	}
+
+	if probe && !cfg.SkipHostNameTest {
+		// the walk verifies Resolver and OutboundProxy after this method, so they are verified here before use
+		err = cfg.Resolver.Verify()
+		if err != nil {
+			return err
+		}
+		err = cfg.OutboundProxy.Verify()
+		if err != nil {
+			return err
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		err = cfg.checkExternalHostNames(ctx)
+		cancel()
 		if err != nil {
 			return fmt.Errorf("[TestExternalHostName] failed: %w", err)
 		}
 	}
 
-	if len(cfg.StaticCert.SSLCertFile) == 0 || len(cfg.StaticCert.SSLPrivateKeyFile) == 0 {
+	err = cfg.parseTrustedProxies()
+	if err != nil {
+		return err
+	}
+
+	if cfg.MaxHeaderBytes < 0 || cfg.MaxBodySize < 0 || cfg.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("http maxheaderbytes, maxbodysize, and maxconcurrentrequests cannot be negative")
+	}
+	if cfg.MaxHeaderBytes == 0 {
+		cfg.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	if cfg.HTTP3.Enabled && len(cfg.HTTP3.BindAddr) == 0 {
+		if len(cfg.SSLBindAddr) == 0 {
+			return fmt.Errorf("http3 is enabled, but neither http3.bindaddr nor sslbindaddr is set")
+		}
+		network, _ = splitBindAddr(cfg.SSLBindAddr)
+		if network != "tcp" {
+			return fmt.Errorf("http3 is enabled with sslbindaddr %q, so http3.bindaddr must be set", cfg.SSLBindAddr)
+		}
+		cfg.HTTP3.BindAddr = cfg.SSLBindAddr
+	}
+
+	if cfg.OCSP.Enabled && (len(cfg.StaticCert.SSLCertFile) == 0 || len(cfg.StaticCert.SSLPrivateKeyFile) == 0) {
+		return fmt.Errorf("http ocsp stapling requires a static certificate")
+	}
+	cfg.StaticCert.hosts = cfg.ExternalHostName
+	if cfg.WebAuthn != nil {
+		cfg.WebAuthn.hosts = cfg.ExternalHostName
+	}
+	if len(cfg.StaticCert.SSLCertFile) == 0 || len(cfg.StaticCert.SSLPrivateKeyFile) == 0 || len(acmeHosts) > 0 {
 		if len(cfg.ACME.Email) == 0 {
 			return fmt.Errorf("ACME certificates are enabled, but the config is missing http.acme.email value for email address for registration")
 		}
 		if len(cfg.ACME.DiskCache) == 0 {
 			return fmt.Errorf("ACME certificates are enabled, but the config is missing http.acme.diskcache value caching certificates")
 		}
+		if len(cfg.StaticCert.SSLCertFile) == 0 || len(cfg.StaticCert.SSLPrivateKeyFile) == 0 {
+			for i = 0; i < len(cfg.ExternalHostName); i++ {
+				if strings.HasPrefix(cfg.ExternalHostName[i], "*.") && cfg.ACME.DNS == nil {
+					return fmt.Errorf("wildcard externalhostname %q requires a static_cert or the ACME dns-01 challenge (http.acme.dns)", cfg.ExternalHostName[i])
+				}
+			}
+			acmeHosts = append(cfg.ExternalHostName[:len(cfg.ExternalHostName):len(cfg.ExternalHostName)], acmeHosts...)
+		}
+		cfg.ACME.hosts = nil
+		cfg.ACME.dnsHosts = nil
+		for i = 0; i < len(acmeHosts); i++ {
+			if strings.HasPrefix(acmeHosts[i], "*.") {
+				cfg.ACME.dnsHosts = append(cfg.ACME.dnsHosts, strings.ToLower(strings.TrimSuffix(acmeHosts[i], ".")))
+			} else {
+				cfg.ACME.hosts = append(cfg.ACME.hosts, acmeHosts[i])
+			}
+		}
+		cfg.ACME.manager = nil
 	}
 
 	return nil
@@ -181,51 +445,74 @@ func (cfg *HTTPConfig) Verify() error {
 // rather, a test probe with an outside server is conducted to see to which IP address the host might be NAT'ed.
 // This isn't a guarantee that the host might be NAT'ed on inbound traffic to more than one IP or that the outbound
 // IP isn't the same as the inbound IP.  The host can be dual-homed (IPv4 and IPv6) but no tests are conducted on the
-// IPv6 address(es) or AAAA DNS names.
+// IPv6 address(es) or AAAA DNS names.  The default HTTP providers are used, through the proxy given by the
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables; see HTTPConfig.CheckExternalHostName.
 func TestExternalHostName(hostname string) error {
 	var (
-		x          bytes.Buffer
-		externalIP string
-		providers  = [4]string{
-			"https://ipv4.whatismyip.akamai.com",
-			"https://ipv4.myexternalip.com/raw",
-			"https://ipecho.net/plain",
-			"https://eth0.me",
-		}
-		ipAddrs []string
-		client  *http.Client
-		resp    *http.Response
-		err     error
-		i       int
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return (&HTTPConfig{}).CheckExternalHostName(ctx, hostname)
+}
+
+// CheckExternalHostName is TestExternalHostName using the configured ExternalIPMethod, ExternalIPProviders,
+// OutboundProxy, and Resolver.
+func (cfg *HTTPConfig) CheckExternalHostName(ctx context.Context, hostname string) error {
+	var (
+		externalIP net.IP
+		err        error
 	)
 
-	ipAddrs, err = net.LookupHost(hostname)
+	externalIP, err = cfg.ExternalIP(ctx)
 	if err != nil {
 		return err
 	}
+	return cfg.matchExternalIP(ctx, hostname, externalIP)
+}
 
-	for i = 0; i < len(providers); i++ {
-		client = &http.Client{Timeout: 4 * time.Second}
-		resp, err = client.Get(providers[i])
-		if err != nil {
+// checkExternalHostNames runs the external IP test for every ExternalHostName, looking up the external IP
+// only once.  Wildcard names cannot be resolved and are skipped.  All failures are reported together.
+func (cfg *HTTPConfig) checkExternalHostNames(ctx context.Context) error {
+	var (
+		externalIP net.IP
+		errs       []error
+		err        error
+		i          int
+	)
+
+	externalIP, err = cfg.ExternalIP(ctx)
+	if err != nil {
+		return err
+	}
+	for i = 0; i < len(cfg.ExternalHostName); i++ {
+		if strings.HasPrefix(cfg.ExternalHostName[i], "*.") {
 			continue
 		}
-
-		_, _ = io.Copy(&x, resp.Body)
-		_ = resp.Body.Close()
-		externalIP = strings.TrimSpace(x.String())
-		x.Reset()
-		if net.ParseIP(externalIP) != nil {
-			break
+		err = cfg.matchExternalIP(ctx, cfg.ExternalHostName[i], externalIP)
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
 
-	if len(externalIP) == 0 {
-		return fmt.Errorf("unable to get external IP from any provider")
+func (cfg *HTTPConfig) matchExternalIP(ctx context.Context, hostname string, externalIP net.IP) error {
+	var (
+		ipAddrs []string
+		err     error
+		i       int
+	)
+
+	ipAddrs, err = cfg.Resolver.Resolver().LookupHost(ctx, hostname)
+	if err != nil {
+		return err
 	}
 
 	for i = 0; i < len(ipAddrs); i++ {
-		if ipAddrs[i] == externalIP {
+		if net.ParseIP(ipAddrs[i]).Equal(externalIP) {
 			return nil
 		}
 	}
@@ -233,3 +520,50 @@ func TestExternalHostName(hostname string) error {
 	return fmt.Errorf("external IP %s doesn't match any value in DNS (%s) for host name %s",
 		externalIP, strings.Join(ipAddrs, ", "), hostname)
 }
+
+// verifyExternalHostNames checks the syntax of every ExternalHostName and rejects duplicates.  A leading
+// "*." label is allowed for wildcard certificates.
+func (cfg *HTTPConfig) verifyExternalHostNames() error {
+	var (
+		seen map[string]bool
+		name string
+		errs []error
+		err  error
+		i    int
+	)
+
+	seen = make(map[string]bool)
+	for i = 0; i < len(cfg.ExternalHostName); i++ {
+		name = strings.ToLower(strings.TrimSuffix(cfg.ExternalHostName[i], "."))
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("duplicate externalhostname %q", cfg.ExternalHostName[i]))
+			continue
+		}
+		seen[name] = true
+		err = validateHostname(strings.TrimPrefix(name, "*."))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid externalhostname: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// basicAuthHandler wraps next with HTTP basic authentication against a single user/password pair.  Both
+// values are compared in constant time.
+func basicAuthHandler(user, password, realm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			u, p string
+			ok   bool
+		)
+
+		u, p, ok = r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
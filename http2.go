@@ -0,0 +1,59 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTP2Config controls HTTP/2 on the server.  HTTP/2 over TLS is on unless Enabled is set to false.  H2C
+// additionally accepts HTTP/2 without TLS (prior knowledge), which gRPC-gateway and internal load balancers
+// need on the plain BindAddr listener.
+//
+//	http:
+//	  http2:
+//	    h2c: true
+//	    maxconcurrentstreams: 250
+type HTTP2Config struct {
+	Enabled              *bool         `yaml:"enabled"`
+	H2C                  bool          `yaml:"h2c"`
+	MaxConcurrentStreams int           `yaml:"maxconcurrentstreams"`
+	IdleTimeout          time.Duration `yaml:"idletimeout"`
+}
+
+// Verify defaults Enabled to true and checks the limits.
+func (cfg *HTTP2Config) Verify() error {
+	var enabled bool
+
+	if cfg.Enabled == nil {
+		enabled = true
+		cfg.Enabled = &enabled
+	}
+	if cfg.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("http2 maxconcurrentstreams cannot be negative")
+	}
+	if cfg.IdleTimeout < 0 {
+		return fmt.Errorf("http2 idletimeout cannot be negative")
+	}
+	if cfg.H2C && !*cfg.Enabled {
+		return fmt.Errorf("http2 h2c cannot be used when http2 is disabled")
+	}
+	return nil
+}
+
+// ConfigureServer sets the protocols and HTTP/2 parameters on srv.  The standard library shares one idle
+// timer between HTTP/1 and HTTP/2 connections, so a non-zero IdleTimeout replaces srv.IdleTimeout.
+func (cfg *HTTP2Config) ConfigureServer(srv *http.Server) {
+	var protocols http.Protocols
+
+	protocols.SetHTTP1(true)
+	if cfg.Enabled == nil || *cfg.Enabled {
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(cfg.H2C)
+		srv.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: cfg.MaxConcurrentStreams}
+		if cfg.IdleTimeout > 0 {
+			srv.IdleTimeout = cfg.IdleTimeout
+		}
+	}
+	srv.Protocols = &protocols
+}
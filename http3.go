@@ -0,0 +1,119 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Config describes an optional HTTP/3 (QUIC) listener.  BindAddr is the UDP address to listen on and
+// defaults to the port of SSLBindAddr.  When AdvertiseAltSvc is set, AltSvcHandler adds an Alt-Svc header
+// to HTTPS responses so browsers can switch to HTTP/3.
+//
+// HTTPConfig.Run starts the listener beside the HTTPS server, using the same TLS configuration and
+// handler, and advertises it.  Servers built with NewServer start it themselves:
+//
+//	h3 := gc.HTTP.NewHTTP3Server(mux, secure.TLSConfig)
+//	go h3.ListenAndServe()
+//	secure.Handler = gc.HTTP.HTTP3.AltSvcHandler(mux)
+type HTTP3Config struct {
+	Enabled         bool          `yaml:"enabled" env:"HTTP3ENABLED"`
+	BindAddr        string        `yaml:"bindaddr" env:"HTTP3BINDADDR"`
+	AdvertiseAltSvc bool          `yaml:"advertisealtsvc"`
+	AltSvcMaxAge    time.Duration `yaml:"altsvcmaxage"`
+}
+
+// Verify checks BindAddr and defaults AltSvcMaxAge to 24 hours.  Nothing is checked when HTTP/3 is not
+// enabled.
+func (cfg *HTTP3Config) Verify() error {
+	var err error
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.BindAddr) > 0 {
+		err = validateHostPort(cfg.BindAddr)
+		if err != nil {
+			return fmt.Errorf("invalid http3 bindaddr: %w", err)
+		}
+	}
+	if cfg.AltSvcMaxAge < 0 {
+		return fmt.Errorf("http3 altsvcmaxage cannot be negative")
+	}
+	if cfg.AltSvcMaxAge == 0 {
+		cfg.AltSvcMaxAge = 24 * time.Hour
+	}
+	return nil
+}
+
+// AltSvcHandler wraps next to advertise the HTTP/3 endpoint on responses to TLS requests.  If HTTP/3 is not
+// enabled or not advertised next is returned unchanged.
+func (cfg *HTTP3Config) AltSvcHandler(next http.Handler) http.Handler {
+	var (
+		port   string
+		altSvc string
+		err    error
+	)
+
+	if !cfg.Enabled || !cfg.AdvertiseAltSvc {
+		return next
+	}
+	_, port, err = net.SplitHostPort(cfg.BindAddr)
+	if err != nil || len(port) == 0 {
+		port = "443"
+	}
+	altSvc = `h3=":` + port + `"; ma=` + strconv.FormatInt(int64(cfg.AltSvcMaxAge/time.Second), 10)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewHTTP3Server returns the HTTP/3 server for handler, using tlsConfig from the HTTPS server, or nil when
+// HTTP/3 is not enabled.  MaxHeaderBytes and Timeouts.Idle are applied as for the other servers.
+func (cfg *HTTPConfig) NewHTTP3Server(handler http.Handler, tlsConfig *tls.Config) *http3.Server {
+	if !cfg.HTTP3.Enabled {
+		return nil
+	}
+	return &http3.Server{
+		Addr:           cfg.HTTP3.BindAddr,
+		Handler:        handler,
+		TLSConfig:      tlsConfig,
+		MaxHeaderBytes: int(cfg.MaxHeaderBytes),
+		IdleTimeout:    cfg.Timeouts.Idle,
+	}
+}
+
+// shutdownHTTP3 gracefully stops h3 within Timeouts.ShutdownGrace, as Shutdown does the other servers, and
+// closes conn, which the server does not own.  A nil server is ignored.
+func (cfg *HTTPConfig) shutdownHTTP3(h3 *http3.Server, conn net.PacketConn) error {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		err    error
+	)
+
+	if h3 == nil {
+		return nil
+	}
+	ctx = context.Background()
+	if cfg.Timeouts.ShutdownGrace > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeouts.ShutdownGrace)
+		defer cancel()
+	}
+	err = h3.Shutdown(ctx)
+	if err != nil {
+		err = fmt.Errorf("shutdown of http3 %s: %w", h3.Addr, err)
+	}
+	_ = conn.Close()
+	return err
+}
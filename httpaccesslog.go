@@ -0,0 +1,333 @@
+package serverconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// httpAccessLogFields are the AccessLogEntry fields that can be named in HTTPAccessLogConfig.Redact.
+var httpAccessLogFields = []string{"remoteaddr", "user", "host", "referer", "useragent"}
+
+// HTTPAccessLogConfig configures the access log written by HTTPConfig.AccessLogHandler.  Format is combined
+// (the Apache/nginx combined log format, the default), json, or a text/template executed with an
+// AccessLogEntry, such as "{{.Method}} {{.URI}} {{.Status}} {{.Duration}}".  Output is stderr (the default),
+// stdout, or a file path, which is rotated by MaxSize, MaxBackups, MaxAge, and Compress as for the logging
+// file output.
+//
+// Redact names fields to leave out of the log (remoteaddr, user, host, referer, or useragent); any other
+// name is a query parameter whose value is masked in the URI and referer.  SampleRate logs that fraction of
+// requests, all of them by default; server errors (status 500 and above) are always logged.
+//
+//	http:
+//	  accesslog:
+//	    enabled: true
+//	    format: json
+//	    output: /var/log/app/access.log
+//	    redact: [token, useragent]
+//	    samplerate: 0.1
+type HTTPAccessLogConfig struct {
+	Enabled      bool          `yaml:"enabled" env:"ACCESSLOG"`
+	Format       string        `yaml:"format"`
+	Output       string        `yaml:"output" env:"ACCESSLOGOUTPUT"`
+	MaxSize      ByteSize      `yaml:"maxsize"`
+	MaxBackups   int           `yaml:"maxbackups"`
+	MaxAge       time.Duration `yaml:"maxage"`
+	Compress     bool          `yaml:"compress"`
+	Redact       []string      `yaml:"redact"`
+	SampleRate   float64       `yaml:"samplerate"`
+	tmpl         *template.Template
+	redactFields map[string]bool
+	redactParams map[string]bool
+	w            io.Writer
+	mu           *sync.Mutex
+}
+
+// AccessLogEntry is one request as written to the access log.
+type AccessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	User       string
+	Method     string
+	URI        string
+	Proto      string
+	Host       string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+}
+
+// Verify checks the format, output, and sample rate and opens the output.  Nothing is checked unless Enabled
+// is set.
+func (cfg *HTTPAccessLogConfig) Verify() error {
+	var (
+		file LoggingFileConfig
+		name string
+		err  error
+		i    int
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+
+	cfg.tmpl = nil
+	switch strings.TrimSpace(cfg.Format) {
+	case "", "combined":
+		cfg.Format = "combined"
+	case "json":
+		cfg.Format = "json"
+	default:
+		cfg.tmpl, err = template.New("accesslog").Parse(cfg.Format)
+		if err != nil {
+			return fmt.Errorf("invalid accesslog format: %w", err)
+		}
+		err = cfg.tmpl.Execute(io.Discard, &AccessLogEntry{})
+		if err != nil {
+			return fmt.Errorf("invalid accesslog format: %w", err)
+		}
+	}
+
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return fmt.Errorf("accesslog samplerate must be between 0 and 1, got %g", cfg.SampleRate)
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = 1
+	}
+
+	cfg.redactFields = make(map[string]bool)
+	cfg.redactParams = make(map[string]bool)
+	for i = 0; i < len(cfg.Redact); i++ {
+		name = strings.TrimSpace(cfg.Redact[i])
+		if len(name) == 0 {
+			return fmt.Errorf("accesslog redact %d is empty", i+1)
+		}
+		if containsString(httpAccessLogFields, strings.ToLower(name)) {
+			cfg.redactFields[strings.ToLower(name)] = true
+		} else {
+			cfg.redactParams[name] = true
+		}
+	}
+
+	cfg.mu = &sync.Mutex{}
+	cfg.Output = strings.TrimSpace(cfg.Output)
+	switch strings.ToLower(cfg.Output) {
+	case "", "stderr":
+		cfg.Output = "stderr"
+		cfg.w = os.Stderr
+	case "stdout":
+		cfg.Output = "stdout"
+		cfg.w = os.Stdout
+	default:
+		file = LoggingFileConfig{Path: cfg.Output, MaxSize: cfg.MaxSize, MaxBackups: cfg.MaxBackups,
+			MaxAge: cfg.MaxAge, Compress: cfg.Compress}
+		err = file.Verify()
+		if err != nil {
+			return fmt.Errorf("accesslog output: %w", err)
+		}
+		cfg.MaxSize = file.MaxSize
+		cfg.w = file.Writer()
+	}
+	return nil
+}
+
+// AccessLogHandler wraps next, writing an access log line for each request as configured in AccessLog.  The
+// remote address is the client IP as reported by ClientIP.  next is returned unchanged when the access log
+// is not enabled.
+//
+//	handler = gc.HTTP.AccessLogHandler(mux)
+func (cfg *HTTPConfig) AccessLogHandler(next http.Handler) http.Handler {
+	var al *HTTPAccessLogConfig
+
+	al = &cfg.AccessLog
+	if !al.Enabled || al.w == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			rec   *accessLogRecorder
+			entry AccessLogEntry
+			ip    net.IP
+			ok    bool
+		)
+
+		rec = &accessLogRecorder{ResponseWriter: w}
+		entry.Time = time.Now()
+		next.ServeHTTP(rec, r)
+		entry.Duration = time.Since(entry.Time)
+		entry.Status = rec.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if entry.Status < http.StatusInternalServerError && al.SampleRate < 1 && rand.Float64() >= al.SampleRate {
+			return
+		}
+
+		ip = cfg.ClientIP(r)
+		if ip != nil {
+			entry.RemoteAddr = ip.String()
+		}
+		entry.User, _, ok = r.BasicAuth()
+		if !ok && r.URL.User != nil {
+			entry.User = r.URL.User.Username()
+		}
+		entry.Method = r.Method
+		entry.URI = al.redactURI(r.RequestURI)
+		entry.Proto = r.Proto
+		entry.Host = r.Host
+		entry.Bytes = rec.bytes
+		entry.Referer = al.redactURI(r.Referer())
+		entry.UserAgent = r.UserAgent()
+		al.write(&entry)
+	})
+}
+
+// redactURI masks the values of the Redact query parameters in uri.
+func (cfg *HTTPAccessLogConfig) redactURI(uri string) string {
+	var (
+		before string
+		query  string
+		params []string
+		raw    string
+		name   string
+		found  bool
+		i      int
+	)
+
+	if len(cfg.redactParams) == 0 {
+		return uri
+	}
+	before, query, found = strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+	params = strings.Split(query, "&")
+	for i = 0; i < len(params); i++ {
+		raw, _, _ = strings.Cut(params[i], "=")
+		name, _ = url.QueryUnescape(raw)
+		if cfg.redactParams[name] {
+			params[i] = raw + "=REDACTED"
+		}
+	}
+	return before + "?" + strings.Join(params, "&")
+}
+
+func (cfg *HTTPAccessLogConfig) write(entry *AccessLogEntry) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+
+	if cfg.redactFields["remoteaddr"] {
+		entry.RemoteAddr = ""
+	}
+	if cfg.redactFields["user"] {
+		entry.User = ""
+	}
+	if cfg.redactFields["host"] {
+		entry.Host = ""
+	}
+	if cfg.redactFields["referer"] {
+		entry.Referer = ""
+	}
+	if cfg.redactFields["useragent"] {
+		entry.UserAgent = ""
+	}
+
+	switch {
+	case cfg.tmpl != nil:
+		err = cfg.tmpl.Execute(&buf, entry)
+		if err == nil && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	case cfg.Format == "json":
+		err = json.NewEncoder(&buf).Encode(struct {
+			Time       time.Time `json:"time"`
+			RemoteAddr string    `json:"remoteaddr,omitempty"`
+			User       string    `json:"user,omitempty"`
+			Method     string    `json:"method"`
+			URI        string    `json:"uri"`
+			Proto      string    `json:"proto"`
+			Host       string    `json:"host,omitempty"`
+			Status     int       `json:"status"`
+			Bytes      int64     `json:"bytes"`
+			DurationMS float64   `json:"durationms"`
+			Referer    string    `json:"referer,omitempty"`
+			UserAgent  string    `json:"useragent,omitempty"`
+		}{entry.Time, entry.RemoteAddr, entry.User, entry.Method, entry.URI, entry.Proto, entry.Host, entry.Status,
+			entry.Bytes, float64(entry.Duration) / float64(time.Millisecond), entry.Referer, entry.UserAgent})
+	default:
+		fmt.Fprintf(&buf, "%s - %s [%s] %s %d %s %s %s\n", accessLogField(entry.RemoteAddr),
+			accessLogField(entry.User), entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(entry.Method+" "+entry.URI+" "+entry.Proto), entry.Status, accessLogBytes(entry.Bytes),
+			strconv.Quote(entry.Referer), strconv.Quote(entry.UserAgent))
+	}
+	if err != nil {
+		warnf("unable to format access log entry: %v", err)
+		return
+	}
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	_, _ = cfg.w.Write(buf.Bytes())
+}
+
+func accessLogField(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+func accessLogBytes(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// accessLogRecorder captures the status and body size written by a handler.
+type accessLogRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *accessLogRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *accessLogRecorder) Write(b []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err = rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for Flush, Hijack, and deadlines.
+func (rec *accessLogRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
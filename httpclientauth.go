@@ -0,0 +1,199 @@
+package serverconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPClientAuthConfig enables mutual TLS on the HTTPS listener.  Mode is one of none (the default),
+// request, require, verify-if-given, or require-and-verify, matching tls.ClientAuthType.  The verifying modes
+// need CAFiles, PEM bundles of the CAs that issue client certificates.  When AllowedCNs or AllowedSANs are
+// given a verified client certificate must match one of them, and certificates listed in CRLFile are refused.
+//
+//	http:
+//	  clientauth:
+//	    mode: require-and-verify
+//	    cafiles: [/etc/pki/internal-ca.pem]
+//	    allowedsans: [billing.internal, spiffe://acme/ns/prod/sa/billing]
+type HTTPClientAuthConfig struct {
+	Mode        string   `yaml:"mode"`
+	CAFiles     []string `yaml:"cafiles"`
+	AllowedCNs  []string `yaml:"allowedcns"`
+	AllowedSANs []string `yaml:"allowedsans"`
+	CRLFile     string   `yaml:"crlfile"`
+	authType    tls.ClientAuthType
+	pool        *x509.CertPool
+	crl         *x509.RevocationList
+}
+
+// Verify parses Mode and loads the CA bundles and CRL.  A CRL must be signed by one of the CAs and a
+// warning is logged if it is past its next update time.
+func (cfg *HTTPClientAuthConfig) Verify() error {
+	var (
+		i     int
+		b     []byte
+		block *pem.Block
+		certs []*x509.Certificate
+		cas   []*x509.Certificate
+		err   error
+	)
+
+	cfg.pool = nil
+	cfg.crl = nil
+	switch strings.ToLower(strings.TrimSpace(cfg.Mode)) {
+	case "", "none":
+		cfg.authType = tls.NoClientCert
+	case "request":
+		cfg.authType = tls.RequestClientCert
+	case "require":
+		cfg.authType = tls.RequireAnyClientCert
+	case "verify-if-given":
+		cfg.authType = tls.VerifyClientCertIfGiven
+	case "require-and-verify":
+		cfg.authType = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("invalid http clientauth mode %q (expected none, request, require, verify-if-given, or require-and-verify)", cfg.Mode)
+	}
+	if cfg.authType == tls.NoClientCert {
+		return nil
+	}
+	if cfg.authType < tls.VerifyClientCertIfGiven {
+		if len(cfg.AllowedCNs) > 0 || len(cfg.AllowedSANs) > 0 || len(cfg.CRLFile) > 0 {
+			return fmt.Errorf("http clientauth mode %s does not verify certificates, so allowedcns, allowedsans, and crlfile cannot be used", cfg.Mode)
+		}
+		return nil
+	}
+
+	if len(cfg.CAFiles) == 0 {
+		return fmt.Errorf("http clientauth mode %s requires at least one entry in cafiles", cfg.Mode)
+	}
+	cfg.pool = x509.NewCertPool()
+	for i = 0; i < len(cfg.CAFiles); i++ {
+		b, err = os.ReadFile(cfg.CAFiles[i])
+		if err != nil {
+			return fmt.Errorf("unable to read http clientauth cafile: %w", err)
+		}
+		certs, err = parseCertificatesPEM(b)
+		if err != nil {
+			return fmt.Errorf("http clientauth cafile %s: %w", cfg.CAFiles[i], err)
+		}
+		cas = append(cas, certs...)
+	}
+	for i = 0; i < len(cas); i++ {
+		cfg.pool.AddCert(cas[i])
+	}
+
+	if len(cfg.CRLFile) > 0 {
+		b, err = os.ReadFile(cfg.CRLFile)
+		if err != nil {
+			return fmt.Errorf("unable to read http clientauth crlfile: %w", err)
+		}
+		block, _ = pem.Decode(b)
+		if block != nil {
+			b = block.Bytes
+		}
+		cfg.crl, err = x509.ParseRevocationList(b)
+		if err != nil {
+			return fmt.Errorf("unable to parse http clientauth crlfile %s: %w", cfg.CRLFile, err)
+		}
+		for i = 0; i < len(cas); i++ {
+			if cfg.crl.CheckSignatureFrom(cas[i]) == nil {
+				break
+			}
+		}
+		if i == len(cas) {
+			return fmt.Errorf("http clientauth crlfile %s is not signed by any of the cafiles", cfg.CRLFile)
+		}
+		if !cfg.crl.NextUpdate.IsZero() && time.Now().After(cfg.crl.NextUpdate) {
+			warnf("http clientauth crlfile %s was due for update at %s", cfg.CRLFile, cfg.crl.NextUpdate.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// apply sets the client certificate policy on tlsCfg.
+func (cfg *HTTPClientAuthConfig) apply(tlsCfg *tls.Config) {
+	tlsCfg.ClientAuth = cfg.authType
+	tlsCfg.ClientCAs = cfg.pool
+	if cfg.authType < tls.VerifyClientCertIfGiven {
+		return
+	}
+	if len(cfg.AllowedCNs) == 0 && len(cfg.AllowedSANs) == 0 && cfg.crl == nil {
+		return
+	}
+	tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		return cfg.checkClientCertificate(cs.PeerCertificates[0])
+	}
+}
+
+func (cfg *HTTPClientAuthConfig) checkClientCertificate(cert *x509.Certificate) error {
+	var (
+		i    int
+		sans []string
+	)
+
+	if cfg.crl != nil {
+		for i = 0; i < len(cfg.crl.RevokedCertificateEntries); i++ {
+			if cfg.crl.RevokedCertificateEntries[i].SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("client certificate %s has been revoked", cert.SerialNumber)
+			}
+		}
+	}
+	if len(cfg.AllowedCNs) == 0 && len(cfg.AllowedSANs) == 0 {
+		return nil
+	}
+	if containsString(cfg.AllowedCNs, cert.Subject.CommonName) {
+		return nil
+	}
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for i = 0; i < len(cert.URIs); i++ {
+		sans = append(sans, cert.URIs[i].String())
+	}
+	for i = 0; i < len(cert.IPAddresses); i++ {
+		sans = append(sans, cert.IPAddresses[i].String())
+	}
+	for i = 0; i < len(sans); i++ {
+		if containsString(cfg.AllowedSANs, sans[i]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate %q is not in the allowed names", cert.Subject.CommonName)
+}
+
+// parseCertificatesPEM returns every certificate in a PEM bundle, failing if there are none.
+func parseCertificatesPEM(b []byte) ([]*x509.Certificate, error) {
+	var (
+		block *pem.Block
+		cert  *x509.Certificate
+		certs []*x509.Certificate
+		err   error
+	)
+
+	for {
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificates found")
+	}
+	return certs, nil
+}
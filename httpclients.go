@@ -0,0 +1,219 @@
+package serverconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPClients holds named profiles for outbound HTTP clients, so that timeouts, TLS, and credentials for
+// each service called are set in one auditable place rather than in code, e.g.
+//
+//	httpclients:
+//	  billing:
+//	    baseurl: https://billing.internal/api/v2/
+//	    timeout: 5s
+//	    authheaderenv: BILLING_TOKEN
+//	    tls:
+//	      cafile: /etc/pki/internal-ca.pem
+//	  geocoder:
+//	    baseurl: https://maps.example.com/
+//	    proxy:
+//	      httpsproxy: http://proxy.corp.example:3128
+type HTTPClients map[string]HTTPClientConfig
+
+// HTTPClientConfig describes one outbound HTTP client.  Requests with a relative URL are resolved against
+// BaseURL, so a path without a leading slash is appended to BaseURL's path.  Timeout is the overall request
+// timeout, defaulting to 30s, and MaxIdleConns and MaxIdleConnsPerHost size the connection pool, defaulting
+// to 100 and 10.  AuthHeaderEnv names an environment variable whose value is sent in the AuthHeader header,
+// defaulting to Authorization, on requests that do not set it themselves.  Proxy is as for the HTTP
+// section's OutboundProxy.
+type HTTPClientConfig struct {
+	BaseURL             string              `yaml:"baseurl"`
+	Timeout             time.Duration       `yaml:"timeout"`
+	MaxIdleConns        int                 `yaml:"maxidleconns"`
+	MaxIdleConnsPerHost int                 `yaml:"maxidleconnsperhost"`
+	TLS                 HTTPClientTLSConfig `yaml:"tls"`
+	AuthHeader          string              `yaml:"authheader"`
+	AuthHeaderEnv       string              `yaml:"authheaderenv"`
+	Proxy               ProxyConfig         `yaml:"proxy"`
+	baseURL             *url.URL
+	authValue           string
+}
+
+// HTTPClientTLSConfig holds the TLS settings of an HTTPClientConfig.  CAFile replaces the system roots
+// with the CAs in a PEM bundle, CertFile and KeyFile give a client certificate for mutual TLS, and
+// MinVersion defaults to 1.2.
+type HTTPClientTLSConfig struct {
+	CAFile        string `yaml:"cafile"`
+	CertFile      string `yaml:"certfile"`
+	KeyFile       string `yaml:"keyfile"`
+	ServerName    string `yaml:"servername"`
+	MinVersion    string `yaml:"minversion"`
+	SkipTLSVerify bool   `yaml:"skiptlsverify"`
+	caPool        *x509.CertPool
+	certs         []tls.Certificate
+	minVersion    uint16
+}
+
+// Verify checks BaseURL, applies the defaults, and reads the auth header value.
+func (cfg *HTTPClientConfig) Verify() error {
+	var (
+		found bool
+		err   error
+	)
+
+	cfg.baseURL = nil
+	if len(cfg.BaseURL) > 0 {
+		cfg.baseURL, err = validateURL(cfg.BaseURL, "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid http client baseurl: %w", err)
+		}
+	}
+	if cfg.Timeout < 0 || cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("http client timeout and connection limits cannot be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = 100
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = 10
+	}
+	if cfg.MaxIdleConnsPerHost > cfg.MaxIdleConns {
+		return fmt.Errorf("http client maxidleconnsperhost (%d) exceeds maxidleconns (%d)", cfg.MaxIdleConnsPerHost, cfg.MaxIdleConns)
+	}
+	if len(cfg.AuthHeader) == 0 {
+		cfg.AuthHeader = "Authorization"
+	}
+	cfg.authValue = ""
+	if len(cfg.AuthHeaderEnv) > 0 {
+		cfg.authValue, found = os.LookupEnv(cfg.AuthHeaderEnv)
+		if !found || len(cfg.authValue) == 0 {
+			return fmt.Errorf("missing http client auth header (environment variable %s is not set)", cfg.AuthHeaderEnv)
+		}
+		if cfg.baseURL != nil && cfg.baseURL.Scheme == "http" {
+			warnf("http client credentials from %s are sent to %s without TLS", cfg.AuthHeaderEnv, cfg.baseURL.Host)
+		}
+	}
+	return nil
+}
+
+// Verify loads the CA bundle and client certificate.
+func (cfg *HTTPClientTLSConfig) Verify() error {
+	var (
+		pem  []byte
+		cert tls.Certificate
+		err  error
+	)
+
+	if len(cfg.MinVersion) == 0 {
+		cfg.MinVersion = "1.2"
+	}
+	cfg.minVersion, err = parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return fmt.Errorf("invalid http client tls minversion: %w", err)
+	}
+	cfg.caPool = nil
+	if len(cfg.CAFile) > 0 {
+		pem, err = os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read http client tls cafile: %w", err)
+		}
+		cfg.caPool = x509.NewCertPool()
+		if !cfg.caPool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("http client tls cafile %s contains no PEM certificates", cfg.CAFile)
+		}
+	}
+	if (len(cfg.CertFile) == 0) != (len(cfg.KeyFile) == 0) {
+		return fmt.Errorf("http client tls requires both certfile and keyfile")
+	}
+	cfg.certs = nil
+	if len(cfg.CertFile) > 0 {
+		cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load http client tls certificate: %w", err)
+		}
+		cfg.certs = []tls.Certificate{cert}
+	}
+	if cfg.SkipTLSVerify {
+		warnf("http client tls skiptlsverify is set; server certificates will not be checked")
+	}
+	return nil
+}
+
+// Config returns the client TLS configuration.
+func (cfg HTTPClientTLSConfig) Config() *tls.Config {
+	return &tls.Config{
+		ServerName:         cfg.ServerName,
+		RootCAs:            cfg.caPool,
+		Certificates:       cfg.certs,
+		InsecureSkipVerify: cfg.SkipTLSVerify,
+		MinVersion:         cfg.minVersion,
+	}
+}
+
+// NewClient returns an http.Client for the named profile.
+//
+//	client, err := gc.HTTPClients.NewClient("billing")
+//	resp, err := client.Get("invoices?status=open")
+func (c HTTPClients) NewClient(name string) (*http.Client, error) {
+	var (
+		cfg   HTTPClientConfig
+		found bool
+	)
+
+	cfg, found = c[name]
+	if !found {
+		return nil, fmt.Errorf("no http client named %q", name)
+	}
+	return cfg.NewClient(), nil
+}
+
+// NewClient returns an http.Client with these settings.
+func (cfg *HTTPClientConfig) NewClient() *http.Client {
+	var t *http.Transport
+
+	t = cfg.Proxy.Transport()
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.TLSClientConfig = cfg.TLS.Config()
+	if cfg.baseURL == nil && len(cfg.authValue) == 0 {
+		return &http.Client{Transport: t, Timeout: cfg.Timeout}
+	}
+	return &http.Client{
+		Transport: &httpClientTransport{next: t, baseURL: cfg.baseURL, authHeader: cfg.AuthHeader, authValue: cfg.authValue},
+		Timeout:   cfg.Timeout,
+	}
+}
+
+// httpClientTransport resolves relative request URLs against baseURL and adds the auth header.
+type httpClientTransport struct {
+	next       http.RoundTripper
+	baseURL    *url.URL
+	authHeader string
+	authValue  string
+}
+
+func (t *httpClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (t.baseURL != nil && len(req.URL.Host) == 0) || (len(t.authValue) > 0 && len(req.Header.Get(t.authHeader)) == 0) {
+		req = req.Clone(req.Context())
+		if t.baseURL != nil && len(req.URL.Host) == 0 {
+			req.URL = t.baseURL.ResolveReference(req.URL)
+			req.Host = ""
+		}
+		// credentials are only sent to the configured service, not to absolute URLs elsewhere
+		if len(t.authValue) > 0 && len(req.Header.Get(t.authHeader)) == 0 &&
+			(t.baseURL == nil || strings.EqualFold(req.URL.Host, t.baseURL.Host)) {
+			req.Header.Set(t.authHeader, t.authValue)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,150 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPCORSConfig holds the Cross-Origin Resource Sharing policy.  CORS is off when AllowedOrigins is empty.
+// Origins are matched exactly, or may use a single leading wildcard label such as https://*.acme.com, or be
+// "*" for any origin.  AllowedMethods defaults to GET, HEAD, and POST.
+//
+//	http:
+//	  cors:
+//	    allowedorigins: [https://app.acme.com, https://*.acme-preview.com]
+//	    allowedheaders: [Authorization, Content-Type]
+//	    allowcredentials: true
+//	    maxage: 10m
+type HTTPCORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowedorigins"`
+	AllowedMethods   []string      `yaml:"allowedmethods"`
+	AllowedHeaders   []string      `yaml:"allowedheaders"`
+	ExposedHeaders   []string      `yaml:"exposedheaders"`
+	AllowCredentials bool          `yaml:"allowcredentials"`
+	MaxAge           time.Duration `yaml:"maxage"`
+}
+
+// Verify checks the origins, rejecting "*" combined with AllowCredentials since browsers refuse that
+// combination, and normalizes methods to upper case.
+func (cfg *HTTPCORSConfig) Verify() error {
+	var (
+		i      int
+		origin string
+		err    error
+	)
+
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil
+	}
+	for i = 0; i < len(cfg.AllowedOrigins); i++ {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cfg.AllowedOrigins[i])), "/")
+		cfg.AllowedOrigins[i] = origin
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return fmt.Errorf("CORS allowedorigins of \"*\" cannot be combined with allowcredentials")
+			}
+			continue
+		}
+		_, err = validateURL(strings.Replace(origin, "://*.", "://wildcard.", 1), "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid CORS origin: %w", err)
+		}
+		if strings.Count(origin, "*") > 1 || (strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			return fmt.Errorf("invalid CORS origin %q: wildcard must be the first label only", origin)
+		}
+		if strings.Count(origin, "/") > 2 {
+			return fmt.Errorf("invalid CORS origin %q: origins cannot include a path", origin)
+		}
+	}
+
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	for i = 0; i < len(cfg.AllowedMethods); i++ {
+		cfg.AllowedMethods[i] = strings.ToUpper(strings.TrimSpace(cfg.AllowedMethods[i]))
+	}
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("CORS maxage cannot be negative")
+	}
+	return nil
+}
+
+// Handler wraps next with the CORS policy, answering preflight requests directly.  If CORS is not
+// configured next is returned unchanged.
+func (cfg *HTTPCORSConfig) Handler(next http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			origin string
+			h      http.Header
+		)
+
+		origin = r.Header.Get("Origin")
+		h = w.Header()
+		h.Add("Vary", "Origin")
+		if len(origin) == 0 || !cfg.originAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if containsString(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if !containsString(cfg.AllowedMethods, strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+			if len(cfg.AllowedHeaders) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(cfg.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *HTTPCORSConfig) originAllowed(origin string) bool {
+	var (
+		allowed string
+		scheme  string
+		suffix  string
+		i       int
+	)
+
+	origin = strings.ToLower(origin)
+	for i = 0; i < len(cfg.AllowedOrigins); i++ {
+		allowed = cfg.AllowedOrigins[i]
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		scheme, suffix, _ = strings.Cut(allowed, "://*.")
+		if len(suffix) > 0 && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPCSRFConfig holds the settings for CSRF protection of a web application.  AuthKey is the 32 byte key
+// used to sign tokens and may be given as hex, base64, or a raw 32 character string.  TrustedOrigins lists
+// the hosts (optionally with a port) other than the request host from which form posts are accepted, and
+// SameSite takes the same values as the session cookie.
+//
+//	http:
+//	  csrf:
+//	    enabled: true
+//	    trustedorigins: [admin.acme.com]
+//	    samesite: strict
+type HTTPCSRFConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	AuthKey        string   `yaml:"authkey" env:"CSRFAUTHKEY"`
+	CookieName     string   `yaml:"cookiename"`
+	RequestHeader  string   `yaml:"requestheader"`
+	TrustedOrigins []string `yaml:"trustedorigins"`
+	SameSite       string   `yaml:"samesite"`
+	key            []byte
+	sameSite       http.SameSite
+}
+
+// Verify decodes AuthKey and requires it to be exactly 32 bytes.  CookieName defaults to _csrf,
+// RequestHeader to X-CSRF-Token, and SameSite to lax.  Nothing is checked when CSRF protection is not
+// enabled.
+func (cfg *HTTPCSRFConfig) Verify() error {
+	var (
+		i    int
+		host string
+		err  error
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.AuthKey) == 0 {
+		return fmt.Errorf("missing CSRF authkey (or CSRFAUTHKEY environment variable)")
+	}
+	cfg.key = decodeSecretKey(cfg.AuthKey, 32)
+	if len(cfg.key) != 32 {
+		return fmt.Errorf("CSRF authkey must be 32 bytes, got %d", len(cfg.key))
+	}
+	if len(cfg.CookieName) == 0 {
+		cfg.CookieName = "_csrf"
+	}
+	if len(cfg.RequestHeader) == 0 {
+		cfg.RequestHeader = "X-CSRF-Token"
+	}
+	for i = 0; i < len(cfg.TrustedOrigins); i++ {
+		host = strings.ToLower(strings.TrimSpace(cfg.TrustedOrigins[i]))
+		cfg.TrustedOrigins[i] = host
+		if strings.Contains(host, "://") {
+			return fmt.Errorf("CSRF trustedorigins entry %q should be a host, not a URL", host)
+		}
+		if strings.Contains(host, ":") {
+			err = validateHostPort(host)
+			if err != nil {
+				return fmt.Errorf("invalid CSRF trustedorigins entry: %w", err)
+			}
+			host, _, _ = net.SplitHostPort(host)
+		}
+		err = validateHostname(host)
+		if err != nil {
+			return fmt.Errorf("invalid CSRF trustedorigins entry: %w", err)
+		}
+	}
+	if len(cfg.SameSite) == 0 {
+		cfg.sameSite = http.SameSiteLaxMode
+	} else {
+		cfg.sameSite, err = parseHTTPSameSite(cfg.SameSite)
+		if err != nil {
+			return fmt.Errorf("invalid CSRF samesite: %w", err)
+		}
+	}
+	return nil
+}
+
+// Key returns the decoded AuthKey.
+func (cfg HTTPCSRFConfig) Key() []byte {
+	return cfg.key
+}
+
+// SameSiteMode returns the parsed SameSite setting for the CSRF cookie.
+func (cfg HTTPCSRFConfig) SameSiteMode() http.SameSite {
+	return cfg.sameSite
+}
@@ -0,0 +1,103 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var httpReferrerPolicies = []string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin",
+	"strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+}
+
+// HTTPSecurityHeaders holds the security related response headers added by Handler.  HSTSMaxAge defaults to
+// 180 days unless DisableHSTS is set, XFrameOptions to DENY, and ReferrerPolicy to
+// strict-origin-when-cross-origin.  ContentSecurityPolicy is sent as given and is omitted when empty.
+// X-Content-Type-Options: nosniff is always sent.
+//
+//	http:
+//	  securityheaders:
+//	    hstsincludesubdomains: true
+//	    contentsecuritypolicy: "default-src 'self'"
+type HTTPSecurityHeaders struct {
+	DisableHSTS           bool          `yaml:"disablehsts"`
+	HSTSMaxAge            time.Duration `yaml:"hstsmaxage"`
+	HSTSIncludeSubdomains bool          `yaml:"hstsincludesubdomains"`
+	HSTSPreload           bool          `yaml:"hstspreload"`
+	ContentSecurityPolicy string        `yaml:"contentsecuritypolicy"`
+	XFrameOptions         string        `yaml:"xframeoptions"`
+	ReferrerPolicy        string        `yaml:"referrerpolicy"`
+}
+
+// Verify applies the defaults and checks the values.  HSTSPreload requires HSTSIncludeSubdomains and a
+// max-age of at least one year, as the browser preload lists do.
+func (cfg *HTTPSecurityHeaders) Verify() error {
+	if !cfg.DisableHSTS {
+		if cfg.HSTSMaxAge < 0 {
+			return fmt.Errorf("securityheaders hstsmaxage cannot be negative")
+		}
+		if cfg.HSTSMaxAge == 0 {
+			cfg.HSTSMaxAge = 180 * 24 * time.Hour
+		}
+		if cfg.HSTSPreload && (!cfg.HSTSIncludeSubdomains || cfg.HSTSMaxAge < 365*24*time.Hour) {
+			return fmt.Errorf("securityheaders hstspreload requires hstsincludesubdomains and an hstsmaxage of at least 8760h")
+		}
+	}
+	if strings.ContainsAny(cfg.ContentSecurityPolicy, "\r\n") {
+		return fmt.Errorf("securityheaders contentsecuritypolicy cannot contain line breaks")
+	}
+	cfg.XFrameOptions = strings.ToUpper(strings.TrimSpace(cfg.XFrameOptions))
+	switch cfg.XFrameOptions {
+	case "":
+		cfg.XFrameOptions = "DENY"
+	case "DENY", "SAMEORIGIN":
+	default:
+		return fmt.Errorf("invalid securityheaders xframeoptions %q (expected DENY or SAMEORIGIN)", cfg.XFrameOptions)
+	}
+	cfg.ReferrerPolicy = strings.ToLower(strings.TrimSpace(cfg.ReferrerPolicy))
+	if len(cfg.ReferrerPolicy) == 0 {
+		cfg.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if !containsString(httpReferrerPolicies, cfg.ReferrerPolicy) {
+		return fmt.Errorf("invalid securityheaders referrerpolicy %q", cfg.ReferrerPolicy)
+	}
+	return nil
+}
+
+// Handler wraps next, setting the configured headers on every response.
+func (cfg *HTTPSecurityHeaders) Handler(next http.Handler) http.Handler {
+	var hsts string
+
+	if !cfg.DisableHSTS && cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var h http.Header
+
+		h = w.Header()
+		if len(hsts) > 0 {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if len(cfg.ContentSecurityPolicy) > 0 {
+			h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+		if len(cfg.XFrameOptions) > 0 {
+			h.Set("X-Frame-Options", cfg.XFrameOptions)
+		}
+		if len(cfg.ReferrerPolicy) > 0 {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		h.Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package serverconfig
+
+import (
+	"net/http"
+)
+
+// LimitHandler wraps next with the configured request limits.  Request bodies larger than MaxBodySize fail
+// to read with an *http.MaxBytesError, and once MaxConcurrentRequests are in progress further requests are
+// refused with 503 Service Unavailable.  A zero limit is not enforced.  MaxHeaderBytes is applied by the
+// http.Server itself.
+func (cfg *HTTPConfig) LimitHandler(next http.Handler) http.Handler {
+	var (
+		maxBody int64
+		slots   chan struct{}
+	)
+
+	maxBody = int64(cfg.MaxBodySize)
+	if cfg.MaxConcurrentRequests > 0 {
+		slots = make(chan struct{}, cfg.MaxConcurrentRequests)
+	}
+	if maxBody == 0 && slots == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		if maxBody > 0 && r.Body != nil {
+			if r.ContentLength > maxBody {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
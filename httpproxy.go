@@ -0,0 +1,231 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPProxyConfig configures the server as a reverse proxy.  Each route matches on Host, PathPrefix, or
+// both, and the most specific match wins: a host match beats none, then the longest prefix.  Idempotent
+// requests without a body are retried up to Retries times on connection failures.  With Buffering off,
+// responses are flushed to the client as they arrive, which streaming endpoints need.
+//
+//	http:
+//	  reverseproxy:
+//	    preservehost: true
+//	    responsetimeout: 30s
+//	    routes:
+//	      - pathprefix: /api/
+//	        upstream: http://api.internal:8080
+//	      - host: static.acme.com
+//	        upstream: http://cdn-origin.internal
+type HTTPProxyConfig struct {
+	Routes          []HTTPProxyRoute `yaml:"routes"`
+	PreserveHost    bool             `yaml:"preservehost"`
+	DialTimeout     time.Duration    `yaml:"dialtimeout"`
+	ResponseTimeout time.Duration    `yaml:"responsetimeout"`
+	Retries         int              `yaml:"retries"`
+	Buffering       *bool            `yaml:"buffering"`
+}
+
+// HTTPProxyRoute maps requests to an upstream.  With StripPrefix the PathPrefix is removed before the
+// request is forwarded.
+type HTTPProxyRoute struct {
+	Host        string `yaml:"host"`
+	PathPrefix  string `yaml:"pathprefix"`
+	Upstream    string `yaml:"upstream"`
+	StripPrefix bool   `yaml:"stripprefix"`
+	upstream    *url.URL
+}
+
+// Verify checks every route and defaults DialTimeout to 10s, ResponseTimeout to 60s, and Buffering to
+// true.  Two routes with the same host and prefix are rejected.
+func (cfg *HTTPProxyConfig) Verify() error {
+	var (
+		i         int
+		route     *HTTPProxyRoute
+		seen      map[string]int
+		key       string
+		prev      int
+		ok        bool
+		buffering bool
+		err       error
+	)
+
+	if len(cfg.Routes) == 0 {
+		return fmt.Errorf("reverseproxy requires at least one route")
+	}
+	if cfg.DialTimeout < 0 || cfg.ResponseTimeout < 0 || cfg.Retries < 0 {
+		return fmt.Errorf("reverseproxy timeouts and retries cannot be negative")
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 10 * time.Second
+	}
+	if cfg.ResponseTimeout == 0 {
+		cfg.ResponseTimeout = 60 * time.Second
+	}
+	if cfg.Buffering == nil {
+		buffering = true
+		cfg.Buffering = &buffering
+	}
+
+	seen = make(map[string]int)
+	for i = 0; i < len(cfg.Routes); i++ {
+		route = &cfg.Routes[i]
+		route.Host = strings.ToLower(strings.TrimSpace(route.Host))
+		if len(route.Host) == 0 && len(route.PathPrefix) == 0 {
+			return fmt.Errorf("reverseproxy route %d needs a host or pathprefix", i+1)
+		}
+		if len(route.Host) > 0 {
+			err = validateHostname(route.Host)
+			if err != nil {
+				return fmt.Errorf("reverseproxy route %d: %w", i+1, err)
+			}
+		}
+		if len(route.PathPrefix) > 0 && !strings.HasPrefix(route.PathPrefix, "/") {
+			return fmt.Errorf("reverseproxy route %d pathprefix must begin with '/': %q", i+1, route.PathPrefix)
+		}
+		if route.StripPrefix && len(route.PathPrefix) == 0 {
+			return fmt.Errorf("reverseproxy route %d has stripprefix without a pathprefix", i+1)
+		}
+		route.upstream, err = validateURL(route.Upstream, "http", "https")
+		if err != nil {
+			return fmt.Errorf("reverseproxy route %d upstream: %w", i+1, err)
+		}
+		key = route.Host + " " + route.PathPrefix
+		prev, ok = seen[key]
+		if ok {
+			return fmt.Errorf("reverseproxy routes %d and %d have the same host and pathprefix", prev, i+1)
+		}
+		seen[key] = i + 1
+	}
+	return nil
+}
+
+// Handler returns a handler proxying each request to the upstream of its matching route, or answering
+// 404 Not Found when no route matches.
+func (cfg *HTTPProxyConfig) Handler() http.Handler {
+	var (
+		transport http.RoundTripper
+		proxies   []*httputil.ReverseProxy
+		i         int
+	)
+
+	transport = &proxyRetryTransport{
+		retries: cfg.Retries,
+		next: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: cfg.DialTimeout}).DialContext,
+			ResponseHeaderTimeout: cfg.ResponseTimeout,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+	proxies = make([]*httputil.ReverseProxy, len(cfg.Routes))
+	for i = 0; i < len(cfg.Routes); i++ {
+		proxies[i] = cfg.newReverseProxy(cfg.Routes[i], transport)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+
+		n = cfg.matchRoute(r)
+		if n < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		proxies[n].ServeHTTP(w, r)
+	})
+}
+
+func (cfg *HTTPProxyConfig) newReverseProxy(route HTTPProxyRoute, transport http.RoundTripper) *httputil.ReverseProxy {
+	var proxy *httputil.ReverseProxy
+
+	proxy = &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.StripPrefix {
+				pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, route.PathPrefix), "/")
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(route.upstream)
+			pr.SetXForwarded()
+			if cfg.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+		},
+	}
+	if cfg.Buffering != nil && !*cfg.Buffering {
+		proxy.FlushInterval = -1
+	}
+	return proxy
+}
+
+// matchRoute returns the index of the most specific route matching r, or -1.
+func (cfg *HTTPProxyConfig) matchRoute(r *http.Request) int {
+	var (
+		host  string
+		best  int
+		score int
+		s     int
+		route *HTTPProxyRoute
+		i     int
+		err   error
+	)
+
+	host, _, err = net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	host = strings.ToLower(host)
+	best = -1
+	score = -1
+	for i = 0; i < len(cfg.Routes); i++ {
+		route = &cfg.Routes[i]
+		if len(route.Host) > 0 && route.Host != host {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+			continue
+		}
+		s = len(route.PathPrefix)
+		if len(route.Host) > 0 {
+			s += 1 << 16
+		}
+		if s > score {
+			best = i
+			score = s
+		}
+	}
+	return best
+}
+
+// proxyRetryTransport retries idempotent requests without a body when the upstream connection fails.
+type proxyRetryTransport struct {
+	retries int
+	next    http.RoundTripper
+}
+
+func (t *proxyRetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var (
+		resp    *http.Response
+		attempt int
+		err     error
+	)
+
+	for attempt = 0; ; attempt++ {
+		resp, err = t.next.RoundTrip(r)
+		if err == nil || attempt >= t.retries || r.Context().Err() != nil {
+			return resp, err
+		}
+		if (r.Body != nil && r.Body != http.NoBody) ||
+			(r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions) {
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// parseTrustedProxies parses TrustedProxies, accepting CIDRs or bare addresses, and canonicalizes
+// RealIPHeader, which defaults to X-Forwarded-For when any proxies are trusted.
+func (cfg *HTTPConfig) parseTrustedProxies() error {
+	var (
+		i     int
+		s     string
+		ip    net.IP
+		ipnet *net.IPNet
+		err   error
+	)
+
+	cfg.trustedProxies = nil
+	for i = 0; i < len(cfg.TrustedProxies); i++ {
+		s = strings.TrimSpace(cfg.TrustedProxies[i])
+		if !strings.Contains(s, "/") {
+			ip = net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid http trustedproxies entry %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, ipnet, err = net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid http trustedproxies entry: %w", err)
+		}
+		cfg.trustedProxies = append(cfg.trustedProxies, ipnet)
+	}
+	if len(cfg.RealIPHeader) > 0 {
+		cfg.RealIPHeader = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(cfg.RealIPHeader))
+	} else if len(cfg.trustedProxies) > 0 {
+		cfg.RealIPHeader = "X-Forwarded-For"
+	}
+	return nil
+}
+
+func (cfg *HTTPConfig) trustedProxy(ip net.IP) bool {
+	var i int
+
+	for i = 0; i < len(cfg.trustedProxies); i++ {
+		if cfg.trustedProxies[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made r.  The peer address is used unless it is one of
+// the TrustedProxies, in which case RealIPHeader is consulted.  For X-Forwarded-For the list is walked from
+// the right and the first address that is not a trusted proxy is returned, so a client cannot spoof its
+// address by sending the header itself.  Headers such as CF-Connecting-IP or X-Real-IP hold a single address
+// which is used as is.
+func (cfg *HTTPConfig) ClientIP(r *http.Request) net.IP {
+	var (
+		host  string
+		peer  net.IP
+		ip    net.IP
+		hops  []string
+		i     int
+		err   error
+		value string
+	)
+
+	host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer = net.ParseIP(host)
+	if peer == nil || len(cfg.RealIPHeader) == 0 || !cfg.trustedProxy(peer) {
+		return peer
+	}
+
+	if cfg.RealIPHeader != "X-Forwarded-For" {
+		ip = net.ParseIP(strings.TrimSpace(r.Header.Get(cfg.RealIPHeader)))
+		if ip == nil {
+			return peer
+		}
+		return ip
+	}
+
+	value = strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	hops = strings.Split(value, ",")
+	for i = len(hops) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		peer = ip
+		if !cfg.trustedProxy(ip) {
+			break
+		}
+	}
+	return peer
+}
@@ -0,0 +1,309 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewServer builds the plaintext and TLS servers described by the configuration, which should already have
+// been verified.  Either return value is nil when the matching bind address is empty.  The TLS server uses
+// the static certificate when one is configured and otherwise obtains certificates through ACME, in which
+// case the plaintext server also answers HTTP-01 challenges.  Timeouts, MaxHeaderBytes, and the HTTP2
+// settings are applied to both servers.  Use Shutdown to stop them gracefully, and cancel ctx once they
+// have stopped to end the certificate watchers started by BuildTLSConfig.
+//
+//	plain, secure, err := gc.HTTP.NewServer(ctx, mux)
+//	go secure.ListenAndServeTLS("", "")
+//	go plain.ListenAndServe()
+func (cfg *HTTPConfig) NewServer(ctx context.Context, handler http.Handler) (*http.Server, *http.Server, error) {
+	return cfg.newServers(ctx, handler, handler)
+}
+
+// newServers is NewServer with a separate handler for the plaintext listener.
+func (cfg *HTTPConfig) newServers(ctx context.Context, handler, plainHandler http.Handler) (*http.Server, *http.Server, error) {
+	var (
+		plain, secure *http.Server
+		manager       *autocert.Manager
+		err           error
+	)
+
+	if len(cfg.BindAddr) == 0 && len(cfg.SSLBindAddr) == 0 {
+		return nil, nil, fmt.Errorf("neither http bindaddr nor sslbindaddr is set")
+	}
+
+	if len(cfg.SSLBindAddr) > 0 {
+		secure = cfg.newServer(cfg.SSLBindAddr, handler)
+		secure.TLSConfig, err = cfg.BuildTLSConfig(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.usesACME() {
+			manager = cfg.ACME.Manager()
+		}
+	}
+
+	if len(cfg.BindAddr) > 0 {
+		if manager != nil {
+			plain = cfg.newServer(cfg.BindAddr, manager.HTTPHandler(plainHandler))
+		} else {
+			plain = cfg.newServer(cfg.BindAddr, plainHandler)
+		}
+	}
+
+	return plain, secure, nil
+}
+
+// BuildTLSConfig returns the TLS configuration for the HTTPS listener, combining the TLS policy and client
+// certificate settings with either the static certificate or, when none is configured, certificates
+// obtained through ACME.  With StaticCert.ReloadInterval set the certificate files are watched, and with
+// OCSP enabled responses are stapled, both in the background until ctx is cancelled.  Connections for a
+// virtual host are answered with its own static certificate or, without one, through ACME.  Wildcard names
+// are issued through the dns-01 challenge of ACME.DNS, also in the background until ctx is cancelled;
+// certificates already in DiskCache are served at once.
+func (cfg *HTTPConfig) BuildTLSConfig(ctx context.Context) (*tls.Config, error) {
+	var (
+		tlsCfg   *tls.Config
+		cert     tls.Certificate
+		reloader *CertReloader
+		stapler  *ocspStapler
+		manager  *autocert.Manager
+		issuer   *dnsIssuer
+		err      error
+	)
+
+	tlsCfg = cfg.TLS.Config()
+	cfg.ClientAuth.apply(tlsCfg)
+	if cfg.hasStaticCert() && cfg.StaticCert.ReloadInterval > 0 {
+		reloader, err = cfg.StaticCert.Reloader()
+		if err != nil {
+			return nil, err
+		}
+		go reloader.Watch(ctx, cfg.StaticCert.ReloadInterval)
+		tlsCfg.GetCertificate = reloader.GetCertificate
+	} else if cfg.hasStaticCert() {
+		cert, err = tls.LoadX509KeyPair(cfg.StaticCert.SSLCertFile, cfg.StaticCert.SSLPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load static certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.hasStaticCert() {
+		if cfg.OCSP.Enabled {
+			if tlsCfg.GetCertificate == nil {
+				tlsCfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				}
+				tlsCfg.Certificates = nil
+			}
+			stapler = newOCSPStapler(cfg.OCSP, tlsCfg.GetCertificate)
+			go stapler.run(ctx)
+			tlsCfg.GetCertificate = stapler.GetCertificate
+		}
+	}
+
+	if cfg.usesACME() {
+		manager = cfg.ACME.Manager()
+		if cfg.hasStaticCert() {
+			tlsCfg.GetCertificate = cfg.acmeVirtualHostCertificates(manager, tlsCfg.GetCertificate)
+		} else {
+			tlsCfg.GetCertificate = manager.GetCertificate
+		}
+		if len(tlsCfg.NextProtos) == 0 {
+			tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+		}
+		tlsCfg.NextProtos = append(tlsCfg.NextProtos, acme.ALPNProto)
+	}
+	issuer = cfg.ACME.newDNSIssuer()
+	if issuer != nil {
+		err = issuer.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		go issuer.run(ctx)
+		tlsCfg.GetCertificate = dnsIssuerCertificates(issuer, tlsCfg.GetCertificate)
+	}
+	tlsCfg.GetCertificate, err = cfg.virtualHostCertificates(ctx, tlsCfg.GetCertificate)
+	if err != nil {
+		return nil, err
+	}
+	return tlsCfg, nil
+}
+
+func (cfg *HTTPConfig) hasStaticCert() bool {
+	return len(cfg.StaticCert.SSLCertFile) > 0 && len(cfg.StaticCert.SSLPrivateKeyFile) > 0
+}
+
+func (cfg *HTTPConfig) newServer(addr string, handler http.Handler) *http.Server {
+	var srv *http.Server
+
+	srv = &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.Timeouts.Read,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+		MaxHeaderBytes:    int(cfg.MaxHeaderBytes),
+	}
+	cfg.HTTP2.ConfigureServer(srv)
+	return srv
+}
+
+// Shutdown gracefully stops the given servers, allowing in-flight requests up to Timeouts.ShutdownGrace
+// to finish.  Nil servers are ignored.
+func (cfg *HTTPConfig) Shutdown(servers ...*http.Server) error {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		errs   []error
+		err    error
+		i      int
+	)
+
+	ctx = context.Background()
+	if cfg.Timeouts.ShutdownGrace > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeouts.ShutdownGrace)
+		defer cancel()
+	}
+	for i = 0; i < len(servers); i++ {
+		if servers[i] == nil {
+			continue
+		}
+		err = servers[i].Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shutdown of %s: %w", servers[i].Addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the servers built by NewServer and blocks until ctx is cancelled or a listener fails, then
+// shuts both down gracefully within Timeouts.ShutdownGrace.  Listeners are opened with Listen, so unix
+// sockets and systemd socket activation are supported.  When RedirectToHTTPS is set and both listeners
+// are configured, the plaintext listener only redirects to HTTPS (and answers ACME challenges).  A
+// cancelled context is a normal stop and returns nil.  Certificate watchers stop when Run returns.  With
+// HTTP3 enabled an HTTP/3 listener is started beside the HTTPS one, as described for HTTP3Config.
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	err = gc.HTTP.Run(ctx, mux)
+func (cfg *HTTPConfig) Run(ctx context.Context, handler http.Handler) error {
+	var (
+		plain, secure *http.Server
+		h3            *http3.Server
+		plainHandler  http.Handler
+		plainLn       net.Listener
+		secureLn      net.Listener
+		h3Conn        net.PacketConn
+		watchCtx      context.Context
+		cancel        context.CancelFunc
+		errc          chan error
+		running       int
+		err           error
+	)
+
+	plainHandler = handler
+	if cfg.RedirectToHTTPS && len(cfg.SSLBindAddr) > 0 {
+		plainHandler = cfg.redirectHandler()
+	}
+	watchCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	plain, secure, err = cfg.newServers(watchCtx, handler, plainHandler)
+	if err != nil {
+		return err
+	}
+	if secure != nil && cfg.HTTP3.Enabled {
+		h3 = cfg.NewHTTP3Server(handler, secure.TLSConfig)
+		secure.Handler = cfg.HTTP3.AltSvcHandler(secure.Handler)
+	}
+
+	if secure != nil {
+		secureLn, err = cfg.Listen(cfg.SSLBindAddr)
+		if err != nil {
+			return err
+		}
+	}
+	if plain != nil {
+		plainLn, err = cfg.Listen(cfg.BindAddr)
+		if err != nil {
+			if secureLn != nil {
+				_ = secureLn.Close()
+			}
+			return err
+		}
+	}
+	if h3 != nil {
+		h3Conn, err = net.ListenPacket("udp", cfg.HTTP3.BindAddr)
+		if err != nil {
+			_ = secureLn.Close()
+			if plainLn != nil {
+				_ = plainLn.Close()
+			}
+			return fmt.Errorf("unable to listen for http3 on %s: %w", cfg.HTTP3.BindAddr, err)
+		}
+	}
+
+	errc = make(chan error, 3)
+	if secure != nil {
+		running++
+		go func() {
+			errc <- secure.ServeTLS(secureLn, "", "")
+		}()
+	}
+	if plain != nil {
+		running++
+		go func() {
+			errc <- plain.Serve(plainLn)
+		}()
+	}
+	if h3 != nil {
+		running++
+		go func() {
+			errc <- h3.Serve(h3Conn)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+		running--
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	err = errors.Join(err, cfg.Shutdown(plain, secure), cfg.shutdownHTTP3(h3, h3Conn))
+	for ; running > 0; running-- {
+		<-errc
+	}
+	return err
+}
+
+// redirectHandler redirects every request to the same path on the HTTPS listener.
+func (cfg *HTTPConfig) redirectHandler() http.Handler {
+	var port string
+
+	_, port, _ = net.SplitHostPort(cfg.SSLBindAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			host string
+			err  error
+		)
+
+		host, _, err = net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if len(port) > 0 && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
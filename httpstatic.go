@@ -0,0 +1,191 @@
+package serverconfig
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPStaticConfig serves plain files from Root under URLPrefix.  CacheMaxAge sets the Cache-Control max-age
+// for assets.  With Precompressed set, a file.br or file.gz next to the requested file is served instead
+// when the client accepts that encoding.  With SPAFallback set, requests for missing paths without a file
+// extension get Root/index.html, uncached, so client-side routing works.
+//
+//	http:
+//	  static:
+//	    root: ./public
+//	    urlprefix: /assets/
+//	    cachemaxage: 24h
+//	    precompressed: true
+type HTTPStaticConfig struct {
+	Root          string        `yaml:"root" env:"STATICROOT"`
+	URLPrefix     string        `yaml:"urlprefix"`
+	CacheMaxAge   time.Duration `yaml:"cachemaxage"`
+	Precompressed bool          `yaml:"precompressed"`
+	SPAFallback   bool          `yaml:"spafallback"`
+}
+
+// Verify checks that Root is a directory and defaults URLPrefix to "/".  SPAFallback requires an
+// index.html in Root.
+func (cfg *HTTPStaticConfig) Verify() error {
+	var (
+		info os.FileInfo
+		err  error
+	)
+
+	if len(cfg.Root) == 0 {
+		return fmt.Errorf("missing static root (or STATICROOT environment variable)")
+	}
+	info, err = os.Stat(cfg.Root)
+	if err != nil {
+		return fmt.Errorf("static root: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("static root %s is not a directory", cfg.Root)
+	}
+	if len(cfg.URLPrefix) == 0 {
+		cfg.URLPrefix = "/"
+	}
+	if !strings.HasPrefix(cfg.URLPrefix, "/") {
+		return fmt.Errorf("static urlprefix must begin with '/': %q", cfg.URLPrefix)
+	}
+	if !strings.HasSuffix(cfg.URLPrefix, "/") {
+		cfg.URLPrefix += "/"
+	}
+	if cfg.CacheMaxAge < 0 {
+		return fmt.Errorf("static cachemaxage cannot be negative")
+	}
+	if cfg.SPAFallback {
+		_, err = os.Stat(filepath.Join(cfg.Root, "index.html"))
+		if err != nil {
+			return fmt.Errorf("static spafallback requires index.html: %w", err)
+		}
+	}
+	return nil
+}
+
+// Handler returns the pattern and handler to register on a mux for serving the files.
+//
+//	mux.Handle(gc.HTTP.Static.Handler())
+func (cfg *HTTPStaticConfig) Handler() (string, http.Handler) {
+	var (
+		root         http.Dir
+		cacheControl string
+	)
+
+	root = http.Dir(cfg.Root)
+	if cfg.CacheMaxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.FormatInt(int64(cfg.CacheMaxAge/time.Second), 10)
+	}
+
+	return cfg.URLPrefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			name string
+			file http.File
+			info os.FileInfo
+			err  error
+		)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		name = path.Clean("/" + strings.TrimPrefix(r.URL.Path, cfg.URLPrefix))
+		if strings.HasSuffix(name, "/") {
+			name += "index.html"
+		}
+
+		file, info, err = openStaticFile(root, name)
+		if err == nil && info.IsDir() {
+			_ = file.Close()
+			name = path.Join(name, "index.html")
+			file, info, err = openStaticFile(root, name)
+		}
+		if err != nil {
+			if !cfg.SPAFallback || len(path.Ext(name)) > 0 {
+				http.NotFound(w, r)
+				return
+			}
+			name = "/index.html"
+			file, info, err = openStaticFile(root, name)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-cache")
+		} else if len(cacheControl) > 0 {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		if cfg.Precompressed {
+			w.Header().Add("Vary", "Accept-Encoding")
+			file, info = cfg.precompressed(w, r, root, name, file, info)
+		}
+		defer file.Close()
+		http.ServeContent(w, r, name, info.ModTime(), file)
+	})
+}
+
+// precompressed swaps file for a .br or .gz sibling the client accepts, setting the encoding headers.
+// The original file is closed when it is replaced.
+func (cfg *HTTPStaticConfig) precompressed(w http.ResponseWriter, r *http.Request, root http.Dir, name string,
+	file http.File, info os.FileInfo) (http.File, os.FileInfo) {
+	var (
+		accept   string
+		encoding string
+		ext      string
+		alt      http.File
+		altInfo  os.FileInfo
+		ctype    string
+		err      error
+		i        int
+	)
+
+	accept = r.Header.Get("Accept-Encoding")
+	for i = 0; i < 2; i++ {
+		encoding, ext = "br", ".br"
+		if i == 1 {
+			encoding, ext = "gzip", ".gz"
+		}
+		if !strings.Contains(accept, encoding) {
+			continue
+		}
+		alt, altInfo, err = openStaticFile(root, name+ext)
+		if err != nil {
+			continue
+		}
+		ctype = mime.TypeByExtension(path.Ext(name))
+		if len(ctype) > 0 {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		_ = file.Close()
+		return alt, altInfo
+	}
+	return file, info
+}
+
+func openStaticFile(root http.Dir, name string) (http.File, os.FileInfo, error) {
+	var (
+		file http.File
+		info os.FileInfo
+		err  error
+	)
+
+	file, err = root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err = file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
@@ -0,0 +1,160 @@
+package serverconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var tlsCurves = map[string]tls.CurveID{
+	"x25519":         tls.X25519,
+	"p256":           tls.CurveP256,
+	"p384":           tls.CurveP384,
+	"p521":           tls.CurveP521,
+	"x25519mlkem768": tls.X25519MLKEM768,
+}
+
+// HTTPTLSConfig is the TLS policy for the HTTPS listener.  Versions are written as 1.0 through 1.3,
+// CipherSuites use the IANA names known to crypto/tls (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256), and
+// CurvePreferences are X25519, P256, P384, P521, or X25519MLKEM768.  Empty lists leave the Go defaults in
+// place.  TLS 1.3 cipher suites are not configurable in Go and are accepted but have no effect.
+//
+//	http:
+//	  tls:
+//	    minversion: "1.2"
+//	    ciphersuites: [TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384]
+type HTTPTLSConfig struct {
+	MinVersion       string   `yaml:"minversion"`
+	MaxVersion       string   `yaml:"maxversion"`
+	CipherSuites     []string `yaml:"ciphersuites"`
+	CurvePreferences []string `yaml:"curvepreferences"`
+	ALPNProtocols    []string `yaml:"alpnprotocols"`
+	minVersion       uint16
+	maxVersion       uint16
+	cipherSuites     []uint16
+	curves           []tls.CurveID
+}
+
+// Verify maps the names to their crypto/tls values, rejecting any that are unknown.  MinVersion defaults
+// to 1.2.  Insecure cipher suites are allowed with a warning.
+func (cfg *HTTPTLSConfig) Verify() error {
+	var (
+		i      int
+		suites map[string]uint16
+		list   []*tls.CipherSuite
+		id     uint16
+		curve  tls.CurveID
+		ok     bool
+		err    error
+	)
+
+	if len(cfg.MinVersion) == 0 {
+		cfg.MinVersion = "1.2"
+	}
+	cfg.minVersion, err = parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return fmt.Errorf("invalid http tls minversion: %w", err)
+	}
+	cfg.maxVersion = 0
+	if len(cfg.MaxVersion) > 0 {
+		cfg.maxVersion, err = parseTLSVersion(cfg.MaxVersion)
+		if err != nil {
+			return fmt.Errorf("invalid http tls maxversion: %w", err)
+		}
+		if cfg.maxVersion < cfg.minVersion {
+			return fmt.Errorf("http tls maxversion %s is lower than minversion %s", cfg.MaxVersion, cfg.MinVersion)
+		}
+	}
+	if cfg.minVersion < tls.VersionTLS12 {
+		warnf("http tls minversion %s is deprecated; use 1.2 or later", cfg.MinVersion)
+	}
+
+	suites = make(map[string]uint16)
+	list = tls.CipherSuites()
+	for i = 0; i < len(list); i++ {
+		suites[list[i].Name] = list[i].ID
+	}
+	list = tls.InsecureCipherSuites()
+	for i = 0; i < len(list); i++ {
+		suites[list[i].Name] = list[i].ID
+	}
+	cfg.cipherSuites = nil
+	for i = 0; i < len(cfg.CipherSuites); i++ {
+		cfg.CipherSuites[i] = strings.ToUpper(strings.TrimSpace(cfg.CipherSuites[i]))
+		id, ok = suites[cfg.CipherSuites[i]]
+		if !ok {
+			return fmt.Errorf("unknown http tls cipher suite %q", cfg.CipherSuites[i])
+		}
+		if isInsecureCipherSuite(id) {
+			warnf("http tls cipher suite %s is insecure", cfg.CipherSuites[i])
+		}
+		cfg.cipherSuites = append(cfg.cipherSuites, id)
+	}
+
+	cfg.curves = nil
+	for i = 0; i < len(cfg.CurvePreferences); i++ {
+		curve, ok = tlsCurves[strings.ToLower(strings.ReplaceAll(strings.TrimSpace(cfg.CurvePreferences[i]), "-", ""))]
+		if !ok {
+			return fmt.Errorf("unknown http tls curve %q (expected X25519, P256, P384, P521, or X25519MLKEM768)", cfg.CurvePreferences[i])
+		}
+		cfg.curves = append(cfg.curves, curve)
+	}
+
+	for i = 0; i < len(cfg.ALPNProtocols); i++ {
+		if len(cfg.ALPNProtocols[i]) == 0 || len(cfg.ALPNProtocols[i]) > 255 {
+			return fmt.Errorf("invalid http tls alpn protocol %q", cfg.ALPNProtocols[i])
+		}
+	}
+	return nil
+}
+
+// Config returns a tls.Config holding the policy, without any certificates.
+func (cfg HTTPTLSConfig) Config() *tls.Config {
+	var tlsCfg *tls.Config
+
+	tlsCfg = &tls.Config{
+		MinVersion:       cfg.minVersion,
+		MaxVersion:       cfg.maxVersion,
+		CipherSuites:     cfg.cipherSuites,
+		CurvePreferences: cfg.curves,
+		NextProtos:       append([]string(nil), cfg.ALPNProtocols...),
+	}
+	if tlsCfg.MinVersion == 0 {
+		tlsCfg.MinVersion = tls.VersionTLS12
+	}
+	return tlsCfg
+}
+
+func parseTLSVersion(s string) (uint16, error) {
+	var v string
+
+	v = strings.ToLower(strings.TrimSpace(s))
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "tls"), "v")
+	switch strings.TrimSpace(v) {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q (expected 1.0, 1.1, 1.2, or 1.3)", s)
+	}
+}
+
+func isInsecureCipherSuite(id uint16) bool {
+	var (
+		list []*tls.CipherSuite
+		i    int
+	)
+
+	list = tls.InsecureCipherSuites()
+	for i = 0; i < len(list); i++ {
+		if list[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package serverconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// I18nConfig describes the application's translation bundles.  LocalesDir holds one bundle per locale,
+// named for its BCP 47 tag, such as en.json or pt-BR.json.  Format is json (the default) or yaml, which
+// also accepts the .yml extension.  A bundle maps message keys to strings, and may nest mappings, whose keys
+// are then joined with dots.  FallbackLocale, defaulting to en, is used for messages missing from the
+// requested locale.  When Locales is set, each must have a bundle.
+//
+//	i18n:
+//	  localesdir: ./locales
+//	  format: yaml
+//	  fallbacklocale: en
+//	  locales: [en, es, pt-BR]
+type I18nConfig struct {
+	LocalesDir     string   `yaml:"localesdir" env:"LOCALESDIR"`
+	Format         string   `yaml:"format"`
+	FallbackLocale string   `yaml:"fallbacklocale"`
+	Locales        []string `yaml:"locales"`
+	bundles        map[string]map[string]string
+}
+
+// Verify loads and parses every bundle in LocalesDir, checks that FallbackLocale and Locales have bundles,
+// and warns about messages in the fallback bundle that another locale lacks.
+func (cfg *I18nConfig) Verify() error {
+	var (
+		entries  []os.DirEntry
+		exts     []string
+		locales  []string
+		name     string
+		ext      string
+		tag      language.Tag
+		b        []byte
+		messages map[string]string
+		fallback map[string]string
+		missing  int
+		found    bool
+		key      string
+		err      error
+		i        int
+	)
+
+	if len(cfg.LocalesDir) == 0 {
+		return fmt.Errorf("missing i18n localesdir (or LOCALESDIR environment variable)")
+	}
+	cfg.Format = strings.ToLower(strings.TrimSpace(cfg.Format))
+	switch cfg.Format {
+	case "", "json":
+		cfg.Format = "json"
+		exts = []string{".json"}
+	case "yaml", "yml":
+		cfg.Format = "yaml"
+		exts = []string{".yaml", ".yml"}
+	default:
+		return fmt.Errorf("invalid i18n format %q (expected json or yaml)", cfg.Format)
+	}
+	if len(cfg.FallbackLocale) == 0 {
+		cfg.FallbackLocale = "en"
+	}
+
+	entries, err = os.ReadDir(cfg.LocalesDir)
+	if err != nil {
+		return fmt.Errorf("invalid i18n localesdir: %w", err)
+	}
+	cfg.bundles = make(map[string]map[string]string)
+	for i = 0; i < len(entries); i++ {
+		ext = filepath.Ext(entries[i].Name())
+		if entries[i].IsDir() || !containsString(exts, strings.ToLower(ext)) {
+			continue
+		}
+		name = strings.TrimSuffix(entries[i].Name(), ext)
+		tag, err = language.Parse(name)
+		if err != nil {
+			return fmt.Errorf("i18n bundle %s is not named for a locale: %w", entries[i].Name(), err)
+		}
+		b, err = os.ReadFile(filepath.Join(cfg.LocalesDir, entries[i].Name()))
+		if err != nil {
+			return fmt.Errorf("unable to read i18n bundle: %w", err)
+		}
+		messages, err = parseI18nBundle(b, cfg.Format)
+		if err != nil {
+			return fmt.Errorf("unable to parse i18n bundle %s: %w", entries[i].Name(), err)
+		}
+		cfg.bundles[tag.String()] = messages
+	}
+	if len(cfg.bundles) == 0 {
+		return fmt.Errorf("i18n localesdir %s holds no %s bundles", cfg.LocalesDir, cfg.Format)
+	}
+
+	tag, err = language.Parse(cfg.FallbackLocale)
+	if err != nil {
+		return fmt.Errorf("invalid i18n fallbacklocale %q: %w", cfg.FallbackLocale, err)
+	}
+	cfg.FallbackLocale = tag.String()
+	fallback, found = cfg.bundles[cfg.FallbackLocale]
+	if !found {
+		return fmt.Errorf("missing i18n bundle for fallbacklocale %s", cfg.FallbackLocale)
+	}
+	for i = 0; i < len(cfg.Locales); i++ {
+		tag, err = language.Parse(cfg.Locales[i])
+		if err != nil {
+			return fmt.Errorf("invalid i18n locale %q: %w", cfg.Locales[i], err)
+		}
+		cfg.Locales[i] = tag.String()
+		_, found = cfg.bundles[cfg.Locales[i]]
+		if !found {
+			return fmt.Errorf("missing i18n bundle for locale %s", cfg.Locales[i])
+		}
+	}
+
+	locales = cfg.AvailableLocales()
+	for i = 0; i < len(locales); i++ {
+		messages = cfg.bundles[locales[i]]
+		missing = 0
+		for key = range fallback {
+			_, found = messages[key]
+			if !found {
+				missing++
+			}
+		}
+		if missing > 0 {
+			warnf("i18n locale %s is missing %d of the messages in %s", locales[i], missing, cfg.FallbackLocale)
+		}
+	}
+	return nil
+}
+
+// AvailableLocales returns the locales with bundles, sorted.
+func (cfg *I18nConfig) AvailableLocales() []string {
+	var (
+		locales []string
+		locale  string
+	)
+
+	for locale = range cfg.bundles {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Bundle returns the messages for locale, keyed by their dotted names, or nil when there is no bundle.
+func (cfg *I18nConfig) Bundle(locale string) map[string]string {
+	return cfg.bundles[locale]
+}
+
+// Message returns the message key in locale, falling back to FallbackLocale, and reports whether it was
+// found in either.
+func (cfg *I18nConfig) Message(locale, key string) (string, bool) {
+	var (
+		msg   string
+		found bool
+	)
+
+	msg, found = cfg.bundles[locale][key]
+	if !found {
+		msg, found = cfg.bundles[cfg.FallbackLocale][key]
+	}
+	return msg, found
+}
+
+// parseI18nBundle decodes a bundle and flattens nested mappings into dotted keys.
+func parseI18nBundle(b []byte, format string) (map[string]string, error) {
+	var (
+		raw      map[string]any
+		messages map[string]string
+		err      error
+	)
+
+	if format == "yaml" {
+		err = yaml.Unmarshal(b, &raw)
+	} else {
+		err = json.Unmarshal(b, &raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages = make(map[string]string)
+	err = flattenI18nMessages(messages, "", raw)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func flattenI18nMessages(messages map[string]string, prefix string, raw map[string]any) error {
+	var (
+		key   string
+		value any
+		err   error
+	)
+
+	for key, value = range raw {
+		if len(prefix) > 0 {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case string:
+			messages[key] = v
+		case map[string]any:
+			err = flattenI18nMessages(messages, key, v)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s is not a string", key)
+		}
+	}
+	return nil
+}
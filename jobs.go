@@ -0,0 +1,171 @@
+package serverconfig
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// jobParser accepts the robfig/cron syntax: five fields, or six with leading seconds, descriptors such as
+// "@daily" and "@every 1h30m", and a "CRON_TZ=Area/City " prefix for the time zone.
+var jobParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// JobsConfig holds the schedules of the application's background jobs, keyed by job name.  A job is either
+// just its cron expression or a mapping with the schedule and options; see JobConfig.
+//
+//	jobs:
+//	  cleanup: "0 3 * * *"
+//	  report:
+//	    schedule: "CRON_TZ=America/Phoenix 0 7 * * 1-5"
+//	    timeout: 10m
+//	    jitter: 2m
+//	  reindex:
+//	    schedule: "@every 6h"
+//	    enabled: false
+type JobsConfig struct {
+	Jobs map[string]*JobConfig `yaml:",inline"`
+}
+
+// JobConfig is one scheduled job.  Enabled defaults to true.  Timeout bounds each run, with no limit when
+// zero, and each run starts after a random delay of up to Jitter so that replicas do not all fire at once.
+type JobConfig struct {
+	Schedule string        `yaml:"schedule"`
+	Enabled  *bool         `yaml:"enabled"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Jitter   time.Duration `yaml:"jitter"`
+	name     string
+	schedule cron.Schedule
+}
+
+// Verify parses every schedule so that a bad expression is found at startup.
+func (cfg *JobsConfig) Verify() error {
+	var (
+		names []string
+		name  string
+		job   *JobConfig
+		err   error
+		i     int
+	)
+
+	for name = range cfg.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i = 0; i < len(names); i++ {
+		job = cfg.Jobs[names[i]]
+		if job == nil {
+			return fmt.Errorf("job %q has no schedule", names[i])
+		}
+		job.name = names[i]
+		err = job.Verify()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Job returns the named job, or nil when it is not configured.
+func (cfg *JobsConfig) Job(name string) *JobConfig {
+	return cfg.Jobs[name]
+}
+
+// Verify parses Schedule, defaults Enabled to true, and checks Timeout and Jitter.
+func (cfg *JobConfig) Verify() error {
+	var (
+		enabled bool
+		err     error
+	)
+
+	if cfg.Enabled == nil {
+		enabled = true
+		cfg.Enabled = &enabled
+	}
+	if len(cfg.Schedule) == 0 {
+		return fmt.Errorf("job %q has no schedule", cfg.name)
+	}
+	cfg.schedule, err = jobParser.Parse(cfg.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q for job %q: %w", cfg.Schedule, cfg.name, err)
+	}
+	if cfg.Timeout < 0 || cfg.Jitter < 0 {
+		return fmt.Errorf("job %q timeout and jitter cannot be negative", cfg.name)
+	}
+	return nil
+}
+
+// IsEnabled reports whether the job should run.
+func (cfg *JobConfig) IsEnabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
+// Next returns the time of the next run after t, jitter included.
+func (cfg *JobConfig) Next(t time.Time) time.Time {
+	var next time.Time
+
+	next = cfg.schedule.Next(t)
+	if cfg.Jitter > 0 {
+		next = next.Add(rand.N(cfg.Jitter))
+	}
+	return next
+}
+
+// Run calls fn on the job's schedule until ctx is done, and returns at once when the job is disabled.  Each
+// call gets a context bounded by Timeout.  Runs do not overlap; times that pass while fn is running are
+// skipped.  Errors returned by fn are reported as warnings.
+//
+//	go gc.Jobs.Job("cleanup").Run(ctx, cleanup)
+func (cfg *JobConfig) Run(ctx context.Context, fn func(context.Context) error) {
+	var (
+		timer  *time.Timer
+		runCtx context.Context
+		cancel context.CancelFunc
+		err    error
+	)
+
+	if !cfg.IsEnabled() {
+		return
+	}
+	for {
+		timer = time.NewTimer(time.Until(cfg.Next(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		runCtx, cancel = ctx, func() {}
+		if cfg.Timeout > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		}
+		err = fn(runCtx)
+		cancel()
+		if err != nil {
+			warnf("job %s failed: %v", cfg.name, err)
+		}
+	}
+}
+
+// UnmarshalYAML accepts a bare cron expression as well as a mapping.
+func (cfg *JobConfig) UnmarshalYAML(value *yaml.Node) error {
+	type jobConfigYAML JobConfig
+	var (
+		raw jobConfigYAML
+		err error
+	)
+
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&cfg.Schedule)
+	}
+	err = value.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	*cfg = JobConfig(raw)
+	return nil
+}
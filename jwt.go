@@ -0,0 +1,257 @@
+package serverconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	jwtHMACMinLength = map[string]int{
+		"HS256": 32,
+		"HS384": 48,
+		"HS512": 64,
+	}
+	jwtAsymmetricAlgorithms = []string{
+		"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+	}
+)
+
+// JWTConfig holds the settings for signing and verifying JSON Web Tokens.  Algorithm is one of HS256,
+// HS384, HS512, RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512, or EdDSA.  HMAC algorithms
+// use Secret, the others use a PEM PrivateKeyFile for signing and/or a PublicKeyFile for verifying only.
+// PreviousKeys hold retired keys which are still accepted for verification during key rotation.
+//
+//	jwt:
+//	  algorithm: ES256
+//	  privatekeyfile: /etc/acme/jwt.key
+//	  issuer: https://auth.acme.com
+//	  audience: [api]
+//	  accessttl: 15m
+//	  refreshttl: 720h
+//	  previouskeys:
+//	    - publickeyfile: /etc/acme/jwt-2023.pub
+type JWTConfig struct {
+	Algorithm      string           `yaml:"algorithm"`
+	Secret         string           `yaml:"secret" env:"JWTSECRET"`
+	PrivateKeyFile string           `yaml:"privatekeyfile"`
+	PublicKeyFile  string           `yaml:"publickeyfile"`
+	Issuer         string           `yaml:"issuer"`
+	Audience       []string         `yaml:"audience"`
+	AccessTTL      time.Duration    `yaml:"accessttl"`
+	RefreshTTL     time.Duration    `yaml:"refreshttl"`
+	PreviousKeys   []JWTPreviousKey `yaml:"previouskeys"`
+	signingKey     any
+	verifyKeys     []any
+}
+
+// JWTPreviousKey is a retired key, given as an HMAC secret or a public key file depending on the algorithm.
+type JWTPreviousKey struct {
+	Secret        string `yaml:"secret"`
+	PublicKeyFile string `yaml:"publickeyfile"`
+}
+
+// Verify checks the algorithm and loads the keys, rejecting HMAC secrets shorter than the hash size and keys
+// of the wrong type for the algorithm.  AccessTTL defaults to 15 minutes and RefreshTTL to 30 days.
+func (cfg *JWTConfig) Verify() error {
+	var (
+		minLen int
+		isHMAC bool
+		signer crypto.Signer
+		public any
+		err    error
+		i      int
+	)
+
+	cfg.Algorithm = strings.TrimSpace(cfg.Algorithm)
+	if strings.EqualFold(cfg.Algorithm, "eddsa") {
+		cfg.Algorithm = "EdDSA"
+	} else {
+		cfg.Algorithm = strings.ToUpper(cfg.Algorithm)
+	}
+	minLen, isHMAC = jwtHMACMinLength[cfg.Algorithm]
+	cfg.signingKey = nil
+	cfg.verifyKeys = nil
+
+	if isHMAC {
+		if len(cfg.PrivateKeyFile) > 0 || len(cfg.PublicKeyFile) > 0 {
+			return fmt.Errorf("JWT %s uses a secret, not key files", cfg.Algorithm)
+		}
+		if len(cfg.Secret) == 0 {
+			return fmt.Errorf("missing JWT secret (or JWTSECRET environment variable)")
+		}
+		if len(cfg.Secret) < minLen {
+			return fmt.Errorf("JWT secret for %s must be at least %d bytes, got %d", cfg.Algorithm, minLen, len(cfg.Secret))
+		}
+		cfg.signingKey = []byte(cfg.Secret)
+		cfg.verifyKeys = append(cfg.verifyKeys, []byte(cfg.Secret))
+		for i = 0; i < len(cfg.PreviousKeys); i++ {
+			if len(cfg.PreviousKeys[i].Secret) < minLen {
+				return fmt.Errorf("JWT previouskeys[%d] secret must be at least %d bytes", i, minLen)
+			}
+			cfg.verifyKeys = append(cfg.verifyKeys, []byte(cfg.PreviousKeys[i].Secret))
+		}
+	} else {
+		if len(cfg.Algorithm) == 0 {
+			return fmt.Errorf("missing JWT algorithm")
+		}
+		if !containsString(jwtAsymmetricAlgorithms, cfg.Algorithm) {
+			return fmt.Errorf("invalid JWT algorithm %q", cfg.Algorithm)
+		}
+		if len(cfg.Secret) > 0 {
+			return fmt.Errorf("JWT %s uses key files, not a secret", cfg.Algorithm)
+		}
+		switch {
+		case len(cfg.PrivateKeyFile) > 0:
+			signer, err = readPrivateKeyFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return fmt.Errorf("JWT privatekeyfile: %w", err)
+			}
+			cfg.signingKey = signer
+			public = signer.Public()
+		case len(cfg.PublicKeyFile) > 0:
+			public, err = readPublicKeyFile(cfg.PublicKeyFile)
+			if err != nil {
+				return fmt.Errorf("JWT publickeyfile: %w", err)
+			}
+		default:
+			return fmt.Errorf("JWT %s requires privatekeyfile or publickeyfile", cfg.Algorithm)
+		}
+		err = checkJWTKeyType(cfg.Algorithm, public)
+		if err != nil {
+			return err
+		}
+		cfg.verifyKeys = append(cfg.verifyKeys, public)
+		for i = 0; i < len(cfg.PreviousKeys); i++ {
+			public, err = readPublicKeyFile(cfg.PreviousKeys[i].PublicKeyFile)
+			if err != nil {
+				return fmt.Errorf("JWT previouskeys[%d]: %w", i, err)
+			}
+			err = checkJWTKeyType(cfg.Algorithm, public)
+			if err != nil {
+				return fmt.Errorf("JWT previouskeys[%d]: %w", i, err)
+			}
+			cfg.verifyKeys = append(cfg.verifyKeys, public)
+		}
+	}
+
+	if cfg.AccessTTL < 0 || cfg.RefreshTTL < 0 {
+		return fmt.Errorf("JWT TTLs cannot be negative")
+	}
+	if cfg.AccessTTL == 0 {
+		cfg.AccessTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTTL == 0 {
+		cfg.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if cfg.RefreshTTL < cfg.AccessTTL {
+		return fmt.Errorf("JWT refreshttl (%s) is shorter than accessttl (%s)", cfg.RefreshTTL, cfg.AccessTTL)
+	}
+	return nil
+}
+
+// SigningKey returns the key for signing tokens: a []byte for HMAC algorithms or a crypto.Signer otherwise.
+// It is nil when only a public key was configured.
+func (cfg JWTConfig) SigningKey() any {
+	return cfg.signingKey
+}
+
+// VerificationKeys returns the keys accepted when verifying tokens, current key first followed by the
+// previous keys: []byte secrets for HMAC algorithms, otherwise public keys.
+func (cfg JWTConfig) VerificationKeys() []any {
+	return cfg.verifyKeys
+}
+
+func checkJWTKeyType(alg string, public any) error {
+	var (
+		curve elliptic.Curve
+		ecKey *ecdsa.PublicKey
+		ok    bool
+	)
+
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		_, ok = public.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT %s requires an RSA key, got %T", alg, public)
+		}
+		return nil
+	case "EdDSA":
+		_, ok = public.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT EdDSA requires an Ed25519 key, got %T", public)
+		}
+		return nil
+	case "ES256":
+		curve = elliptic.P256()
+	case "ES384":
+		curve = elliptic.P384()
+	case "ES512":
+		curve = elliptic.P521()
+	default:
+		return fmt.Errorf("invalid JWT algorithm %q", alg)
+	}
+
+	ecKey, ok = public.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != curve {
+		return fmt.Errorf("JWT %s requires an ECDSA %s key", alg, curve.Params().Name)
+	}
+	return nil
+}
+
+func readPrivateKeyFile(filename string) (crypto.Signer, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	data, err = os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKeyPEM(data)
+}
+
+// readPublicKeyFile reads a PEM encoded PKIX public key, PKCS#1 RSA public key, or certificate.
+func readPublicKeyFile(filename string) (any, error) {
+	var (
+		data  []byte
+		block *pem.Block
+		cert  *x509.Certificate
+		err   error
+	)
+
+	if len(filename) == 0 {
+		return nil, fmt.Errorf("missing public key file")
+	}
+	data, err = os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q in %s", block.Type, filename)
+	}
+}
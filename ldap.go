@@ -0,0 +1,256 @@
+package serverconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// LDAPConfig holds the settings for authenticating against LDAP or Active Directory.  URL uses the ldap://
+// or ldaps:// scheme; StartTLS upgrades a plain ldap:// connection.  UserFilter must contain one or more %s,
+// each replaced by the escaped user name in UserFilterFor, and GroupFilter, if given, may contain a %s for
+// the user's DN.
+//
+//	ldap:
+//	  url: ldaps://dc1.corp.example.com:636
+//	  binddn: CN=svc-app,OU=Service Accounts,DC=corp,DC=example,DC=com
+//	  basedn: DC=corp,DC=example,DC=com
+//	  userfilter: (&(objectClass=user)(sAMAccountName=%s))
+//	  groupfilter: (&(objectClass=group)(member=%s))
+//	  cafile: /etc/ssl/corp-ca.pem
+type LDAPConfig struct {
+	URL           string `yaml:"url" env:"LDAPURL"`
+	BindDN        string `yaml:"binddn" env:"LDAPBINDDN"`
+	BindPassword  string `yaml:"bindpassword" env:"LDAPBINDPASS"`
+	BaseDN        string `yaml:"basedn"`
+	UserFilter    string `yaml:"userfilter"`
+	GroupFilter   string `yaml:"groupfilter"`
+	CAFile        string `yaml:"cafile"`
+	StartTLS      bool   `yaml:"starttls"`
+	SkipTLSVerify bool   `yaml:"skiptlsverify"`
+	caPool        *x509.CertPool
+	host          string
+}
+
+// Verify checks the URL scheme, the DNs, and the filter syntax, and loads the CA file if given.
+func (cfg *LDAPConfig) Verify() error {
+	var (
+		u   *url.URL
+		pem []byte
+		err error
+	)
+
+	if len(cfg.URL) == 0 {
+		return fmt.Errorf("missing LDAP url (or LDAPURL environment variable)")
+	}
+	u, err = validateURL(cfg.URL, "ldap", "ldaps")
+	if err != nil {
+		return fmt.Errorf("invalid LDAP url: %w", err)
+	}
+	cfg.host = u.Hostname()
+	if u.Scheme == "ldaps" && cfg.StartTLS {
+		return fmt.Errorf("LDAP starttls cannot be used with an ldaps:// url")
+	}
+	if u.Scheme == "ldap" && !cfg.StartTLS {
+		warnf("LDAP connection to %s is not encrypted, consider ldaps:// or starttls", u.Host)
+	}
+
+	if len(cfg.BindDN) > 0 {
+		err = validateDN(cfg.BindDN)
+		if err != nil {
+			return fmt.Errorf("invalid LDAP binddn: %w", err)
+		}
+		if len(cfg.BindPassword) == 0 {
+			return fmt.Errorf("missing LDAP bindpassword (or LDAPBINDPASS environment variable)")
+		}
+	}
+	if len(cfg.BaseDN) == 0 {
+		return fmt.Errorf("missing LDAP basedn")
+	}
+	err = validateDN(cfg.BaseDN)
+	if err != nil {
+		return fmt.Errorf("invalid LDAP basedn: %w", err)
+	}
+
+	if len(cfg.UserFilter) == 0 {
+		return fmt.Errorf("missing LDAP userfilter")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return fmt.Errorf("LDAP userfilter must contain %%s for the user name")
+	}
+	err = validateLDAPFilter(strings.ReplaceAll(cfg.UserFilter, "%s", "x"))
+	if err != nil {
+		return fmt.Errorf("invalid LDAP userfilter: %w", err)
+	}
+	if len(cfg.GroupFilter) > 0 {
+		err = validateLDAPFilter(strings.ReplaceAll(cfg.GroupFilter, "%s", "x"))
+		if err != nil {
+			return fmt.Errorf("invalid LDAP groupfilter: %w", err)
+		}
+	}
+
+	if len(cfg.CAFile) > 0 {
+		pem, err = os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read LDAP cafile: %w", err)
+		}
+		cfg.caPool = x509.NewCertPool()
+		if !cfg.caPool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("LDAP cafile %s contains no PEM certificates", cfg.CAFile)
+		}
+	}
+	return nil
+}
+
+// UserFilterFor returns UserFilter with each %s replaced by name, escaped as RFC 4515 requires so that the
+// name cannot change the filter.
+//
+//	filter := gc.LDAP.UserFilterFor(username)
+//	req := ldap.NewSearchRequest(gc.LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false, filter, nil, nil)
+func (cfg LDAPConfig) UserFilterFor(name string) string {
+	return strings.ReplaceAll(cfg.UserFilter, "%s", escapeLDAPFilter(name))
+}
+
+// escapeLDAPFilter escapes the characters with a meaning in a filter value, NUL, and non-ASCII bytes as \XX,
+// as ldap.EscapeFilter does.
+func escapeLDAPFilter(s string) string {
+	var (
+		b strings.Builder
+		c byte
+		i int
+	)
+
+	for i = 0; i < len(s); i++ {
+		c = s[i]
+		if c == '(' || c == ')' || c == '*' || c == '\\' || c == 0 || c > 0x7f {
+			_, _ = fmt.Fprintf(&b, "\\%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// TLSConfig returns the TLS settings for connecting to the LDAP server, using the CA file if one was
+// given and the system roots otherwise.
+func (cfg LDAPConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         cfg.host,
+		RootCAs:            cfg.caPool,
+		InsecureSkipVerify: cfg.SkipTLSVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// validateDN performs a basic syntax check of a distinguished name: a comma separated list of
+// attribute=value pairs.  Escaped commas are allowed in values.
+func validateDN(dn string) error {
+	var (
+		rdns []string
+		i    int
+		eq   int
+	)
+
+	rdns = splitUnescaped(dn, ',')
+	for i = 0; i < len(rdns); i++ {
+		eq = strings.IndexByte(rdns[i], '=')
+		if eq <= 0 || len(strings.TrimSpace(rdns[i][:eq])) == 0 || eq == len(rdns[i])-1 {
+			return fmt.Errorf("%q is not of the form attribute=value", strings.TrimSpace(rdns[i]))
+		}
+	}
+	return nil
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	var (
+		parts []string
+		start int
+		i     int
+	)
+
+	for i = 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// validateLDAPFilter checks filter syntax per RFC 4515: a parenthesised item, or a parenthesised &, |, or !
+// followed by nested filters.
+func validateLDAPFilter(filter string) error {
+	var (
+		n   int
+		err error
+	)
+
+	n, err = parseLDAPFilter(filter, 0)
+	if err != nil {
+		return err
+	}
+	if n != len(filter) {
+		return fmt.Errorf("unexpected text %q after filter", filter[n:])
+	}
+	return nil
+}
+
+func parseLDAPFilter(f string, pos int) (int, error) {
+	var (
+		end   int
+		item  string
+		op    int
+		count int
+		err   error
+	)
+
+	if pos >= len(f) || f[pos] != '(' {
+		return pos, fmt.Errorf("expected '(' at position %d", pos)
+	}
+	pos++
+	if pos >= len(f) {
+		return pos, fmt.Errorf("unexpected end of filter")
+	}
+
+	switch f[pos] {
+	case '&', '|', '!':
+		op = int(f[pos])
+		pos++
+		for pos < len(f) && f[pos] == '(' {
+			pos, err = parseLDAPFilter(f, pos)
+			if err != nil {
+				return pos, err
+			}
+			count++
+		}
+		if count == 0 || (op == '!' && count != 1) {
+			return pos, fmt.Errorf("invalid filter list at position %d", pos)
+		}
+	default:
+		end = pos
+		for end < len(f) && f[end] != ')' {
+			if f[end] == '(' {
+				return end, fmt.Errorf("unescaped '(' at position %d", end)
+			}
+			end++
+		}
+		item = f[pos:end]
+		op = strings.IndexByte(item, '=')
+		if op <= 0 || (op == 1 && strings.ContainsAny(item[:1], "~<>")) {
+			return pos, fmt.Errorf("invalid filter item %q", item)
+		}
+		pos = end
+	}
+
+	if pos >= len(f) || f[pos] != ')' {
+		return pos, fmt.Errorf("expected ')' at position %d", pos)
+	}
+	return pos + 1, nil
+}
@@ -0,0 +1,246 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HTTPUnixSocketConfig sets the permissions of unix domain sockets created for a "unix:/path" bindaddr or
+// sslbindaddr.  Mode is an octal string such as "0660"; Owner and Group are names or numeric ids.  Empty
+// values leave the socket as created by the process.
+//
+//	http:
+//	  bindaddr: unix:/run/app/http.sock
+//	  unixsocket:
+//	    mode: "0660"
+//	    group: www-data
+type HTTPUnixSocketConfig struct {
+	Mode  string `yaml:"mode"`
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+	mode  os.FileMode
+	uid   int
+	gid   int
+}
+
+// Verify parses Mode and looks up Owner and Group.
+func (cfg *HTTPUnixSocketConfig) Verify() error {
+	var (
+		mode uint64
+		u    *user.User
+		g    *user.Group
+		err  error
+	)
+
+	cfg.mode, cfg.uid, cfg.gid = 0, -1, -1
+	if len(cfg.Mode) > 0 {
+		mode, err = strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil || mode > 0o777 {
+			return fmt.Errorf("invalid unixsocket mode %q (expected octal permissions such as 0660)", cfg.Mode)
+		}
+		cfg.mode = os.FileMode(mode)
+	}
+	if len(cfg.Owner) > 0 {
+		cfg.uid, err = strconv.Atoi(cfg.Owner)
+		if err != nil {
+			u, err = user.Lookup(cfg.Owner)
+			if err != nil {
+				return fmt.Errorf("invalid unixsocket owner: %w", err)
+			}
+			cfg.uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if len(cfg.Group) > 0 {
+		cfg.gid, err = strconv.Atoi(cfg.Group)
+		if err != nil {
+			g, err = user.LookupGroup(cfg.Group)
+			if err != nil {
+				return fmt.Errorf("invalid unixsocket group: %w", err)
+			}
+			cfg.gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return nil
+}
+
+// verifyBindAddr checks a bindaddr or sslbindaddr value, which is host:port, "unix:/path/to.sock", or
+// "systemd" / "systemd:name" to use a listener passed in by systemd socket activation.  The name matches
+// FileDescriptorName= in the socket unit; a bare "systemd" takes the first listener, and "systemd:N" the
+// Nth, counting from 0.
+func verifyBindAddr(key, addr string) error {
+	var (
+		network string
+		address string
+		err     error
+	)
+
+	if len(addr) == 0 {
+		return nil
+	}
+	network, address = splitBindAddr(addr)
+	switch network {
+	case "unix":
+		if len(address) == 0 {
+			return fmt.Errorf("%s %q is missing the socket path", key, addr)
+		}
+	case "systemd":
+		_, err = systemdListenerIndex(address)
+		if err != nil {
+			return fmt.Errorf("%s %q: %w", key, addr, err)
+		}
+	default:
+		err = validateHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// splitBindAddr returns the network ("tcp", "unix", or "systemd") and address of a bindaddr value.
+func splitBindAddr(addr string) (string, string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", addr[len("unix:"):]
+	}
+	if addr == "systemd" || strings.HasPrefix(addr, "systemd:") {
+		return "systemd", strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":")
+	}
+	return "tcp", addr
+}
+
+// Listen opens a listener for a bindaddr or sslbindaddr value.  A stale unix socket left by a previous run
+// is removed before listening, and the UnixSocket permissions are applied to the new one.
+//
+//	ln, err := gc.HTTP.Listen(gc.HTTP.BindAddr)
+//	go srv.Serve(ln)
+func (cfg *HTTPConfig) Listen(addr string) (net.Listener, error) {
+	var (
+		network string
+		address string
+		ln      net.Listener
+		info    os.FileInfo
+		err     error
+	)
+
+	network, address = splitBindAddr(addr)
+	switch network {
+	case "systemd":
+		return systemdListener(address)
+	case "unix":
+		info, err = os.Lstat(address)
+		if err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+		ln, err = net.Listen("unix", address)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.UnixSocket.apply(address)
+		if err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	default:
+		return net.Listen("tcp", address)
+	}
+}
+
+func (cfg *HTTPUnixSocketConfig) apply(path string) error {
+	var err error
+
+	if cfg.mode != 0 {
+		err = os.Chmod(path, cfg.mode)
+		if err != nil {
+			return fmt.Errorf("unable to set unix socket mode: %w", err)
+		}
+	}
+	if cfg.uid >= 0 || cfg.gid >= 0 {
+		err = os.Chown(path, cfg.uid, cfg.gid)
+		if err != nil {
+			return fmt.Errorf("unable to set unix socket owner: %w", err)
+		}
+	}
+	return nil
+}
+
+// systemd passes activated sockets as file descriptors starting at 3, see sd_listen_fds(3).
+const systemdListenFDStart = 3
+
+var systemdListeners struct {
+	sync.Mutex
+	taken map[int]bool
+}
+
+// systemdListenerIndex finds the descriptor index for name in LISTEN_FDNAMES, or parses name as an index.
+func systemdListenerIndex(name string) (int, error) {
+	var (
+		pid   int
+		count int
+		names []string
+		i     int
+		err   error
+	)
+
+	pid, err = strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0, fmt.Errorf("no systemd socket activation for this process (LISTEN_PID)")
+	}
+	count, err = strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("no sockets passed by systemd (LISTEN_FDS)")
+	}
+	if len(name) == 0 {
+		return 0, nil
+	}
+	i, err = strconv.Atoi(name)
+	if err == nil {
+		if i < 0 || i >= count {
+			return 0, fmt.Errorf("systemd socket %d out of range (LISTEN_FDS=%d)", i, count)
+		}
+		return i, nil
+	}
+	names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i = 0; i < len(names) && i < count; i++ {
+		if names[i] == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no systemd socket named %q (LISTEN_FDNAMES)", name)
+}
+
+// systemdListener returns the activated socket for name.  Each descriptor can be taken only once.
+func systemdListener(name string) (net.Listener, error) {
+	var (
+		i    int
+		file *os.File
+		ln   net.Listener
+		err  error
+	)
+
+	i, err = systemdListenerIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	systemdListeners.Lock()
+	defer systemdListeners.Unlock()
+	if systemdListeners.taken[i] {
+		return nil, fmt.Errorf("systemd socket %q is already in use", name)
+	}
+	file = os.NewFile(uintptr(systemdListenFDStart+i), "systemd:"+name)
+	ln, err = net.FileListener(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket %q: %w", name, err)
+	}
+	if systemdListeners.taken == nil {
+		systemdListeners.taken = make(map[int]bool)
+	}
+	systemdListeners.taken[i] = true
+	return ln, nil
+}
@@ -0,0 +1,132 @@
+package serverconfig
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ToZapConfig returns a zap.Config built from Level, Handler, Output, and AddSource, starting from zap's
+// production settings without zap's sampler; pass ZapOptions to Build to apply the Sampling section.  The
+// text handler maps to zap's console encoding.  Zap opens file output itself, so the file is not rotated; to
+// keep rotation, build the core around File.Writer instead.  The syslog, eventlog, journald, gelf, and loki
+// outputs have no zap equivalent and return an error.
+//
+//	zc, err := gc.Logging.ToZapConfig()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	logger, err := zc.Build(gc.Logging.ZapOptions()...)
+func (cfg *LoggingConfig) ToZapConfig() (zap.Config, error) {
+	var zc zap.Config
+
+	zc = zap.NewProductionConfig()
+	zc.Level = zap.NewAtomicLevelAt(zapLevel(cfg.level))
+	zc.DisableCaller = !cfg.AddSource
+	zc.Sampling = nil
+	if cfg.Handler == "text" {
+		zc.Encoding = "console"
+	}
+	switch cfg.Output {
+	case "", "stderr":
+		zc.OutputPaths = []string{"stderr"}
+	case "stdout":
+		zc.OutputPaths = []string{"stdout"}
+	case "file":
+		zc.OutputPaths = []string{cfg.File.Path}
+	default:
+		return zc, fmt.Errorf("logging output %s is not supported by zap", cfg.Output)
+	}
+	return zc, nil
+}
+
+// ZerologOptions holds what is needed to build a zerolog.Logger from the logging section.  Caller reports
+// whether AddSource is set, in which case the logger should be built with Caller().
+//
+//	zo, err := gc.Logging.ToZerologOptions()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	ctx := zerolog.New(zo.Writer).Level(zo.Level).With().Timestamp()
+//	if zo.Caller {
+//		ctx = ctx.Caller()
+//	}
+//	logger := ctx.Logger()
+type ZerologOptions struct {
+	Level  zerolog.Level
+	Writer io.Writer
+	Caller bool
+}
+
+// ToZerologOptions returns the zerolog level and writer for the configured output.  The text handler maps
+// to zerolog's ConsoleWriter without colors.  Files are rotated as for NewSlogLogger, syslog records are sent
+// at the severity matching their level, and journald output uses zerolog's journald writer.  The eventlog,
+// gelf, and loki outputs have no zerolog equivalent and return an error.
+func (cfg *LoggingConfig) ToZerologOptions() (ZerologOptions, error) {
+	var (
+		zo  ZerologOptions
+		w   io.Writer
+		err error
+	)
+
+	zo.Level = zerologLevel(cfg.level)
+	zo.Caller = cfg.AddSource
+	switch cfg.Output {
+	case "", "stderr":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		w = cfg.File.Writer()
+	case "syslog", "eventlog":
+		zo.Writer, err = cfg.systemLogZerologWriter()
+		if err != nil {
+			return zo, err
+		}
+		return zo, nil
+	case "journald":
+		zo.Writer, err = journaldZerologWriter()
+		if err != nil {
+			return zo, err
+		}
+		return zo, nil
+	default:
+		return zo, fmt.Errorf("logging output %s is not supported by zerolog", cfg.Output)
+	}
+	if cfg.Handler == "text" {
+		w = zerolog.ConsoleWriter{Out: w, NoColor: true}
+	}
+	zo.Writer = w
+	return zo, nil
+}
+
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zapcore.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zapcore.WarnLevel
+	case level >= slog.LevelInfo:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
+
+func zerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zerolog.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zerolog.WarnLevel
+	case level >= slog.LevelInfo:
+		return zerolog.InfoLevel
+	default:
+		return zerolog.DebugLevel
+	}
+}
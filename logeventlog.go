@@ -0,0 +1,28 @@
+package serverconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoggingEventLogConfig names the Windows event log source written by the eventlog output, which is what
+// SyslogEnabled selects on Windows.  Source defaults to the program name without its extension.  Windows
+// shows the messages in full only when the source is registered, which needs administrator rights and is
+// normally done by the installer, for example with eventcreate or eventlog.InstallAsEventCreate.
+//
+//	logging:
+//	  output: eventlog
+//	  eventlog:
+//	    source: billing
+type LoggingEventLogConfig struct {
+	Source string `yaml:"source"`
+}
+
+// Verify defaults Source.
+func (cfg *LoggingEventLogConfig) Verify() error {
+	if len(cfg.Source) == 0 {
+		cfg.Source = strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// systemLogOutput is the logging output selected by SyslogEnabled on this platform.
+const systemLogOutput = "eventlog"
+
+// eventLogEventID is the event id of every entry.  Sources registered with eventcreate accept ids 1 to 1000.
+const eventLogEventID = 1
+
+// systemLogHandler returns the slog handler for the eventlog output.
+func (cfg *LoggingConfig) systemLogHandler(opts *slog.HandlerOptions) (slog.Handler, error) {
+	var (
+		el  *eventlog.Log
+		h   *eventLogHandler
+		err error
+	)
+
+	el, err = eventlog.Open(cfg.EventLog.Source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the windows event log: %w", err)
+	}
+	h = &eventLogHandler{log: el, mu: &sync.Mutex{}, buf: &bytes.Buffer{}}
+	h.inner = newLineHandler(h.buf, cfg.Handler, opts)
+	return h, nil
+}
+
+// systemLogZerologWriter reports that zerolog has no event log writer.
+func (cfg *LoggingConfig) systemLogZerologWriter() (io.Writer, error) {
+	return nil, fmt.Errorf("logging output eventlog is not supported by zerolog")
+}
+
+// eventLogHandler formats records with a text or JSON handler and reports each one to the event log as an
+// error, warning, or information entry matching its level.
+type eventLogHandler struct {
+	log   *eventlog.Log
+	mu    *sync.Mutex
+	buf   *bytes.Buffer
+	inner slog.Handler
+}
+
+func (h *eventLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *eventLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		msg string
+		err error
+	)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	err = h.inner.Handle(ctx, r)
+	if err != nil {
+		return err
+	}
+	msg = strings.TrimSuffix(h.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.log.Error(eventLogEventID, msg)
+	case r.Level >= slog.LevelWarn:
+		return h.log.Warning(eventLogEventID, msg)
+	default:
+		return h.log.Info(eventLogEventID, msg)
+	}
+}
+
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &eventLogHandler{log: h.log, mu: h.mu, buf: h.buf, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	return &eventLogHandler{log: h.log, mu: h.mu, buf: h.buf, inner: h.inner.WithGroup(name)}
+}
+
+// journaldZerologWriter reports that zerolog's journald writer is not available on Windows.
+func journaldZerologWriter() (io.Writer, error) {
+	return nil, fmt.Errorf("logging output journald is not supported by zerolog on windows")
+}
@@ -0,0 +1,26 @@
+package serverconfig
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoggingEventLogDefaults(t *testing.T) {
+	var (
+		cfg LoggingConfig
+		err error
+	)
+
+	cfg = LoggingConfig{SyslogEnabled: true}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Output != "eventlog" {
+		t.Fatalf("expected syslog_enabled to select the eventlog output, got %q (%v)", cfg.Output, err)
+	}
+	err = cfg.EventLog.Verify()
+	if !errors.Is(err, nil) || len(cfg.EventLog.Source) == 0 {
+		t.Fatalf("expected a default event log source, got %q (%v)", cfg.EventLog.Source, err)
+	}
+
+	cfg = LoggingConfig{Output: "syslog"}
+	checkError(t, cfg.Verify(), "logging output syslog is not available on windows")
+}
@@ -0,0 +1,354 @@
+package serverconfig
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gelfChunkSize is the largest UDP datagram sent; bigger messages are split into GELF chunks.
+const (
+	gelfChunkSize = 8192
+	gelfMaxChunks = 128
+)
+
+// LoggingGELFConfig sends logs straight to Graylog in GELF format.  Protocol is udp (the default) or tcp;
+// Compression (gzip, the default, zlib, or none) applies to udp only, since GELF over tcp cannot be
+// compressed.  Fields are static additional fields added to every message, and Host defaults to the
+// host name.
+//
+//	logging:
+//	  output: gelf
+//	  gelf:
+//	    address: graylog.internal:12201
+//	    fields:
+//	      environment: production
+type LoggingGELFConfig struct {
+	Address     string            `yaml:"address" env:"GELFADDRESS"`
+	Protocol    string            `yaml:"protocol"`
+	Compression string            `yaml:"compression"`
+	Host        string            `yaml:"host"`
+	Fields      map[string]string `yaml:"fields"`
+}
+
+// Verify checks the settings when Address is set, adding the default port 12201.
+func (cfg *LoggingGELFConfig) Verify() error {
+	var (
+		name string
+		err  error
+	)
+
+	if len(cfg.Address) == 0 {
+		return nil
+	}
+	_, _, err = net.SplitHostPort(cfg.Address)
+	if err != nil {
+		cfg.Address = net.JoinHostPort(cfg.Address, "12201")
+	}
+	err = validateHostPort(cfg.Address)
+	if err != nil {
+		return fmt.Errorf("invalid logging gelf address: %w", err)
+	}
+	cfg.Protocol = strings.ToLower(strings.TrimSpace(cfg.Protocol))
+	if len(cfg.Protocol) == 0 {
+		cfg.Protocol = "udp"
+	}
+	if cfg.Protocol != "udp" && cfg.Protocol != "tcp" {
+		return fmt.Errorf("invalid logging gelf protocol %q (expected udp or tcp)", cfg.Protocol)
+	}
+	cfg.Compression = strings.ToLower(strings.TrimSpace(cfg.Compression))
+	if len(cfg.Compression) == 0 {
+		cfg.Compression = "gzip"
+		if cfg.Protocol == "tcp" {
+			cfg.Compression = "none"
+		}
+	}
+	switch cfg.Compression {
+	case "gzip", "zlib", "none":
+	default:
+		return fmt.Errorf("invalid logging gelf compression %q (expected gzip, zlib, or none)", cfg.Compression)
+	}
+	if cfg.Protocol == "tcp" && cfg.Compression != "none" {
+		return fmt.Errorf("logging gelf compression is not supported over tcp")
+	}
+	if len(cfg.Host) == 0 {
+		cfg.Host, _ = os.Hostname()
+	}
+	for name = range cfg.Fields {
+		if !isGELFFieldName(name) || name == "id" {
+			return fmt.Errorf("invalid logging gelf field name %q", name)
+		}
+	}
+	return nil
+}
+
+// Handler returns a slog.Handler sending each record to Graylog.  Record attributes become additional
+// fields, with groups joined by underscores, and the level is mapped to a syslog severity.
+func (cfg *LoggingGELFConfig) Handler(opts *slog.HandlerOptions) slog.Handler {
+	var (
+		fields map[string]any
+		name   string
+	)
+
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	fields = make(map[string]any, len(cfg.Fields))
+	for name = range cfg.Fields {
+		fields["_"+name] = cfg.Fields[name]
+	}
+	return &gelfHandler{
+		opts:   *opts,
+		host:   cfg.Host,
+		fields: fields,
+		w:      &gelfWriter{network: cfg.Protocol, address: cfg.Address, compression: cfg.Compression},
+	}
+}
+
+type gelfHandler struct {
+	opts   slog.HandlerOptions
+	host   string
+	fields map[string]any
+	prefix string
+	w      *gelfWriter
+}
+
+func (h *gelfHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	var minLevel slog.Level
+
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *gelfHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		msg     map[string]any
+		name    string
+		frame   slog.Source
+		payload []byte
+		err     error
+	)
+
+	msg = make(map[string]any, len(h.fields)+r.NumAttrs()+8)
+	for name = range h.fields {
+		msg[name] = h.fields[name]
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addGELFField(msg, h.prefix, a)
+		return true
+	})
+	msg["version"] = "1.1"
+	msg["host"] = h.host
+	msg["short_message"] = r.Message
+	msg["level"] = slogSyslogSeverity(r.Level)
+	if !r.Time.IsZero() {
+		msg["timestamp"] = float64(r.Time.UnixMicro()) / 1e6
+	}
+	if h.opts.AddSource && r.PC != 0 {
+		frame = *r.Source()
+		msg["_file"] = frame.File
+		msg["_line"] = frame.Line
+		msg["_function"] = frame.Function
+	}
+
+	payload, err = json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return h.w.send(payload)
+}
+
+func (h *gelfHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var (
+		fields map[string]any
+		name   string
+		i      int
+	)
+
+	fields = make(map[string]any, len(h.fields)+len(attrs))
+	for name = range h.fields {
+		fields[name] = h.fields[name]
+	}
+	for i = 0; i < len(attrs); i++ {
+		addGELFField(fields, h.prefix, attrs[i])
+	}
+	return &gelfHandler{opts: h.opts, host: h.host, fields: fields, prefix: h.prefix, w: h.w}
+}
+
+func (h *gelfHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	return &gelfHandler{opts: h.opts, host: h.host, fields: h.fields, prefix: h.prefix + name + "_", w: h.w}
+}
+
+// addGELFField stores a as an additional field, flattening groups.
+func addGELFField(fields map[string]any, prefix string, a slog.Attr) {
+	var (
+		group []slog.Attr
+		key   string
+		i     int
+	)
+
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		group = a.Value.Group()
+		if len(a.Key) > 0 {
+			prefix += a.Key + "_"
+		}
+		for i = 0; i < len(group); i++ {
+			addGELFField(fields, prefix, group[i])
+		}
+		return
+	}
+	if len(a.Key) == 0 {
+		return
+	}
+	key = gelfFieldName(prefix + a.Key)
+	if key == "id" {
+		key = "id_"
+	}
+	switch a.Value.Kind() {
+	case slog.KindInt64:
+		fields["_"+key] = a.Value.Int64()
+	case slog.KindUint64:
+		fields["_"+key] = a.Value.Uint64()
+	case slog.KindFloat64:
+		fields["_"+key] = a.Value.Float64()
+	default:
+		fields["_"+key] = a.Value.String()
+	}
+}
+
+// gelfFieldName replaces characters GELF does not allow in field names with underscores.
+func gelfFieldName(key string) string {
+	var (
+		b []byte
+		i int
+	)
+
+	b = []byte(key)
+	for i = 0; i < len(b); i++ {
+		if !isGELFFieldChar(b[i]) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func isGELFFieldName(name string) bool {
+	return len(name) > 0 && gelfFieldName(name) == name
+}
+
+func isGELFFieldChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+// slogSyslogSeverity maps a slog level onto the syslog severities.
+func slogSyslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// gelfWriter sends GELF payloads, compressing and chunking them over udp and null-terminating them over
+// tcp.  The connection is opened on first use and reopened after a write error.
+type gelfWriter struct {
+	network     string
+	address     string
+	compression string
+	mu          sync.Mutex
+	conn        net.Conn
+}
+
+func (w *gelfWriter) send(payload []byte) error {
+	var (
+		buf bytes.Buffer
+		zw  io.WriteCloser
+		err error
+	)
+
+	switch w.compression {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "zlib":
+		zw = zlib.NewWriter(&buf)
+	}
+	if zw != nil {
+		_, _ = zw.Write(payload)
+		_ = zw.Close()
+		payload = buf.Bytes()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		w.conn, err = net.DialTimeout(w.network, w.address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("unable to connect to gelf server: %w", err)
+		}
+	}
+	if w.network == "tcp" {
+		_, err = w.conn.Write(append(payload, 0))
+	} else {
+		err = w.writeChunks(payload)
+	}
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// writeChunks sends payload in one datagram, or as GELF chunks when it is too large for one.
+func (w *gelfWriter) writeChunks(payload []byte) error {
+	var (
+		id    [8]byte
+		chunk []byte
+		count int
+		end   int
+		err   error
+		i     int
+	)
+
+	if len(payload) <= gelfChunkSize {
+		_, err = w.conn.Write(payload)
+		return err
+	}
+	count = (len(payload) + gelfChunkSize - 13) / (gelfChunkSize - 12)
+	if count > gelfMaxChunks {
+		return fmt.Errorf("gelf message of %d bytes is too large", len(payload))
+	}
+	_, _ = rand.Read(id[:])
+	for i = 0; i < count; i++ {
+		end = min((i+1)*(gelfChunkSize-12), len(payload))
+		chunk = append([]byte{0x1e, 0x0f}, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*(gelfChunkSize-12):end]...)
+		_, err = w.conn.Write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
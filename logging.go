@@ -2,41 +2,54 @@ package serverconfig
 
 import (
 	"fmt"
-	"log/syslog"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"time"
 )
 
+// The facility and severity values are those of log/syslog, which is not available on every platform.
 var (
-	logFacilityString2Int = map[string]syslog.Priority{
-		"LOG_KERN":     syslog.LOG_KERN,
-		"LOG_USER":     syslog.LOG_USER,
-		"LOG_MAIL":     syslog.LOG_MAIL,
-		"LOG_DAEMON":   syslog.LOG_DAEMON,
-		"LOG_AUTH":     syslog.LOG_AUTH,
-		"LOG_SYSLOG":   syslog.LOG_SYSLOG,
-		"LOG_LPR":      syslog.LOG_LPR,
-		"LOG_NEWS":     syslog.LOG_NEWS,
-		"LOG_UUCP":     syslog.LOG_UUCP,
-		"LOG_CRON":     syslog.LOG_CRON,
-		"LOG_AUTHPRIV": syslog.LOG_AUTHPRIV,
-		"LOG_FTP":      syslog.LOG_FTP,
-		"LOG_LOCAL0":   syslog.LOG_LOCAL0,
-		"LOG_LOCAL1":   syslog.LOG_LOCAL1,
-		"LOG_LOCAL2":   syslog.LOG_LOCAL2,
-		"LOG_LOCAL3":   syslog.LOG_LOCAL3,
-		"LOG_LOCAL4":   syslog.LOG_LOCAL4,
-		"LOG_LOCAL5":   syslog.LOG_LOCAL5,
-		"LOG_LOCAL6":   syslog.LOG_LOCAL6,
-		"LOG_LOCAL7":   syslog.LOG_LOCAL7,
+	logFacilityString2Int = map[string]int{
+		"LOG_KERN":     0 << 3,
+		"LOG_USER":     1 << 3,
+		"LOG_MAIL":     2 << 3,
+		"LOG_DAEMON":   3 << 3,
+		"LOG_AUTH":     4 << 3,
+		"LOG_SYSLOG":   5 << 3,
+		"LOG_LPR":      6 << 3,
+		"LOG_NEWS":     7 << 3,
+		"LOG_UUCP":     8 << 3,
+		"LOG_CRON":     9 << 3,
+		"LOG_AUTHPRIV": 10 << 3,
+		"LOG_FTP":      11 << 3,
+		"LOG_LOCAL0":   16 << 3,
+		"LOG_LOCAL1":   17 << 3,
+		"LOG_LOCAL2":   18 << 3,
+		"LOG_LOCAL3":   19 << 3,
+		"LOG_LOCAL4":   20 << 3,
+		"LOG_LOCAL5":   21 << 3,
+		"LOG_LOCAL6":   22 << 3,
+		"LOG_LOCAL7":   23 << 3,
 	}
-	logSeverityString2Int = map[string]syslog.Priority{
-		"LOG_EMERG":   syslog.LOG_EMERG,
-		"LOG_ALERT":   syslog.LOG_ALERT,
-		"LOG_CRIT":    syslog.LOG_CRIT,
-		"LOG_ERR":     syslog.LOG_ERR,
-		"LOG_WARNING": syslog.LOG_WARNING,
-		"LOG_NOTICE":  syslog.LOG_NOTICE,
-		"LOG_INFO":    syslog.LOG_INFO,
-		"LOG_DEBUG":   syslog.LOG_DEBUG,
+	logSeverityString2Int = map[string]int{
+		"LOG_EMERG":   0,
+		"LOG_ALERT":   1,
+		"LOG_CRIT":    2,
+		"LOG_ERR":     3,
+		"LOG_WARNING": 4,
+		"LOG_NOTICE":  5,
+		"LOG_INFO":    6,
+		"LOG_DEBUG":   7,
+	}
+	// logSeverityAliases maps other common spellings to the syslog severity names.
+	logSeverityAliases = map[string]string{
+		"EMERGENCY": "EMERG",
+		"PANIC":     "EMERG",
+		"CRITICAL":  "CRIT",
+		"ERROR":     "ERR",
+		"WARN":      "WARNING",
 	}
 )
 
@@ -52,22 +65,75 @@ var (
 //				log.Fatal(err)
 //			}
 //		}
+//
+// For log/slog, NewSlogLogger builds the logger from Handler (text or json), Level, Output, and AddSource.
+// Output is stderr, stdout, file, syslog, eventlog, journald, gelf, or loki, and defaults to journald when
+// Journald.Enabled is set, to syslog when SyslogEnabled is set, and to stderr otherwise.  log/syslog is not
+// available on Windows, where SyslogEnabled selects the eventlog output instead and syslog is rejected;
+// eventlog is only available on Windows.
+//
+//	logging:
+//	  handler: json
+//	  level: debug
+//	  output: file
+//	  file:
+//	    path: /var/log/app/app.log
 type LoggingConfig struct {
-	SyslogEnabled bool                `yaml:"syslog_enabled"`
-	Syslog        LoggingSyslogConfig `yaml:"syslog"`
+	SyslogEnabled bool                   `yaml:"syslog_enabled"`
+	Syslog        LoggingSyslogConfig    `yaml:"syslog"`
+	Handler       string                 `yaml:"handler"`
+	Level         string                 `yaml:"level" env:"LOGLEVEL"`
+	Output        string                 `yaml:"output" env:"LOGOUTPUT"`
+	AddSource     bool                   `yaml:"addsource"`
+	File          LoggingFileConfig      `yaml:"file"`
+	Journald      LoggingJournaldConfig  `yaml:"journald"`
+	GELF          LoggingGELFConfig      `yaml:"gelf"`
+	Loki          LoggingLokiConfig      `yaml:"loki"`
+	EventLog      LoggingEventLogConfig  `yaml:"eventlog"`
+	Sampling      *LoggingSamplingConfig `yaml:"sampling"`
+	level         slog.Level
 }
 
+// LoggingFileConfig names the file written when Output is file and how it is rotated.  The file is rotated
+// when it reaches MaxSize, 100MiB by default.  Rotated files are removed once there are more than MaxBackups
+// of them or they are older than MaxAge; zero keeps them all.  Compress gzips rotated files.
+type LoggingFileConfig struct {
+	Path       string        `yaml:"path" env:"LOGFILE"`
+	MaxSize    ByteSize      `yaml:"maxsize"`
+	MaxBackups int           `yaml:"maxbackups"`
+	MaxAge     time.Duration `yaml:"maxage"`
+	Compress   bool          `yaml:"compress"`
+}
+
+// LoggingSyslogConfig selects the syslog facility and severity.  Names are case-insensitive and the "LOG_"
+// prefix is optional, so "local3" is LOG_LOCAL3; for the severity, warn, error, critical, and emergency are
+// also accepted.  Verify stores the names in their "LOG_" form.  By default messages go to the local
+// syslog socket; Network (udp, tcp, or unix) and Address send them to a remote collector instead, with the
+// port defaulting to 514.  Tag defaults to the program name.
+//
+//	logging:
+//	  syslog_enabled: true
+//	  syslog:
+//	    facility: LOG_LOCAL3
+//	    network: tcp
+//	    address: logs.internal
+//	    tag: billing
 type LoggingSyslogConfig struct {
-	FacilityString string          `yaml:"facility"`
-	SeverityString string          `yaml:"severity"`
-	priority       syslog.Priority `yaml:"-"`
+	FacilityString string `yaml:"facility"`
+	SeverityString string `yaml:"severity"`
+	Network        string `yaml:"network"`
+	Address        string `yaml:"address" env:"SYSLOGADDRESS"`
+	Tag            string `yaml:"tag"`
+	priority       int    `yaml:"-"`
 }
 
 func (cfg *LoggingConfig) Verify() error {
 	var (
-		facility syslog.Priority
-		severity syslog.Priority
+		facility int
+		severity int
+		name     string
 		found    bool
+		err      error
 	)
 
 	if len(cfg.Syslog.FacilityString) == 0 {
@@ -77,20 +143,89 @@ func (cfg *LoggingConfig) Verify() error {
 		cfg.Syslog.SeverityString = "LOG_INFO"
 	}
 
-	facility, found = logFacilityString2Int[cfg.Syslog.FacilityString]
+	name = syslogName(cfg.Syslog.FacilityString, nil)
+	facility, found = logFacilityString2Int[name]
 	if !found {
-		return fmt.Errorf("invalid logging facility specified: '%s'", cfg.Syslog.FacilityString)
+		return fmt.Errorf("invalid logging facility specified: '%s' (expected one of %s)", cfg.Syslog.FacilityString,
+			syslogNames(logFacilityString2Int))
 	}
+	cfg.Syslog.FacilityString = name
 
-	severity, found = logSeverityString2Int[cfg.Syslog.SeverityString]
+	name = syslogName(cfg.Syslog.SeverityString, logSeverityAliases)
+	severity, found = logSeverityString2Int[name]
 	if !found {
-		return fmt.Errorf("invalid logging severity specified: '%s'", cfg.Syslog.SeverityString)
+		return fmt.Errorf("invalid logging severity specified: '%s' (expected one of %s)", cfg.Syslog.SeverityString,
+			syslogNames(logSeverityString2Int))
 	}
+	cfg.Syslog.SeverityString = name
 
-	cfg.Syslog.priority = syslog.Priority(int(facility) | int(severity))
-	return nil
+	cfg.Syslog.priority = facility | severity
+
+	err = cfg.Syslog.verifyRemote()
+	if err != nil {
+		return err
+	}
+
+	return cfg.verifySlog()
+}
+
+// syslogName turns a facility or severity such as "local5", "Warn", or "LOG_INFO" into its "LOG_" name.
+func syslogName(s string, aliases map[string]string) string {
+	var alias string
+
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "LOG_")
+	alias = aliases[s]
+	if len(alias) > 0 {
+		s = alias
+	}
+	return "LOG_" + s
 }
 
-func (cfg LoggingSyslogConfig) Priority() syslog.Priority {
-	return cfg.priority
+// syslogNames lists the short lower-case names in m in priority order, for error messages.
+func syslogNames(m map[string]int) string {
+	var (
+		names []string
+		name  string
+		i     int
+	)
+
+	for name = range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return m[names[i]] < m[names[j]] })
+	for i = 0; i < len(names); i++ {
+		names[i] = strings.ToLower(strings.TrimPrefix(names[i], "LOG_"))
+	}
+	return strings.Join(names, ", ")
+}
+
+// verifyRemote checks Network and Address, adding the default port 514 to an address without one.
+func (cfg *LoggingSyslogConfig) verifyRemote() error {
+	var err error
+
+	cfg.Network = strings.ToLower(strings.TrimSpace(cfg.Network))
+	if len(cfg.Network) == 0 && len(cfg.Address) == 0 {
+		return nil
+	}
+	if len(cfg.Network) == 0 {
+		cfg.Network = "udp"
+	}
+	if len(cfg.Address) == 0 {
+		return fmt.Errorf("logging syslog network %s requires an address (or SYSLOGADDRESS environment variable)", cfg.Network)
+	}
+	switch cfg.Network {
+	case "udp", "tcp":
+		_, _, err = net.SplitHostPort(cfg.Address)
+		if err != nil {
+			cfg.Address = net.JoinHostPort(cfg.Address, "514")
+		}
+		err = validateHostPort(cfg.Address)
+		if err != nil {
+			return fmt.Errorf("invalid logging syslog address: %w", err)
+		}
+	case "unix", "unixgram":
+	default:
+		return fmt.Errorf("invalid logging syslog network %q (expected udp, tcp, or unix)", cfg.Network)
+	}
+	return nil
 }
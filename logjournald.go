@@ -0,0 +1,213 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/journal"
+)
+
+// journalSend is journal.Send, replaced in tests.
+var journalSend = journal.Send
+
+// LoggingJournaldConfig sends logs to the systemd journal with structured fields instead of a formatted
+// line.  Identifier is the SYSLOG_IDENTIFIER field, the program name by default, and Fields are added to
+// every entry.  Field names are upper case letters, digits, and underscores, as journald requires.
+//
+//	logging:
+//	  journald:
+//	    enabled: true
+//	    identifier: billing
+//	    fields:
+//	      DEPLOYMENT: blue
+type LoggingJournaldConfig struct {
+	Enabled    bool              `yaml:"enabled" env:"JOURNALDENABLED"`
+	Identifier string            `yaml:"identifier"`
+	Fields     map[string]string `yaml:"fields"`
+}
+
+// Verify defaults Identifier and checks the Fields names.
+func (cfg *LoggingJournaldConfig) Verify() error {
+	var name string
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.Identifier) == 0 {
+		cfg.Identifier = filepath.Base(os.Args[0])
+	}
+	for name = range cfg.Fields {
+		if !isJournalFieldName(name) {
+			return fmt.Errorf("invalid logging journald field name %q (expected upper case letters, digits, and underscores)", name)
+		}
+	}
+	return nil
+}
+
+// Handler returns a slog.Handler writing to the journal.  Record attributes become journal fields, named by
+// upper-casing the key and joining groups with underscores, and the level sets PRIORITY.
+func (cfg *LoggingJournaldConfig) Handler(opts *slog.HandlerOptions) slog.Handler {
+	var (
+		fields map[string]string
+		name   string
+	)
+
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	fields = map[string]string{"SYSLOG_IDENTIFIER": cfg.Identifier}
+	for name = range cfg.Fields {
+		fields[name] = cfg.Fields[name]
+	}
+	return &journaldHandler{opts: *opts, fields: fields}
+}
+
+// Writer returns a writer that sends each write to the journal as one entry at info priority, for use with
+// log.Logger.
+func (cfg *LoggingJournaldConfig) Writer() io.Writer {
+	return &journaldWriter{h: cfg.Handler(nil).(*journaldHandler)}
+}
+
+type journaldWriter struct {
+	h *journaldHandler
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	var err error
+
+	err = journalSend(string(bytes.TrimRight(p, "\n")), journal.PriInfo, w.h.fields)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type journaldHandler struct {
+	opts   slog.HandlerOptions
+	fields map[string]string
+	prefix string
+}
+
+func (h *journaldHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	var minLevel slog.Level
+
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *journaldHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		fields   map[string]string
+		name     string
+		priority journal.Priority
+		frame    slog.Source
+	)
+
+	fields = make(map[string]string, len(h.fields)+r.NumAttrs()+3)
+	for name = range h.fields {
+		fields[name] = h.fields[name]
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addJournalField(fields, h.prefix, a)
+		return true
+	})
+	if h.opts.AddSource && r.PC != 0 {
+		frame = *r.Source()
+		fields["CODE_FILE"] = frame.File
+		fields["CODE_LINE"] = strconv.Itoa(frame.Line)
+		fields["CODE_FUNC"] = frame.Function
+	}
+
+	switch {
+	case r.Level >= slog.LevelError:
+		priority = journal.PriErr
+	case r.Level >= slog.LevelWarn:
+		priority = journal.PriWarning
+	case r.Level >= slog.LevelInfo:
+		priority = journal.PriInfo
+	default:
+		priority = journal.PriDebug
+	}
+	return journalSend(r.Message, priority, fields)
+}
+
+func (h *journaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var (
+		fields map[string]string
+		name   string
+		i      int
+	)
+
+	fields = make(map[string]string, len(h.fields)+len(attrs))
+	for name = range h.fields {
+		fields[name] = h.fields[name]
+	}
+	for i = 0; i < len(attrs); i++ {
+		addJournalField(fields, h.prefix, attrs[i])
+	}
+	return &journaldHandler{opts: h.opts, fields: fields, prefix: h.prefix}
+}
+
+func (h *journaldHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	return &journaldHandler{opts: h.opts, fields: h.fields, prefix: h.prefix + journalFieldName(name) + "_"}
+}
+
+// addJournalField stores a as a journal field, flattening groups.
+func addJournalField(fields map[string]string, prefix string, a slog.Attr) {
+	var (
+		group []slog.Attr
+		i     int
+	)
+
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		group = a.Value.Group()
+		if len(a.Key) > 0 {
+			prefix += journalFieldName(a.Key) + "_"
+		}
+		for i = 0; i < len(group); i++ {
+			addJournalField(fields, prefix, group[i])
+		}
+		return
+	}
+	if len(a.Key) == 0 {
+		return
+	}
+	fields[prefix+journalFieldName(a.Key)] = a.Value.String()
+}
+
+// journalFieldName upper-cases key and replaces characters journald does not allow with underscores.  A
+// leading underscore is reserved for trusted fields, so one is prefixed with "F".
+func journalFieldName(key string) string {
+	var (
+		b []byte
+		i int
+	)
+
+	b = []byte(strings.ToUpper(key))
+	for i = 0; i < len(b); i++ {
+		if !(b[i] >= 'A' && b[i] <= 'Z' || b[i] >= '0' && b[i] <= '9' || b[i] == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && (b[0] == '_' || b[0] >= '0' && b[0] <= '9') {
+		return "F" + string(b)
+	}
+	return string(b)
+}
+
+func isJournalFieldName(name string) bool {
+	return len(name) > 0 && journalFieldName(name) == name
+}
@@ -0,0 +1,276 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoggingLokiConfig ships logs straight to Grafana Loki's push API, for hosts without a log agent.  URL is
+// the Loki base URL or the full push URL.  Entries are sent in batches of BatchSize (100 by default) or
+// every BatchInterval (1s by default), whichever comes first, with the static Labels as the stream labels;
+// the job label defaults to the program name.  TenantID sets X-Scope-OrgID for multi-tenant Loki, and User
+// and Password enable basic authentication.
+//
+//	logging:
+//	  output: loki
+//	  loki:
+//	    url: https://loki.example.com
+//	    tenantid: edge
+//	    labels:
+//	      site: store-42
+type LoggingLokiConfig struct {
+	URL           string            `yaml:"url" env:"LOKIURL"`
+	TenantID      string            `yaml:"tenantid"`
+	Labels        map[string]string `yaml:"labels"`
+	BatchSize     int               `yaml:"batchsize"`
+	BatchInterval time.Duration     `yaml:"batchinterval"`
+	User          string            `yaml:"user"`
+	Password      string            `yaml:"password" env:"LOKIPASSWORD"`
+}
+
+// Verify checks the settings when URL is set and fills in the defaults.
+func (cfg *LoggingLokiConfig) Verify() error {
+	var (
+		name string
+		err  error
+	)
+
+	if len(cfg.URL) == 0 {
+		return nil
+	}
+	_, err = validateURL(cfg.URL, "http", "https")
+	if err != nil {
+		return fmt.Errorf("invalid logging loki url: %w", err)
+	}
+	if !strings.HasSuffix(cfg.URL, "/loki/api/v1/push") {
+		cfg.URL = strings.TrimSuffix(cfg.URL, "/") + "/loki/api/v1/push"
+	}
+	if cfg.BatchSize < 0 || cfg.BatchInterval < 0 {
+		return fmt.Errorf("logging loki batchsize and batchinterval cannot be negative")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.BatchInterval == 0 {
+		cfg.BatchInterval = time.Second
+	}
+	if len(cfg.User) > 0 != (len(cfg.Password) > 0) {
+		return fmt.Errorf("logging loki user and password must be set together")
+	}
+	if cfg.Labels == nil {
+		cfg.Labels = make(map[string]string)
+	}
+	if len(cfg.Labels["job"]) == 0 {
+		cfg.Labels["job"] = filepath.Base(os.Args[0])
+	}
+	for name = range cfg.Labels {
+		if !isLokiLabelName(name) {
+			return fmt.Errorf("invalid logging loki label name %q", name)
+		}
+	}
+	return nil
+}
+
+// Handler returns a LokiHandler formatting each record as a text or json line.  Close it on shutdown to send
+// the entries still buffered:
+//
+//	defer logger.Handler().(*serverconfig.LokiHandler).Close()
+func (cfg *LoggingLokiConfig) Handler(format string, opts *slog.HandlerOptions) *LokiHandler {
+	var s *lokiShipper
+
+	s = &lokiShipper{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		done:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+	s.stopped.Add(1)
+	go s.run()
+	return newLokiHandler(s, format, opts)
+}
+
+// LokiHandler is the slog.Handler returned by LoggingLokiConfig.Handler.
+type LokiHandler struct {
+	s     *lokiShipper
+	mu    *sync.Mutex
+	buf   *bytes.Buffer
+	inner slog.Handler
+}
+
+func newLokiHandler(s *lokiShipper, format string, opts *slog.HandlerOptions) *LokiHandler {
+	var h *LokiHandler
+
+	h = &LokiHandler{s: s, mu: &sync.Mutex{}, buf: &bytes.Buffer{}}
+	h.inner = newLineHandler(h.buf, format, opts)
+	return h
+}
+
+func (h *LokiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *LokiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		line string
+		ts   time.Time
+		err  error
+	)
+
+	h.mu.Lock()
+	h.buf.Reset()
+	err = h.inner.Handle(ctx, r)
+	line = strings.TrimSuffix(h.buf.String(), "\n")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	ts = r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	h.s.add([2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+	return nil
+}
+
+func (h *LokiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LokiHandler{s: h.s, mu: h.mu, buf: h.buf, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *LokiHandler) WithGroup(name string) slog.Handler {
+	return &LokiHandler{s: h.s, mu: h.mu, buf: h.buf, inner: h.inner.WithGroup(name)}
+}
+
+// Close stops the background sender after pushing any buffered entries.
+func (h *LokiHandler) Close() error {
+	h.s.closeOnce.Do(func() {
+		close(h.s.done)
+	})
+	h.s.stopped.Wait()
+	return h.s.lastErr()
+}
+
+// lokiShipper collects entries from every handler derived from one LokiHandler and pushes them in batches.
+type lokiShipper struct {
+	cfg       LoggingLokiConfig
+	client    *http.Client
+	mu        sync.Mutex
+	entries   [][2]string
+	err       error
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   sync.WaitGroup
+}
+
+func (s *lokiShipper) add(entry [2]string) {
+	var full bool
+
+	s.mu.Lock()
+	s.entries = append(s.entries, entry)
+	full = len(s.entries) >= s.cfg.BatchSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *lokiShipper) run() {
+	var ticker *time.Ticker
+
+	defer s.stopped.Done()
+	ticker = time.NewTicker(s.cfg.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-s.done:
+			s.flush()
+			return
+		}
+		s.flush()
+	}
+}
+
+// flush pushes the buffered entries.  A failed push drops them rather than growing without bound, and the
+// error is kept for Close.
+func (s *lokiShipper) flush() {
+	var (
+		entries [][2]string
+		body    []byte
+		req     *http.Request
+		resp    *http.Response
+		err     error
+	)
+
+	s.mu.Lock()
+	entries = s.entries
+	s.entries = nil
+	s.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	body, err = json.Marshal(map[string]any{
+		"streams": []map[string]any{{"stream": s.cfg.Labels, "values": entries}},
+	})
+	if err == nil {
+		req, err = http.NewRequest(http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	}
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		if len(s.cfg.TenantID) > 0 {
+			req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+		}
+		if len(s.cfg.User) > 0 {
+			req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+		}
+		resp, err = s.client.Do(req)
+	}
+	if err == nil {
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("loki push returned %s", resp.Status)
+		}
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *lokiShipper) lastErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// isLokiLabelName reports whether name is a valid label name that is not reserved for Loki's own use.
+func isLokiLabelName(name string) bool {
+	var i int
+
+	if len(name) == 0 || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i = 0; i < len(name); i++ {
+		switch {
+		case name[i] == '_', name[i] >= 'a' && name[i] <= 'z', name[i] >= 'A' && name[i] <= 'Z':
+		case name[i] >= '0' && name[i] <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
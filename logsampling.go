@@ -0,0 +1,144 @@
+package serverconfig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LoggingSamplingConfig limits how many records are logged, so that a flood of the same message cannot
+// swamp the log collector.  Within each second the first Initial records with a given level and message are
+// logged, then only every Thereafter-th one, as in zap's sampler; both default to 100.  PerSecond caps the
+// records logged per second across all messages, with no cap when zero.  Dropped records are discarded.
+//
+//	logging:
+//	  sampling:
+//	    initial: 10
+//	    thereafter: 100
+//	    persecond: 500
+type LoggingSamplingConfig struct {
+	Initial    int `yaml:"initial"`
+	Thereafter int `yaml:"thereafter"`
+	PerSecond  int `yaml:"persecond"`
+}
+
+// Verify applies the defaults.
+func (cfg *LoggingSamplingConfig) Verify() error {
+	if cfg.Initial < 0 || cfg.Thereafter < 0 || cfg.PerSecond < 0 {
+		return fmt.Errorf("logging sampling initial, thereafter, and persecond cannot be negative")
+	}
+	if cfg.Initial == 0 {
+		cfg.Initial = 100
+	}
+	if cfg.Thereafter == 0 {
+		cfg.Thereafter = 100
+	}
+	return nil
+}
+
+// Handler wraps h so that only the sampled records reach it.
+func (cfg *LoggingSamplingConfig) Handler(h slog.Handler) slog.Handler {
+	return &samplingHandler{inner: h, sampler: &logSampler{cfg: *cfg}}
+}
+
+// ZapOptions returns the options to pass to zap.Config.Build along with ToZapConfig.  When Sampling is set,
+// they sample entries as NewSlogLogger does; zap's own sampler has no per-second cap, so ToZapConfig turns it
+// off.
+//
+//	zc, err := gc.Logging.ToZapConfig()
+//	logger, err := zc.Build(gc.Logging.ZapOptions()...)
+func (cfg *LoggingConfig) ZapOptions() []zap.Option {
+	var sampler *logSampler
+
+	if cfg.Sampling == nil {
+		return nil
+	}
+	sampler = &logSampler{cfg: *cfg.Sampling}
+	return []zap.Option{zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &zapSamplingCore{Core: core, sampler: sampler}
+	})}
+}
+
+// logSampler counts records per one-second window.
+type logSampler struct {
+	cfg    LoggingSamplingConfig
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+	total  int
+}
+
+// allow reports whether a record with key, the level and message, is logged.
+func (s *logSampler) allow(key string, now time.Time) bool {
+	var n int
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.window) >= time.Second || now.Before(s.window) {
+		s.window = now
+		s.counts = make(map[string]int)
+		s.total = 0
+	}
+	n = s.counts[key] + 1
+	s.counts[key] = n
+	if n > s.cfg.Initial && (n-s.cfg.Initial)%s.cfg.Thereafter != 0 {
+		return false
+	}
+	if s.cfg.PerSecond > 0 && s.total >= s.cfg.PerSecond {
+		return false
+	}
+	s.total++
+	return true
+}
+
+type samplingHandler struct {
+	inner   slog.Handler
+	sampler *logSampler
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	var now time.Time
+
+	now = r.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if !h.sampler.allow(r.Level.String()+"\x00"+r.Message, now) {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{inner: h.inner.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{inner: h.inner.WithGroup(name), sampler: h.sampler}
+}
+
+// zapSamplingCore drops the entries not sampled before they reach the wrapped core.
+type zapSamplingCore struct {
+	zapcore.Core
+	sampler *logSampler
+}
+
+func (c *zapSamplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &zapSamplingCore{Core: c.Core.With(fields), sampler: c.sampler}
+}
+
+func (c *zapSamplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) || !c.sampler.allow(ent.Level.String()+"\x00"+ent.Message, ent.Time) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
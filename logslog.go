@@ -0,0 +1,200 @@
+package serverconfig
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// verifySlog checks the log/slog settings and fills in their defaults.
+func (cfg *LoggingConfig) verifySlog() error {
+	var err error
+
+	cfg.Handler = strings.ToLower(strings.TrimSpace(cfg.Handler))
+	if len(cfg.Handler) == 0 {
+		cfg.Handler = "text"
+	}
+	if cfg.Handler != "text" && cfg.Handler != "json" {
+		return fmt.Errorf("invalid logging handler %q (expected text or json)", cfg.Handler)
+	}
+
+	cfg.level = slog.LevelInfo
+	if len(cfg.Level) > 0 {
+		err = cfg.level.UnmarshalText([]byte(cfg.Level))
+		if err != nil {
+			return fmt.Errorf("invalid logging level %q (expected debug, info, warn, or error)", cfg.Level)
+		}
+	}
+
+	cfg.Output = strings.ToLower(strings.TrimSpace(cfg.Output))
+	if len(cfg.Output) == 0 {
+		cfg.Output = "stderr"
+		if cfg.Journald.Enabled {
+			cfg.Output = "journald"
+		} else if cfg.SyslogEnabled && len(systemLogOutput) > 0 {
+			cfg.Output = systemLogOutput
+		}
+	}
+	switch cfg.Output {
+	case "stderr", "stdout":
+	case "syslog", "eventlog":
+		if cfg.Output != systemLogOutput {
+			return fmt.Errorf("logging output %s is not available on %s", cfg.Output, runtime.GOOS)
+		}
+	case "journald":
+		cfg.Journald.Enabled = true
+	case "gelf":
+		if len(cfg.GELF.Address) == 0 {
+			return fmt.Errorf("logging output gelf requires gelf.address (or GELFADDRESS environment variable)")
+		}
+	case "loki":
+		if len(cfg.Loki.URL) == 0 {
+			return fmt.Errorf("logging output loki requires loki.url (or LOKIURL environment variable)")
+		}
+	case "file":
+		if len(cfg.File.Path) == 0 {
+			return fmt.Errorf("logging output file requires file.path (or LOGFILE environment variable)")
+		}
+	default:
+		return fmt.Errorf("invalid logging output %q (expected stderr, stdout, file, syslog, eventlog, journald, gelf, or loki)", cfg.Output)
+	}
+	return nil
+}
+
+// LogLevel returns the parsed Level, info by default.
+func (cfg *LoggingConfig) LogLevel() slog.Level {
+	return cfg.level
+}
+
+// NewSlogLogger returns a *slog.Logger writing to the configured output.  With syslog output each record is
+// sent with the syslog severity matching its level under the configured facility, with eventlog output (on
+// Windows) as an event log entry of the matching type, and with journald output
+// as a journal entry with the attributes as fields.  Loki output is batched; see LoggingLokiConfig.Handler
+// for flushing it on shutdown.  Records are sampled when the Sampling section is set, and carry the
+// application name, environment, and version when an AppConfig has been verified.
+//
+//	logger, err := gc.Logging.NewSlogLogger()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	slog.SetDefault(logger)
+func (cfg *LoggingConfig) NewSlogLogger() (*slog.Logger, error) {
+	var (
+		w       io.Writer
+		opts    *slog.HandlerOptions
+		handler slog.Handler
+		attrs   []slog.Attr
+		err     error
+	)
+
+	opts = &slog.HandlerOptions{AddSource: cfg.AddSource, Level: cfg.level}
+	switch cfg.Output {
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		w = cfg.File.Writer()
+	case "syslog", "eventlog":
+		handler, err = cfg.systemLogHandler(opts)
+		if err != nil {
+			return nil, err
+		}
+	case "journald":
+		handler = cfg.Journald.Handler(opts)
+	case "gelf":
+		handler = cfg.GELF.Handler(opts)
+	case "loki":
+		handler = cfg.Loki.Handler(cfg.Handler, opts)
+	default:
+		w = os.Stderr
+	}
+
+	if handler == nil {
+		if cfg.Handler == "json" {
+			handler = slog.NewJSONHandler(w, opts)
+		} else {
+			handler = slog.NewTextHandler(w, opts)
+		}
+	}
+	if cfg.Sampling != nil {
+		handler = cfg.Sampling.Handler(handler)
+	}
+	attrs = CurrentApp().SlogAttrs()
+	if len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	return slog.New(handler), nil
+}
+
+// newLineHandler returns a text or JSON handler writing to w without the time, for outputs that timestamp
+// the lines themselves.
+func newLineHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	opts = &slog.HandlerOptions{
+		AddSource: opts.AddSource,
+		Level:     opts.Level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Verify checks that the log file's directory exists and is writable, and defaults MaxSize to 100MiB.
+// Nothing is checked when Path is empty.
+func (cfg *LoggingFileConfig) Verify() error {
+	var (
+		info os.FileInfo
+		f    *os.File
+		err  error
+	)
+
+	if len(cfg.Path) == 0 {
+		return nil
+	}
+	if cfg.MaxSize < 0 || cfg.MaxBackups < 0 || cfg.MaxAge < 0 {
+		return fmt.Errorf("logging file maxsize, maxbackups, and maxage cannot be negative")
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = 100 << 20
+	}
+	info, err = os.Stat(cfg.Path)
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("logging file path %s is a directory", cfg.Path)
+	}
+	f, err = os.CreateTemp(filepath.Dir(cfg.Path), ".logcheck-*")
+	if err != nil {
+		return fmt.Errorf("logging file directory is not writable: %w", err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return nil
+}
+
+// Writer returns a writer for the log file which rotates it as configured.  It can also back a log.Logger:
+//
+//	logger = log.New(gc.Logging.File.Writer(), "", log.LstdFlags)
+func (cfg *LoggingFileConfig) Writer() io.WriteCloser {
+	return &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    int((cfg.MaxSize + 1<<20 - 1) >> 20),
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     int((cfg.MaxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+		Compress:   cfg.Compress,
+		LocalTime:  true,
+	}
+}
@@ -0,0 +1,132 @@
+//go:build !windows
+
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/journald"
+)
+
+// systemLogOutput is the logging output selected by SyslogEnabled on this platform.
+const systemLogOutput = "syslog"
+
+// Priority returns the facility and severity as a syslog priority.
+func (cfg LoggingSyslogConfig) Priority() syslog.Priority {
+	return syslog.Priority(cfg.priority)
+}
+
+// Writer connects to the local syslog daemon, or to Address when set, using the configured priority and
+// Tag.
+//
+//	w, err := gc.Logging.Syslog.Writer()
+//	logger := log.New(w, "", 0)
+func (cfg *LoggingSyslogConfig) Writer() (*syslog.Writer, error) {
+	var (
+		w   *syslog.Writer
+		err error
+	)
+
+	w, err = syslog.Dial(cfg.Network, cfg.Address, syslog.Priority(cfg.priority), cfg.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to syslog: %w", err)
+	}
+	return w, nil
+}
+
+// syslogHandler formats records with a text or JSON handler and sends each one to syslog at the severity
+// matching its level.  The time is left to syslog.
+type syslogHandler struct {
+	w     *syslog.Writer
+	mu    *sync.Mutex
+	buf   *bytes.Buffer
+	inner slog.Handler
+}
+
+func newSyslogHandler(w *syslog.Writer, format string, opts *slog.HandlerOptions) *syslogHandler {
+	var h *syslogHandler
+
+	h = &syslogHandler{w: w, mu: &sync.Mutex{}, buf: &bytes.Buffer{}}
+	h.inner = newLineHandler(h.buf, format, opts)
+	return h
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		msg string
+		err error
+	)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	err = h.inner.Handle(ctx, r)
+	if err != nil {
+		return err
+	}
+	msg = strings.TrimSuffix(h.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.w.Info(msg)
+	default:
+		return h.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{w: h.w, mu: h.mu, buf: h.buf, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{w: h.w, mu: h.mu, buf: h.buf, inner: h.inner.WithGroup(name)}
+}
+
+// systemLogHandler returns the slog handler for the syslog output.
+func (cfg *LoggingConfig) systemLogHandler(opts *slog.HandlerOptions) (slog.Handler, error) {
+	var (
+		sw  *syslog.Writer
+		err error
+	)
+
+	sw, err = cfg.Syslog.Writer()
+	if err != nil {
+		return nil, err
+	}
+	return newSyslogHandler(sw, cfg.Handler, opts), nil
+}
+
+// systemLogZerologWriter returns a zerolog writer sending each event to syslog at the severity matching its
+// level.
+func (cfg *LoggingConfig) systemLogZerologWriter() (io.Writer, error) {
+	var (
+		sw  *syslog.Writer
+		err error
+	)
+
+	sw, err = cfg.Syslog.Writer()
+	if err != nil {
+		return nil, err
+	}
+	return zerolog.SyslogLevelWriter(sw), nil
+}
+
+// journaldZerologWriter returns zerolog's journald writer.
+func journaldZerologWriter() (io.Writer, error) {
+	return journald.NewJournalDWriter(), nil
+}
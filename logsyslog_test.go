@@ -0,0 +1,113 @@
+//go:build !windows
+
+package serverconfig
+
+import (
+	"errors"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingSyslogHandler(t *testing.T) {
+	var (
+		cfg    LoggingConfig
+		logger *slog.Logger
+		conn   net.PacketConn
+		sw     *syslog.Writer
+		buf    []byte
+		n      int
+		err    error
+	)
+
+	// records reach syslog with the severity matching their level
+	conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("ListenPacket returned error: %v", err)
+	}
+	defer conn.Close()
+	sw, err = syslog.Dial("udp", conn.LocalAddr().String(), syslog.LOG_LOCAL5|syslog.LOG_INFO, "app")
+	if !errors.Is(err, nil) {
+		t.Fatalf("syslog.Dial returned error: %v", err)
+	}
+	defer sw.Close()
+	logger = slog.New(newSyslogHandler(sw, "text", &slog.HandlerOptions{}))
+	logger.With("user", "bob").Warn("disk low")
+	buf = make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = conn.ReadFrom(buf)
+	if !errors.Is(err, nil) {
+		t.Fatalf("ReadFrom returned error: %v", err)
+	}
+	// <172> is LOG_LOCAL5|LOG_WARNING
+	if !strings.HasPrefix(string(buf[:n]), "<172>") || !strings.Contains(string(buf[:n]), `level=WARN msg="disk low" user=bob`) ||
+		strings.Contains(string(buf[:n]), "time=") {
+		t.Fatalf("unexpected syslog message %q", buf[:n])
+	}
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{FacilityString: "local3", SeverityString: "warn"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Syslog.Priority() != syslog.LOG_LOCAL3|syslog.LOG_WARNING {
+		t.Fatalf("unexpected priority %d (%v)", cfg.Syslog.Priority(), err)
+	}
+
+	cfg = LoggingConfig{Output: "eventlog"}
+	checkError(t, cfg.Verify(), "logging output eventlog is not available on")
+}
+
+func TestLoggingRemoteSyslog(t *testing.T) {
+	var (
+		cfg    LoggingConfig
+		conn   net.PacketConn
+		logger *slog.Logger
+		buf    []byte
+		n      int
+		err    error
+	)
+
+	conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if !errors.Is(err, nil) {
+		t.Fatalf("ListenPacket returned error: %v", err)
+	}
+	defer conn.Close()
+
+	cfg = LoggingConfig{SyslogEnabled: true, Syslog: LoggingSyslogConfig{
+		FacilityString: "LOG_LOCAL3", Address: conn.LocalAddr().String(), Tag: "billing"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if cfg.Syslog.Network != "udp" {
+		t.Fatalf("expected network to default to udp, got %q", cfg.Syslog.Network)
+	}
+	logger, err = cfg.NewSlogLogger()
+	if !errors.Is(err, nil) {
+		t.Fatalf("NewSlogLogger returned error: %v", err)
+	}
+	logger.Error("payment failed")
+	buf = make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = conn.ReadFrom(buf)
+	if !errors.Is(err, nil) {
+		t.Fatalf("ReadFrom returned error: %v", err)
+	}
+	// <155> is LOG_LOCAL3|LOG_ERR
+	if !strings.HasPrefix(string(buf[:n]), "<155>") || !strings.Contains(string(buf[:n]), " billing[") {
+		t.Fatalf("unexpected syslog message %q", buf[:n])
+	}
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{Network: "tcp", Address: "logs.internal"}}
+	err = cfg.Verify()
+	if !errors.Is(err, nil) || cfg.Syslog.Address != "logs.internal:514" {
+		t.Fatalf("expected default port, got %q (%v)", cfg.Syslog.Address, err)
+	}
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{Network: "tcp"}}
+	checkError(t, cfg.Verify(), "requires an address")
+
+	cfg = LoggingConfig{Syslog: LoggingSyslogConfig{Network: "sctp", Address: "logs.internal"}}
+	checkError(t, cfg.Verify(), "invalid logging syslog network")
+}
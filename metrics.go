@@ -0,0 +1,74 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var metricsNamespaceRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricsConfig describes how a Prometheus metrics endpoint is exposed.  If BindAddr is empty the endpoint
+// is meant to be mounted at Path on the main HTTP server, otherwise a dedicated listener should be started
+// on BindAddr.  When User and Password are supplied the endpoint is protected with basic authentication.
+//
+//	metrics:
+//	  enabled: true
+//	  bindaddr: 127.0.0.1:9100
+//	  namespace: myapp
+type MetricsConfig struct {
+	Enabled   bool   `yaml:"enabled" env:"METRICSENABLED"`
+	BindAddr  string `yaml:"bindaddr" env:"METRICSBINDADDR"`
+	Path      string `yaml:"path"`
+	Namespace string `yaml:"namespace"`
+	User      string `yaml:"user" env:"METRICSUSER"`
+	Password  string `yaml:"password" env:"METRICSPASS"`
+}
+
+// Verify checks the metrics settings and defaults Path to /metrics.  Nothing is checked when the endpoint
+// is not enabled.
+func (cfg *MetricsConfig) Verify() error {
+	var err error
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.Path) == 0 {
+		cfg.Path = "/metrics"
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return fmt.Errorf("metrics path must begin with '/': %q", cfg.Path)
+	}
+	if len(cfg.BindAddr) > 0 {
+		_, _, err = net.SplitHostPort(cfg.BindAddr)
+		if err != nil {
+			return fmt.Errorf("metrics bindaddr should specify a port: %w", err)
+		}
+	}
+	if len(cfg.Namespace) > 0 && !metricsNamespaceRE.MatchString(cfg.Namespace) {
+		return fmt.Errorf("invalid metrics namespace %q (must match %s)", cfg.Namespace, metricsNamespaceRE.String())
+	}
+	if (len(cfg.User) == 0) != (len(cfg.Password) == 0) {
+		return fmt.Errorf("metrics basic-auth requires both user and password (or METRICSUSER and METRICSPASS environment variables)")
+	}
+	return nil
+}
+
+// Handler returns the pattern and handler to register on a mux for serving metrics.  The metrics handler
+// is normally promhttp.Handler() and will be wrapped with basic authentication if credentials are configured.
+//
+//	mux.Handle(gc.Metrics.Handler(promhttp.Handler()))
+func (cfg *MetricsConfig) Handler(metrics http.Handler) (string, http.Handler) {
+	var path string
+
+	path = cfg.Path
+	if len(path) == 0 {
+		path = "/metrics"
+	}
+	if len(cfg.User) > 0 {
+		return path, basicAuthHandler(cfg.User, cfg.Password, "metrics", metrics)
+	}
+	return path, metrics
+}
@@ -0,0 +1,113 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// NotifyConfig maps named channels to chat webhooks (Slack, Microsoft Teams, or Discord) for operational
+// notifications.  RateLimit is the maximum number of messages per minute sent to any one channel, defaulting
+// to 20.  Since webhook URLs are secrets, a channel may name an environment variable holding its URL in
+// webhookurlenv rather than putting the URL in the file.
+//
+//	notify:
+//	  defaultchannel: ops
+//	  channels:
+//	    ops:
+//	      type: slack
+//	      webhookurlenv: SLACK_OPS_WEBHOOK
+//	    releases:
+//	      type: discord
+//	      webhookurl: https://discord.com/api/webhooks/...
+type NotifyConfig struct {
+	Channels       map[string]NotifyChannel `yaml:"channels"`
+	DefaultChannel string                   `yaml:"defaultchannel"`
+	RateLimit      int                      `yaml:"ratelimit"`
+}
+
+// NotifyChannel is one webhook destination.  Type is "slack", "teams", or "discord" and is inferred from
+// the webhook host when not given.
+type NotifyChannel struct {
+	Type          string `yaml:"type"`
+	WebhookURL    string `yaml:"webhookurl"`
+	WebhookURLEnv string `yaml:"webhookurlenv"`
+}
+
+// Verify checks that the default channel, if given, exists and defaults the RateLimit.  The channels themselves are
+// verified by NotifyChannel.Verify.
+func (cfg *NotifyConfig) Verify() error {
+	var found bool
+
+	if len(cfg.Channels) == 0 {
+		return fmt.Errorf("notify requires at least one channel")
+	}
+	if len(cfg.DefaultChannel) > 0 {
+		_, found = cfg.Channels[cfg.DefaultChannel]
+		if !found {
+			return fmt.Errorf("notify defaultchannel %q is not one of the configured channels", cfg.DefaultChannel)
+		}
+	}
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("notify ratelimit cannot be negative")
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = 20
+	}
+	return nil
+}
+
+// Verify resolves the webhook URL from the environment if webhookurlenv is set, then checks that it is an
+// https URL appropriate for the channel type.
+func (cfg *NotifyChannel) Verify() error {
+	var (
+		u        *url.URL
+		host     string
+		envValue string
+		found    bool
+		err      error
+	)
+
+	if len(cfg.WebhookURLEnv) > 0 {
+		envValue, found = os.LookupEnv(cfg.WebhookURLEnv)
+		if found {
+			cfg.WebhookURL = envValue
+		}
+	}
+	if len(cfg.WebhookURL) == 0 {
+		if len(cfg.WebhookURLEnv) > 0 {
+			return fmt.Errorf("missing webhook url (environment variable %s is not set)", cfg.WebhookURLEnv)
+		}
+		return fmt.Errorf("missing webhook url")
+	}
+	u, err = validateURL(cfg.WebhookURL, "https")
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+
+	cfg.Type = strings.ToLower(strings.TrimSpace(cfg.Type))
+	if len(cfg.Type) == 0 {
+		host = strings.ToLower(u.Hostname())
+		switch {
+		case host == "hooks.slack.com":
+			cfg.Type = "slack"
+		case host == "discord.com" || strings.HasSuffix(host, ".discord.com") || host == "discordapp.com" || strings.HasSuffix(host, ".discordapp.com"):
+			cfg.Type = "discord"
+		case strings.HasSuffix(host, ".office.com") || strings.HasSuffix(host, ".logic.azure.com"):
+			cfg.Type = "teams"
+		default:
+			return fmt.Errorf("unable to infer channel type from %s, please set type", u.Hostname())
+		}
+	}
+	switch cfg.Type {
+	case "slack", "teams":
+	case "discord":
+		if !strings.HasPrefix(u.Path, "/api/webhooks/") {
+			return fmt.Errorf("invalid discord webhook url: path should begin with /api/webhooks/")
+		}
+	default:
+		return fmt.Errorf("invalid channel type %q (expected slack, teams, or discord)", cfg.Type)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package serverconfig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	s3BucketRE  = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	gcsBucketRE = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$`)
+
+	azureAccountRE   = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+	azureContainerRE = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+)
+
+// ObjectStoreConfig configures access to an S3-compatible object store (AWS S3, MinIO, Ceph, etc.).
+// Endpoint is only needed for non-AWS stores.  If AccessKey and SecretKey are both empty the client is
+// expected to use its default credential chain (instance role, shared credentials file, ...).
+//
+//	objectstore:
+//	  endpoint: https://minio.internal:9000
+//	  region: us-east-1
+//	  bucket: uploads
+//	  pathstyle: true
+//
+// With minio-go, for example:
+//
+//	client, err := minio.New(u.Host, &minio.Options{
+//		Creds:        credentials.NewStaticV4(gc.ObjectStore.AccessKey, gc.ObjectStore.SecretKey, ""),
+//		Secure:       u.Scheme == "https",
+//		Region:       gc.ObjectStore.Region,
+//		BucketLookup: minio.BucketLookupPath,
+//	})
+type ObjectStoreConfig struct {
+	Endpoint      string `yaml:"endpoint" env:"S3ENDPOINT"`
+	Region        string `yaml:"region" env:"AWS_REGION"`
+	Bucket        string `yaml:"bucket" env:"S3BUCKET"`
+	AccessKey     string `yaml:"accesskey" env:"AWS_ACCESS_KEY_ID"`
+	SecretKey     string `yaml:"secretkey" env:"AWS_SECRET_ACCESS_KEY"`
+	PathStyle     bool   `yaml:"pathstyle"`
+	SkipTLSVerify bool   `yaml:"skiptlsverify"`
+}
+
+// Verify checks the endpoint, the bucket name against the S3 naming rules, and that credentials are
+// either complete or absent.  Region defaults to us-east-1.
+func (cfg *ObjectStoreConfig) Verify() error {
+	var err error
+
+	if len(cfg.Bucket) == 0 {
+		return fmt.Errorf("missing object store bucket (or S3BUCKET environment variable)")
+	}
+	err = validateS3BucketName(cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Endpoint) > 0 {
+		_, err = validateURL(cfg.Endpoint, "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid object store endpoint: %w", err)
+		}
+	}
+	if len(cfg.Region) == 0 {
+		cfg.Region = "us-east-1"
+	}
+	if len(cfg.AccessKey) == 0 && len(cfg.SecretKey) > 0 {
+		return fmt.Errorf("object store secretkey given without accesskey (or AWS_ACCESS_KEY_ID environment variable)")
+	}
+	if len(cfg.AccessKey) > 0 && len(cfg.SecretKey) == 0 {
+		return fmt.Errorf("object store accesskey given without secretkey (or AWS_SECRET_ACCESS_KEY environment variable)")
+	}
+	if cfg.SkipTLSVerify {
+		warnf("object store TLS certificate verification is disabled")
+	}
+	return nil
+}
+
+func validateS3BucketName(name string) error {
+	if !s3BucketRE.MatchString(name) {
+		return fmt.Errorf("invalid bucket name %q: must be 3-63 lowercase letters, digits, dots, or hyphens, beginning and ending with a letter or digit", name)
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, ".-") || strings.Contains(name, "-.") {
+		return fmt.Errorf("invalid bucket name %q: adjacent periods and hyphens are not allowed", name)
+	}
+	if net.ParseIP(name) != nil {
+		return fmt.Errorf("invalid bucket name %q: must not be formatted as an IP address", name)
+	}
+	if strings.HasPrefix(name, "xn--") {
+		return fmt.Errorf("invalid bucket name %q: must not begin with xn--", name)
+	}
+	return nil
+}
+
+// GCSConfig configures access to a Google Cloud Storage bucket.  If CredentialsFile is empty the client is
+// expected to use Application Default Credentials.  Prefix is prepended to every object name, and
+// SignedURLTTL is the lifetime of generated signed URLs (V4 signing allows at most 7 days).
+//
+//	gcs:
+//	  bucket: acme-uploads
+//	  credentialsfile: /etc/acme/gcs-sa.json
+//	  prefix: uploads/
+//	  signedurlttl: 15m
+type GCSConfig struct {
+	Bucket          string        `yaml:"bucket" env:"GCSBUCKET"`
+	CredentialsFile string        `yaml:"credentialsfile" env:"GOOGLE_APPLICATION_CREDENTIALS"`
+	Prefix          string        `yaml:"prefix"`
+	SignedURLTTL    time.Duration `yaml:"signedurlttl"`
+}
+
+// Verify checks the bucket name, that the credentials file exists if one is given, and defaults
+// SignedURLTTL to 15 minutes.
+func (cfg *GCSConfig) Verify() error {
+	var (
+		info os.FileInfo
+		err  error
+	)
+
+	if len(cfg.Bucket) == 0 {
+		return fmt.Errorf("missing GCS bucket (or GCSBUCKET environment variable)")
+	}
+	if !gcsBucketRE.MatchString(cfg.Bucket) || strings.HasPrefix(cfg.Bucket, "goog") {
+		return fmt.Errorf("invalid GCS bucket name %q", cfg.Bucket)
+	}
+
+	if len(cfg.CredentialsFile) > 0 {
+		info, err = os.Stat(cfg.CredentialsFile)
+		if err != nil {
+			return fmt.Errorf("GCS credentialsfile: %w", err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("GCS credentialsfile %s is a directory", cfg.CredentialsFile)
+		}
+	}
+
+	if strings.HasPrefix(cfg.Prefix, "/") {
+		return fmt.Errorf("GCS prefix should not begin with '/': %q", cfg.Prefix)
+	}
+	if cfg.SignedURLTTL < 0 || cfg.SignedURLTTL > 7*24*time.Hour {
+		return fmt.Errorf("GCS signedurlttl must be between 0 and 7 days, got %s", cfg.SignedURLTTL)
+	}
+	if cfg.SignedURLTTL == 0 {
+		cfg.SignedURLTTL = 15 * time.Minute
+	}
+	return nil
+}
+
+// AzureBlobConfig configures access to an Azure Blob Storage container.  At most one of SASToken and
+// AccountKey should be given; with neither the client is expected to use a managed identity or other
+// token credential.  EndpointSuffix defaults to the public cloud, core.windows.net.
+//
+//	azureblob:
+//	  account: acmeuploads
+//	  container: uploads
+type AzureBlobConfig struct {
+	Account        string `yaml:"account" env:"AZURE_STORAGE_ACCOUNT"`
+	Container      string `yaml:"container" env:"AZURE_STORAGE_CONTAINER"`
+	SASToken       string `yaml:"sastoken" env:"AZURE_STORAGE_SAS_TOKEN"`
+	AccountKey     string `yaml:"accountkey" env:"AZURE_STORAGE_KEY"`
+	EndpointSuffix string `yaml:"endpointsuffix"`
+}
+
+// Verify checks the account and container names against the Azure naming rules and that the credentials
+// are consistent.
+func (cfg *AzureBlobConfig) Verify() error {
+	var err error
+
+	if len(cfg.Account) == 0 {
+		return fmt.Errorf("missing Azure storage account (or AZURE_STORAGE_ACCOUNT environment variable)")
+	}
+	if !azureAccountRE.MatchString(cfg.Account) {
+		return fmt.Errorf("invalid Azure storage account %q: must be 3-24 lowercase letters or digits", cfg.Account)
+	}
+	if len(cfg.Container) == 0 {
+		return fmt.Errorf("missing Azure storage container (or AZURE_STORAGE_CONTAINER environment variable)")
+	}
+	if !azureContainerRE.MatchString(cfg.Container) || strings.Contains(cfg.Container, "--") {
+		return fmt.Errorf("invalid Azure container name %q: must be 3-63 lowercase letters, digits, or single hyphens, beginning and ending with a letter or digit", cfg.Container)
+	}
+
+	if len(cfg.SASToken) > 0 && len(cfg.AccountKey) > 0 {
+		return fmt.Errorf("only one of Azure sastoken and accountkey may be given")
+	}
+	if len(cfg.AccountKey) > 0 {
+		_, err = base64.StdEncoding.DecodeString(cfg.AccountKey)
+		if err != nil {
+			return fmt.Errorf("invalid Azure accountkey: %w", err)
+		}
+	}
+	cfg.SASToken = strings.TrimPrefix(cfg.SASToken, "?")
+
+	if len(cfg.EndpointSuffix) == 0 {
+		cfg.EndpointSuffix = "core.windows.net"
+	}
+	if strings.Contains(cfg.EndpointSuffix, "/") {
+		return fmt.Errorf("invalid Azure endpointsuffix %q: should be a domain such as core.windows.net", cfg.EndpointSuffix)
+	}
+	return nil
+}
+
+// ServiceURL returns the blob service URL for the account, including the SAS token if one is configured.
+func (cfg *AzureBlobConfig) ServiceURL() string {
+	var (
+		suffix string
+		u      string
+	)
+
+	suffix = cfg.EndpointSuffix
+	if len(suffix) == 0 {
+		suffix = "core.windows.net"
+	}
+	u = "https://" + cfg.Account + ".blob." + suffix + "/"
+	if len(cfg.SASToken) > 0 {
+		u += "?" + strings.TrimPrefix(cfg.SASToken, "?")
+	}
+	return u
+}
@@ -0,0 +1,194 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// HTTPOCSPConfig enables OCSP stapling for the static certificate.  Responses are fetched in the background
+// from the responder named in the certificate, or ResponderURL if set, and refreshed every RefreshInterval
+// (1 hour by default) or sooner if the current response is about to expire.  The certificate file must
+// include the issuing certificate after the leaf.
+type HTTPOCSPConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	RefreshInterval time.Duration `yaml:"refreshinterval"`
+	ResponderURL    string        `yaml:"responderurl"`
+}
+
+// Verify defaults RefreshInterval and checks ResponderURL.  Nothing is checked when stapling is not enabled.
+func (cfg *HTTPOCSPConfig) Verify() error {
+	var err error
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.RefreshInterval == 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.RefreshInterval < time.Minute {
+		return fmt.Errorf("http ocsp refreshinterval must be at least 1m")
+	}
+	if len(cfg.ResponderURL) > 0 {
+		_, err = validateURL(cfg.ResponderURL, "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid http ocsp responderurl: %w", err)
+		}
+	}
+	return nil
+}
+
+// ocspStapler attaches OCSP responses to the certificates returned by an underlying GetCertificate.
+type ocspStapler struct {
+	cfg     HTTPOCSPConfig
+	source  func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	client  *http.Client
+	mu      sync.RWMutex
+	staples map[string][]byte
+}
+
+func newOCSPStapler(cfg HTTPOCSPConfig, source func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *ocspStapler {
+	return &ocspStapler{
+		cfg:     cfg,
+		source:  source,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		staples: make(map[string][]byte),
+	}
+}
+
+// GetCertificate returns the current certificate with its staple, if one has been fetched.
+func (s *ocspStapler) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var (
+		cert    *tls.Certificate
+		stapled tls.Certificate
+		staple  []byte
+		err     error
+	)
+
+	cert, err = s.source(hello)
+	if err != nil || cert == nil || len(cert.Certificate) == 0 {
+		return cert, err
+	}
+	s.mu.RLock()
+	staple = s.staples[string(cert.Certificate[0])]
+	s.mu.RUnlock()
+	if len(staple) == 0 {
+		return cert, nil
+	}
+	stapled = *cert
+	stapled.OCSPStaple = staple
+	return &stapled, nil
+}
+
+// run refreshes the staple for the current certificate until ctx is done.
+func (s *ocspStapler) run(ctx context.Context) {
+	var (
+		wait  time.Duration
+		timer *time.Timer
+		err   error
+	)
+
+	for {
+		wait, err = s.refresh(ctx)
+		if err != nil {
+			warnf("OCSP staple refresh failed: %v", err)
+			wait = time.Minute
+		}
+		timer = time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// refresh fetches a response for the current certificate and returns how long to wait before the next fetch.
+func (s *ocspStapler) refresh(ctx context.Context) (time.Duration, error) {
+	var (
+		cert      *tls.Certificate
+		leaf      *x509.Certificate
+		issuer    *x509.Certificate
+		responder string
+		body      []byte
+		req       *http.Request
+		resp      *http.Response
+		parsed    *ocsp.Response
+		wait      time.Duration
+		err       error
+	)
+
+	cert, err = s.source(nil)
+	if err != nil {
+		return 0, err
+	}
+	if cert == nil || len(cert.Certificate) < 2 {
+		return 0, fmt.Errorf("certificate chain does not include the issuer")
+	}
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return 0, err
+	}
+	issuer, err = x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return 0, err
+	}
+	responder = s.cfg.ResponderURL
+	if len(responder) == 0 {
+		if len(leaf.OCSPServer) == 0 {
+			return 0, fmt.Errorf("certificate has no OCSP responder and no responderurl is configured")
+		}
+		responder = leaf.OCSPServer[0]
+	}
+
+	body, err = ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return 0, err
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	_ = resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("OCSP responder %s returned %s", responder, resp.Status)
+	}
+	parsed, err = ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.Status != ocsp.Good {
+		return 0, fmt.Errorf("OCSP status for certificate %s is not good (%d)", leaf.SerialNumber, parsed.Status)
+	}
+
+	s.mu.Lock()
+	s.staples = map[string][]byte{string(cert.Certificate[0]): body}
+	s.mu.Unlock()
+
+	wait = s.cfg.RefreshInterval
+	if !parsed.NextUpdate.IsZero() && time.Until(parsed.NextUpdate)/2 < wait {
+		wait = time.Until(parsed.NextUpdate) / 2
+	}
+	if wait < time.Minute {
+		wait = time.Minute
+	}
+	return wait, nil
+}
@@ -0,0 +1,185 @@
+package serverconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDCConfig holds the settings for single sign-on with an OpenID Connect provider.  Scopes defaults to
+// openid, profile, and email.  AllowedDomains, if given, restricts sign-in to users whose email address is
+// in one of those domains.  If Discover is set, Verify fetches the provider's discovery document so that a
+// wrong issuer is found at startup; the endpoints found are available from Metadata.
+//
+//	oidc:
+//	  issuerurl: https://accounts.google.com
+//	  clientid: 1234.apps.googleusercontent.com
+//	  redirecturl: https://www.acme.com/auth/callback
+//	  alloweddomains: [acme.com]
+//	  discover: true
+type OIDCConfig struct {
+	IssuerURL      string   `yaml:"issuerurl" env:"OIDCISSUER"`
+	ClientID       string   `yaml:"clientid" env:"OIDCCLIENTID"`
+	ClientSecret   string   `yaml:"clientsecret" env:"OIDCCLIENTSECRET"`
+	RedirectURL    string   `yaml:"redirecturl"`
+	Scopes         []string `yaml:"scopes"`
+	AllowedDomains []string `yaml:"alloweddomains"`
+	Discover       bool     `yaml:"discover"`
+	metadata       *OIDCProviderMetadata
+}
+
+// OIDCProviderMetadata is the subset of the OpenID Connect discovery document used by clients.
+type OIDCProviderMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	ScopesSupported       []string `json:"scopes_supported"`
+}
+
+// Verify checks the issuer and redirect URLs, the client credentials, scopes, and allowed domains.  The
+// issuer must use https except for localhost, which is allowed for development.
+func (cfg *OIDCConfig) Verify() error {
+	return cfg.verify(true)
+}
+
+// verifyOffline is Verify without discovery.
+func (cfg *OIDCConfig) verifyOffline() error {
+	return cfg.verify(false)
+}
+
+// verify is Verify, fetching the discovery document only when probe is set.
+func (cfg *OIDCConfig) verify(probe bool) error {
+	var (
+		err error
+		i   int
+	)
+
+	if len(cfg.IssuerURL) == 0 {
+		return fmt.Errorf("missing OIDC issuerurl (or OIDCISSUER environment variable)")
+	}
+	err = validateSecureURL(cfg.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("invalid OIDC issuerurl: %w", err)
+	}
+	if len(cfg.ClientID) == 0 {
+		return fmt.Errorf("missing OIDC clientid (or OIDCCLIENTID environment variable)")
+	}
+	if len(cfg.ClientSecret) == 0 {
+		return fmt.Errorf("missing OIDC clientsecret (or OIDCCLIENTSECRET environment variable)")
+	}
+	if len(cfg.RedirectURL) == 0 {
+		return fmt.Errorf("missing OIDC redirecturl")
+	}
+	err = validateSecureURL(cfg.RedirectURL)
+	if err != nil {
+		return fmt.Errorf("invalid OIDC redirecturl: %w", err)
+	}
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if !containsString(cfg.Scopes, "openid") {
+		return fmt.Errorf("OIDC scopes must include openid")
+	}
+	for i = 0; i < len(cfg.AllowedDomains); i++ {
+		cfg.AllowedDomains[i] = strings.ToLower(strings.TrimPrefix(cfg.AllowedDomains[i], "@"))
+		err = validateHostname(cfg.AllowedDomains[i])
+		if err != nil {
+			return fmt.Errorf("invalid OIDC alloweddomains entry: %w", err)
+		}
+	}
+
+	if probe && cfg.Discover {
+		_, err = cfg.FetchMetadata(context.Background())
+		if err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// FetchMetadata retrieves the provider's discovery document from <issuer>/.well-known/openid-configuration
+// and checks that it names the configured issuer.  The result is kept and returned by Metadata.
+func (cfg *OIDCConfig) FetchMetadata(ctx context.Context) (*OIDCProviderMetadata, error) {
+	var (
+		req    *http.Request
+		resp   *http.Response
+		client *http.Client
+		md     OIDCProviderMetadata
+		cancel context.CancelFunc
+		err    error
+	)
+
+	ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(cfg.IssuerURL, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	client = &http.Client{}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery document returned %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&md)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse discovery document: %w", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != strings.TrimSuffix(cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("discovery document issuer %q does not match issuerurl %q", md.Issuer, cfg.IssuerURL)
+	}
+	if len(md.AuthorizationEndpoint) == 0 || len(md.TokenEndpoint) == 0 || len(md.JWKSURI) == 0 {
+		return nil, fmt.Errorf("discovery document is missing required endpoints")
+	}
+	cfg.metadata = &md
+	return &md, nil
+}
+
+// Metadata returns the discovery document fetched by FetchMetadata, or nil if it hasn't been fetched.
+func (cfg OIDCConfig) Metadata() *OIDCProviderMetadata {
+	return cfg.metadata
+}
+
+// DomainAllowed reports whether the email address is in one of the AllowedDomains, or true if no domains
+// are configured.
+func (cfg OIDCConfig) DomainAllowed(email string) bool {
+	var at int
+
+	if len(cfg.AllowedDomains) == 0 {
+		return true
+	}
+	at = strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	return containsString(cfg.AllowedDomains, strings.ToLower(email[at+1:]))
+}
+
+// validateSecureURL checks raw is an https URL, or http to a loopback host.
+func validateSecureURL(raw string) error {
+	var (
+		u   *url.URL
+		err error
+	)
+
+	u, err = validateURL(raw, "http", "https")
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "http" && !isLocalhost(u.Hostname()) {
+		return fmt.Errorf("%q must use https", raw)
+	}
+	return nil
+}
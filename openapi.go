@@ -0,0 +1,209 @@
+package serverconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIConfig controls serving an OpenAPI (or Swagger 2.0) specification and a Swagger UI page for it.
+// SpecFile is the JSON or YAML spec, read and checked by Verify so that a missing or broken spec stops the
+// server at startup rather than being found by the API's consumers.  A spec compiled into the program is
+// given to SetSpec instead, with Embedded set.  The spec is served at SpecPath, defaulting to
+// /openapi.yaml for a YAML SpecFile and /openapi.json otherwise, and the UI at UIPath, defaulting to /docs.  The UI page loads Swagger UI
+// from unpkg.com.
+//
+// Environments, if given, limits serving to those App section environments.  When User and Password are
+// supplied both paths are protected with basic authentication.
+//
+//	openapi:
+//	  enabled: true
+//	  specfile: /srv/api/openapi.yaml
+//	  environments: [dev, staging]
+type OpenAPIConfig struct {
+	Enabled      bool     `yaml:"enabled" env:"OPENAPIENABLED"`
+	SpecFile     string   `yaml:"specfile" env:"OPENAPISPEC"`
+	Embedded     bool     `yaml:"embedded"`
+	SpecPath     string   `yaml:"specpath"`
+	UIPath       string   `yaml:"uipath"`
+	Environments []string `yaml:"environments"`
+	User         string   `yaml:"user" env:"OPENAPIUSER"`
+	Password     string   `yaml:"password" env:"OPENAPIPASS"`
+	spec         []byte
+	specJSON     bool
+}
+
+// Verify reads and parses SpecFile, defaults the paths, and checks Environments.  Nothing is checked when
+// serving is not enabled.
+func (cfg *OpenAPIConfig) Verify() error {
+	var (
+		data []byte
+		ok   bool
+		err  error
+		i    int
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Embedded {
+		if len(cfg.SpecFile) > 0 {
+			return fmt.Errorf("openapi specfile and embedded are mutually exclusive")
+		}
+	} else {
+		if len(cfg.SpecFile) == 0 {
+			return fmt.Errorf("missing openapi specfile (or OPENAPISPEC environment variable)")
+		}
+		data, err = os.ReadFile(cfg.SpecFile)
+		if err != nil {
+			return fmt.Errorf("unable to read openapi specfile: %w", err)
+		}
+		cfg.specJSON, err = parseOpenAPISpec(data)
+		if err != nil {
+			return fmt.Errorf("openapi specfile %s: %w", cfg.SpecFile, err)
+		}
+		cfg.spec = data
+	}
+	if len(cfg.SpecPath) == 0 {
+		if cfg.Embedded || cfg.specJSON {
+			cfg.SpecPath = "/openapi.json"
+		} else {
+			cfg.SpecPath = "/openapi.yaml"
+		}
+	}
+	if len(cfg.UIPath) == 0 {
+		cfg.UIPath = "/docs"
+	}
+	if !strings.HasPrefix(cfg.SpecPath, "/") || !strings.HasPrefix(cfg.UIPath, "/") {
+		return fmt.Errorf("openapi specpath and uipath must begin with '/'")
+	}
+	if cfg.SpecPath == cfg.UIPath {
+		return fmt.Errorf("openapi specpath and uipath cannot both be %s", cfg.SpecPath)
+	}
+	for i = 0; i < len(cfg.Environments); i++ {
+		cfg.Environments[i], ok = normalizeEnvironment(cfg.Environments[i])
+		if !ok {
+			return fmt.Errorf("invalid openapi environments entry %q (expected dev, staging, or prod)", cfg.Environments[i])
+		}
+	}
+	if (len(cfg.User) == 0) != (len(cfg.Password) == 0) {
+		return fmt.Errorf("openapi basic-auth requires both user and password (or OPENAPIUSER and OPENAPIPASS environment variables)")
+	}
+	return nil
+}
+
+// SetSpec checks and sets a spec compiled into the program, for use with Embedded.
+//
+//	//go:embed openapi.json
+//	var spec []byte
+//
+//	err = gc.OpenAPI.SetSpec(spec)
+func (cfg *OpenAPIConfig) SetSpec(data []byte) error {
+	var err error
+
+	cfg.specJSON, err = parseOpenAPISpec(data)
+	if err != nil {
+		return fmt.Errorf("openapi spec: %w", err)
+	}
+	cfg.spec = data
+	return nil
+}
+
+// Active reports whether the spec should be served, given Enabled, Environments, and the environment
+// returned by CurrentApp.
+func (cfg *OpenAPIConfig) Active() bool {
+	return cfg.Enabled && (len(cfg.Environments) == 0 || containsString(cfg.Environments, CurrentApp().Environment))
+}
+
+// Handler returns a handler serving the spec at SpecPath and the Swagger UI at UIPath.  If the spec is not
+// active, or no spec has been set, the handler responds with 404 to everything.
+//
+//	docs := gc.OpenAPI.Handler()
+//	mux.Handle(gc.OpenAPI.SpecPath, docs)
+//	mux.Handle(gc.OpenAPI.UIPath, docs)
+func (cfg *OpenAPIConfig) Handler() http.Handler {
+	var (
+		mux         *http.ServeMux
+		spec        []byte
+		contentType string
+		page        string
+	)
+
+	if !cfg.Active() || len(cfg.spec) == 0 {
+		return http.NotFoundHandler()
+	}
+	spec = cfg.spec
+	contentType = "application/yaml"
+	if cfg.specJSON {
+		contentType = "application/json"
+	}
+	page = fmt.Sprintf(swaggerUIPage, html.EscapeString(cfg.SpecPath))
+
+	mux = http.NewServeMux()
+	mux.HandleFunc(cfg.SpecPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(spec)
+	})
+	mux.HandleFunc(cfg.UIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	})
+	if len(cfg.User) > 0 {
+		return basicAuthHandler(cfg.User, cfg.Password, "openapi", mux)
+	}
+	return mux
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "%s", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// parseOpenAPISpec checks that data is a JSON or YAML document with an openapi 3.x or swagger 2.0 version
+// and an info title, and reports whether it is JSON.
+func parseOpenAPISpec(data []byte) (bool, error) {
+	var (
+		doc struct {
+			OpenAPI string `json:"openapi" yaml:"openapi"`
+			Swagger string `json:"swagger" yaml:"swagger"`
+			Info    struct {
+				Title string `json:"title" yaml:"title"`
+			} `json:"info" yaml:"info"`
+		}
+		isJSON bool
+		err    error
+	)
+
+	isJSON = bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	if isJSON {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return isJSON, fmt.Errorf("unable to parse: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") && doc.Swagger != "2.0" {
+		return isJSON, fmt.Errorf("not an OpenAPI 3.x or Swagger 2.0 document")
+	}
+	if len(doc.Info.Title) == 0 {
+		return isJSON, fmt.Errorf("missing info title")
+	}
+	return isJSON, nil
+}
@@ -0,0 +1,154 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OTelConfig configures an OpenTelemetry OTLP trace exporter.  Protocol is either "grpc" (the default) or
+// "http".  For grpc the Endpoint may be a host:port pair or a URL, for http it must be a URL.  SampleRatio is
+// the fraction of traces sampled, from 0 to 1, and defaults to 1 (sample everything) if not given.
+//
+//	otel:
+//	  enabled: true
+//	  endpoint: otel-collector:4317
+//	  servicename: billing
+//	  sampleratio: 0.25
+type OTelConfig struct {
+	Enabled        bool              `yaml:"enabled" env:"OTELENABLED"`
+	Endpoint       string            `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Protocol       string            `yaml:"protocol"`
+	Headers        map[string]string `yaml:"headers"`
+	SampleRatio    *float64          `yaml:"sampleratio"`
+	ServiceName    string            `yaml:"servicename" env:"OTEL_SERVICE_NAME"`
+	ServiceVersion string            `yaml:"serviceversion"`
+	Insecure       bool              `yaml:"insecure"`
+}
+
+// Verify checks the exporter endpoint, protocol, and sampling ratio.  Nothing is checked when tracing is
+// not enabled.
+func (cfg *OTelConfig) Verify() error {
+	var (
+		u   *url.URL
+		err error
+	)
+
+	if !cfg.Enabled {
+		return nil
+	}
+
+	cfg.Protocol = strings.ToLower(strings.TrimSpace(cfg.Protocol))
+	if len(cfg.Protocol) == 0 {
+		cfg.Protocol = "grpc"
+	}
+	if cfg.Protocol != "grpc" && cfg.Protocol != "http" {
+		return fmt.Errorf("invalid otel protocol %q (expected grpc or http)", cfg.Protocol)
+	}
+
+	if len(cfg.Endpoint) == 0 {
+		return fmt.Errorf("missing otel endpoint (or OTEL_EXPORTER_OTLP_ENDPOINT environment variable)")
+	}
+	if strings.Contains(cfg.Endpoint, "://") {
+		u, err = validateURL(cfg.Endpoint, "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid otel endpoint: %w", err)
+		}
+		if cfg.Insecure && u.Scheme == "https" {
+			return fmt.Errorf("otel endpoint %q uses https but insecure is set", cfg.Endpoint)
+		}
+	} else {
+		if cfg.Protocol == "http" {
+			return fmt.Errorf("otel endpoint must be a URL when protocol is http: %q", cfg.Endpoint)
+		}
+		err = validateHostPort(cfg.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid otel endpoint: %w", err)
+		}
+	}
+
+	if cfg.SampleRatio == nil {
+		cfg.SampleRatio = new(float64)
+		*cfg.SampleRatio = 1
+	}
+	if *cfg.SampleRatio < 0 || *cfg.SampleRatio > 1 {
+		return fmt.Errorf("otel sampleratio must be between 0 and 1, got %g", *cfg.SampleRatio)
+	}
+	if len(cfg.ServiceName) == 0 {
+		return fmt.Errorf("missing otel servicename (or OTEL_SERVICE_NAME environment variable)")
+	}
+	return nil
+}
+
+// ExporterEnv returns the settings as the standard OTEL_* environment variables understood by the
+// OpenTelemetry SDK exporters and samplers, so that no OpenTelemetry types are needed here.  The fields of a
+// verified AppConfig are included in the resource attributes, with ServiceVersion taking precedence.  The SDKs
+// parse the endpoint as a URL, so a grpc host:port is given the http scheme when Insecure is set and https
+// otherwise:
+//
+//	for k, v := range gc.OTel.ExporterEnv() {
+//		os.Setenv(k, v)
+//	}
+//	exporter, err := otlptracegrpc.New(ctx)
+func (cfg *OTelConfig) ExporterEnv() map[string]string {
+	var (
+		env      map[string]string
+		protocol string
+		keys     []string
+		headers  []string
+		attrs    map[string]string
+		resource []string
+		k        string
+	)
+
+	env = make(map[string]string)
+	protocol = "grpc"
+	if cfg.Protocol == "http" {
+		protocol = "http/protobuf"
+	}
+	env["OTEL_EXPORTER_OTLP_PROTOCOL"] = protocol
+	env["OTEL_EXPORTER_OTLP_ENDPOINT"] = cfg.Endpoint
+	if !strings.Contains(cfg.Endpoint, "://") {
+		if cfg.Insecure {
+			env["OTEL_EXPORTER_OTLP_ENDPOINT"] = "http://" + cfg.Endpoint
+		} else {
+			env["OTEL_EXPORTER_OTLP_ENDPOINT"] = "https://" + cfg.Endpoint
+		}
+	}
+	env["OTEL_EXPORTER_OTLP_INSECURE"] = strconv.FormatBool(cfg.Insecure)
+	env["OTEL_TRACES_SAMPLER"] = "parentbased_traceidratio"
+	if cfg.SampleRatio != nil {
+		env["OTEL_TRACES_SAMPLER_ARG"] = strconv.FormatFloat(*cfg.SampleRatio, 'g', -1, 64)
+	}
+	env["OTEL_SERVICE_NAME"] = cfg.ServiceName
+
+	if len(cfg.Headers) > 0 {
+		for k = range cfg.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k = range keys {
+			headers = append(headers, url.PathEscape(k)+"="+url.PathEscape(cfg.Headers[k]))
+		}
+		env["OTEL_EXPORTER_OTLP_HEADERS"] = strings.Join(headers, ",")
+	}
+	attrs = CurrentApp().resourceAttributes()
+	if len(cfg.ServiceVersion) > 0 {
+		attrs["service.version"] = cfg.ServiceVersion
+	}
+	if len(attrs) > 0 {
+		keys = keys[:0]
+		for k = range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k = range keys {
+			resource = append(resource, k+"="+url.PathEscape(attrs[k]))
+		}
+		env["OTEL_RESOURCE_ATTRIBUTES"] = strings.Join(resource, ",")
+	}
+
+	return env
+}
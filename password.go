@@ -0,0 +1,206 @@
+package serverconfig
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHashConfig holds the password hashing parameters, so that they can be tuned to the hardware of
+// each deployment.  Algorithm is argon2id (the default) or bcrypt.  Cost is the bcrypt cost, at least 10
+// and defaulting to 12.  Memory, Iterations, and Parallelism are the argon2id parameters, defaulting to
+// 64MiB, 3, and 2; the minimums follow the OWASP recommendation of 19MiB with 2 iterations.
+//
+//	passwordhash:
+//	  algorithm: argon2id
+//	  memory: 128MiB
+//	  iterations: 4
+//	  parallelism: 4
+type PasswordHashConfig struct {
+	Algorithm   string   `yaml:"algorithm"`
+	Cost        int      `yaml:"cost"`
+	Memory      ByteSize `yaml:"memory"`
+	Iterations  int      `yaml:"iterations"`
+	Parallelism int      `yaml:"parallelism"`
+}
+
+// PasswordHasher hashes and checks passwords.  Hashes are self-describing, so Compare accepts hashes made
+// with either algorithm and any parameters, and NeedsRehash reports those made with other settings so
+// they can be replaced at the user's next login.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// Verify applies the defaults and rejects parameters below the safe minimums.
+func (cfg *PasswordHashConfig) Verify() error {
+	cfg.Algorithm = strings.ToLower(strings.TrimSpace(cfg.Algorithm))
+	switch cfg.Algorithm {
+	case "", "argon2id":
+		cfg.Algorithm = "argon2id"
+		if cfg.Memory == 0 {
+			cfg.Memory = 64 << 20
+		}
+		if cfg.Iterations == 0 {
+			cfg.Iterations = 3
+		}
+		if cfg.Parallelism == 0 {
+			cfg.Parallelism = 2
+		}
+		if cfg.Memory < 19<<20 || cfg.Memory > 4<<30 {
+			return fmt.Errorf("passwordhash memory must be between 19MiB and 4GiB, got %s", cfg.Memory)
+		}
+		if cfg.Iterations < 2 || cfg.Iterations > 100 {
+			return fmt.Errorf("passwordhash iterations must be between 2 and 100, got %d", cfg.Iterations)
+		}
+		if cfg.Parallelism < 1 || cfg.Parallelism > 255 {
+			return fmt.Errorf("passwordhash parallelism must be between 1 and 255, got %d", cfg.Parallelism)
+		}
+		if cfg.Cost != 0 {
+			warnf("passwordhash cost is ignored by argon2id")
+		}
+	case "bcrypt":
+		if cfg.Cost == 0 {
+			cfg.Cost = 12
+		}
+		if cfg.Cost < 10 || cfg.Cost > bcrypt.MaxCost {
+			return fmt.Errorf("passwordhash cost must be between 10 and %d, got %d", bcrypt.MaxCost, cfg.Cost)
+		}
+		if cfg.Memory != 0 || cfg.Iterations != 0 || cfg.Parallelism != 0 {
+			warnf("passwordhash memory, iterations, and parallelism are ignored by bcrypt")
+		}
+	default:
+		return fmt.Errorf("invalid passwordhash algorithm %q (expected argon2id or bcrypt)", cfg.Algorithm)
+	}
+	return nil
+}
+
+// NewHasher returns a PasswordHasher using the configured algorithm and parameters.
+//
+//	hasher := gc.PasswordHash.NewHasher()
+//	ok, err := hasher.Compare(user.PasswordHash, password)
+//	if ok && hasher.NeedsRehash(user.PasswordHash) {
+//		user.PasswordHash, err = hasher.Hash(password)
+//	}
+func (cfg *PasswordHashConfig) NewHasher() PasswordHasher {
+	return &passwordHasher{cfg: *cfg}
+}
+
+type passwordHasher struct {
+	cfg PasswordHashConfig
+}
+
+// argon2idParams holds the parameters encoded in an argon2id hash.
+type argon2idParams struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	var (
+		b   []byte
+		p   argon2idParams
+		err error
+	)
+
+	if h.cfg.Algorithm == "bcrypt" {
+		b, err = bcrypt.GenerateFromPassword([]byte(password), h.cfg.Cost)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	p = argon2idParams{
+		memory:      uint32(h.cfg.Memory >> 10),
+		iterations:  uint32(h.cfg.Iterations),
+		parallelism: uint8(h.cfg.Parallelism),
+		salt:        make([]byte, 16),
+	}
+	_, err = rand.Read(p.salt)
+	if err != nil {
+		return "", err
+	}
+	p.key = argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(p.salt), base64.RawStdEncoding.EncodeToString(p.key)), nil
+}
+
+func (h *passwordHasher) Compare(hash, password string) (bool, error) {
+	var (
+		p   argon2idParams
+		key []byte
+		err error
+	)
+
+	if strings.HasPrefix(hash, "$2") {
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	p, err = parseArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+	key = argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *passwordHasher) NeedsRehash(hash string) bool {
+	var (
+		cost int
+		p    argon2idParams
+		err  error
+	)
+
+	if h.cfg.Algorithm == "bcrypt" {
+		cost, err = bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.cfg.Cost
+	}
+	p, err = parseArgon2idHash(hash)
+	return err != nil || p.memory != uint32(h.cfg.Memory>>10) || p.iterations != uint32(h.cfg.Iterations) ||
+		p.parallelism != uint8(h.cfg.Parallelism)
+}
+
+// parseArgon2idHash decodes a hash in the PHC string format, $argon2id$v=19$m=65536,t=3,p=2$salt$key.
+func parseArgon2idHash(hash string) (argon2idParams, error) {
+	var (
+		p       argon2idParams
+		parts   []string
+		version int
+		err     error
+	)
+
+	parts = strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, fmt.Errorf("unrecognized password hash format")
+	}
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil || p.memory == 0 || p.memory > 4<<20 || p.iterations == 0 || p.parallelism == 0 {
+		return p, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(p.key) == 0 {
+		return p, fmt.Errorf("invalid argon2id key")
+	}
+	return p, nil
+}
@@ -0,0 +1,107 @@
+package serverconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var stripeAPIVersionRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(\.[a-z]+)?$`)
+
+// PaymentConfig holds the payment provider credentials.  Provider is stripe, the default and only provider
+// supported.  PublishableKey is given to the browser, SecretKey (or a restricted key) is used by the
+// server, and WebhookSecret verifies the signatures of webhook events.  APIVersion pins the Stripe API
+// version, such as 2024-06-20; the account's default version is used when it is empty.
+//
+// Live and test keys must not be mixed: the keys must agree with each other, test keys are refused when
+// the App section's environment is prod, and live keys outside prod produce a warning.
+//
+//	payment:
+//	  provider: stripe
+//	  publishablekey: pk_live_XXXXXXXXXXXXXXXXXXXXXXXX
+//	  apiversion: 2024-06-20
+type PaymentConfig struct {
+	Provider       string `yaml:"provider"`
+	PublishableKey string `yaml:"publishablekey" env:"STRIPEPUBLISHABLEKEY"`
+	SecretKey      string `yaml:"secretkey" env:"STRIPESECRETKEY"`
+	WebhookSecret  string `yaml:"webhooksecret" env:"STRIPEWEBHOOKSECRET"`
+	APIVersion     string `yaml:"apiversion"`
+	live           bool
+}
+
+// Verify checks the key prefixes and APIVersion.  The keys are checked against the environment by
+// PostVerify.
+func (cfg *PaymentConfig) Verify() error {
+	var (
+		publishableLive bool
+		secretLive      bool
+		err             error
+	)
+
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	if len(cfg.Provider) == 0 {
+		cfg.Provider = "stripe"
+	}
+	if cfg.Provider != "stripe" {
+		return fmt.Errorf("invalid payment provider %q (expected stripe)", cfg.Provider)
+	}
+	if len(cfg.SecretKey) == 0 {
+		return fmt.Errorf("missing payment secretkey (or STRIPESECRETKEY environment variable)")
+	}
+	secretLive, err = stripeKeyMode(cfg.SecretKey, "sk_", "rk_")
+	if err != nil {
+		return fmt.Errorf("invalid payment secretkey: %w", err)
+	}
+	if len(cfg.PublishableKey) > 0 {
+		publishableLive, err = stripeKeyMode(cfg.PublishableKey, "pk_")
+		if err != nil {
+			return fmt.Errorf("invalid payment publishablekey: %w", err)
+		}
+		if publishableLive != secretLive {
+			return fmt.Errorf("payment publishablekey and secretkey mix live and test modes")
+		}
+	}
+	if len(cfg.WebhookSecret) > 0 && !strings.HasPrefix(cfg.WebhookSecret, "whsec_") {
+		return fmt.Errorf("invalid payment webhooksecret (expected whsec_ prefix)")
+	}
+	if len(cfg.APIVersion) > 0 && !stripeAPIVersionRE.MatchString(cfg.APIVersion) {
+		return fmt.Errorf("invalid payment apiversion %q (expected a date such as 2024-06-20)", cfg.APIVersion)
+	}
+	cfg.live = secretLive
+	return nil
+}
+
+// PostVerify checks the key mode against the environment of root's App section.
+func (cfg *PaymentConfig) PostVerify(root any) error {
+	var app AppConfig
+
+	app = rootApp(root)
+	if app.IsProduction() && !cfg.live {
+		return fmt.Errorf("payment keys are test mode keys but the app environment is prod")
+	}
+	if !app.IsProduction() && cfg.live {
+		warnf("payment keys are live mode keys but the app environment is %q", app.Environment)
+	}
+	return nil
+}
+
+// LiveMode reports whether the keys are live mode keys.
+func (cfg *PaymentConfig) LiveMode() bool {
+	return cfg.live
+}
+
+// stripeKeyMode checks that key begins with one of prefixes followed by live_ or test_, and reports
+// whether it is a live key.
+func stripeKeyMode(key string, prefixes ...string) (bool, error) {
+	var i int
+
+	for i = 0; i < len(prefixes); i++ {
+		if strings.HasPrefix(key, prefixes[i]+"live_") {
+			return true, nil
+		}
+		if strings.HasPrefix(key, prefixes[i]+"test_") {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected a key beginning %slive_ or %stest_", prefixes[0], prefixes[0])
+}
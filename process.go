@@ -0,0 +1,194 @@
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ProcessConfig holds the process settings usually handled by daemonizing code in main().  Apply writes
+// PIDFile, changes to WorkingDir, sets Umask (an octal string such as "027"), switches to User and Group
+// (names or numeric ids), and sets GOMAXPROCS when it is above zero.  User, Group, and Umask are not
+// available on Windows.
+//
+//	process:
+//	  pidfile: /run/billing/billing.pid
+//	  workingdir: /srv/billing
+//	  umask: "027"
+//	  user: billing
+//	  group: billing
+type ProcessConfig struct {
+	PIDFile    string `yaml:"pidfile" env:"PIDFILE"`
+	WorkingDir string `yaml:"workingdir"`
+	Umask      string `yaml:"umask"`
+	User       string `yaml:"user"`
+	Group      string `yaml:"group"`
+	GOMAXPROCS int    `yaml:"gomaxprocs" env:"GOMAXPROCS"`
+	umask      int
+	uid        int
+	gid        int
+}
+
+// Verify parses Umask, looks up User and Group, and checks that WorkingDir exists and that the directory of
+// PIDFile is writable.
+func (cfg *ProcessConfig) Verify() error {
+	var (
+		mask uint64
+		u    *user.User
+		g    *user.Group
+		info os.FileInfo
+		f    *os.File
+		err  error
+	)
+
+	cfg.umask, cfg.uid, cfg.gid = -1, -1, -1
+	err = cfg.verifyPlatform()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Umask) > 0 {
+		mask, err = strconv.ParseUint(cfg.Umask, 8, 32)
+		if err != nil || mask > 0o777 {
+			return fmt.Errorf("invalid process umask %q (expected octal such as 027)", cfg.Umask)
+		}
+		cfg.umask = int(mask)
+	}
+	if len(cfg.User) > 0 {
+		cfg.uid, err = strconv.Atoi(cfg.User)
+		if err != nil {
+			u, err = user.Lookup(cfg.User)
+			if err != nil {
+				return fmt.Errorf("invalid process user: %w", err)
+			}
+			cfg.uid, _ = strconv.Atoi(u.Uid)
+			if len(cfg.Group) == 0 {
+				cfg.gid, _ = strconv.Atoi(u.Gid)
+			}
+		}
+	}
+	if len(cfg.Group) > 0 {
+		cfg.gid, err = strconv.Atoi(cfg.Group)
+		if err != nil {
+			g, err = user.LookupGroup(cfg.Group)
+			if err != nil {
+				return fmt.Errorf("invalid process group: %w", err)
+			}
+			cfg.gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	if cfg.GOMAXPROCS < 0 {
+		return fmt.Errorf("process gomaxprocs cannot be negative")
+	}
+	if len(cfg.WorkingDir) > 0 {
+		info, err = os.Stat(cfg.WorkingDir)
+		if err != nil {
+			return fmt.Errorf("invalid process workingdir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("process workingdir %s is not a directory", cfg.WorkingDir)
+		}
+	}
+	if len(cfg.PIDFile) > 0 {
+		f, err = os.CreateTemp(filepath.Dir(cfg.PIDFile), ".pidcheck-*")
+		if err != nil {
+			return fmt.Errorf("process pidfile directory is not writable: %w", err)
+		}
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	return nil
+}
+
+// Apply puts the settings into effect, in an order that lets a service started as root write its PID file
+// before giving up its privileges.  It fails when PIDFile names a process that is still running.
+//
+//	err = gc.Process.Apply()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer gc.Process.RemovePIDFile()
+func (cfg *ProcessConfig) Apply() error {
+	var err error
+
+	if len(cfg.PIDFile) > 0 {
+		err = writePIDFile(cfg.PIDFile)
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.WorkingDir) > 0 {
+		err = os.Chdir(cfg.WorkingDir)
+		if err != nil {
+			return fmt.Errorf("unable to change to process workingdir: %w", err)
+		}
+	}
+	if cfg.umask >= 0 {
+		setUmask(cfg.umask)
+	}
+	if cfg.gid >= 0 || cfg.uid >= 0 {
+		err = setProcessIDs(cfg.uid, cfg.gid)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.GOMAXPROCS > 0 {
+		runtime.GOMAXPROCS(cfg.GOMAXPROCS)
+	}
+	return nil
+}
+
+// RemovePIDFile removes PIDFile if it still holds this process's id.
+func (cfg *ProcessConfig) RemovePIDFile() error {
+	var (
+		b   []byte
+		err error
+	)
+
+	if len(cfg.PIDFile) == 0 {
+		return nil
+	}
+	b, err = os.ReadFile(cfg.PIDFile)
+	if err != nil || strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	return os.Remove(cfg.PIDFile)
+}
+
+func writePIDFile(path string) error {
+	var (
+		b   []byte
+		pid int
+		f   *os.File
+		err error
+	)
+
+	b, err = os.ReadFile(path)
+	if err == nil {
+		pid, err = strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("process pidfile %s belongs to running process %d", path, pid)
+		}
+		_ = os.Remove(path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read process pidfile: %w", err)
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to create process pidfile: %w", err)
+	}
+	_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write process pidfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+func (cfg *ProcessConfig) verifyPlatform() error {
+	return nil
+}
+
+func setUmask(mask int) {
+	syscall.Umask(mask)
+}
+
+// setProcessIDs switches group before user, as the group can no longer be changed once root is given up.
+func setProcessIDs(uid, gid int) error {
+	var err error
+
+	if gid >= 0 {
+		err = syscall.Setgroups([]int{gid})
+		if err == nil {
+			err = syscall.Setgid(gid)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to set process group: %w", err)
+		}
+	}
+	if uid >= 0 {
+		err = syscall.Setuid(uid)
+		if err != nil {
+			return fmt.Errorf("unable to set process user: %w", err)
+		}
+	}
+	return nil
+}
+
+func processAlive(pid int) bool {
+	var err error
+
+	err = syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
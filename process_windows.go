@@ -0,0 +1,27 @@
+package serverconfig
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cfg *ProcessConfig) verifyPlatform() error {
+	if len(cfg.Umask) > 0 || len(cfg.User) > 0 || len(cfg.Group) > 0 {
+		return fmt.Errorf("process umask, user, and group are not supported on windows")
+	}
+	return nil
+}
+
+func setUmask(mask int) {
+}
+
+func setProcessIDs(uid, gid int) error {
+	return fmt.Errorf("process user and group are not supported on windows")
+}
+
+func processAlive(pid int) bool {
+	var err error
+
+	_, err = os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,223 @@
+package serverconfig
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lastProvenance is the provenance recorded by the last successful Read, returned by Provenance.
+var lastProvenance atomic.Pointer[map[string]string]
+
+// provenanceKeeper is implemented by sections which serve the provenance of the configuration containing
+// them, as DebugConfig does at /debug/config.  Read calls keepProvenance once the provenance is complete.
+type provenanceKeeper interface {
+	keepProvenance(provenance map[string]string)
+}
+
+// Provenance returns where each setting of the configuration read last by Read came from, keyed by the
+// dotted yaml path of the setting, such as http.bindaddr.  The source is "file" for settings given in the
+// file, "env:NAME" for those overridden by an environment variable, "secret:PATH" for those overridden by a
+// file in the secrets directory, and "default" for those filled in by Verify.  Settings left at their zero
+// value are not listed.  It returns nil when nothing has been read.  Use WithProvenance for the provenance
+// of a particular configuration, since another Read replaces this one.
+func Provenance() map[string]string {
+	var p *map[string]string
+
+	p = lastProvenance.Load()
+	if p == nil {
+		return nil
+	}
+	return maps.Clone(*p)
+}
+
+// WithProvenance has Read store the provenance of the configuration it reads in *provenance, as described
+// for Provenance, once the configuration passes verification.
+//
+//	err := serverconfig.Read("config.yaml", &cfg, serverconfig.WithProvenance(&provenance))
+//	handler := serverconfig.ConfigHandler(&cfg, provenance)
+func WithProvenance(provenance *map[string]string) ReadOption {
+	return func(options *readOptions) {
+		options.provenance = provenance
+	}
+}
+
+// callKeepProvenance gives provenance to value if it is a provenanceKeeper.
+func callKeepProvenance(value reflect.Value, provenance map[string]string) {
+	var (
+		keeper provenanceKeeper
+		ok     bool
+	)
+
+	if value.Kind() != reflect.Pointer && value.CanAddr() {
+		value = value.Addr()
+	}
+	if !value.IsValid() || (value.Kind() == reflect.Pointer && value.IsNil()) || !value.CanInterface() {
+		return
+	}
+	keeper, ok = value.Interface().(provenanceKeeper)
+	if ok {
+		keeper.keepProvenance(provenance)
+	}
+}
+
+// yamlFieldName returns the key of a struct field in yaml, which is empty when the field is inlined into its
+// parent, and whether it is inlined.
+func yamlFieldName(field reflect.StructField) (string, bool) {
+	var (
+		name string
+		opts string
+	)
+
+	name, opts, _ = strings.Cut(field.Tag.Get("yaml"), ",")
+	if containsString(strings.Split(opts, ","), "inline") {
+		return "", true
+	}
+	if len(name) == 0 {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+// joinYAMLPath appends key to the dotted path.
+func joinYAMLPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	if len(key) == 0 {
+		return path
+	}
+	return path + "." + key
+}
+
+// fileProvenance records every mapping key of a parsed yaml document as coming from the file.  Sequences
+// are recorded as a whole.
+func fileProvenance(node *yaml.Node, path string, out map[string]string) {
+	var i int
+
+	if node == nil {
+		return
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for i = 0; i < len(node.Content); i++ {
+			fileProvenance(node.Content[i], path, out)
+		}
+	case yaml.AliasNode:
+		fileProvenance(node.Alias, path, out)
+	case yaml.MappingNode:
+		for i = 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "<<" {
+				fileProvenance(node.Content[i+1], path, out)
+				continue
+			}
+			fileProvenance(node.Content[i+1], joinYAMLPath(path, node.Content[i].Value), out)
+		}
+	default:
+		if len(path) > 0 {
+			out[path] = "file"
+		}
+	}
+}
+
+// overrideProvenance records the fields overridden by lookup, following applyOverridesValue.
+func overrideProvenance(value reflect.Value, path string, out map[string]string, lookup overrideLookup) {
+	var (
+		fieldDef reflect.StructField
+		key      string
+		envName  string
+		source   string
+		found    bool
+		i        int
+	)
+
+	for value.IsValid() && value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.Kind() != reflect.Struct {
+		return
+	}
+	for i = 0; i < value.NumField(); i++ {
+		fieldDef = value.Type().Field(i)
+		if len(fieldDef.PkgPath) > 0 {
+			continue
+		}
+		key, _ = yamlFieldName(fieldDef)
+		if key == "-" {
+			continue
+		}
+		envName = fieldDef.Tag.Get("env")
+		if len(envName) > 0 {
+			_, source, found = lookup(envName)
+			if found {
+				out[joinYAMLPath(path, key)] = source
+			}
+		}
+		overrideProvenance(value.Field(i), joinYAMLPath(path, key), out, lookup)
+	}
+}
+
+// defaultProvenance records the non-zero settings that came from neither the file nor the environment,
+// which must have been filled in by Verify.
+func defaultProvenance(value reflect.Value, path string, out map[string]string) {
+	var (
+		fieldDef reflect.StructField
+		key      string
+		keys     []reflect.Value
+		found    bool
+		i        int
+	)
+
+	for value.IsValid() && value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type().NumField() == 0 {
+			break
+		}
+		for i = 0; i < value.NumField(); i++ {
+			fieldDef = value.Type().Field(i)
+			if len(fieldDef.PkgPath) > 0 {
+				continue
+			}
+			key, _ = yamlFieldName(fieldDef)
+			if key == "-" {
+				continue
+			}
+			defaultProvenance(value.Field(i), joinYAMLPath(path, key), out)
+		}
+		return
+	case reflect.Map:
+		_, found = out[path]
+		if found {
+			return
+		}
+		keys = value.MapKeys()
+		for i = 0; i < len(keys); i++ {
+			if keys[i].Kind() == reflect.String {
+				defaultProvenance(value.MapIndex(keys[i]), joinYAMLPath(path, keys[i].String()), out)
+			}
+		}
+		return
+	}
+	if len(path) == 0 || value.IsZero() {
+		return
+	}
+	_, found = out[path]
+	if !found {
+		out[path] = "default"
+	}
+}
@@ -0,0 +1,86 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig selects the proxy used for outbound HTTP requests.  HTTPProxy and HTTPSProxy are proxy URLs
+// (http, https, or socks5) for plain and TLS requests, and NoProxy lists hosts, domains, and CIDR ranges to
+// reach directly, in the NO_PROXY format; "*" disables proxying.  Environment takes the HTTP_PROXY,
+// HTTPS_PROXY, and NO_PROXY environment variables, with any values set here taking precedence.  When nothing
+// is set, Environment defaults to true, as for Go's default transport.  Requests to localhost are never
+// proxied.
+//
+//	http:
+//	  outboundproxy:
+//	    httpsproxy: http://proxy.corp.example:3128
+//	    noproxy: [.corp.example, 10.0.0.0/8]
+type ProxyConfig struct {
+	HTTPProxy   string   `yaml:"httpproxy"`
+	HTTPSProxy  string   `yaml:"httpsproxy"`
+	NoProxy     []string `yaml:"noproxy"`
+	Environment bool     `yaml:"environment"`
+}
+
+// Verify checks the proxy URLs.
+func (cfg *ProxyConfig) Verify() error {
+	var err error
+
+	if len(cfg.HTTPProxy) == 0 && len(cfg.HTTPSProxy) == 0 && len(cfg.NoProxy) == 0 {
+		cfg.Environment = true
+	}
+	if len(cfg.HTTPProxy) > 0 {
+		_, err = validateURL(cfg.HTTPProxy, "http", "https", "socks5")
+		if err != nil {
+			return fmt.Errorf("invalid proxy httpproxy: %w", err)
+		}
+	}
+	if len(cfg.HTTPSProxy) > 0 {
+		_, err = validateURL(cfg.HTTPSProxy, "http", "https", "socks5")
+		if err != nil {
+			return fmt.Errorf("invalid proxy httpsproxy: %w", err)
+		}
+	}
+	return nil
+}
+
+// ProxyFunc returns the function for http.Transport.Proxy.
+func (cfg *ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	var (
+		pc httpproxy.Config
+		fn func(*url.URL) (*url.URL, error)
+	)
+
+	if cfg.Environment || (len(cfg.HTTPProxy) == 0 && len(cfg.HTTPSProxy) == 0 && len(cfg.NoProxy) == 0) {
+		pc = *httpproxy.FromEnvironment()
+	}
+	if len(cfg.HTTPProxy) > 0 {
+		pc.HTTPProxy = cfg.HTTPProxy
+	}
+	if len(cfg.HTTPSProxy) > 0 {
+		pc.HTTPSProxy = cfg.HTTPSProxy
+	}
+	if len(cfg.NoProxy) > 0 {
+		pc.NoProxy = strings.Join(cfg.NoProxy, ",")
+	}
+	fn = pc.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return fn(r.URL)
+	}
+}
+
+// Transport returns a copy of http.DefaultTransport using the configured proxy.
+//
+//	client := &http.Client{Transport: gc.HTTP.OutboundProxy.Transport(), Timeout: 30 * time.Second}
+func (cfg *ProxyConfig) Transport() *http.Transport {
+	var t *http.Transport
+
+	t = http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = cfg.ProxyFunc()
+	return t
+}
@@ -0,0 +1,163 @@
+package serverconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	apnsIDRE       = regexp.MustCompile(`^[A-Z0-9]{10}$`)
+	apnsBundleIDRE = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+)
+
+// PushConfig holds the credentials for mobile push notifications through Firebase Cloud Messaging and the
+// Apple Push Notification service.  Either sub-section may be omitted.
+//
+//	push:
+//	  fcm:
+//	    credentialsfile: /etc/acme/fcm-sa.json
+//	  apns:
+//	    keyid: ABC123DEFG
+//	    teamid: DEF123GHIJ
+//	    keyfile: /etc/acme/AuthKey_ABC123DEFG.p8
+//	    topic: com.acme.app
+//	    sandbox: true
+type PushConfig struct {
+	FCM  *PushFCMConfig  `yaml:"fcm"`
+	APNs *PushAPNsConfig `yaml:"apns"`
+}
+
+// PushFCMConfig holds the Firebase service account used to send FCM messages.  ProjectID defaults to the
+// project of the service account.
+type PushFCMConfig struct {
+	CredentialsFile string `yaml:"credentialsfile" env:"FCMCREDENTIALS"`
+	ProjectID       string `yaml:"projectid" env:"FCMPROJECTID"`
+	clientEmail     string
+}
+
+// PushAPNsConfig holds the token-based credentials used to send APNs notifications.  KeyID and TeamID are the
+// 10 character identifiers from the Apple developer account, KeyFile is the .p8 signing key downloaded for
+// KeyID, and Topic is the app's bundle id.  Sandbox sends to the development environment.
+type PushAPNsConfig struct {
+	KeyID   string `yaml:"keyid" env:"APNSKEYID"`
+	TeamID  string `yaml:"teamid" env:"APNSTEAMID"`
+	KeyFile string `yaml:"keyfile" env:"APNSKEYFILE"`
+	Topic   string `yaml:"topic"`
+	Sandbox bool   `yaml:"sandbox"`
+	key     *ecdsa.PrivateKey
+}
+
+// Verify requires at least one of the sub-sections.
+func (cfg *PushConfig) Verify() error {
+	if cfg.FCM == nil && cfg.APNs == nil {
+		return fmt.Errorf("push requires an fcm or apns section")
+	}
+	return nil
+}
+
+// Verify reads CredentialsFile and checks that it holds a service account with a usable private key.
+func (cfg *PushFCMConfig) Verify() error {
+	var (
+		data    []byte
+		account struct {
+			Type        string `json:"type"`
+			ProjectID   string `json:"project_id"`
+			PrivateKey  string `json:"private_key"`
+			ClientEmail string `json:"client_email"`
+		}
+		err error
+	)
+
+	if len(cfg.CredentialsFile) == 0 {
+		return fmt.Errorf("missing FCM credentialsfile (or FCMCREDENTIALS environment variable)")
+	}
+	data, err = os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("unable to read FCM credentialsfile: %w", err)
+	}
+	err = json.Unmarshal(data, &account)
+	if err != nil {
+		return fmt.Errorf("unable to parse FCM credentialsfile %s: %w", cfg.CredentialsFile, err)
+	}
+	if account.Type != "service_account" {
+		return fmt.Errorf("FCM credentialsfile %s is not a service account key", cfg.CredentialsFile)
+	}
+	if len(account.ClientEmail) == 0 {
+		return fmt.Errorf("FCM credentialsfile %s has no client_email", cfg.CredentialsFile)
+	}
+	_, err = parsePrivateKeyPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("invalid private_key in FCM credentialsfile %s: %w", cfg.CredentialsFile, err)
+	}
+	if len(cfg.ProjectID) == 0 {
+		cfg.ProjectID = account.ProjectID
+	}
+	if len(cfg.ProjectID) == 0 {
+		return fmt.Errorf("missing FCM projectid (or FCMPROJECTID environment variable)")
+	}
+	cfg.clientEmail = account.ClientEmail
+	return nil
+}
+
+// ClientEmail returns the service account's email address.
+func (cfg PushFCMConfig) ClientEmail() string {
+	return cfg.clientEmail
+}
+
+// SendURL returns the FCM HTTP v1 endpoint for ProjectID.
+func (cfg PushFCMConfig) SendURL() string {
+	return "https://fcm.googleapis.com/v1/projects/" + cfg.ProjectID + "/messages:send"
+}
+
+// Verify checks the identifiers and Topic, and loads KeyFile, which must hold a P-256 key.
+func (cfg *PushAPNsConfig) Verify() error {
+	var (
+		signer crypto.Signer
+		found  bool
+		err    error
+	)
+
+	if !apnsIDRE.MatchString(cfg.KeyID) {
+		return fmt.Errorf("invalid APNs keyid %q (expected 10 letters and digits)", cfg.KeyID)
+	}
+	if !apnsIDRE.MatchString(cfg.TeamID) {
+		return fmt.Errorf("invalid APNs teamid %q (expected 10 letters and digits)", cfg.TeamID)
+	}
+	if len(cfg.Topic) == 0 {
+		return fmt.Errorf("missing APNs topic")
+	}
+	if !apnsBundleIDRE.MatchString(strings.TrimSuffix(cfg.Topic, ".voip")) {
+		return fmt.Errorf("invalid APNs topic %q (expected a bundle id such as com.example.app)", cfg.Topic)
+	}
+	if len(cfg.KeyFile) == 0 {
+		return fmt.Errorf("missing APNs keyfile (or APNSKEYFILE environment variable)")
+	}
+	signer, err = readPrivateKeyFile(cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load APNs keyfile %s: %w", cfg.KeyFile, err)
+	}
+	cfg.key, found = signer.(*ecdsa.PrivateKey)
+	if !found || cfg.key.Curve != elliptic.P256() {
+		return fmt.Errorf("APNs keyfile %s must hold a P-256 ECDSA key", cfg.KeyFile)
+	}
+	return nil
+}
+
+// Key returns the signing key loaded from KeyFile.
+func (cfg PushAPNsConfig) Key() *ecdsa.PrivateKey {
+	return cfg.key
+}
+
+// Host returns the APNs host for the production or, with Sandbox, the development environment.
+func (cfg PushAPNsConfig) Host() string {
+	if cfg.Sandbox {
+		return "api.sandbox.push.apple.com"
+	}
+	return "api.push.apple.com"
+}
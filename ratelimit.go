@@ -0,0 +1,111 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RateLimitConfig is a declarative request throttle.  RequestsPerSecond is the sustained rate allowed per key
+// and Burst the bucket size.  KeyStrategy decides what a request is counted against: "ip" (the default),
+// "header" (the value of KeyHeader), or "user" (the authenticated principal, which the application supplies).
+// When Redis is present the counters are meant to be shared through it, otherwise they are kept in memory.
+// Requests from ExemptCIDRs are never throttled.
+//
+//	ratelimit:
+//	  requestspersecond: 20
+//	  burst: 40
+//	  exemptcidrs: [10.0.0.0/8, 127.0.0.1/32]
+//	  redis:
+//	    server: redis:6379
+type RateLimitConfig struct {
+	Enabled           bool         `yaml:"enabled" env:"RATELIMITENABLED"`
+	RequestsPerSecond float64      `yaml:"requestspersecond"`
+	Burst             int          `yaml:"burst"`
+	KeyStrategy       string       `yaml:"keystrategy"`
+	KeyHeader         string       `yaml:"keyheader"`
+	ExemptCIDRs       []string     `yaml:"exemptcidrs"`
+	Redis             *RedisConfig `yaml:"redis"`
+	exempt            []*net.IPNet
+}
+
+// Verify checks the rate and key strategy and parses ExemptCIDRs.  Burst defaults to RequestsPerSecond
+// rounded up.  Nothing is checked when rate limiting is not enabled.
+func (cfg *RateLimitConfig) Verify() error {
+	var (
+		i     int
+		ipnet *net.IPNet
+		err   error
+	)
+
+	cfg.exempt = nil
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.RequestsPerSecond <= 0 {
+		return fmt.Errorf("ratelimit requestspersecond must be greater than zero")
+	}
+	if cfg.Burst < 0 {
+		return fmt.Errorf("ratelimit burst cannot be negative")
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = int(cfg.RequestsPerSecond)
+		if float64(cfg.Burst) < cfg.RequestsPerSecond {
+			cfg.Burst++
+		}
+	}
+	cfg.KeyStrategy = strings.ToLower(strings.TrimSpace(cfg.KeyStrategy))
+	switch cfg.KeyStrategy {
+	case "":
+		cfg.KeyStrategy = "ip"
+	case "ip", "user":
+	case "header":
+		if len(cfg.KeyHeader) == 0 {
+			return fmt.Errorf("ratelimit keystrategy header requires keyheader")
+		}
+	default:
+		return fmt.Errorf("invalid ratelimit keystrategy %q (expected ip, header, or user)", cfg.KeyStrategy)
+	}
+	for i = 0; i < len(cfg.ExemptCIDRs); i++ {
+		_, ipnet, err = net.ParseCIDR(strings.TrimSpace(cfg.ExemptCIDRs[i]))
+		if err != nil {
+			return fmt.Errorf("invalid ratelimit exemptcidrs entry: %w", err)
+		}
+		cfg.exempt = append(cfg.exempt, ipnet)
+	}
+	return nil
+}
+
+// Exempt reports whether ip falls within one of the ExemptCIDRs.
+func (cfg RateLimitConfig) Exempt(ip net.IP) bool {
+	var i int
+
+	for i = 0; i < len(cfg.exempt); i++ {
+		if cfg.exempt[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the value a request is counted against for the ip and header strategies.  For the user
+// strategy it returns an empty string and the application should key on its authenticated principal.
+func (cfg RateLimitConfig) Key(r *http.Request) string {
+	var (
+		host string
+		err  error
+	)
+
+	switch cfg.KeyStrategy {
+	case "header":
+		return r.Header.Get(cfg.KeyHeader)
+	case "user":
+		return ""
+	}
+	host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,157 @@
+package serverconfig
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedFieldRE matches the lowercased names of fields holding secrets.
+var redactedFieldRE = regexp.MustCompile(`(password|passwd|pass|secret|token|key|keys|dsn|connectstring|webhookurl)$`)
+
+// redactedValuesFieldRE matches the lowercased names of map fields whose keys may be shown but whose values
+// may hold credentials, such as an Authorization header.
+var redactedValuesFieldRE = regexp.MustCompile(`headers$`)
+
+// Redacted replaces the values of secret fields in the output of Redact.
+const Redacted = "REDACTED"
+
+// Redact returns a copy of cfg as nested maps and slices keyed by yaml name, suitable for encoding as JSON
+// or YAML, with the values of secret fields replaced by Redacted.  Fields are treated as secret by name:
+// passwords, secrets, tokens, keys (but not KeyID, KeyFile, and the like), DSNs, connect strings, and
+// webhook URLs.  The values of header maps are redacted too, keeping their names.  Passwords in any other URL
+// are redacted as by url.URL.Redacted, and unexported fields are left out.
+//
+//	b, err := json.MarshalIndent(serverconfig.Redact(&gc), "", "  ")
+func Redact(cfg any) any {
+	return redactValue(reflect.ValueOf(cfg))
+}
+
+func redactValue(value reflect.Value) any {
+	var (
+		out      map[string]any
+		nested   map[string]any
+		inline   bool
+		list     []any
+		keys     []reflect.Value
+		fieldDef reflect.StructField
+		name     string
+		stringer fmt.Stringer
+		ok       bool
+		u        *url.URL
+		err      error
+		i        int
+	)
+
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Kind() != reflect.Struct && value.Kind() != reflect.Map && value.CanInterface() {
+		stringer, ok = value.Interface().(fmt.Stringer)
+		if ok {
+			return stringer.String()
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		out = make(map[string]any)
+		for i = 0; i < value.NumField(); i++ {
+			fieldDef = value.Type().Field(i)
+			if len(fieldDef.PkgPath) > 0 {
+				continue
+			}
+			name, inline = yamlFieldName(fieldDef)
+			if name == "-" {
+				continue
+			}
+			if redactedFieldRE.MatchString(strings.ToLower(fieldDef.Name)) {
+				if !inline && !value.Field(i).IsZero() {
+					out[name] = Redacted
+				}
+				continue
+			}
+			if redactedValuesFieldRE.MatchString(strings.ToLower(fieldDef.Name)) && value.Field(i).Kind() == reflect.Map {
+				out[name] = redactMapValues(value.Field(i))
+				continue
+			}
+			if inline {
+				nested, ok = redactValue(value.Field(i)).(map[string]any)
+				if ok {
+					maps.Copy(out, nested)
+				}
+				continue
+			}
+			out[name] = redactValue(value.Field(i))
+		}
+		return out
+	case reflect.Map:
+		out = make(map[string]any, value.Len())
+		keys = value.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+		})
+		for i = 0; i < len(keys); i++ {
+			out[fmt.Sprint(keys[i].Interface())] = redactValue(value.MapIndex(keys[i]))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		list = make([]any, value.Len())
+		for i = 0; i < value.Len(); i++ {
+			list[i] = redactValue(value.Index(i))
+		}
+		return list
+	case reflect.String:
+		if strings.Contains(value.String(), "@") {
+			u, err = url.Parse(value.String())
+			if err == nil && u.User != nil {
+				_, ok = u.User.Password()
+				if ok {
+					return u.Redacted()
+				}
+			}
+		}
+		return value.String()
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	default:
+		if value.CanInterface() {
+			return value.Interface()
+		}
+		return nil
+	}
+}
+
+// redactMapValues returns the map as redactValue would, with every value that is set replaced by Redacted.
+func redactMapValues(value reflect.Value) any {
+	var (
+		out  map[string]any
+		iter *reflect.MapIter
+	)
+
+	if value.IsNil() {
+		return nil
+	}
+	out = make(map[string]any, value.Len())
+	for iter = value.MapRange(); iter.Next(); {
+		if iter.Value().IsZero() {
+			out[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+			continue
+		}
+		out[fmt.Sprint(iter.Key().Interface())] = Redacted
+	}
+	return out
+}
@@ -0,0 +1,263 @@
+package serverconfig
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigReloader holds the current configuration read from a file and replaces it when Reload reads the
+// file again successfully.  On failure the current configuration is kept, so a bad edit to the file cannot
+// take down a running server.  It is safe for concurrent use.
+//
+//	reloader, err := serverconfig.NewConfigReloader[MyConfig]("/etc/myapp/config.yaml")
+//	reloader.OnReload(func(cfg *MyConfig) { logger.SetLevel(cfg.Logging.Level) })
+//	go reloader.Watch(ctx, 30*time.Second)
+//	admin, err := reloader.Current().Admin.Handler(serverconfig.AdminHandlers{Config: reloader, Reload: reloader.Reload})
+type ConfigReloader[T any] struct {
+	filename   string
+	options    []ReadOption
+	secretsDir string
+	current    atomic.Pointer[loadedConfig[T]]
+	mu         sync.Mutex // serializes reloads
+	callbacks  []func(cfg *T)
+	stamp      string // files as of the last reload, for Watch
+}
+
+// loadedConfig is a configuration held by a ConfigReloader, with its provenance.
+type loadedConfig[T any] struct {
+	cfg        *T
+	provenance map[string]string
+}
+
+// NewConfigReloader reads filename into a new T with Read and returns a ConfigReloader holding it.  opts are
+// passed to Read on every reload.
+func NewConfigReloader[T any](filename string, opts ...ReadOption) (*ConfigReloader[T], error) {
+	var (
+		r       *ConfigReloader[T]
+		options readOptions
+		err     error
+		i       int
+	)
+
+	for i = 0; i < len(opts); i++ {
+		opts[i](&options)
+	}
+	r = &ConfigReloader[T]{filename: filename, options: opts, secretsDir: options.secretsDir}
+	err = r.Reload(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Current returns the configuration read last.  It must be treated as read only.
+func (r *ConfigReloader[T]) Current() *T {
+	var loaded *loadedConfig[T]
+
+	loaded = r.current.Load()
+	if loaded == nil {
+		return nil
+	}
+	return loaded.cfg
+}
+
+// Provenance returns where each setting of the current configuration came from, as described for the
+// Provenance function.
+func (r *ConfigReloader[T]) Provenance() map[string]string {
+	var loaded *loadedConfig[T]
+
+	loaded = r.current.Load()
+	if loaded == nil {
+		return nil
+	}
+	return maps.Clone(loaded.provenance)
+}
+
+// currentConfig lets a ConfigReloader be given in place of a configuration, as to AdminHandlers.Config.
+func (r *ConfigReloader[T]) currentConfig() any {
+	return r.Current()
+}
+
+// currentWithProvenance returns the current configuration and its provenance, for EffectiveConfig.
+func (r *ConfigReloader[T]) currentWithProvenance() (any, map[string]string) {
+	var loaded *loadedConfig[T]
+
+	loaded = r.current.Load()
+	if loaded == nil {
+		return nil, nil
+	}
+	return loaded.cfg, loaded.provenance
+}
+
+// resolveConfig returns the current configuration when cfg is a ConfigReloader, and cfg otherwise.
+func resolveConfig(cfg any) any {
+	var (
+		reloader interface{ currentConfig() any }
+		ok       bool
+	)
+
+	reloader, ok = cfg.(interface{ currentConfig() any })
+	if ok {
+		return reloader.currentConfig()
+	}
+	return cfg
+}
+
+// OnReload registers fn to be called with the new configuration after each successful reload.  fn must
+// not call OnReload or Reload itself.
+func (r *ConfigReloader[T]) OnReload(fn func(cfg *T)) {
+	r.mu.Lock()
+	r.callbacks = append(r.callbacks, fn)
+	r.mu.Unlock()
+}
+
+// Reload reads the file again and, only if it passes verification, makes it the current configuration.
+// The App section returned by CurrentApp is also left unchanged when the reload fails.
+func (r *ConfigReloader[T]) Reload(ctx context.Context) error {
+	var (
+		cfg        *T
+		provenance map[string]string
+		err        error
+		i          int
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+	r.stamp, err = r.fileStamp()
+	if err != nil {
+		return err
+	}
+	cfg = new(T)
+	err = Read(r.filename, cfg, append(slices.Clip(r.options), WithProvenance(&provenance))...)
+	if err != nil {
+		return err
+	}
+	r.current.Store(&loadedConfig[T]{cfg: cfg, provenance: provenance})
+	for i = 0; i < len(r.callbacks); i++ {
+		r.callbacks[i](cfg)
+	}
+	return nil
+}
+
+// fileStamp summarizes the file and the secrets directory, if any, as statStamp does.
+func (r *ConfigReloader[T]) fileStamp() (string, error) {
+	if len(r.secretsDir) > 0 {
+		return statStamp(r.filename, r.secretsDir)
+	}
+	return statStamp(r.filename)
+}
+
+// Watch checks every interval, until ctx is done, whether the file or the secrets directory given by
+// WithSecretsDir has changed, and if so calls Reload.  Files mounted from a Kubernetes ConfigMap or Secret
+// are followed through the ..data symlink Kubernetes swaps on update.  A failed reload is reported through
+// Warnf once for each change to the files, so a bad edit is not reported again until it is fixed.  Watch
+// returns immediately when the configuration was read from standard input.
+func (r *ConfigReloader[T]) Watch(ctx context.Context, interval time.Duration) {
+	var (
+		ticker *time.Ticker
+		stamp  string
+		last   string
+		err    error
+	)
+
+	if r.filename == "-" {
+		return
+	}
+	ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stamp, err = r.fileStamp()
+			if err == nil {
+				r.mu.Lock()
+				last = r.stamp
+				r.mu.Unlock()
+				if stamp == last {
+					continue
+				}
+				err = r.Reload(ctx)
+			}
+			if err != nil && ctx.Err() == nil {
+				warnf("configuration reload of %s failed, keeping the current configuration: %v", r.filename, err)
+			}
+		}
+	}
+}
+
+// Handler returns a handler which reloads the configuration on POST, as the admin interface's reload
+// endpoint does.
+func (r *ConfigReloader[T]) Handler() http.Handler {
+	return reloadHandler(r.Reload)
+}
+
+// reloadHandler calls reload on POST and reports the result as JSON: {"status":"ok"}, or status 422 with
+// {"status":"fail","errors":[...]} listing each of the errors that were joined together.
+func reloadHandler(reload func(ctx context.Context) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		err = reload(r.Context())
+		if err != nil {
+			writeAdminJSON(w, http.StatusUnprocessableEntity, map[string]any{"status": "fail", "errors": errorList(err)})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+}
+
+// errorList splits errors joined with errors.Join into their messages.  A joined error wrapped by a
+// prefix, such as the section path added by Read, has the prefix repeated on each message.
+func errorList(err error) []string {
+	var (
+		multi  interface{ Unwrap() []error }
+		inner  error
+		prefix string
+		list   []string
+		errs   []error
+		ok     bool
+		i      int
+	)
+
+	if err == nil {
+		return nil
+	}
+	multi, ok = err.(interface{ Unwrap() []error })
+	if ok {
+		errs = multi.Unwrap()
+		for i = 0; i < len(errs); i++ {
+			list = append(list, errorList(errs[i])...)
+		}
+		return list
+	}
+	inner = errors.Unwrap(err)
+	if inner != nil && strings.HasSuffix(err.Error(), inner.Error()) {
+		list = errorList(inner)
+		if len(list) > 1 {
+			prefix = strings.TrimSuffix(err.Error(), inner.Error())
+			for i = 0; i < len(list); i++ {
+				list[i] = prefix + list[i]
+			}
+			return list
+		}
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,232 @@
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Allow while the breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ResilienceConfig holds the retry and circuit breaker policy for calls to other services.  Retry and
+// CircuitBreaker are the defaults, and Dependencies overrides them per dependency; settings left out of an
+// override are taken from the defaults.
+//
+//	resilience:
+//	  retry:
+//	    maxattempts: 3
+//	    initialbackoff: 200ms
+//	    maxbackoff: 5s
+//	    jitter: 0.2
+//	  circuitbreaker:
+//	    failurethreshold: 5
+//	    opentimeout: 30s
+//	  dependencies:
+//	    payments:
+//	      retry:
+//	        maxattempts: 1
+//	      circuitbreaker:
+//	        failurethreshold: 3
+type ResilienceConfig struct {
+	Retry          RetryConfig                  `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig         `yaml:"circuitbreaker"`
+	Dependencies   map[string]*ResiliencePolicy `yaml:"dependencies"`
+}
+
+// ResiliencePolicy is the retry and circuit breaker policy for one dependency.
+type ResiliencePolicy struct {
+	Retry          *RetryConfig          `yaml:"retry"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuitbreaker"`
+}
+
+// CircuitBreakerConfig describes a circuit breaker.  The breaker opens after FailureThreshold consecutive
+// failures, defaulting to 5, and rejects calls for OpenTimeout, defaulting to 30s.  It then lets
+// HalfOpenRequests calls through, defaulting to 1, and closes once SuccessThreshold of them succeed,
+// defaulting to 1, or opens again on a failure.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failurethreshold"`
+	SuccessThreshold int           `yaml:"successthreshold"`
+	OpenTimeout      time.Duration `yaml:"opentimeout"`
+	HalfOpenRequests int           `yaml:"halfopenrequests"`
+}
+
+// Verify checks the defaults and completes each override from them.
+func (cfg *ResilienceConfig) Verify() error {
+	var (
+		names  []string
+		name   string
+		policy *ResiliencePolicy
+		err    error
+		i      int
+	)
+
+	err = cfg.Retry.Verify()
+	if err != nil {
+		return err
+	}
+	err = cfg.CircuitBreaker.Verify()
+	if err != nil {
+		return err
+	}
+	for name = range cfg.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i = 0; i < len(names); i++ {
+		policy = cfg.Dependencies[names[i]]
+		if policy == nil {
+			policy = &ResiliencePolicy{}
+			cfg.Dependencies[names[i]] = policy
+		}
+		if policy.Retry == nil {
+			policy.Retry = &RetryConfig{}
+		}
+		mergeRetryConfig(policy.Retry, cfg.Retry)
+		err = policy.Retry.Verify()
+		if err != nil {
+			return fmt.Errorf("resilience dependency %q: %w", names[i], err)
+		}
+		if policy.CircuitBreaker == nil {
+			policy.CircuitBreaker = &CircuitBreakerConfig{}
+		}
+		mergeCircuitBreakerConfig(policy.CircuitBreaker, cfg.CircuitBreaker)
+		err = policy.CircuitBreaker.Verify()
+		if err != nil {
+			return fmt.Errorf("resilience dependency %q: %w", names[i], err)
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy for the named dependency, which is the default policy when there is no
+// override for it.
+//
+//	policy := gc.Resilience.Policy("payments")
+//	breaker := policy.CircuitBreaker.NewCircuitBreaker()
+func (cfg *ResilienceConfig) Policy(name string) ResiliencePolicy {
+	var policy *ResiliencePolicy
+
+	policy = cfg.Dependencies[name]
+	if policy == nil {
+		return ResiliencePolicy{Retry: &cfg.Retry, CircuitBreaker: &cfg.CircuitBreaker}
+	}
+	return *policy
+}
+
+// Verify applies the defaults.
+func (cfg *CircuitBreakerConfig) Verify() error {
+	if cfg.FailureThreshold < 0 || cfg.SuccessThreshold < 0 || cfg.OpenTimeout < 0 || cfg.HalfOpenRequests < 0 {
+		return fmt.Errorf("circuitbreaker settings cannot be negative")
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.SuccessThreshold == 0 {
+		cfg.SuccessThreshold = 1
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests == 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.SuccessThreshold > cfg.HalfOpenRequests {
+		return fmt.Errorf("circuitbreaker successthreshold (%d) exceeds halfopenrequests (%d)", cfg.SuccessThreshold, cfg.HalfOpenRequests)
+	}
+	return nil
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker with these settings.
+func (cfg *CircuitBreakerConfig) NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{cfg: *cfg}
+}
+
+// CircuitBreaker tracks the outcome of calls to one dependency.  Call Allow before each call and, when it
+// returns nil, Record with the call's result.  It is safe for concurrent use.
+type CircuitBreaker struct {
+	cfg       CircuitBreakerConfig
+	mu        sync.Mutex
+	open      bool
+	openUntil time.Time
+	failures  int
+	trials    int // calls let through while half open
+	successes int // of those, the ones that succeeded
+}
+
+// Allow returns ErrCircuitOpen when the call should not be made.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.trials >= b.cfg.HalfOpenRequests {
+		return ErrCircuitOpen
+	}
+	b.trials++
+	return nil
+}
+
+// Record reports the result of a call allowed by Allow.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		if b.open {
+			b.successes++
+			if b.successes >= b.cfg.SuccessThreshold {
+				b.open = false
+			}
+		}
+		return
+	}
+	b.failures++
+	if b.open || b.failures >= b.cfg.FailureThreshold {
+		b.open = true
+		b.openUntil = time.Now().Add(b.cfg.OpenTimeout)
+		b.trials, b.successes = 0, 0
+	}
+}
+
+// Open reports whether the breaker is rejecting calls.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open && time.Now().Before(b.openUntil)
+}
+
+// mergeRetryConfig fills the unset fields of dst from src.
+func mergeRetryConfig(dst *RetryConfig, src RetryConfig) {
+	if dst.MaxAttempts == 0 {
+		dst.MaxAttempts = src.MaxAttempts
+	}
+	if dst.InitialBackoff == 0 {
+		dst.InitialBackoff = src.InitialBackoff
+	}
+	if dst.MaxBackoff == 0 {
+		dst.MaxBackoff = src.MaxBackoff
+	}
+	if dst.Jitter == 0 {
+		dst.Jitter = src.Jitter
+	}
+}
+
+// mergeCircuitBreakerConfig fills the unset fields of dst from src.
+func mergeCircuitBreakerConfig(dst *CircuitBreakerConfig, src CircuitBreakerConfig) {
+	if dst.FailureThreshold == 0 {
+		dst.FailureThreshold = src.FailureThreshold
+	}
+	if dst.SuccessThreshold == 0 {
+		dst.SuccessThreshold = src.SuccessThreshold
+	}
+	if dst.OpenTimeout == 0 {
+		dst.OpenTimeout = src.OpenTimeout
+	}
+	if dst.HalfOpenRequests == 0 {
+		dst.HalfOpenRequests = src.HalfOpenRequests
+	}
+}
@@ -0,0 +1,202 @@
+package serverconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResolverConfig selects the DNS server used for host name checks instead of the system resolver, which is
+// useful when split-horizon DNS would otherwise answer with internal addresses.  Protocol is udp (the
+// default), tcp, dot (DNS over TLS), or doh (DNS over HTTPS).  For doh Address is the query URL, for the
+// others it is host:port, with the port defaulting to 53, or 853 for dot.  An empty Address uses the system
+// resolver.
+//
+//	http:
+//	  resolver:
+//	    protocol: dot
+//	    address: 1.1.1.1
+//	    servername: cloudflare-dns.com
+type ResolverConfig struct {
+	Address    string `yaml:"address" env:"DNSRESOLVER"`
+	Protocol   string `yaml:"protocol"`
+	ServerName string `yaml:"servername"`
+}
+
+// Verify checks Address for the chosen protocol.
+func (cfg *ResolverConfig) Verify() error {
+	var (
+		host string
+		err  error
+	)
+
+	cfg.Protocol = strings.ToLower(strings.TrimSpace(cfg.Protocol))
+	if len(cfg.Protocol) == 0 {
+		cfg.Protocol = "udp"
+	}
+	if len(cfg.Address) == 0 {
+		return nil
+	}
+	switch cfg.Protocol {
+	case "udp", "tcp", "dot":
+		_, _, err = net.SplitHostPort(cfg.Address)
+		if err != nil {
+			if cfg.Protocol == "dot" {
+				cfg.Address = net.JoinHostPort(cfg.Address, "853")
+			} else {
+				cfg.Address = net.JoinHostPort(cfg.Address, "53")
+			}
+		}
+		err = validateHostPort(cfg.Address)
+		if err != nil {
+			return fmt.Errorf("invalid resolver address: %w", err)
+		}
+		if cfg.Protocol == "dot" && len(cfg.ServerName) == 0 {
+			host, _, _ = net.SplitHostPort(cfg.Address)
+			if net.ParseIP(host) != nil {
+				return fmt.Errorf("resolver protocol dot with an IP address requires servername for certificate verification")
+			}
+			cfg.ServerName = host
+		}
+	case "doh":
+		_, err = validateURL(cfg.Address, "https")
+		if err != nil {
+			return fmt.Errorf("invalid resolver address: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid resolver protocol %q (expected udp, tcp, dot, or doh)", cfg.Protocol)
+	}
+	return nil
+}
+
+// Resolver returns a net.Resolver using the configured server, or net.DefaultResolver if none is set.
+func (cfg *ResolverConfig) Resolver() *net.Resolver {
+	if len(cfg.Address) == 0 {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			switch cfg.Protocol {
+			case "tcp":
+				return dialer.DialContext(ctx, "tcp", cfg.Address)
+			case "dot":
+				return (&tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: cfg.ServerName, MinVersion: tls.VersionTLS12}}).
+					DialContext(ctx, "tcp", cfg.Address)
+			case "doh":
+				return &dohConn{ctx: ctx, url: cfg.Address}, nil
+			default:
+				return dialer.DialContext(ctx, network, cfg.Address)
+			}
+		},
+	}
+}
+
+// dohConn adapts DNS over HTTPS to the stream connection the Go resolver expects.  Each length-prefixed
+// query written is sent as an RFC 8484 POST and the answer is returned, length-prefixed, by Read.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	mu       sync.Mutex
+	query    bytes.Buffer
+	response bytes.Buffer
+	deadline time.Time
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	var (
+		size int
+		err  error
+	)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query.Write(b)
+	for c.query.Len() >= 2 {
+		size = int(binary.BigEndian.Uint16(c.query.Bytes()))
+		if c.query.Len() < 2+size {
+			break
+		}
+		c.query.Next(2)
+		err = c.exchange(c.query.Next(size))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *dohConn) exchange(msg []byte) error {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		req    *http.Request
+		resp   *http.Response
+		body   []byte
+		err    error
+	)
+
+	ctx = c.ctx
+	if !c.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 65535))
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DNS over HTTPS server returned %s", resp.Status)
+	}
+	_ = binary.Write(&c.response, binary.BigEndian, uint16(len(body)))
+	c.response.Write(body)
+	return nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.response.Read(b)
+}
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "doh" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,73 @@
+package serverconfig
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryConfig is a retry policy with exponential backoff.  MaxAttempts includes the first attempt, so 1
+// means no retries.  The delay before retry n (starting at 1) is InitialBackoff * 2^(n-1), capped at
+// MaxBackoff.  Jitter, between 0 and 1, is the fraction of each delay that JitteredBackoff randomizes.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxattempts"`
+	InitialBackoff time.Duration `yaml:"initialbackoff"`
+	MaxBackoff     time.Duration `yaml:"maxbackoff"`
+	Jitter         float64       `yaml:"jitter"`
+}
+
+// Verify defaults MaxAttempts to 3, InitialBackoff to 500ms, and MaxBackoff to 30s.
+func (cfg *RetryConfig) Verify() error {
+	if cfg.MaxAttempts < 0 || cfg.InitialBackoff < 0 || cfg.MaxBackoff < 0 {
+		return fmt.Errorf("retry settings cannot be negative")
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %g", cfg.Jitter)
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		return fmt.Errorf("retry maxbackoff (%s) is less than initialbackoff (%s)", cfg.MaxBackoff, cfg.InitialBackoff)
+	}
+	return nil
+}
+
+// Backoff returns the delay to wait before the given retry, where retry 1 follows the first attempt.
+func (cfg RetryConfig) Backoff(retry int) time.Duration {
+	var (
+		d time.Duration
+		i int
+	)
+
+	d = cfg.InitialBackoff
+	for i = 1; i < retry && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	return d
+}
+
+// JitteredBackoff returns Backoff(retry) with the Jitter fraction of it replaced by a random amount, so
+// that clients failing together do not retry together.
+func (cfg RetryConfig) JitteredBackoff(retry int) time.Duration {
+	var (
+		d      time.Duration
+		spread time.Duration
+	)
+
+	d = cfg.Backoff(retry)
+	spread = time.Duration(float64(d) * cfg.Jitter)
+	if spread <= 0 {
+		return d
+	}
+	return d - spread + rand.N(spread+1)
+}
@@ -0,0 +1,120 @@
+package serverconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SAMLConfig holds the settings for a SAML 2.0 service provider.  The identity provider's metadata is
+// given by exactly one of IdPMetadataURL and IdPMetadataFile.  CertFile and KeyFile are the SP's signing
+// and encryption key pair.
+//
+//	saml:
+//	  idpmetadataurl: https://login.microsoftonline.com/<tenant>/federationmetadata/2007-06/federationmetadata.xml
+//	  entityid: https://www.acme.com/saml/metadata
+//	  acsurl: https://www.acme.com/saml/acs
+//	  certfile: /etc/acme/saml.crt
+//	  keyfile: /etc/acme/saml.key
+type SAMLConfig struct {
+	IdPMetadataURL  string `yaml:"idpmetadataurl"`
+	IdPMetadataFile string `yaml:"idpmetadatafile"`
+	EntityID        string `yaml:"entityid"`
+	ACSURL          string `yaml:"acsurl"`
+	CertFile        string `yaml:"certfile"`
+	KeyFile         string `yaml:"keyfile"`
+	keyPair         tls.Certificate
+}
+
+// Verify checks the metadata source, the SP URLs, and that the certificate and key load, match, and the
+// certificate has not expired.
+func (cfg *SAMLConfig) Verify() error {
+	var (
+		data []byte
+		root struct {
+			XMLName xml.Name
+		}
+		err error
+	)
+
+	switch {
+	case len(cfg.IdPMetadataURL) > 0 && len(cfg.IdPMetadataFile) > 0:
+		return fmt.Errorf("only one of SAML idpmetadataurl and idpmetadatafile may be given")
+	case len(cfg.IdPMetadataURL) > 0:
+		_, err = validateURL(cfg.IdPMetadataURL, "https")
+		if err != nil {
+			return fmt.Errorf("invalid SAML idpmetadataurl: %w", err)
+		}
+	case len(cfg.IdPMetadataFile) > 0:
+		data, err = os.ReadFile(cfg.IdPMetadataFile)
+		if err != nil {
+			return fmt.Errorf("unable to read SAML idpmetadatafile: %w", err)
+		}
+		err = xml.Unmarshal(data, &root)
+		if err != nil {
+			return fmt.Errorf("unable to parse SAML idpmetadatafile: %w", err)
+		}
+		if root.XMLName.Local != "EntityDescriptor" && root.XMLName.Local != "EntitiesDescriptor" {
+			return fmt.Errorf("SAML idpmetadatafile has root element %q, expected EntityDescriptor", root.XMLName.Local)
+		}
+	default:
+		return fmt.Errorf("missing SAML idpmetadataurl or idpmetadatafile")
+	}
+
+	if len(cfg.EntityID) == 0 {
+		return fmt.Errorf("missing SAML entityid")
+	}
+	if len(cfg.ACSURL) == 0 {
+		return fmt.Errorf("missing SAML acsurl")
+	}
+	err = validateSecureURL(cfg.ACSURL)
+	if err != nil {
+		return fmt.Errorf("invalid SAML acsurl: %w", err)
+	}
+
+	if len(cfg.CertFile) == 0 || len(cfg.KeyFile) == 0 {
+		return fmt.Errorf("missing SAML certfile or keyfile")
+	}
+	cfg.keyPair, err = loadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("SAML certificate: %w", err)
+	}
+	return nil
+}
+
+// KeyPair returns the service provider certificate and key loaded by Verify.
+func (cfg SAMLConfig) KeyPair() tls.Certificate {
+	return cfg.keyPair
+}
+
+// loadKeyPair loads a PEM certificate and matching private key, and rejects a certificate which is
+// expired or not yet valid.  The parsed leaf is available in the Leaf field of the result.
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	var (
+		pair tls.Certificate
+		now  time.Time
+		err  error
+	)
+
+	pair, err = tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return pair, err
+	}
+	if pair.Leaf == nil {
+		pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return pair, err
+		}
+	}
+	now = time.Now()
+	if now.After(pair.Leaf.NotAfter) {
+		return pair, fmt.Errorf("certificate %s expired on %s", certFile, pair.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(pair.Leaf.NotBefore) {
+		return pair, fmt.Errorf("certificate %s is not valid until %s", certFile, pair.Leaf.NotBefore.Format(time.RFC3339))
+	}
+	return pair, nil
+}
@@ -0,0 +1,95 @@
+package serverconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSecretsDir is where Docker Swarm and Kubernetes conventionally mount secrets.
+const DefaultSecretsDir = "/run/secrets"
+
+// ReadOption changes how Read loads a configuration.
+type ReadOption func(options *readOptions)
+
+type readOptions struct {
+	secretsDir string
+	cueSchema  string
+	offline    bool // skip network checks, as DriftMonitor does
+	provenance *map[string]string
+}
+
+// WithSecretsDir has Read take overrides from the files in dir, or DefaultSecretsDir when dir is empty, as
+// mounted for Docker Swarm and Kubernetes secrets.  A file named by a setting's env tag, either as is or
+// lowercased (DBPASS or dbpass), overrides the value from the yaml file, and is in turn overridden by the
+// environment variable.  Trailing newlines are trimmed from the file.  A missing directory is not an error,
+// so the same build runs where no secrets are mounted.
+//
+//	err := serverconfig.Read("config.yaml", &cfg, serverconfig.WithSecretsDir(""))
+func WithSecretsDir(dir string) ReadOption {
+	if len(dir) == 0 {
+		dir = DefaultSecretsDir
+	}
+	return func(options *readOptions) {
+		options.secretsDir = dir
+	}
+}
+
+// secretsDirLookup reads every file in dir and returns an overrideLookup finding them by name.  Hidden
+// entries are skipped, as are directories, which leaves out the ..data links Kubernetes mounts alongside
+// the files.
+func secretsDirLookup(dir string) (overrideLookup, error) {
+	var (
+		entries []os.DirEntry
+		info    os.FileInfo
+		secrets map[string]string
+		path    string
+		b       []byte
+		err     error
+		i       int
+	)
+
+	entries, err = os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		entries, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read secrets directory %s: %w", dir, err)
+	}
+	secrets = make(map[string]string)
+	for i = 0; i < len(entries); i++ {
+		if strings.HasPrefix(entries[i].Name(), ".") {
+			continue
+		}
+		path = filepath.Join(dir, entries[i].Name())
+		info, err = os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		b, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret %s: %w", path, err)
+		}
+		secrets[entries[i].Name()] = strings.TrimRight(string(b), "\r\n")
+	}
+
+	return func(name string) (string, string, bool) {
+		var (
+			value string
+			found bool
+		)
+
+		value, found = secrets[name]
+		if !found {
+			name = strings.ToLower(name)
+			value, found = secrets[name]
+		}
+		return value, "secret:" + filepath.Join(dir, name), found
+	}, nil
+}
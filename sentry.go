@@ -0,0 +1,59 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SentryConfig holds the error reporting settings for Sentry.  An empty DSN disables reporting, which is
+// also how the Sentry SDK treats it.  SampleRate is the fraction of error events sent, from 0 to 1, and
+// defaults to 1.  The values map directly onto sentry.ClientOptions:
+//
+//	err = sentry.Init(sentry.ClientOptions{
+//		Dsn:         gc.Sentry.DSN,
+//		Environment: gc.Sentry.Environment,
+//		Release:     gc.Sentry.Release,
+//		SampleRate:  *gc.Sentry.SampleRate,
+//		Debug:       gc.Sentry.Debug,
+//	})
+type SentryConfig struct {
+	DSN         string   `yaml:"dsn" env:"SENTRY_DSN"`
+	Environment string   `yaml:"environment" env:"SENTRY_ENVIRONMENT"`
+	Release     string   `yaml:"release" env:"SENTRY_RELEASE"`
+	SampleRate  *float64 `yaml:"samplerate"`
+	Debug       bool     `yaml:"debug"`
+}
+
+// Verify checks the DSN is of the form scheme://publickey@host/projectid and that SampleRate is in range.
+func (cfg *SentryConfig) Verify() error {
+	var (
+		u         *url.URL
+		err       error
+		projectID string
+	)
+
+	if cfg.SampleRate == nil {
+		cfg.SampleRate = new(float64)
+		*cfg.SampleRate = 1
+	}
+	if *cfg.SampleRate < 0 || *cfg.SampleRate > 1 {
+		return fmt.Errorf("sentry samplerate must be between 0 and 1, got %g", *cfg.SampleRate)
+	}
+
+	if len(cfg.DSN) == 0 {
+		return nil
+	}
+	u, err = validateURL(cfg.DSN, "http", "https")
+	if err != nil {
+		return fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+	if u.User == nil || len(u.User.Username()) == 0 {
+		return fmt.Errorf("invalid sentry dsn: missing public key")
+	}
+	projectID = u.Path[strings.LastIndex(u.Path, "/")+1:]
+	if len(projectID) == 0 {
+		return fmt.Errorf("invalid sentry dsn: missing project id")
+	}
+	return nil
+}
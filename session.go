@@ -0,0 +1,254 @@
+package serverconfig
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Verify decodes and checks the lengths of HashKey and EncryptKey, so that a bad key is reported at startup
+// rather than by securecookie on the first request, and checks the cookie attributes.  It defaults Store
+// to cookie and TTL to MaxAgeSeconds, or 30 days when that is unset too.  The redis store requires a redis
+// sub-section, which is usually a copy of the top-level redis settings.
+//
+//	http:
+//	  sessioncookie:
+//	    hashkey: ...
+//	    store: redis
+//	    ttl: 12h
+//	    redis:
+//	      server: redis.internal:6379
+func (cfg *HTTPSessionCookieConfig) Verify() error {
+	var (
+		key  []byte
+		seen map[string]bool
+		err  error
+		i    int
+	)
+
+	cfg.hashKeys, cfg.encryptKeys = nil, nil
+	seen = make(map[string]bool)
+	for i = 0; i < len(cfg.HashKey); i++ {
+		key = decodeSecretKey(cfg.HashKey[i], 32, 64)
+		if len(key) != 32 && len(key) != 64 {
+			return fmt.Errorf("session hashkey %d must be 32 or 64 bytes, got %d", i+1, len(key))
+		}
+		if seen[string(key)] {
+			return fmt.Errorf("session hashkey %d is a duplicate", i+1)
+		}
+		seen[string(key)] = true
+		cfg.hashKeys = append(cfg.hashKeys, key)
+	}
+	if len(cfg.EncryptKey) > 0 {
+		if len(cfg.HashKey) == 0 {
+			return fmt.Errorf("session encryptkey requires a hashkey")
+		}
+		if len(cfg.EncryptKey) != len(cfg.HashKey) {
+			return fmt.Errorf("session encryptkey has %d entries, but hashkey has %d", len(cfg.EncryptKey), len(cfg.HashKey))
+		}
+	}
+	for i = 0; i < len(cfg.EncryptKey); i++ {
+		key = decodeSecretKey(cfg.EncryptKey[i], 16, 24, 32)
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return fmt.Errorf("session encryptkey %d must be 16, 24, or 32 bytes, got %d", i+1, len(key))
+		}
+		cfg.encryptKeys = append(cfg.encryptKeys, key)
+	}
+
+	err = cfg.verifyCookie()
+	if err != nil {
+		return err
+	}
+
+	cfg.Store = strings.ToLower(strings.TrimSpace(cfg.Store))
+	if len(cfg.Store) == 0 {
+		cfg.Store = "cookie"
+	}
+	switch cfg.Store {
+	case "cookie", "memstore":
+	case "redis":
+		if cfg.Redis == nil {
+			return fmt.Errorf("session store redis requires the sessioncookie.redis section")
+		}
+	default:
+		return fmt.Errorf("invalid session store %q (expected cookie, redis, or memstore)", cfg.Store)
+	}
+	if cfg.TTL < 0 || cfg.MaxAgeSeconds < 0 {
+		return fmt.Errorf("session ttl and maxageseconds cannot be negative")
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = time.Duration(cfg.MaxAgeSeconds) * time.Second
+		if cfg.TTL == 0 {
+			cfg.TTL = 30 * 24 * time.Hour
+		}
+	}
+	return nil
+}
+
+// verifyCookie defaults Name and Path and checks the attributes against current browser rules: SameSite=None
+// needs Secure, a "__Secure-" name needs Secure, and a "__Host-" name also needs Path "/" and no Domain.
+func (cfg *HTTPSessionCookieConfig) verifyCookie() error {
+	var err error
+
+	if len(cfg.Name) == 0 {
+		cfg.Name = "session"
+	}
+	if len(cfg.Path) == 0 {
+		cfg.Path = "/"
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return fmt.Errorf("session cookie path must begin with '/': %q", cfg.Path)
+	}
+	err = (&http.Cookie{Name: cfg.Name, Value: "x", Path: cfg.Path, Domain: cfg.Domain}).Valid()
+	if err != nil {
+		return fmt.Errorf("invalid session cookie: %w", err)
+	}
+	if cfg.SameSite == http.SameSiteNoneMode && !cfg.Secure {
+		return fmt.Errorf("session cookie samesite none requires secure, or browsers will reject the cookie")
+	}
+	if strings.HasPrefix(cfg.Name, "__Secure-") && !cfg.Secure {
+		return fmt.Errorf("session cookie name %q requires secure", cfg.Name)
+	}
+	if strings.HasPrefix(cfg.Name, "__Host-") && (!cfg.Secure || cfg.Path != "/" || len(cfg.Domain) > 0) {
+		return fmt.Errorf("session cookie name %q requires secure, path \"/\", and no domain", cfg.Name)
+	}
+	return nil
+}
+
+// NewCookie returns a session cookie carrying value with the configured attributes.
+func (cfg *HTTPSessionCookieConfig) NewCookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     cfg.Name,
+		Value:    value,
+		Path:     cfg.Path,
+		Domain:   cfg.Domain,
+		MaxAge:   cfg.MaxAgeSeconds,
+		Secure:   cfg.Secure,
+		HttpOnly: cfg.HttpOnly,
+		SameSite: cfg.SameSite,
+	}
+}
+
+// KeyPairs returns the decoded keys as hash/encryption pairs, newest first, in the order expected by
+// gorilla/sessions store constructors and securecookie.CodecsFromPairs.  Without encryption keys each hash
+// key is paired with nil.
+//
+//	codecs := securecookie.CodecsFromPairs(gc.HTTP.Session.KeyPairs()...)
+func (cfg *HTTPSessionCookieConfig) KeyPairs() [][]byte {
+	var (
+		pairs [][]byte
+		i     int
+	)
+
+	for i = 0; i < len(cfg.hashKeys); i++ {
+		if i < len(cfg.encryptKeys) {
+			pairs = append(pairs, cfg.hashKeys[i], cfg.encryptKeys[i])
+		} else {
+			pairs = append(pairs, cfg.hashKeys[i], nil)
+		}
+	}
+	return pairs
+}
+
+// GenerateSessionKeys returns a new random 64-byte hash key and 32-byte encryption key, base64 encoded for
+// the hashkey and encryptkey settings.  When rotating, put the new keys first in each list.
+func GenerateSessionKeys() (string, string, error) {
+	var (
+		hashKey    [64]byte
+		encryptKey [32]byte
+		err        error
+	)
+
+	_, err = rand.Read(hashKey[:])
+	if err != nil {
+		return "", "", err
+	}
+	_, err = rand.Read(encryptKey[:])
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(hashKey[:]), base64.StdEncoding.EncodeToString(encryptKey[:]), nil
+}
+
+// SessionStores holds the constructors of the session library used by the application, so that this
+// package does not depend on it.  S is normally sessions.Store from github.com/gorilla/sessions; a nil
+// constructor means that store is not supported by the application.
+type SessionStores[S any] struct {
+	Cookie   func(cfg *HTTPSessionCookieConfig, keyPairs ...[]byte) (S, error)
+	Memstore func(cfg *HTTPSessionCookieConfig, keyPairs ...[]byte) (S, error)
+	Redis    func(cfg *HTTPSessionCookieConfig, keyPairs ...[]byte) (S, error)
+}
+
+// NewSessionStore builds the store selected by cfg.Store with the matching constructor.  The constructors
+// receive the verified configuration for TTL, Redis, and the cookie attributes.
+//
+//	store, err := serverconfig.NewSessionStore(&gc.HTTP.Session, serverconfig.SessionStores[sessions.Store]{
+//		Cookie: func(cfg *serverconfig.HTTPSessionCookieConfig, keyPairs ...[]byte) (sessions.Store, error) {
+//			return sessions.NewCookieStore(keyPairs...), nil
+//		},
+//		Redis: func(cfg *serverconfig.HTTPSessionCookieConfig, keyPairs ...[]byte) (sessions.Store, error) {
+//			client := redis.NewClient(&redis.Options{Addr: cfg.Redis.Server, Password: cfg.Redis.Password})
+//			store, err := redisstore.NewRedisStore(context.Background(), client)
+//			if err == nil {
+//				store.KeyPrefix("session_")
+//				store.Options(sessions.Options{MaxAge: int(cfg.TTL.Seconds())})
+//			}
+//			return store, err
+//		},
+//	})
+func NewSessionStore[S any](cfg *HTTPSessionCookieConfig, stores SessionStores[S]) (S, error) {
+	var (
+		build func(*HTTPSessionCookieConfig, ...[]byte) (S, error)
+		zero  S
+	)
+
+	switch cfg.Store {
+	case "", "cookie":
+		build = stores.Cookie
+	case "memstore":
+		build = stores.Memstore
+	case "redis":
+		build = stores.Redis
+	}
+	if build == nil {
+		return zero, fmt.Errorf("session store %q is not supported by this application", cfg.Store)
+	}
+	if len(cfg.hashKeys) == 0 {
+		return zero, fmt.Errorf("missing session hashkey (or SESSIONHASHKEY environment variable)")
+	}
+	return build(cfg, cfg.KeyPairs()...)
+}
+
+// SessionKeys is a list of session keys, newest first.  In YAML it may be a single string or a list.
+type SessionKeys []string
+
+func (keys *SessionKeys) UnmarshalYAML(value *yaml.Node) error {
+	var (
+		one  string
+		list []string
+		err  error
+	)
+
+	if value.Kind == yaml.ScalarNode {
+		err = value.Decode(&one)
+		if err != nil {
+			return err
+		}
+		*keys = nil
+		if len(one) > 0 {
+			*keys = SessionKeys{one}
+		}
+		return nil
+	}
+	err = value.Decode(&list)
+	if err != nil {
+		return err
+	}
+	*keys = list
+	return nil
+}
@@ -0,0 +1,263 @@
+package serverconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// shutdownSignals are the signal names accepted in ShutdownConfig.Signals, available on every platform.
+var shutdownSignals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ShutdownConfig describes how the process stops.  Signals lists the signals that begin a shutdown, by
+// name with or without the SIG prefix, defaulting to SIGINT and SIGTERM.  GracePeriod bounds the whole
+// shutdown and defaults to 30s.  Order lists the subsystems to stop, first to last, each given as a name
+// or as a mapping with its own timeout; a step without a timeout may use whatever remains of GracePeriod.
+// The subsystems themselves are registered on the Orchestrator returned by NewOrchestrator.
+//
+//	shutdown:
+//	  signals: [SIGTERM, SIGINT]
+//	  graceperiod: 30s
+//	  order:
+//	    - name: health
+//	      timeout: 5s
+//	    - name: http
+//	      timeout: 15s
+//	    - jobs
+//	    - database
+type ShutdownConfig struct {
+	Signals     []string             `yaml:"signals"`
+	GracePeriod time.Duration        `yaml:"graceperiod" env:"SHUTDOWNGRACE"`
+	Order       []ShutdownStepConfig `yaml:"order"`
+	signals     []os.Signal
+}
+
+// ShutdownStepConfig is one subsystem in ShutdownConfig.Order.
+type ShutdownStepConfig struct {
+	Name    string        `yaml:"name"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// StopFunc stops a subsystem, returning when it has stopped or ctx is done.
+type StopFunc func(ctx context.Context) error
+
+// Orchestrator runs the registered stop functions as described by its ShutdownConfig.  It is safe for
+// concurrent use.
+type Orchestrator struct {
+	cfg   ShutdownConfig
+	mu    sync.Mutex
+	names []string
+	stops map[string]StopFunc
+}
+
+// Verify parses Signals, defaults GracePeriod, and checks the steps in Order.
+func (cfg *ShutdownConfig) Verify() error {
+	var (
+		seen  map[string]bool
+		name  string
+		sig   os.Signal
+		found bool
+		i     int
+	)
+
+	if len(cfg.Signals) == 0 {
+		cfg.Signals = []string{"SIGINT", "SIGTERM"}
+	}
+	cfg.signals = nil
+	for i = 0; i < len(cfg.Signals); i++ {
+		name = strings.ToUpper(strings.TrimSpace(cfg.Signals[i]))
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig, found = shutdownSignals[name]
+		if !found {
+			return fmt.Errorf("invalid shutdown signal %q (expected one of SIGHUP, SIGINT, SIGQUIT, or SIGTERM)", cfg.Signals[i])
+		}
+		cfg.Signals[i] = name
+		cfg.signals = append(cfg.signals, sig)
+	}
+	if cfg.GracePeriod < 0 {
+		return fmt.Errorf("shutdown graceperiod cannot be negative")
+	}
+	if cfg.GracePeriod == 0 {
+		cfg.GracePeriod = 30 * time.Second
+	}
+	seen = make(map[string]bool)
+	for i = 0; i < len(cfg.Order); i++ {
+		name = cfg.Order[i].Name
+		if len(name) == 0 {
+			return fmt.Errorf("shutdown order step %d has no name", i+1)
+		}
+		if seen[name] {
+			return fmt.Errorf("shutdown order lists %q more than once", name)
+		}
+		seen[name] = true
+		if cfg.Order[i].Timeout < 0 {
+			return fmt.Errorf("shutdown timeout for %q cannot be negative", name)
+		}
+		if cfg.Order[i].Timeout > cfg.GracePeriod {
+			warnf("shutdown timeout %s for %q exceeds graceperiod %s", cfg.Order[i].Timeout, name, cfg.GracePeriod)
+		}
+	}
+	return nil
+}
+
+// OSSignals returns the signals that begin a shutdown.
+func (cfg *ShutdownConfig) OSSignals() []os.Signal {
+	if len(cfg.signals) == 0 {
+		return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return cfg.signals
+}
+
+// NotifyContext returns a copy of parent that is cancelled when one of Signals arrives.  Calling stop
+// restores the default signal behavior, so a second signal then kills the process.
+func (cfg *ShutdownConfig) NotifyContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(parent, cfg.OSSignals()...)
+}
+
+// NewOrchestrator returns an Orchestrator with no stop functions registered.
+//
+//	orch := gc.Shutdown.NewOrchestrator()
+//	orch.Register("health", func(ctx context.Context) error { health.Shutdown(ctx); return nil })
+//	orch.Register("http", func(ctx context.Context) error { return srv.Shutdown(ctx) })
+//	orch.Register("database", func(ctx context.Context) error { return db.Close() })
+//	err = orch.Wait(context.Background())
+func (cfg *ShutdownConfig) NewOrchestrator() *Orchestrator {
+	return &Orchestrator{
+		cfg:   *cfg,
+		stops: make(map[string]StopFunc),
+	}
+}
+
+// Register sets the stop function for the named subsystem, replacing any registered before.  Subsystems
+// not listed in Order are stopped after those that are, in the order they were registered.
+func (o *Orchestrator) Register(name string, fn StopFunc) {
+	var found bool
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, found = o.stops[name]
+	if !found {
+		o.names = append(o.names, name)
+	}
+	o.stops[name] = fn
+}
+
+// Wait blocks until one of the configured signals arrives or ctx is done, then calls Shutdown.
+func (o *Orchestrator) Wait(ctx context.Context) error {
+	var (
+		sigCtx context.Context
+		stop   context.CancelFunc
+	)
+
+	sigCtx, stop = o.cfg.NotifyContext(ctx)
+	<-sigCtx.Done()
+	stop()
+	return o.Shutdown(context.Background())
+}
+
+// Shutdown stops the registered subsystems one at a time within GracePeriod, or until ctx is done.  A
+// subsystem that does not stop within its timeout is abandoned and the next one is stopped.  Errors from
+// every step are returned together.
+func (o *Orchestrator) Shutdown(ctx context.Context) error {
+	var (
+		steps  []ShutdownStepConfig
+		stops  map[string]StopFunc
+		listed map[string]bool
+		cancel context.CancelFunc
+		fn     StopFunc
+		found  bool
+		errs   []error
+		err    error
+		i      int
+	)
+
+	o.mu.Lock()
+	stops = make(map[string]StopFunc, len(o.stops))
+	listed = make(map[string]bool)
+	for i = 0; i < len(o.cfg.Order); i++ {
+		listed[o.cfg.Order[i].Name] = true
+		steps = append(steps, o.cfg.Order[i])
+	}
+	for i = 0; i < len(o.names); i++ {
+		stops[o.names[i]] = o.stops[o.names[i]]
+		if !listed[o.names[i]] {
+			steps = append(steps, ShutdownStepConfig{Name: o.names[i]})
+		}
+	}
+	o.mu.Unlock()
+
+	if o.cfg.GracePeriod > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.cfg.GracePeriod)
+		defer cancel()
+	}
+	for i = 0; i < len(steps); i++ {
+		fn, found = stops[steps[i].Name]
+		if !found || fn == nil {
+			continue
+		}
+		err = runStopFunc(ctx, steps[i].Timeout, fn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shutdown of %s: %w", steps[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runStopFunc calls fn with a context bounded by timeout, when above zero, and returns early if fn
+// outlives that context.
+func runStopFunc(ctx context.Context, timeout time.Duration, fn StopFunc) error {
+	var (
+		cancel context.CancelFunc
+		done   chan error
+		err    error
+	)
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done = make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UnmarshalYAML accepts a bare subsystem name as well as a mapping.
+func (cfg *ShutdownStepConfig) UnmarshalYAML(value *yaml.Node) error {
+	type shutdownStepYAML ShutdownStepConfig
+	var (
+		raw shutdownStepYAML
+		err error
+	)
+
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&cfg.Name)
+	}
+	err = value.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	*cfg = ShutdownStepConfig(raw)
+	return nil
+}
@@ -0,0 +1,123 @@
+package serverconfig
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a size in bytes which may be written in YAML or the environment as a plain number or with a
+// unit suffix, e.g. "512", "100MB", "1.5GiB".  The SI units (KB, MB, GB, TB) are powers of 1000, the IEC
+// units (KiB, MiB, GiB, TiB) and the single letters (K, M, G, T) are powers of 1024.  Units are
+// case-insensitive.
+type ByteSize int64
+
+var (
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+
+	byteSizeUnits = map[string]float64{
+		"":    1,
+		"b":   1,
+		"k":   1 << 10,
+		"kb":  1e3,
+		"kib": 1 << 10,
+		"m":   1 << 20,
+		"mb":  1e6,
+		"mib": 1 << 20,
+		"g":   1 << 30,
+		"gb":  1e9,
+		"gib": 1 << 30,
+		"t":   1 << 40,
+		"tb":  1e12,
+		"tib": 1 << 40,
+	}
+)
+
+// ParseByteSize parses a human-readable size such as "100MB" into a number of bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	var (
+		i      int
+		number float64
+		mult   float64
+		found  bool
+		err    error
+	)
+
+	s = strings.TrimSpace(s)
+	for i = 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && s[i] != '.' {
+			break
+		}
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	number, err = strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	mult, found = byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !found {
+		return 0, fmt.Errorf("invalid size unit in %q (expected B, KB, MB, GB, TB, KiB, MiB, GiB, or TiB)", s)
+	}
+	number *= mult
+	if number >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return ByteSize(number), nil
+}
+
+// UnmarshalYAML accepts either an integer number of bytes or a size string.
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	var (
+		parsed ByteSize
+		err    error
+	)
+
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: size must be a scalar value", value.Line)
+	}
+	parsed, err = ParseByteSize(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*b = parsed
+	return nil
+}
+
+// UnmarshalText allows a ByteSize to be decoded from any text-based format.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	var (
+		parsed ByteSize
+		err    error
+	)
+
+	parsed, err = ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// String formats the size using the largest IEC unit which represents it exactly.
+func (b ByteSize) String() string {
+	var (
+		units = [4]string{"TiB", "GiB", "MiB", "KiB"}
+		i     int
+		unit  ByteSize
+	)
+
+	for i = 0; i < len(units); i++ {
+		unit = ByteSize(1) << (10 * (len(units) - i))
+		if b != 0 && b%unit == 0 {
+			return strconv.FormatInt(int64(b/unit), 10) + units[i]
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
@@ -0,0 +1,62 @@
+package serverconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	e164RE       = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	twilioSIDRE  = regexp.MustCompile(`^AC[0-9a-fA-F]{32}$`)
+	twilioMSIDRE = regexp.MustCompile(`^MG[0-9a-fA-F]{32}$`)
+	smsProviders = []string{"twilio"}
+)
+
+// SMSConfig holds the settings for sending SMS messages.  Provider currently must be "twilio", which is
+// also the default.  Messages are sent either from FromNumber, in E.164 form (e.g. +14155550100), or
+// through a Messaging Service, in which case MessagingServiceSID is used instead.
+//
+//	sms:
+//	  accountsid: ACxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx
+//	  fromnumber: "+14155550100"
+type SMSConfig struct {
+	Provider            string `yaml:"provider"`
+	AccountSID          string `yaml:"accountsid" env:"TWILIO_ACCOUNT_SID"`
+	AuthToken           string `yaml:"authtoken" env:"TWILIO_AUTH_TOKEN"`
+	FromNumber          string `yaml:"fromnumber"`
+	MessagingServiceSID string `yaml:"messagingservicesid"`
+}
+
+// Verify checks the provider credentials and that the sender is a valid E.164 number or Messaging
+// Service SID.
+func (cfg *SMSConfig) Verify() error {
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	if len(cfg.Provider) == 0 {
+		cfg.Provider = "twilio"
+	}
+	if cfg.Provider != "twilio" {
+		return fmt.Errorf("invalid sms provider %q (expected %s)", cfg.Provider, strings.Join(smsProviders, ", "))
+	}
+
+	if len(cfg.AccountSID) == 0 {
+		return fmt.Errorf("missing sms accountsid (or TWILIO_ACCOUNT_SID environment variable)")
+	}
+	if !twilioSIDRE.MatchString(cfg.AccountSID) {
+		return fmt.Errorf("invalid sms accountsid %q (expected AC followed by 32 hex digits)", cfg.AccountSID)
+	}
+	if len(cfg.AuthToken) == 0 {
+		return fmt.Errorf("missing sms authtoken (or TWILIO_AUTH_TOKEN environment variable)")
+	}
+
+	if len(cfg.FromNumber) == 0 && len(cfg.MessagingServiceSID) == 0 {
+		return fmt.Errorf("sms requires either fromnumber or messagingservicesid")
+	}
+	if len(cfg.FromNumber) > 0 && !e164RE.MatchString(cfg.FromNumber) {
+		return fmt.Errorf("invalid sms fromnumber %q (expected E.164 format such as +14155550100)", cfg.FromNumber)
+	}
+	if len(cfg.MessagingServiceSID) > 0 && !twilioMSIDRE.MatchString(cfg.MessagingServiceSID) {
+		return fmt.Errorf("invalid sms messagingservicesid %q (expected MG followed by 32 hex digits)", cfg.MessagingServiceSID)
+	}
+	return nil
+}
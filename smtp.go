@@ -1,9 +1,246 @@
 package serverconfig
 
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the settings for sending mail through an SMTP relay.  TLSMode is "none", "starttls", or
+// "implicit" (SMTPS), and the default Port follows from it: 25, 587, or 465 respectively.  AuthMechanism
+// is "plain", "login", or "cram-md5" and defaults to plain when a User is given.  If VerifyConnection is
+// set, Verify also calls TestConnection so that bad credentials are found at startup.  The optional DKIM
+// section configures signing of outgoing messages.
 type SMTPConfig struct {
-	Server   string `yaml:"server"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user" env:"SMTPUSER"`
-	Password string `yaml:"password" env:"SMTPPASS"`
-	From     string `yaml:"from"`
+	Server           string        `yaml:"server"`
+	Port             int           `yaml:"port"`
+	User             string        `yaml:"user" env:"SMTPUSER"`
+	Password         string        `yaml:"password" env:"SMTPPASS"`
+	From             string        `yaml:"from"`
+	TLSMode          string        `yaml:"tlsmode"`
+	SkipTLSVerify    bool          `yaml:"skiptlsverify"`
+	AuthMechanism    string        `yaml:"authmechanism"`
+	Timeout          time.Duration `yaml:"timeout"`
+	VerifyConnection bool          `yaml:"verifyconnection"`
+	DKIM             *DKIMConfig   `yaml:"dkim"`
+}
+
+// Verify checks the server, port, From address, TLS mode, and authentication settings, applying the
+// defaults described on SMTPConfig.  TLSMode defaults to starttls and Timeout to 30 seconds.
+func (cfg *SMTPConfig) Verify() error {
+	return cfg.verify(true)
+}
+
+// verifyOffline is Verify without the connection test.
+func (cfg *SMTPConfig) verifyOffline() error {
+	return cfg.verify(false)
+}
+
+// verify is Verify, running the connection test only when probe is set.
+func (cfg *SMTPConfig) verify(probe bool) error {
+	var err error
+
+	if len(cfg.Server) == 0 {
+		return fmt.Errorf("missing SMTP server")
+	}
+	if strings.Contains(cfg.Server, ":") {
+		return fmt.Errorf("SMTP server should not include a port, use smtp.port instead: %q", cfg.Server)
+	}
+
+	cfg.TLSMode = strings.ToLower(strings.TrimSpace(cfg.TLSMode))
+	if len(cfg.TLSMode) == 0 {
+		cfg.TLSMode = "starttls"
+	}
+	switch cfg.TLSMode {
+	case "none":
+		if cfg.Port == 0 {
+			cfg.Port = 25
+		}
+	case "starttls":
+		if cfg.Port == 0 {
+			cfg.Port = 587
+		}
+	case "implicit":
+		if cfg.Port == 0 {
+			cfg.Port = 465
+		}
+	default:
+		return fmt.Errorf("invalid SMTP tlsmode %q (expected none, starttls, or implicit)", cfg.TLSMode)
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Errorf("invalid SMTP port %d", cfg.Port)
+	}
+
+	if len(cfg.From) == 0 {
+		return fmt.Errorf("missing SMTP from address")
+	}
+	_, err = mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP from address %q: %w", cfg.From, err)
+	}
+
+	cfg.AuthMechanism = strings.ToLower(strings.TrimSpace(cfg.AuthMechanism))
+	if len(cfg.AuthMechanism) == 0 && len(cfg.User) > 0 {
+		cfg.AuthMechanism = "plain"
+	}
+	switch cfg.AuthMechanism {
+	case "":
+	case "plain", "login", "cram-md5":
+		if len(cfg.User) == 0 || len(cfg.Password) == 0 {
+			return fmt.Errorf("SMTP %s authentication requires user and password (or SMTPUSER and SMTPPASS environment variables)", cfg.AuthMechanism)
+		}
+		if cfg.TLSMode == "none" && cfg.AuthMechanism != "cram-md5" {
+			warnf("SMTP %s authentication will send credentials to %s without TLS", cfg.AuthMechanism, cfg.Server)
+		}
+	default:
+		return fmt.Errorf("invalid SMTP authmechanism %q (expected plain, login, or cram-md5)", cfg.AuthMechanism)
+	}
+
+	if cfg.SkipTLSVerify && cfg.TLSMode != "none" {
+		warnf("SMTP TLS certificate verification is disabled for %s", cfg.Server)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("SMTP timeout cannot be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	if probe && cfg.VerifyConnection {
+		err = cfg.TestConnection(context.Background())
+		if err != nil {
+			return fmt.Errorf("SMTP connection test failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// TestConnection connects to the SMTP server, negotiates TLS as configured, and authenticates, then quits
+// without sending any mail.  The whole exchange is bounded by Timeout (if set) and by ctx.
+func (cfg *SMTPConfig) TestConnection(ctx context.Context) error {
+	var (
+		addr     string
+		dialer   net.Dialer
+		conn     net.Conn
+		client   *smtp.Client
+		tlsCfg   *tls.Config
+		auth     smtp.Auth
+		ok       bool
+		deadline time.Time
+		cancel   context.CancelFunc
+		err      error
+	)
+
+	if cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	addr = net.JoinHostPort(cfg.Server, strconv.Itoa(cfg.Port))
+	tlsCfg = &tls.Config{ServerName: cfg.Server, InsecureSkipVerify: cfg.SkipTLSVerify}
+	if cfg.TLSMode == "implicit" {
+		conn, err = (&tls.Dialer{NetDialer: &dialer, Config: tlsCfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, ok = ctx.Deadline()
+	if ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err = smtp.NewClient(conn, cfg.Server)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	err = client.Hello(smtpHelloName())
+	if err != nil {
+		return err
+	}
+
+	if cfg.TLSMode == "starttls" {
+		ok, _ = client.Extension("STARTTLS")
+		if !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", addr)
+		}
+		err = client.StartTLS(tlsCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch cfg.AuthMechanism {
+	case "plain":
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Server)
+	case "login":
+		auth = &smtpLoginAuth{user: cfg.User, password: cfg.Password}
+	case "cram-md5":
+		auth = smtp.CRAMMD5Auth(cfg.User, cfg.Password)
+	}
+	if auth != nil {
+		err = client.Auth(auth)
+		if err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	return client.Quit()
+}
+
+func smtpHelloName() string {
+	var (
+		name string
+		err  error
+	)
+
+	name, err = os.Hostname()
+	if err != nil || len(name) == 0 {
+		return "localhost"
+	}
+	return name
+}
+
+// smtpLoginAuth implements the non-standard but widely deployed AUTH LOGIN mechanism, which net/smtp
+// doesn't provide.
+type smtpLoginAuth struct {
+	user     string
+	password string
+}
+
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.user), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
 }
@@ -0,0 +1,104 @@
+package serverconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StatsdConfig configures a StatsD or DogStatsD client.  Address is either host:port (UDP, the default),
+// udp://host:port, or unix:///path/to/socket for a Unix domain socket as used by the Datadog agent.
+// Tags are only meaningful to DogStatsD.
+//
+//	statsd:
+//	  address: unix:///var/run/datadog/dsd.socket
+//	  prefix: myapp.
+//	  tags:
+//	    env: prod
+type StatsdConfig struct {
+	Address    string            `yaml:"address" env:"STATSDADDR"`
+	Prefix     string            `yaml:"prefix"`
+	Tags       map[string]string `yaml:"tags"`
+	SampleRate *float64          `yaml:"samplerate"`
+}
+
+// StatsdClientOptions is the resolved form of a StatsdConfig, suitable for passing to a StatsD client
+// constructor or to net.Dial.
+type StatsdClientOptions struct {
+	Network    string   // "udp" or "unixgram"
+	Address    string   // host:port or socket path
+	Prefix     string   // metric name prefix (namespace)
+	Tags       []string // sorted "key:value" pairs
+	SampleRate float64
+}
+
+// Verify checks the form of the address and that SampleRate is in range, defaulting it to 1.  Nothing is
+// checked when no address is configured.
+func (cfg *StatsdConfig) Verify() error {
+	var (
+		network string
+		address string
+		err     error
+	)
+
+	if cfg.SampleRate == nil {
+		cfg.SampleRate = new(float64)
+		*cfg.SampleRate = 1
+	}
+	if *cfg.SampleRate < 0 || *cfg.SampleRate > 1 {
+		return fmt.Errorf("statsd samplerate must be between 0 and 1, got %g", *cfg.SampleRate)
+	}
+
+	if len(cfg.Address) == 0 {
+		return nil
+	}
+	network, address, err = splitStatsdAddress(cfg.Address)
+	if err != nil {
+		return err
+	}
+	if network == "unixgram" {
+		if !filepath.IsAbs(address) {
+			return fmt.Errorf("statsd socket path must be absolute: %q", address)
+		}
+		return nil
+	}
+	err = validateHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid statsd address: %w", err)
+	}
+	return nil
+}
+
+// ClientOptions returns the network, address, prefix, tags, and sample rate for constructing a client.
+func (cfg *StatsdConfig) ClientOptions() StatsdClientOptions {
+	var (
+		opts StatsdClientOptions
+		k    string
+	)
+
+	opts.Network, opts.Address, _ = splitStatsdAddress(cfg.Address)
+	opts.Prefix = cfg.Prefix
+	opts.SampleRate = 1
+	if cfg.SampleRate != nil {
+		opts.SampleRate = *cfg.SampleRate
+	}
+	for k = range cfg.Tags {
+		opts.Tags = append(opts.Tags, k+":"+cfg.Tags[k])
+	}
+	sort.Strings(opts.Tags)
+	return opts
+}
+
+func splitStatsdAddress(addr string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unixgram", strings.TrimPrefix(addr, "unix://"), nil
+	case strings.HasPrefix(addr, "udp://"):
+		return "udp", strings.TrimPrefix(addr, "udp://"), nil
+	case strings.Contains(addr, "://"):
+		return "", "", fmt.Errorf("invalid statsd address %q (expected host:port, udp://host:port, or unix:///path)", addr)
+	default:
+		return "udp", addr, nil
+	}
+}
@@ -0,0 +1,220 @@
+package serverconfig
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HTTPTemplatesConfig describes the application's html/template set.  Path is a directory or a glob such as
+// "./templates/*.html"; a directory stands for every file directly in it.  With Embed set, Path is a glob
+// within the fs.FS the application passes to Load, normally an embed.FS, and is not checked on disk.  Reload
+// re-parses the templates on every Get, which is meant for development.  LeftDelim and RightDelim replace
+// "{{" and "}}".  When Funcs is set, only the named functions of the FuncMap given to Load are made
+// available to templates.
+//
+//	http:
+//	  templates:
+//	    path: ./templates/*.html
+//	    reload: true
+//	    funcs: [formatDate, asset]
+type HTTPTemplatesConfig struct {
+	Path       string   `yaml:"path"`
+	Embed      bool     `yaml:"embed"`
+	Reload     bool     `yaml:"reload" env:"TEMPLATERELOAD"`
+	LeftDelim  string   `yaml:"leftdelim"`
+	RightDelim string   `yaml:"rightdelim"`
+	Funcs      []string `yaml:"funcs"`
+}
+
+// Verify checks that Path matches at least one file, so that a missing or empty template directory is found
+// at startup rather than on the first request.
+func (cfg *HTTPTemplatesConfig) Verify() error {
+	var (
+		err error
+		i   int
+	)
+
+	if len(cfg.LeftDelim) == 0 != (len(cfg.RightDelim) == 0) {
+		return fmt.Errorf("templates leftdelim and rightdelim must be set together")
+	}
+	for i = 0; i < len(cfg.Funcs); i++ {
+		if !isTemplateIdentifier(cfg.Funcs[i]) {
+			return fmt.Errorf("invalid templates func name %q", cfg.Funcs[i])
+		}
+	}
+	if len(cfg.Path) == 0 {
+		if cfg.Embed {
+			return fmt.Errorf("templates embed requires a path glob")
+		}
+		return nil
+	}
+	if cfg.Embed {
+		_, err = path.Match(cfg.Path, "")
+		if err != nil {
+			return fmt.Errorf("invalid templates path %q: %w", cfg.Path, err)
+		}
+		return nil
+	}
+	return checkTemplateGlob(cfg.Path)
+}
+
+// Glob returns Path as a glob, adding "/*" when it names a directory on disk.
+func (cfg *HTTPTemplatesConfig) Glob() string {
+	return templateGlob(cfg.Path, cfg.Embed)
+}
+
+// Load parses the templates, from fsys when Embed is set and from disk otherwise, with funcs restricted to
+// the Funcs allowlist.  The returned set caches the parsed templates unless Reload is set.
+//
+//	//go:embed templates
+//	var templateFS embed.FS
+//	ts, err := gc.HTTP.Templates.Load(templateFS, template.FuncMap{"formatDate": formatDate})
+//	tmpl, err := ts.Get()
+func (cfg *HTTPTemplatesConfig) Load(fsys fs.FS, funcs template.FuncMap) (*TemplateSet, error) {
+	var (
+		ts      *TemplateSet
+		allowed template.FuncMap
+		err     error
+		i       int
+		ok      bool
+	)
+
+	if len(cfg.Path) == 0 {
+		return nil, fmt.Errorf("templates path is not configured")
+	}
+	if cfg.Embed && fsys == nil {
+		return nil, fmt.Errorf("templates embed is set, but no fs.FS was given")
+	}
+	allowed = funcs
+	if len(cfg.Funcs) > 0 {
+		allowed = make(template.FuncMap)
+		for i = 0; i < len(cfg.Funcs); i++ {
+			allowed[cfg.Funcs[i]], ok = funcs[cfg.Funcs[i]]
+			if !ok {
+				return nil, fmt.Errorf("templates func %q is allowed but not provided", cfg.Funcs[i])
+			}
+		}
+	}
+
+	ts = &TemplateSet{cfg: *cfg, funcs: allowed}
+	if cfg.Embed {
+		ts.fsys = fsys
+	}
+	ts.tmpl, err = ts.parse()
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// TemplateSet holds the templates parsed by HTTPTemplatesConfig.Load.
+type TemplateSet struct {
+	cfg   HTTPTemplatesConfig
+	fsys  fs.FS
+	funcs template.FuncMap
+	mu    sync.Mutex
+	tmpl  *template.Template
+}
+
+// Get returns the parsed templates, parsing them again first when Reload is set.  A failed re-parse returns
+// the error and keeps the last good set for the next call.
+func (ts *TemplateSet) Get() (*template.Template, error) {
+	var (
+		tmpl *template.Template
+		err  error
+	)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.cfg.Reload {
+		tmpl, err = ts.parse()
+		if err != nil {
+			return nil, err
+		}
+		ts.tmpl = tmpl
+	}
+	return ts.tmpl, nil
+}
+
+func (ts *TemplateSet) parse() (*template.Template, error) {
+	var (
+		tmpl *template.Template
+		err  error
+	)
+
+	tmpl = template.New("").Funcs(ts.funcs)
+	if len(ts.cfg.LeftDelim) > 0 {
+		tmpl = tmpl.Delims(ts.cfg.LeftDelim, ts.cfg.RightDelim)
+	}
+	if ts.fsys != nil {
+		tmpl, err = tmpl.ParseFS(ts.fsys, ts.cfg.Glob())
+	} else {
+		tmpl, err = tmpl.ParseGlob(ts.cfg.Glob())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse templates: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateGlob turns a template directory into a glob of the files in it.
+func templateGlob(p string, embedded bool) string {
+	var (
+		info os.FileInfo
+		err  error
+	)
+
+	if embedded || strings.ContainsAny(p, "*?[") {
+		return p
+	}
+	info, err = os.Stat(p)
+	if err == nil && info.IsDir() {
+		return filepath.Join(p, "*")
+	}
+	return p
+}
+
+// checkTemplateGlob checks that a template directory or glob on disk matches at least one regular file.
+func checkTemplateGlob(p string) error {
+	var (
+		matches []string
+		info    os.FileInfo
+		err     error
+		i       int
+	)
+
+	matches, err = filepath.Glob(templateGlob(p, false))
+	if err != nil {
+		return fmt.Errorf("invalid templates path %q: %w", p, err)
+	}
+	for i = 0; i < len(matches); i++ {
+		info, err = os.Stat(matches[i])
+		if err == nil && info.Mode().IsRegular() {
+			return nil
+		}
+	}
+	return fmt.Errorf("templates path %q does not match any files", p)
+}
+
+func isTemplateIdentifier(name string) bool {
+	var i int
+
+	if len(name) == 0 {
+		return false
+	}
+	for i = 0; i < len(name); i++ {
+		switch {
+		case name[i] == '_', name[i] >= 'a' && name[i] <= 'z', name[i] >= 'A' && name[i] <= 'Z':
+		case name[i] >= '0' && name[i] <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package serverconfig
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TwoFactorConfig holds the TOTP (RFC 6238) parameters for two-factor authentication.  Issuer is shown in
+// authenticator apps and defaults to the App section's name.  Digits is 6 (the default) or 8, Period is the
+// code lifetime, defaulting to 30s, and Skew is the number of periods either side of the current one whose
+// codes are still accepted, defaulting to 1; with 0 only the current code is accepted.  Algorithm is SHA1
+// (the default and the only one most apps support), SHA256, or SHA512.  EncryptionKeyEnv names an environment variable holding the 32 byte key,
+// as hex or base64, used by Seal and Open to encrypt users' TOTP secrets at rest.
+//
+//	twofactor:
+//	  issuer: Acme
+//	  digits: 6
+//	  period: 30s
+//	  skew: 1
+//	  encryptionkeyenv: TOTP_KEY
+type TwoFactorConfig struct {
+	Issuer           string        `yaml:"issuer"`
+	Digits           int           `yaml:"digits"`
+	Period           time.Duration `yaml:"period"`
+	Skew             *int          `yaml:"skew"`
+	Algorithm        string        `yaml:"algorithm"`
+	EncryptionKeyEnv string        `yaml:"encryptionkeyenv"`
+	aead             cipher.AEAD
+}
+
+// Verify applies the defaults, checks the parameters, and reads the encryption key.  The Issuer default is
+// applied by PostVerify.
+func (cfg *TwoFactorConfig) Verify() error {
+	var (
+		envValue string
+		found    bool
+		key      []byte
+		block    cipher.Block
+		skew     int
+		err      error
+	)
+
+	if strings.Contains(cfg.Issuer, ":") {
+		return fmt.Errorf("twofactor issuer %q cannot contain ':'", cfg.Issuer)
+	}
+	if cfg.Digits == 0 {
+		cfg.Digits = 6
+	}
+	if cfg.Digits != 6 && cfg.Digits != 8 {
+		return fmt.Errorf("twofactor digits must be 6 or 8, got %d", cfg.Digits)
+	}
+	if cfg.Period == 0 {
+		cfg.Period = 30 * time.Second
+	}
+	if cfg.Period < 15*time.Second || cfg.Period > 5*time.Minute || cfg.Period%time.Second != 0 {
+		return fmt.Errorf("twofactor period must be whole seconds between 15s and 5m, got %s", cfg.Period)
+	}
+	if cfg.Skew == nil {
+		skew = 1
+		cfg.Skew = &skew
+	}
+	if *cfg.Skew < 0 || *cfg.Skew > 5 {
+		return fmt.Errorf("twofactor skew must be between 0 and 5, got %d", *cfg.Skew)
+	}
+	cfg.Algorithm = strings.ToUpper(strings.ReplaceAll(cfg.Algorithm, "-", ""))
+	switch cfg.Algorithm {
+	case "":
+		cfg.Algorithm = "SHA1"
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		return fmt.Errorf("invalid twofactor algorithm %q (expected SHA1, SHA256, or SHA512)", cfg.Algorithm)
+	}
+	cfg.aead = nil
+	if len(cfg.EncryptionKeyEnv) > 0 {
+		envValue, found = os.LookupEnv(cfg.EncryptionKeyEnv)
+		if !found || len(envValue) == 0 {
+			return fmt.Errorf("missing twofactor encryption key (environment variable %s is not set)", cfg.EncryptionKeyEnv)
+		}
+		key = decodeSecretKey(envValue, 32)
+		if len(key) != 32 {
+			return fmt.Errorf("twofactor encryption key in %s must be 32 bytes, got %d", cfg.EncryptionKeyEnv, len(key))
+		}
+		block, err = aes.NewCipher(key)
+		if err == nil {
+			cfg.aead, err = cipher.NewGCM(block)
+		}
+		if err != nil {
+			return fmt.Errorf("twofactor encryption key: %w", err)
+		}
+	}
+	return nil
+}
+
+// PostVerify defaults Issuer to the name of root's App section.
+func (cfg *TwoFactorConfig) PostVerify(root any) error {
+	if len(cfg.Issuer) == 0 {
+		cfg.Issuer = rootApp(root).Name
+	}
+	if len(cfg.Issuer) == 0 {
+		return fmt.Errorf("missing twofactor issuer")
+	}
+	return nil
+}
+
+// GenerateSecret returns a new random TOTP secret of the length recommended for Algorithm.
+func (cfg TwoFactorConfig) GenerateSecret() ([]byte, error) {
+	var (
+		secret []byte
+		err    error
+	)
+
+	secret = make([]byte, cfg.newHash()().Size())
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// KeyURI returns the otpauth URI, usually shown as a QR code, that enrolls secret for account in an
+// authenticator app.
+func (cfg TwoFactorConfig) KeyURI(account string, secret []byte) string {
+	var (
+		u url.URL
+		q url.Values
+	)
+
+	q = url.Values{}
+	q.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret))
+	q.Set("issuer", cfg.Issuer)
+	q.Set("algorithm", cfg.Algorithm)
+	q.Set("digits", strconv.Itoa(cfg.Digits))
+	q.Set("period", strconv.Itoa(int(cfg.Period/time.Second)))
+	u = url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + cfg.Issuer + ":" + account, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Code returns the code for secret at t.
+func (cfg TwoFactorConfig) Code(secret []byte, t time.Time) string {
+	return cfg.code(secret, uint64(t.Unix())/uint64(cfg.Period/time.Second))
+}
+
+// Validate reports whether code is valid for secret at t, allowing for Skew.
+func (cfg TwoFactorConfig) Validate(secret []byte, code string, t time.Time) bool {
+	var (
+		counter uint64
+		skew    int
+		valid   bool
+		i       int
+	)
+
+	if len(code) != cfg.Digits {
+		return false
+	}
+	if cfg.Skew != nil {
+		skew = *cfg.Skew
+	}
+	counter = uint64(t.Unix()) / uint64(cfg.Period/time.Second)
+	for i = -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(cfg.code(secret, counter+uint64(i))), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// Seal encrypts secret for storage.  It fails when EncryptionKeyEnv is not set.
+func (cfg TwoFactorConfig) Seal(secret []byte) ([]byte, error) {
+	var (
+		nonce []byte
+		err   error
+	)
+
+	if cfg.aead == nil {
+		return nil, fmt.Errorf("twofactor encryptionkeyenv is not set")
+	}
+	nonce = make([]byte, cfg.aead.NonceSize(), cfg.aead.NonceSize()+len(secret)+cfg.aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.aead.Seal(nonce, nonce, secret, nil), nil
+}
+
+// Open decrypts a secret encrypted by Seal.
+func (cfg TwoFactorConfig) Open(sealed []byte) ([]byte, error) {
+	if cfg.aead == nil {
+		return nil, fmt.Errorf("twofactor encryptionkeyenv is not set")
+	}
+	if len(sealed) < cfg.aead.NonceSize() {
+		return nil, fmt.Errorf("sealed twofactor secret is too short")
+	}
+	return cfg.aead.Open(nil, sealed[:cfg.aead.NonceSize()], sealed[cfg.aead.NonceSize():], nil)
+}
+
+// code computes the HOTP value (RFC 4226) of secret for counter.
+func (cfg TwoFactorConfig) code(secret []byte, counter uint64) string {
+	var (
+		mac    hash.Hash
+		sum    []byte
+		offset int
+		value  uint32
+		mod    uint32
+		i      int
+	)
+
+	mac = hmac.New(cfg.newHash(), secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum = mac.Sum(nil)
+	offset = int(sum[len(sum)-1] & 0x0f)
+	value = binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod = 1
+	for i = 0; i < cfg.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", cfg.Digits, value%mod)
+}
+
+func (cfg TwoFactorConfig) newHash() func() hash.Hash {
+	switch cfg.Algorithm {
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
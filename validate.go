@@ -0,0 +1,141 @@
+package serverconfig
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// validateURL checks that raw is an absolute URL with a host and, if any schemes are given, that its scheme
+// is one of them.  The parsed URL is returned for further inspection.
+func validateURL(raw string, schemes ...string) (*url.URL, error) {
+	var (
+		u   *url.URL
+		err error
+		i   int
+	)
+
+	u, err = url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return nil, fmt.Errorf("%q is not an absolute URL", raw)
+	}
+	if len(schemes) == 0 {
+		return u, nil
+	}
+	for i = 0; i < len(schemes); i++ {
+		if strings.EqualFold(u.Scheme, schemes[i]) {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("%q has unsupported scheme %q (expected %s)", raw, u.Scheme, strings.Join(schemes, ", "))
+}
+
+// validateHostPort checks that addr is of the form host:port with a numeric port.
+func validateHostPort(addr string) error {
+	var (
+		port string
+		err  error
+		i    int
+	)
+
+	_, port, err = net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if len(port) == 0 {
+		return fmt.Errorf("missing port in address %q", addr)
+	}
+	for i = 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return fmt.Errorf("invalid port %q in address %q", port, addr)
+		}
+	}
+	return nil
+}
+
+// validateHostname checks that name is a syntactically valid RFC 1123 host name.  A trailing dot is
+// allowed.  Wildcards are rejected.
+func validateHostname(name string) error {
+	var (
+		labels []string
+		label  string
+		i, j   int
+		c      byte
+	)
+
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return fmt.Errorf("invalid host name %q: length must be 1 to 253 characters", name)
+	}
+	labels = strings.Split(name, ".")
+	for i = 0; i < len(labels); i++ {
+		label = labels[i]
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("invalid host name %q: each label must be 1 to 63 characters", name)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid host name %q: labels cannot begin or end with a hyphen", name)
+		}
+		for j = 0; j < len(label); j++ {
+			c = label[j]
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+				return fmt.Errorf("invalid host name %q: invalid character %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeSecretKey returns the bytes of a secret key given as hex or as standard or URL-safe base64.  The
+// first decoding whose length is one of sizes is used, and if none fits the raw string itself is returned.
+func decodeSecretKey(s string, sizes ...int) []byte {
+	var (
+		b   []byte
+		err error
+		i   int
+	)
+
+	s = strings.TrimSpace(s)
+	for i = 0; i < 3; i++ {
+		switch i {
+		case 0:
+			b, err = hex.DecodeString(s)
+		case 1:
+			b, err = base64.StdEncoding.DecodeString(s)
+		case 2:
+			b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		}
+		if err == nil && (len(sizes) == 0 || containsInt(sizes, len(b))) {
+			return b
+		}
+	}
+	return []byte(s)
+}
+
+func containsInt(list []int, n int) bool {
+	var i int
+
+	for i = 0; i < len(list); i++ {
+		if list[i] == n {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	var i int
+
+	for i = 0; i < len(list); i++ {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package serverconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// HTTPVirtualHost is one site served by a multi-tenant server alongside the ExternalHostName site.  Each
+// virtual host has its own host names and template directory or glob, checked like Templates.Path, and
+// either its own static certificate or, without one, a certificate for its names from the top-level ACME
+// settings, which need a dns section for wildcard names.  Host names may not overlap those of another virtual
+// host or ExternalHostName; a wildcard overlaps every name it covers.
+//
+//	http:
+//	  virtualhosts:
+//	    - name: tenant-a
+//	      hostnames: [a.example.com, www.a.example.com]
+//	      templatepath: ./templates/a
+//	    - name: tenant-b
+//	      hostnames: ["*.b.example.net"]
+//	      static_cert:
+//	        certfile: /etc/ssl/b.pem
+//	        privatekeyfile: /etc/ssl/b.key
+type HTTPVirtualHost struct {
+	Name         string                `yaml:"name"`
+	HostNames    []string              `yaml:"hostnames"`
+	TemplatePath string                `yaml:"templatepath"`
+	StaticCert   *HTTPStaticCertConfig `yaml:"static_cert"`
+}
+
+// verifyVirtualHosts checks every virtual host and the host names across all of them.  Virtual hosts
+// without a static certificate are returned so the caller can add them to the ACME host policy.
+func (cfg *HTTPConfig) verifyVirtualHosts() ([]string, error) {
+	var (
+		vh    *HTTPVirtualHost
+		owner map[string]string
+		names []string
+		acme  []string
+		label string
+		name  string
+		other string
+		errs  []error
+		err   error
+		i, j  int
+	)
+
+	owner = make(map[string]string)
+	for i = 0; i < len(cfg.ExternalHostName); i++ {
+		owner[strings.ToLower(strings.TrimSuffix(cfg.ExternalHostName[i], "."))] = "externalhostname"
+	}
+	for i = 0; i < len(cfg.VirtualHosts); i++ {
+		vh = &cfg.VirtualHosts[i]
+		label = fmt.Sprintf("virtualhost %d", i+1)
+		if len(vh.Name) > 0 {
+			label = fmt.Sprintf("virtualhost %q", vh.Name)
+		}
+		if len(vh.HostNames) == 0 {
+			errs = append(errs, fmt.Errorf("%s has no hostnames", label))
+			continue
+		}
+		if len(vh.TemplatePath) > 0 {
+			err = checkTemplateGlob(vh.TemplatePath)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", label, err))
+			}
+		}
+		for j = 0; j < len(vh.HostNames); j++ {
+			name = strings.ToLower(strings.TrimSuffix(vh.HostNames[j], "."))
+			err = validateHostname(strings.TrimPrefix(name, "*."))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid hostname: %w", label, err))
+				continue
+			}
+			if strings.HasPrefix(name, "*.") && vh.StaticCert == nil && cfg.ACME.DNS == nil {
+				errs = append(errs, fmt.Errorf("%s: wildcard hostname %q requires a static_cert or the ACME dns-01 challenge (http.acme.dns)", label, vh.HostNames[j]))
+			}
+			for other = range owner {
+				if hostNameMatches(other, name) || hostNameMatches(name, other) {
+					errs = append(errs, fmt.Errorf("%s: hostname %q overlaps %q of %s", label, vh.HostNames[j], other, owner[other]))
+				}
+			}
+			names = append(names, name)
+		}
+		for j = 0; j < len(names); j++ {
+			owner[names[j]] = label
+		}
+		if vh.StaticCert == nil {
+			acme = append(acme, names...)
+		} else {
+			vh.StaticCert.hosts = names
+			err = vh.StaticCert.Verify()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", label, err))
+			}
+			if len(vh.StaticCert.SSLCertFile) == 0 && len(vh.StaticCert.SSLPrivateKeyFile) == 0 {
+				errs = append(errs, fmt.Errorf("%s: static_cert requires both certfile and privatekeyfile", label))
+			}
+		}
+		names = nil
+	}
+	return acme, errors.Join(errs...)
+}
+
+// usesACME reports whether any certificate comes from ACME: the default site's when it has no static
+// certificate, or a virtual host's.
+func (cfg *HTTPConfig) usesACME() bool {
+	var i int
+
+	if !cfg.hasStaticCert() {
+		return true
+	}
+	for i = 0; i < len(cfg.VirtualHosts); i++ {
+		if cfg.VirtualHosts[i].StaticCert == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualHost returns the virtual host serving the request's host name, or nil for the default site.
+//
+//	vh := gc.HTTP.VirtualHost(r)
+//	if vh != nil {
+//		tmpl = tenantTemplates[vh.Name]
+//	}
+func (cfg *HTTPConfig) VirtualHost(r *http.Request) *HTTPVirtualHost {
+	var (
+		host string
+		err  error
+	)
+
+	host, _, err = net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return cfg.virtualHostFor(host)
+}
+
+func (cfg *HTTPConfig) virtualHostFor(host string) *HTTPVirtualHost {
+	var i, j int
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for i = 0; i < len(cfg.VirtualHosts); i++ {
+		for j = 0; j < len(cfg.VirtualHosts[i].HostNames); j++ {
+			if hostNameMatches(strings.ToLower(strings.TrimSuffix(cfg.VirtualHosts[i].HostNames[j], ".")), host) {
+				return &cfg.VirtualHosts[i]
+			}
+		}
+	}
+	return nil
+}
+
+// virtualHostCertificates wraps getCertificate so that connections for a virtual host with a static
+// certificate are answered with it.  Any other name falls through to getCertificate, or to the
+// certificates in the tls.Config when getCertificate is nil.  Certificates with a ReloadInterval are watched
+// until ctx is cancelled.
+func (cfg *HTTPConfig) virtualHostCertificates(ctx context.Context, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	var (
+		reloaders map[*HTTPVirtualHost]*CertReloader
+		reloader  *CertReloader
+		vh        *HTTPVirtualHost
+		err       error
+		i         int
+	)
+
+	reloaders = make(map[*HTTPVirtualHost]*CertReloader)
+	for i = 0; i < len(cfg.VirtualHosts); i++ {
+		vh = &cfg.VirtualHosts[i]
+		if vh.StaticCert == nil {
+			continue
+		}
+		reloader, err = vh.StaticCert.Reloader()
+		if err != nil {
+			return nil, fmt.Errorf("virtualhost %q: %w", vh.Name, err)
+		}
+		if vh.StaticCert.ReloadInterval > 0 {
+			go reloader.Watch(ctx, vh.StaticCert.ReloadInterval)
+		}
+		reloaders[vh] = reloader
+	}
+	if len(reloaders) == 0 {
+		return getCertificate, nil
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		var r *CertReloader
+
+		r = reloaders[cfg.virtualHostFor(hello.ServerName)]
+		if r != nil {
+			return r.GetCertificate(hello)
+		}
+		if getCertificate != nil {
+			return getCertificate(hello)
+		}
+		return nil, nil
+	}, nil
+}
+
+// acmeVirtualHostCertificates serves ACME certificates for virtual hosts while the default site keeps its
+// static certificate through getCertificate, or tls.Config.Certificates when that is nil.
+func (cfg *HTTPConfig) acmeVirtualHostCertificates(manager *autocert.Manager, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cfg.virtualHostFor(hello.ServerName) != nil {
+			return manager.GetCertificate(hello)
+		}
+		if getCertificate != nil {
+			return getCertificate(hello)
+		}
+		return nil, nil
+	}
+}
+
+// hostNameMatches reports whether pattern, a lower-case host name that may start with "*.", covers host.
+// A wildcard covers exactly one additional label, as in certificates.
+func hostNameMatches(pattern, host string) bool {
+	var i int
+
+	if pattern == host {
+		return true
+	}
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+	i = strings.IndexByte(host, '.')
+	return i > 0 && host[:i] != "*" && host[i:] == pattern[1:]
+}
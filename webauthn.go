@@ -0,0 +1,120 @@
+package serverconfig
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// WebAuthnConfig holds the relying party settings for WebAuthn and passkeys.  RPID is the domain that
+// credentials are bound to and must be one of the ExternalHostName entries or a parent domain of one,
+// though not a public suffix such as co.uk; it defaults to the first ExternalHostName.  Browsers refuse to
+// register a credential when the page's host is not within RPID, so the mismatch is reported here instead.
+// Origins lists the origins that ceremonies may come from, defaulting to https on each ExternalHostName
+// within RPID.  RPDisplayName defaults to RPID.
+//
+//	http:
+//	  externalhostname: [www.acme.com, login.acme.com]
+//	  webauthn:
+//	    rpid: acme.com
+//	    rpdisplayname: Acme
+type WebAuthnConfig struct {
+	RPID          string   `yaml:"rpid"`
+	RPDisplayName string   `yaml:"rpdisplayname"`
+	Origins       []string `yaml:"origins"`
+	hosts         []string // ExternalHostName of the enclosing HTTPConfig
+}
+
+// Verify defaults RPID, RPDisplayName, and Origins, and checks that each origin is within RPID.  Within an
+// HTTPConfig, RPID is also checked against ExternalHostName.
+func (cfg *WebAuthnConfig) Verify() error {
+	var (
+		u     *url.URL
+		host  string
+		found bool
+		err   error
+		i     int
+	)
+
+	cfg.RPID = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(cfg.RPID), "."))
+	if len(cfg.RPID) == 0 {
+		for i = 0; i < len(cfg.hosts) && len(cfg.RPID) == 0; i++ {
+			if !strings.HasPrefix(cfg.hosts[i], "*.") {
+				cfg.RPID = strings.ToLower(strings.TrimSuffix(cfg.hosts[i], "."))
+			}
+		}
+		if len(cfg.RPID) == 0 {
+			return fmt.Errorf("missing webauthn rpid")
+		}
+	}
+	if strings.ContainsAny(cfg.RPID, ":/") {
+		return fmt.Errorf("webauthn rpid %q should be a domain, not a URL or host:port", cfg.RPID)
+	}
+	err = validateHostname(cfg.RPID)
+	if err != nil {
+		return fmt.Errorf("invalid webauthn rpid: %w", err)
+	}
+	if cfg.RPID != "localhost" {
+		_, err = publicsuffix.EffectiveTLDPlusOne(cfg.RPID)
+		if err != nil {
+			return fmt.Errorf("webauthn rpid %q is a public suffix", cfg.RPID)
+		}
+	}
+	if len(cfg.RPDisplayName) == 0 {
+		cfg.RPDisplayName = cfg.RPID
+	}
+
+	if len(cfg.hosts) > 0 {
+		for i = 0; i < len(cfg.hosts); i++ {
+			host = strings.ToLower(strings.TrimSuffix(cfg.hosts[i], "."))
+			if webAuthnWithin(strings.TrimPrefix(host, "*."), cfg.RPID) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("webauthn rpid %q does not match any externalhostname (%s)", cfg.RPID, strings.Join(cfg.hosts, ", "))
+		}
+		if len(cfg.Origins) == 0 {
+			for i = 0; i < len(cfg.hosts); i++ {
+				host = strings.ToLower(strings.TrimSuffix(cfg.hosts[i], "."))
+				if !strings.HasPrefix(host, "*.") && webAuthnWithin(host, cfg.RPID) {
+					cfg.Origins = append(cfg.Origins, "https://"+host)
+				}
+			}
+		}
+	}
+	if len(cfg.Origins) == 0 {
+		return fmt.Errorf("missing webauthn origins")
+	}
+
+	for i = 0; i < len(cfg.Origins); i++ {
+		cfg.Origins[i] = strings.TrimSuffix(strings.TrimSpace(cfg.Origins[i]), "/")
+		u, err = validateURL(cfg.Origins[i], "http", "https")
+		if err != nil {
+			return fmt.Errorf("invalid webauthn origins entry: %w", err)
+		}
+		if len(u.Path) > 0 || len(u.RawQuery) > 0 {
+			return fmt.Errorf("webauthn origins entry %q should be an origin without a path", cfg.Origins[i])
+		}
+		host = strings.ToLower(u.Hostname())
+		if u.Scheme == "http" && host != "localhost" {
+			return fmt.Errorf("webauthn origins entry %q must use https", cfg.Origins[i])
+		}
+		if !webAuthnWithin(host, cfg.RPID) {
+			return fmt.Errorf("webauthn origins entry %q is not within rpid %q", cfg.Origins[i], cfg.RPID)
+		}
+	}
+	return nil
+}
+
+// AllowedOrigin reports whether origin, as sent in the client data, is one of Origins.
+func (cfg WebAuthnConfig) AllowedOrigin(origin string) bool {
+	return containsString(cfg.Origins, strings.TrimSuffix(origin, "/"))
+}
+
+// webAuthnWithin reports whether host is rpID or a subdomain of it.
+func webAuthnWithin(host, rpID string) bool {
+	return host == rpID || strings.HasSuffix(host, "."+rpID)
+}
@@ -0,0 +1,95 @@
+package serverconfig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// WebhookConfig describes an outbound webhook endpoint which events are posted to.  When Signing is
+// enabled each request carries an HMAC-SHA256 signature of the timestamp and body, computed by Sign and
+// sent in SignatureHeader (default X-Webhook-Signature).
+//
+//	webhook:
+//	  url: https://customer.example.com/hooks/acme
+//	  signing: true
+//	  headers:
+//	    X-Source: acme
+//	  retry:
+//	    maxattempts: 5
+//	  timeout: 10s
+type WebhookConfig struct {
+	URL             string            `yaml:"url"`
+	Signing         bool              `yaml:"signing"`
+	SigningSecret   string            `yaml:"signingsecret" env:"WEBHOOKSECRET"`
+	SignatureHeader string            `yaml:"signatureheader"`
+	Headers         map[string]string `yaml:"headers"`
+	Retry           RetryConfig       `yaml:"retry"`
+	Timeout         time.Duration     `yaml:"timeout"`
+}
+
+// Verify checks the URL and that a secret is present when signing is enabled.  Timeout defaults to 10
+// seconds.  Plain http URLs are allowed but produce a warning.
+func (cfg *WebhookConfig) Verify() error {
+	var (
+		u   *url.URL
+		err error
+		k   string
+	)
+
+	if len(cfg.URL) == 0 {
+		return fmt.Errorf("missing webhook url")
+	}
+	u, err = validateURL(cfg.URL, "http", "https")
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if u.Scheme == "http" {
+		warnf("webhook url %s is not using https", u.Redacted())
+	}
+
+	if cfg.Signing {
+		if len(cfg.SigningSecret) == 0 {
+			return fmt.Errorf("webhook signing is enabled but signingsecret is missing (or WEBHOOKSECRET environment variable)")
+		}
+		if len(cfg.SigningSecret) < 16 {
+			return fmt.Errorf("webhook signingsecret must be at least 16 characters")
+		}
+	}
+	if len(cfg.SignatureHeader) == 0 {
+		cfg.SignatureHeader = "X-Webhook-Signature"
+	}
+	for k = range cfg.Headers {
+		if len(k) == 0 || http.CanonicalHeaderKey(k) == "Content-Length" {
+			return fmt.Errorf("invalid webhook header %q", k)
+		}
+	}
+
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("webhook timeout cannot be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a request body sent at the given time, in the form
+// "t=<unix seconds>,v1=<hex hmac-sha256>" where the MAC covers "<unix seconds>.<body>".
+func (cfg *WebhookConfig) Sign(body []byte, at time.Time) string {
+	var (
+		ts  string
+		mac = hmac.New(sha256.New, []byte(cfg.SigningSecret))
+	)
+
+	ts = strconv.FormatInt(at.Unix(), 10)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}